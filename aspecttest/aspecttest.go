@@ -0,0 +1,321 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package aspecttest runs golden-file tests for aspect configurations. A test
+// case is any directory containing an [InputFile], which is instrumented using
+// all aspects declared in `*.yml` files found in the case directory and its
+// ancestors (up to the fixtures root directory). The result is compared to the
+// [ExpectedFile] found in the same directory.
+//
+// Integration authors can run these tests as part of `go test` using [Test],
+// or with the `orchestrion test-aspects` command.
+package aspecttest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	toolexecaspect "github.com/DataDog/orchestrion/internal/toolexec/aspect"
+	"github.com/DataDog/orchestrion/internal/yaml"
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/tools/go/packages"
+)
+
+const (
+	// InputFile is the name of the source file to be instrumented in a test case.
+	InputFile = "input.go"
+	// ExpectedFile is the name of the golden file containing the expected
+	// instrumented source in a test case.
+	ExpectedFile = "expected.go"
+
+	// defaultImportPathPrefix is used to derive the import path of test cases
+	// whose input file does not have an import comment.
+	defaultImportPathPrefix = "aspecttest"
+)
+
+// Case is a single golden-file test case.
+type Case struct {
+	// Name is the path of the case directory, relative to the fixtures root.
+	Name string
+	// Dir is the absolute path to the case directory.
+	Dir string
+	// ConfigFiles are the YAML files declaring the aspects used by this case, from
+	// the outermost to the innermost directory.
+	ConfigFiles []string
+}
+
+// Result is the outcome of running a [Case].
+type Result struct {
+	Case
+	// Actual is the normalized instrumented source.
+	Actual []byte
+	// Diff is a unified diff between the expected and actual sources, and is
+	// empty if they are identical.
+	Diff string
+	// Updated is true if the [ExpectedFile] was (re-)written.
+	Updated bool
+}
+
+// Passed returns true if the actual source matched the expected one, or if the
+// expected file was updated.
+func (r Result) Passed() bool {
+	return r.Diff == "" || r.Updated
+}
+
+// Options control how cases are run.
+type Options struct {
+	// Update causes the [ExpectedFile] of cases to be (re-)written with the actual
+	// result instead of being compared with it.
+	Update bool
+}
+
+// Discover finds all test cases under the provided root directory. Directories
+// named `testdata` are traversed, but other directories starting with `.` or
+// `_` are skipped, consistent with the go toolchain.
+func Discover(root string) ([]Case, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []Case
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "_")) {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, InputFile)); errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		configs, err := configFiles(root, path)
+		if err != nil {
+			return err
+		}
+		cases = append(cases, Case{Name: filepath.ToSlash(name), Dir: path, ConfigFiles: configs})
+		return nil
+	})
+	return cases, err
+}
+
+// configFiles lists all `*.yml` files in dir and its ancestors up to root.
+func configFiles(root string, dir string) ([]string, error) {
+	var dirs []string
+	for d := dir; ; d = filepath.Dir(d) {
+		dirs = append(dirs, d)
+		if d == root || d == filepath.Dir(d) {
+			break
+		}
+	}
+	slices.Reverse(dirs)
+
+	var res []string
+	for _, d := range dirs {
+		matches, err := filepath.Glob(filepath.Join(d, "*.yml"))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, matches...)
+	}
+	return res, nil
+}
+
+// Run instruments the input file of the provided case and compares the result
+// with the case's expected file, or updates the expected file if requested.
+func Run(ctx context.Context, c Case, opts Options) (Result, error) {
+	res := Result{Case: c}
+
+	aspects, err := loadAspects(ctx, c.ConfigFiles)
+	if err != nil {
+		return res, err
+	}
+
+	inputFile := filepath.Join(c.Dir, InputFile)
+	input, err := os.ReadFile(inputFile)
+	if err != nil {
+		return res, err
+	}
+
+	importPath, imports, err := inputMetadata(inputFile, input)
+	if err != nil {
+		return res, err
+	}
+	if importPath == "" {
+		importPath = defaultImportPathPrefix + "/" + c.Name
+	}
+
+	exports, err := exportFiles(ctx, c.Dir, imports)
+	if err != nil {
+		return res, err
+	}
+	importMap := make(map[string]string, len(imports))
+	for _, path := range imports {
+		importMap[path] = exports[path]
+	}
+
+	tmp, err := os.MkdirTemp("", "orchestrion-aspecttest-*")
+	if err != nil {
+		return res, err
+	}
+	defer os.RemoveAll(tmp)
+
+	inj, aspects := toolexecaspect.NewInjector(ctx, importPath, toolexecaspect.ExportLookup(exports), aspects)
+	if inj == nil {
+		return res, fmt.Errorf("aspects are never woven into %q", importPath)
+	}
+	inj.ImportMap = importMap
+	inj.ModifiedFile = func(path string) string { return filepath.Join(tmp, filepath.Base(path)) }
+	results, _, err := inj.InjectFiles(ctx, []string{inputFile}, aspects)
+	if err != nil {
+		return res, err
+	}
+
+	res.Actual = input
+	if modified, found := results[inputFile]; found {
+		if res.Actual, err = os.ReadFile(modified.Filename); err != nil {
+			return res, err
+		}
+	}
+	res.Actual = normalize(res.Actual, inputFile)
+
+	expectedFile := filepath.Join(c.Dir, ExpectedFile)
+	expected, err := os.ReadFile(expectedFile)
+	if err != nil && !(opts.Update && errors.Is(err, fs.ErrNotExist)) {
+		return res, err
+	}
+
+	if res.Diff, err = unifiedDiff(expected, res.Actual); err != nil {
+		return res, err
+	}
+	if res.Diff != "" && opts.Update {
+		if err := os.WriteFile(expectedFile, res.Actual, 0o644); err != nil {
+			return res, err
+		}
+		res.Updated = true
+	}
+
+	return res, nil
+}
+
+// loadAspects decodes the aspects declared in the provided configuration files.
+// Contrary to regular configuration loading, `extends` are not followed.
+func loadAspects(ctx context.Context, files []string) ([]*aspect.Aspect, error) {
+	var aspects []*aspect.Aspect
+	for _, filename := range files {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		var cfg struct {
+			Aspects []*aspect.Aspect `yaml:"aspects"`
+		}
+		err = yaml.UnmarshalContext(ctx, file, &cfg)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding %q: %w", filename, err)
+		}
+		aspects = append(aspects, cfg.Aspects...)
+	}
+	return aspects, nil
+}
+
+// importCommentRe matches the package clause of a file carrying an import
+// comment, such as `package main // import "example.com/main"`.
+var importCommentRe = regexp.MustCompile(`(?m)^package\s+\w+\s*//\s*import\s+("[^"]+")`)
+
+// inputMetadata returns the import path declared by the input file's import
+// comment (if any), and the list of packages it imports.
+func inputMetadata(filename string, content []byte) (string, []string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), filename, content, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var importPath string
+	if match := importCommentRe.FindSubmatch(content); match != nil {
+		if importPath, err = strconv.Unquote(string(match[1])); err != nil {
+			return "", nil, fmt.Errorf("invalid import comment in %q: %w", filename, err)
+		}
+	}
+
+	imports := make([]string, 0, len(file.Imports))
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid import path %s in %q: %w", spec.Path.Value, filename, err)
+		}
+		imports = append(imports, path)
+	}
+	return importPath, imports, nil
+}
+
+// exportFiles resolves the export data files of the provided packages and all
+// their dependencies, from the module enclosing dir.
+func exportFiles(ctx context.Context, dir string, imports []string) (map[string]string, error) {
+	res := make(map[string]string)
+	if len(imports) == 0 {
+		return res, nil
+	}
+
+	pkgs, err := packages.Load(&packages.Config{
+		Context: ctx,
+		Dir:     dir,
+		Mode:    packages.NeedName | packages.NeedImports | packages.NeedDeps | packages.NeedExportFile,
+	}, imports...)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, e := range pkg.Errors {
+			errs = append(errs, e)
+		}
+		res[pkg.PkgPath] = pkg.ExportFile
+	})
+	return res, errors.Join(errs...)
+}
+
+// normalize removes the absolute path of the input file from `//line`
+// directives, so that golden files are independent of their location.
+func normalize(content []byte, inputFile string) []byte {
+	return bytes.ReplaceAll(content, []byte("//line "+inputFile+":"), []byte("//line "+InputFile+":"))
+}
+
+func unifiedDiff(expected []byte, actual []byte) (string, error) {
+	if bytes.Equal(expected, actual) {
+		return "", nil
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(expected)),
+		B:        difflib.SplitLines(string(actual)),
+		FromFile: ExpectedFile,
+		ToFile:   "actual",
+		Context:  3,
+	})
+}
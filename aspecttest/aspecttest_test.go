@@ -0,0 +1,70 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package aspecttest_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/orchestrion/aspecttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscover(t *testing.T) {
+	cases, err := aspecttest.Discover("testdata")
+	require.NoError(t, err)
+
+	root, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+
+	require.Len(t, cases, 2)
+	assert.Equal(t, "unmodified", cases[0].Name)
+	assert.Equal(t, "wrap-println", cases[1].Name)
+	assert.Equal(t, []string{filepath.Join(root, "aspects.yml")}, cases[1].ConfigFiles)
+}
+
+func TestGolden(t *testing.T) {
+	aspecttest.Test(t, "testdata", aspecttest.Options{})
+}
+
+func TestMismatch(t *testing.T) {
+	tmp := t.TempDir()
+	caseDir := filepath.Join(tmp, "case")
+	require.NoError(t, os.MkdirAll(caseDir, 0o755))
+
+	aspects, err := os.ReadFile(filepath.Join("testdata", "aspects.yml"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "aspects.yml"), aspects, 0o644))
+	input, err := os.ReadFile(filepath.Join("testdata", "wrap-println", aspecttest.InputFile))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(caseDir, aspecttest.InputFile), input, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(caseDir, aspecttest.ExpectedFile), input, 0o644))
+
+	// The test case directory is outside of any module, so imports must be
+	// resolved from the standard library only.
+	cases, err := aspecttest.Discover(tmp)
+	require.NoError(t, err)
+	require.Len(t, cases, 1)
+
+	res, err := aspecttest.Run(t.Context(), cases[0], aspecttest.Options{})
+	require.NoError(t, err)
+	assert.False(t, res.Passed())
+	assert.Contains(t, res.Diff, "+\t\t__orchestrion_log.Print(\"calling fmt.Println\")")
+
+	res, err = aspecttest.Run(t.Context(), cases[0], aspecttest.Options{Update: true})
+	require.NoError(t, err)
+	assert.True(t, res.Updated)
+	expected, err := os.ReadFile(filepath.Join(caseDir, aspecttest.ExpectedFile))
+	require.NoError(t, err)
+	assert.Equal(t, res.Actual, expected)
+
+	res, err = aspecttest.Run(t.Context(), cases[0], aspecttest.Options{})
+	require.NoError(t, err)
+	assert.True(t, res.Passed())
+	assert.False(t, res.Updated)
+}
@@ -0,0 +1,5 @@
+package unmodified // import "example.com/unmodified"
+
+func Answer() int {
+	return 42
+}
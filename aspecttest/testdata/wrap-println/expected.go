@@ -0,0 +1,19 @@
+//line input.go:1:1
+package main
+
+import (
+	"fmt"
+
+//line <generated>:1
+	__orchestrion_log "log"
+)
+
+//line input.go:5
+func main() {
+//line <generated>:1
+	func() (int, error) {
+		__orchestrion_log.Print("calling fmt.Println")
+		return fmt.//line input.go:6
+		Println("Hello, World!")
+	}()
+}
@@ -0,0 +1,37 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package aspecttest
+
+import (
+	"testing"
+)
+
+// Test discovers all cases under root and runs each of them as a sub-test of t.
+func Test(t *testing.T, root string, opts Options) {
+	t.Helper()
+
+	cases, err := Discover(root)
+	if err != nil {
+		t.Fatalf("discovering test cases in %q: %v", root, err)
+	}
+	if len(cases) == 0 {
+		t.Fatalf("no test cases found in %q", root)
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			res, err := Run(t.Context(), c, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Updated {
+				t.Logf("updated %s", ExpectedFile)
+			} else if !res.Passed() {
+				t.Errorf("instrumented source does not match %s:\n%s", ExpectedFile, res.Diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cacheprog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// EnvVarBackend is the environment variable used to configure the cache
+	// backend used by `orchestrion go` and `orchestrion cacheprog`. See [Open]
+	// for supported values.
+	EnvVarBackend = "ORCHESTRION_CACHE_BACKEND"
+	// EnvVarDir is the environment variable used to configure the local
+	// directory in which `orchestrion cacheprog` stores the files it presents to
+	// the go command.
+	EnvVarDir = "ORCHESTRION_CACHE_DIR"
+)
+
+// ErrNotFound is returned by [Backend.Get] when there is no entry for the
+// requested action ID.
+var ErrNotFound = errors.New("not found")
+
+type (
+	// Backend is a content-addressed cache storage.
+	Backend interface {
+		// Get returns the entry stored for the provided action ID, and a reader for
+		// its body. It returns [ErrNotFound] if there is no such entry. The caller
+		// must close the returned reader.
+		Get(ctx context.Context, actionID []byte) (Entry, io.ReadCloser, error)
+		// Put stores an entry with the provided body. The body must be exactly
+		// [Entry.Size] bytes long.
+		Put(ctx context.Context, entry Entry, body io.Reader) error
+		// Close releases any resource held by the backend.
+		Close() error
+	}
+
+	// Entry describes an object stored in a [Backend].
+	Entry struct {
+		ActionID []byte    `json:"actionID"`
+		OutputID []byte    `json:"outputID"`
+		Size     int64     `json:"size"`
+		Time     time.Time `json:"time"`
+	}
+)
+
+// Open returns the [Backend] described by spec, which is one of:
+//   - an absolute path or a `file://` URL, designating a local directory;
+//   - an `http://` or `https://` URL, designating a content-addressed HTTP
+//     service (see [NewHTTP]);
+//   - `prog:` followed by a command line, designating another `GOCACHEPROG`
+//     program to chain to.
+func Open(ctx context.Context, spec string) (Backend, error) {
+	if cmdline, ok := strings.CutPrefix(spec, "prog:"); ok {
+		return StartProg(ctx, cmdline)
+	}
+	if filepath.IsAbs(spec) {
+		return NewDir(spec)
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache backend %q: %w", spec, err)
+	}
+	switch u.Scheme {
+	case "file":
+		return NewDir(filepath.FromSlash(u.Path))
+	case "http", "https":
+		return NewHTTP(u, nil), nil
+	default:
+		return nil, fmt.Errorf("invalid cache backend %q: unsupported scheme %q", spec, u.Scheme)
+	}
+}
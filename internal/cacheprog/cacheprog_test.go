@@ -0,0 +1,253 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cacheprog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// envVarServeDir makes the test binary act as a `GOCACHEPROG` program storing
+// entries in the designated directory, so that [Prog] can be tested.
+const envVarServeDir = "ORCHESTRION_CACHEPROG_TEST_SERVE_DIR"
+
+func TestMain(m *testing.M) {
+	if dir := os.Getenv(envVarServeDir); dir != "" {
+		local, err := NewDir(dir)
+		if err == nil {
+			err = (&Server{Local: local}).Serve(context.Background(), os.Stdin, os.Stdout)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestServer(t *testing.T) {
+	remote := NewHTTP(mustParseURL(t, newStubServer(t).URL), nil)
+
+	body := []byte("Hello, world!")
+	actionID := sha256.Sum256([]byte("action"))
+	outputID := sha256.Sum256(body)
+
+	// A first server (e.g, on a CI shard) stores an entry...
+	first := newTestClient(t, &Server{Local: mustNewDir(t), Remote: remote})
+	res := first.roundTrip(Request{Command: CmdGet, ActionID: actionID[:]}, nil)
+	assert.True(t, res.Miss)
+
+	res = first.roundTrip(Request{Command: CmdPut, ActionID: actionID[:], OutputID: outputID[:], BodySize: int64(len(body))}, body)
+	require.Empty(t, res.Err)
+	assertFileContent(t, body, res.DiskPath)
+
+	res = first.roundTrip(Request{Command: CmdGet, ActionID: actionID[:]}, nil)
+	require.False(t, res.Miss)
+	assert.Equal(t, outputID[:], res.OutputID)
+	assert.Equal(t, int64(len(body)), res.Size)
+	assertFileContent(t, body, res.DiskPath)
+	first.close()
+
+	// A second server (e.g, on another CI shard) re-uses it through the remote...
+	second := newTestClient(t, &Server{Local: mustNewDir(t), Remote: remote})
+	res = second.roundTrip(Request{Command: CmdGet, ActionID: actionID[:]}, nil)
+	require.False(t, res.Miss)
+	assert.Equal(t, outputID[:], res.OutputID)
+	assertFileContent(t, body, res.DiskPath)
+
+	// Empty bodies are supported...
+	emptyActionID := sha256.Sum256([]byte("empty"))
+	emptyOutputID := sha256.Sum256(nil)
+	res = second.roundTrip(Request{Command: CmdPut, ActionID: emptyActionID[:], OutputID: emptyOutputID[:]}, nil)
+	require.Empty(t, res.Err)
+	assertFileContent(t, nil, res.DiskPath)
+	second.close()
+}
+
+func TestProg(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv(envVarServeDir, t.TempDir())
+
+	prog, err := StartProg(ctx, fmt.Sprintf("%q -test.run=^$", os.Args[0]))
+	require.NoError(t, err)
+
+	body := []byte("Hello, world!")
+	actionID := sha256.Sum256([]byte("action"))
+	outputID := sha256.Sum256(body)
+
+	_, _, err = prog.Get(ctx, actionID[:])
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, prog.Put(ctx, Entry{ActionID: actionID[:], OutputID: outputID[:], Size: int64(len(body))}, bytes.NewReader(body)))
+
+	entry, reader, err := prog.Get(ctx, actionID[:])
+	require.NoError(t, err)
+	defer reader.Close()
+	assert.Equal(t, outputID[:], entry.OutputID)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, body, content)
+
+	require.NoError(t, prog.Close())
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	backend, err := Open(ctx, dir)
+	require.NoError(t, err)
+	assert.IsType(t, &Dir{}, backend)
+
+	backend, err = Open(ctx, (&url.URL{Scheme: "file", Path: dir}).String())
+	require.NoError(t, err)
+	assert.IsType(t, &Dir{}, backend)
+
+	backend, err = Open(ctx, "https://cache.example.com/orchestrion")
+	require.NoError(t, err)
+	assert.IsType(t, &HTTP{}, backend)
+
+	_, err = Open(ctx, "ftp://cache.example.com")
+	require.ErrorContains(t, err, `unsupported scheme "ftp"`)
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	for cmdline, expected := range map[string][]string{
+		"":                          nil,
+		"prog":                      {"prog"},
+		"  prog -flag  arg ":        {"prog", "-flag", "arg"},
+		`"/path with/spaces" -flag`: {"/path with/spaces", "-flag"},
+		`prog 'single quoted' ""`:   {"prog", "single quoted", ""},
+	} {
+		t.Run(cmdline, func(t *testing.T) {
+			args, err := splitCommandLine(cmdline)
+			require.NoError(t, err)
+			assert.Equal(t, expected, args)
+		})
+	}
+
+	_, err := splitCommandLine(`prog "unterminated`)
+	require.ErrorContains(t, err, "unterminated")
+}
+
+// newStubServer starts an HTTP server implementing the protocol expected by
+// [HTTP] using in-memory storage.
+func newStubServer(t *testing.T) *httptest.Server {
+	var (
+		mu      sync.Mutex
+		objects = make(map[string][]byte)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/action/") && !strings.HasPrefix(r.URL.Path, "/output/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			data, found := objects[r.URL.Path]
+			if !found {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(data)
+		case http.MethodPut:
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			objects[r.URL.Path] = data
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testClient acts as the go command would, sending requests to a [Server] and
+// waiting for their responses.
+type testClient struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	out  *json.Decoder
+	done chan error
+	id   int64
+}
+
+func newTestClient(t *testing.T, srv *Server) *testClient {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &testClient{t: t, in: inW, out: json.NewDecoder(outR), done: make(chan error, 1)}
+	go func() {
+		err := srv.Serve(context.Background(), inR, outW)
+		_ = outW.CloseWithError(err)
+		c.done <- err
+	}()
+
+	var hello Response
+	require.NoError(t, c.out.Decode(&hello))
+	assert.Equal(t, []Cmd{CmdGet, CmdPut, CmdClose}, hello.KnownCommands)
+	return c
+}
+
+func (c *testClient) roundTrip(req Request, body []byte) Response {
+	c.id++
+	req.ID = c.id
+	enc := json.NewEncoder(c.in)
+	require.NoError(c.t, enc.Encode(req))
+	if len(body) > 0 {
+		require.NoError(c.t, enc.Encode(body))
+	}
+
+	var res Response
+	require.NoError(c.t, c.out.Decode(&res))
+	require.Equal(c.t, req.ID, res.ID)
+	return res
+}
+
+func (c *testClient) close() {
+	res := c.roundTrip(Request{Command: CmdClose}, nil)
+	require.Empty(c.t, res.Err)
+	require.NoError(c.t, <-c.done)
+}
+
+func mustNewDir(t *testing.T) *Dir {
+	dir, err := NewDir(t.TempDir())
+	require.NoError(t, err)
+	return dir
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	return u
+}
+
+func assertFileContent(t *testing.T, expected []byte, path string) {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(content))
+}
@@ -0,0 +1,117 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cacheprog
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Dir is a [Backend] storing entries in a local directory. Action entries are
+// stored as JSON documents under `a/`, and bodies are stored under `o/`, named
+// after their output ID. Files are written atomically, so a directory can be
+// shared by concurrent processes.
+type Dir struct {
+	root string
+}
+
+// NewDir returns a [Dir] backend rooted in the provided directory, creating it
+// if necessary.
+func NewDir(root string) (*Dir, error) {
+	for _, sub := range []string{"a", "o"} {
+		if err := os.MkdirAll(filepath.Join(root, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("creating cache directory: %w", err)
+		}
+	}
+	return &Dir{root: root}, nil
+}
+
+func (d *Dir) Get(_ context.Context, actionID []byte) (Entry, io.ReadCloser, error) {
+	entry, err := d.entry(actionID)
+	if err != nil {
+		return Entry{}, nil, err
+	}
+	body, err := os.Open(d.OutputPath(entry.OutputID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Entry{}, nil, ErrNotFound
+	}
+	if err != nil {
+		return Entry{}, nil, err
+	}
+	return entry, body, nil
+}
+
+func (d *Dir) Put(_ context.Context, entry Entry, body io.Reader) error {
+	if err := writeAtomic(d.OutputPath(entry.OutputID), func(w io.Writer) error {
+		n, err := io.Copy(w, body)
+		if err == nil && n != entry.Size {
+			err = fmt.Errorf("body is %d bytes long, expected %d", n, entry.Size)
+		}
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return writeAtomic(d.actionPath(entry.ActionID), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(entry)
+	})
+}
+
+func (*Dir) Close() error {
+	return nil
+}
+
+// OutputPath returns the path to the file containing the body of the entry with
+// the provided output ID.
+func (d *Dir) OutputPath(outputID []byte) string {
+	return filepath.Join(d.root, "o", hex.EncodeToString(outputID))
+}
+
+func (d *Dir) actionPath(actionID []byte) string {
+	return filepath.Join(d.root, "a", hex.EncodeToString(actionID))
+}
+
+func (d *Dir) entry(actionID []byte) (Entry, error) {
+	data, err := os.ReadFile(d.actionPath(actionID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Entry{}, ErrNotFound
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, fmt.Errorf("invalid entry for action %x: %w", actionID, err)
+	}
+	return entry, nil
+}
+
+// writeAtomic writes a file by first writing to a temporary file in the same
+// directory, then renaming it to its final name.
+func writeAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
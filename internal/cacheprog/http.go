@@ -0,0 +1,106 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cacheprog
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// HTTP is a [Backend] storing entries in a content-addressed HTTP service. The
+// service must support the following operations:
+//   - `GET /action/<hex action ID>` returns the JSON-encoded [Entry], or 404;
+//   - `PUT /action/<hex action ID>` stores the JSON-encoded [Entry];
+//   - `GET /output/<hex output ID>` returns the body, or 404;
+//   - `PUT /output/<hex output ID>` stores the body.
+type HTTP struct {
+	base   *url.URL
+	client *http.Client
+}
+
+// NewHTTP returns an [HTTP] backend for the service at base. If client is nil,
+// [http.DefaultClient] is used.
+func NewHTTP(base *url.URL, client *http.Client) *HTTP {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTP{base: base, client: client}
+}
+
+func (h *HTTP) Get(ctx context.Context, actionID []byte) (Entry, io.ReadCloser, error) {
+	res, err := h.do(ctx, http.MethodGet, "action", actionID, nil, -1)
+	if err != nil {
+		return Entry{}, nil, err
+	}
+	var entry Entry
+	err = json.NewDecoder(res.Body).Decode(&entry)
+	res.Body.Close()
+	if err != nil {
+		return Entry{}, nil, fmt.Errorf("invalid entry for action %x: %w", actionID, err)
+	}
+
+	res, err = h.do(ctx, http.MethodGet, "output", entry.OutputID, nil, -1)
+	if err != nil {
+		return Entry{}, nil, err
+	}
+	return entry, res.Body, nil
+}
+
+func (h *HTTP) Put(ctx context.Context, entry Entry, body io.Reader) error {
+	res, err := h.do(ctx, http.MethodPut, "output", entry.OutputID, body, entry.Size)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	res, err = h.do(ctx, http.MethodPut, "action", entry.ActionID, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (*HTTP) Close() error {
+	return nil
+}
+
+// do sends a request for the specified object, and returns the response if it
+// has a successful status code. It returns [ErrNotFound] if the status code is
+// 404.
+func (h *HTTP) do(ctx context.Context, method string, kind string, id []byte, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, h.base.JoinPath(kind, hex.EncodeToString(id)).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrNotFound
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		res.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, req.URL, res.Status)
+	default:
+		return res, nil
+	}
+}
@@ -0,0 +1,235 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cacheprog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prog is a [Backend] that chains to another `GOCACHEPROG` program, acting as
+// the go command would.
+type Prog struct {
+	cmd *exec.Cmd
+
+	mu      sync.Mutex // Guards stdin, nextID, pending and err
+	stdin   io.WriteCloser
+	nextID  int64
+	pending map[int64]chan<- Response
+	err     error // Set once the program's output is no longer readable
+
+	done chan struct{} // Closed once the program's output has been fully read
+}
+
+// StartProg starts the `GOCACHEPROG` program described by cmdline, which is a
+// space-separated list of arguments that may be quoted.
+func StartProg(ctx context.Context, cmdline string) (*Prog, error) {
+	args, err := splitCommandLine(cmdline)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("blank cache program command line")
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting cache program %q: %w", cmdline, err)
+	}
+
+	p := &Prog{
+		cmd:     cmd,
+		stdin:   stdin,
+		nextID:  1,
+		pending: make(map[int64]chan<- Response),
+		done:    make(chan struct{}),
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(stdout))
+	var hello Response
+	if err := dec.Decode(&hello); err != nil {
+		return nil, errors.Join(fmt.Errorf("reading cache program capabilities: %w", err), p.kill())
+	}
+	for _, required := range []Cmd{CmdGet, CmdPut} {
+		if !slices.Contains(hello.KnownCommands, required) {
+			return nil, errors.Join(fmt.Errorf("cache program %q does not support %q", cmdline, required), p.kill())
+		}
+	}
+
+	go p.readResponses(dec)
+	return p, nil
+}
+
+func (p *Prog) Get(_ context.Context, actionID []byte) (Entry, io.ReadCloser, error) {
+	res, err := p.roundTrip(Request{Command: CmdGet, ActionID: actionID}, nil)
+	if err != nil {
+		return Entry{}, nil, err
+	}
+	if res.Miss {
+		return Entry{}, nil, ErrNotFound
+	}
+
+	body, err := os.Open(res.DiskPath)
+	if err != nil {
+		return Entry{}, nil, err
+	}
+	entry := Entry{ActionID: actionID, OutputID: res.OutputID, Size: res.Size}
+	if res.Time != nil {
+		entry.Time = *res.Time
+	}
+	return entry, body, nil
+}
+
+func (p *Prog) Put(_ context.Context, entry Entry, body io.Reader) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	_, err = p.roundTrip(Request{Command: CmdPut, ActionID: entry.ActionID, OutputID: entry.OutputID, BodySize: int64(len(data))}, data)
+	return err
+}
+
+// Close asks the program to exit, and waits for it to do so.
+func (p *Prog) Close() error {
+	_, err := p.roundTrip(Request{Command: CmdClose}, nil)
+	err = errors.Join(err, p.stdin.Close())
+
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		return errors.Join(err, p.kill())
+	}
+	return errors.Join(err, p.cmd.Wait())
+}
+
+// roundTrip sends the provided request (followed by its body, if any), and
+// waits for the corresponding response.
+func (p *Prog) roundTrip(req Request, body []byte) (Response, error) {
+	resChan := make(chan Response, 1)
+
+	p.mu.Lock()
+	if p.err != nil {
+		p.mu.Unlock()
+		return Response{}, p.err
+	}
+	req.ID = p.nextID
+	p.nextID++
+	p.pending[req.ID] = resChan
+
+	enc := json.NewEncoder(p.stdin)
+	err := enc.Encode(req)
+	if err == nil && len(body) > 0 {
+		// The body is sent as a base64-encoded JSON string literal.
+		err = enc.Encode(body)
+	}
+	if err != nil {
+		delete(p.pending, req.ID)
+	}
+	p.mu.Unlock()
+	if err != nil {
+		return Response{}, fmt.Errorf("sending %s request: %w", req.Command, err)
+	}
+
+	res, ok := <-resChan
+	if !ok {
+		return Response{}, p.readErr()
+	}
+	if res.Err != "" {
+		return Response{}, fmt.Errorf("%s request failed: %s", req.Command, res.Err)
+	}
+	return res, nil
+}
+
+func (p *Prog) readResponses(dec *json.Decoder) {
+	defer close(p.done)
+
+	for {
+		var res Response
+		err := dec.Decode(&res)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("cache program exited")
+			}
+			p.mu.Lock()
+			p.err = err
+			for id, ch := range p.pending {
+				close(ch)
+				delete(p.pending, id)
+			}
+			p.mu.Unlock()
+			return
+		}
+
+		p.mu.Lock()
+		ch, found := p.pending[res.ID]
+		delete(p.pending, res.ID)
+		p.mu.Unlock()
+		if found {
+			ch <- res
+		}
+	}
+}
+
+func (p *Prog) readErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *Prog) kill() error {
+	if err := p.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	_ = p.cmd.Wait()
+	return nil
+}
+
+// splitCommandLine splits a command line into its arguments, separated by
+// white space. Arguments may be enclosed in single or double quotes, in which
+// case they may contain white space; there is no escaping.
+func splitCommandLine(cmdline string) ([]string, error) {
+	var args []string
+	for {
+		cmdline = strings.TrimLeft(cmdline, " \t\n\r")
+		if cmdline == "" {
+			return args, nil
+		}
+		if quote := cmdline[0]; quote == '"' || quote == '\'' {
+			end := strings.IndexByte(cmdline[1:], quote)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated %c in %q", quote, cmdline)
+			}
+			args = append(args, cmdline[1:end+1])
+			cmdline = cmdline[end+2:]
+			continue
+		}
+		end := strings.IndexAny(cmdline, " \t\n\r")
+		if end < 0 {
+			end = len(cmdline)
+		}
+		args = append(args, cmdline[:end])
+		cmdline = cmdline[end:]
+	}
+}
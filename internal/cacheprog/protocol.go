@@ -0,0 +1,51 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package cacheprog implements the `GOCACHEPROG` protocol of the go command,
+// allowing build outputs (including instrumented ones) to be stored in a
+// pluggable [Backend], which can be shared by several machines.
+//
+// See https://pkg.go.dev/cmd/go/internal/cacheprog for the protocol
+// definition.
+package cacheprog
+
+import "time"
+
+// Cmd is a command that can be issued by the go command.
+type Cmd string
+
+const (
+	CmdGet   Cmd = "get"
+	CmdPut   Cmd = "put"
+	CmdClose Cmd = "close"
+)
+
+type (
+	// Request is the JSON-encoded message sent by the go command. A [CmdPut]
+	// request with a non-zero BodySize is followed by a base64-encoded JSON
+	// string literal containing the body.
+	Request struct {
+		ID       int64
+		Command  Cmd
+		ActionID []byte `json:",omitempty"`
+		OutputID []byte `json:",omitempty"`
+		BodySize int64  `json:",omitempty"`
+	}
+
+	// Response is the JSON-encoded message sent in response to a [Request]. The
+	// first message (with ID 0) is sent unprompted and lists the commands that
+	// are supported.
+	Response struct {
+		ID            int64
+		Err           string `json:",omitempty"`
+		KnownCommands []Cmd  `json:",omitempty"`
+
+		Miss     bool       `json:",omitempty"`
+		OutputID []byte     `json:",omitempty"`
+		Size     int64      `json:",omitempty"`
+		Time     *time.Time `json:",omitempty"`
+		DiskPath string     `json:",omitempty"`
+	}
+)
@@ -0,0 +1,181 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cacheprog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Server serves the `GOCACHEPROG` protocol. Bodies are always stored in the
+// [Server.Local] directory, as the go command requires them to be present on
+// disk; and the [Server.Remote] backend, if any, is used to share them.
+type Server struct {
+	// Local is the directory where bodies presented to the go command are
+	// stored. It also serves as a first-level cache.
+	Local *Dir
+	// Remote is the backend that entries are shared through. Failing to access
+	// it is not fatal, and results in cache misses.
+	Remote Backend
+
+	mu  sync.Mutex // Guards enc
+	enc *json.Encoder
+
+	inflight sync.WaitGroup // Requests being processed
+	uploads  sync.WaitGroup // Uploads to Remote being processed
+}
+
+// Serve reads requests from r and writes responses to w, until a [CmdClose]
+// request is received, or r is exhausted.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	log := zerolog.Ctx(ctx)
+	bw := bufio.NewWriter(w)
+	s.enc = json.NewEncoder(bw)
+	flush := func() error { return bw.Flush() }
+
+	if err := s.respond(Response{KnownCommands: []Cmd{CmdGet, CmdPut, CmdClose}}, flush); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var req Request
+		if err := dec.Decode(&req); err != nil {
+			s.wait()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("reading request: %w", err)
+		}
+
+		switch req.Command {
+		case CmdGet:
+			s.inflight.Add(1)
+			go func() {
+				defer s.inflight.Done()
+				s.logErr(ctx, s.respond(s.get(ctx, req), flush))
+			}()
+
+		case CmdPut:
+			var body []byte
+			if req.BodySize > 0 {
+				// The body is sent as a base64-encoded JSON string literal, which must
+				// be consumed before the next request can be read.
+				if err := dec.Decode(&body); err != nil {
+					s.wait()
+					return fmt.Errorf("reading body of request %d: %w", req.ID, err)
+				}
+			}
+			s.inflight.Add(1)
+			go func() {
+				defer s.inflight.Done()
+				s.logErr(ctx, s.respond(s.put(ctx, req, body), flush))
+			}()
+
+		case CmdClose:
+			s.wait()
+			log.Debug().Msg("Closing cache program")
+			return s.respond(Response{ID: req.ID}, flush)
+
+		default:
+			s.logErr(ctx, s.respond(Response{ID: req.ID, Err: fmt.Sprintf("unknown command %q", req.Command)}, flush))
+		}
+	}
+}
+
+func (s *Server) get(ctx context.Context, req Request) Response {
+	entry, body, err := s.Local.Get(ctx, req.ActionID)
+	if errors.Is(err, ErrNotFound) && s.Remote != nil {
+		entry, err = s.fetch(ctx, req.ActionID)
+	} else if err == nil {
+		err = body.Close()
+	}
+	if errors.Is(err, ErrNotFound) {
+		return Response{ID: req.ID, Miss: true}
+	}
+	if err != nil {
+		return Response{ID: req.ID, Err: err.Error()}
+	}
+
+	return Response{
+		ID:       req.ID,
+		OutputID: entry.OutputID,
+		Size:     entry.Size,
+		Time:     &entry.Time,
+		DiskPath: s.Local.OutputPath(entry.OutputID),
+	}
+}
+
+// fetch retrieves an entry from the remote backend, and stores it locally.
+func (s *Server) fetch(ctx context.Context, actionID []byte) (Entry, error) {
+	entry, body, err := s.Remote.Get(ctx, actionID)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			zerolog.Ctx(ctx).Warn().Err(err).Hex("action-id", actionID).Msg("Failed to fetch entry from remote cache")
+		}
+		return Entry{}, ErrNotFound
+	}
+	defer body.Close()
+
+	if err := s.Local.Put(ctx, entry, body); err != nil {
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+func (s *Server) put(ctx context.Context, req Request, body []byte) Response {
+	if int64(len(body)) != req.BodySize {
+		return Response{ID: req.ID, Err: fmt.Sprintf("body is %d bytes long, expected %d", len(body), req.BodySize)}
+	}
+
+	entry := Entry{ActionID: req.ActionID, OutputID: req.OutputID, Size: req.BodySize, Time: time.Now()}
+	if err := s.Local.Put(ctx, entry, bytes.NewReader(body)); err != nil {
+		return Response{ID: req.ID, Err: err.Error()}
+	}
+
+	if s.Remote != nil {
+		// Uploads happen in the background, so they do not slow down the build.
+		s.uploads.Add(1)
+		go func() {
+			defer s.uploads.Done()
+			if err := s.Remote.Put(ctx, entry, bytes.NewReader(body)); err != nil {
+				zerolog.Ctx(ctx).Warn().Err(err).Hex("action-id", entry.ActionID).Msg("Failed to store entry in remote cache")
+			}
+		}()
+	}
+
+	return Response{ID: req.ID, DiskPath: s.Local.OutputPath(entry.OutputID)}
+}
+
+func (s *Server) respond(res Response, flush func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(res); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// wait blocks until all in-flight requests and uploads have completed.
+func (s *Server) wait() {
+	s.inflight.Wait()
+	s.uploads.Wait()
+}
+
+func (*Server) logErr(ctx context.Context, err error) {
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to write response")
+	}
+}
@@ -0,0 +1,74 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/DataDog/orchestrion/internal/cacheprog"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+var CacheProg = &cli.Command{
+	Name:        "cacheprog",
+	Usage:       "`GOCACHEPROG`-compatible build cache helper.",
+	Description: "Serves the go command's `GOCACHEPROG` protocol on standard input & output, storing build outputs in the configured backend so they can be shared between machines.\n\nUsers do not normally need to use this command directly, as `orchestrion go` automatically uses it when " + cacheprog.EnvVarBackend + " is set.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "backend",
+			Usage:    "The cache backend to use: a local directory, an http(s):// URL to a content-addressed cache service, or 'prog:' followed by the command line of another GOCACHEPROG program.",
+			EnvVars:  []string{cacheprog.EnvVarBackend},
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:        "dir",
+			Usage:       "The local directory where cached files are stored for use by the go command.",
+			EnvVars:     []string{cacheprog.EnvVarDir},
+			DefaultText: "$GOCACHE/orchestrion/cacheprog",
+		},
+	},
+	Hidden: true,
+	Action: func(ctx *cli.Context) (resErr error) {
+		log := zerolog.Ctx(ctx.Context)
+
+		backend, err := cacheprog.Open(ctx.Context, ctx.String("backend"))
+		if err != nil {
+			return cli.Exit(err, 2)
+		}
+		defer func() {
+			if err := backend.Close(); err != nil {
+				log.Warn().Err(err).Msg("Failed to close cache backend")
+			}
+		}()
+
+		srv := cacheprog.Server{Remote: backend}
+		if dir, ok := backend.(*cacheprog.Dir); ok {
+			// The backend is a local directory already, it can be used directly.
+			srv.Local, srv.Remote = dir, nil
+		} else {
+			dir := ctx.String("dir")
+			if dir == "" {
+				goCache, err := goenv.GOCACHE()
+				if err != nil {
+					return cli.Exit(fmt.Errorf("locating the local cache directory: %w", err), 1)
+				}
+				dir = filepath.Join(goCache, "orchestrion", "cacheprog")
+			}
+			if srv.Local, err = cacheprog.NewDir(dir); err != nil {
+				return cli.Exit(err, 1)
+			}
+		}
+
+		if err := srv.Serve(ctx.Context, os.Stdin, os.Stdout); err != nil {
+			return cli.Exit(err, 1)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,287 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	aspectcontext "github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/injector/typed"
+	toolexecaspect "github.com/DataDog/orchestrion/internal/toolexec/aspect"
+	"github.com/DataDog/orchestrion/internal/toolexec/aspect/linkdeps"
+	"github.com/DataDog/orchestrion/internal/toolexec/importcfg"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	compilePackageFlag = cli.StringFlag{
+		Name:     "p",
+		Usage:    "The import path of the package being compiled.",
+		Required: true,
+	}
+
+	compileImportCfgFlag = cli.StringFlag{
+		Name:     "importcfg",
+		Usage:    "The importcfg file listing the export data of the package's dependencies, as passed to `go tool compile`.",
+		Required: true,
+	}
+
+	compileOutputFlag = cli.StringFlag{
+		Name:     "o",
+		Usage:    "The directory where modified source files (and the " + linkdeps.Filename + " file) are written.",
+		Required: true,
+	}
+
+	compileLangFlag = cli.StringFlag{
+		Name:  "lang",
+		Usage: "The go language version the package is compiled with, as passed to `go tool compile`.",
+	}
+
+	compileConcurrencyFlag = cli.IntFlag{
+		Name:  "c",
+		Usage: "The maximum number of files to instrument concurrently, as passed to `go tool compile`. Defaults to GOMAXPROCS.",
+	}
+
+	compileConfigDirFlag = cli.StringFlag{
+		Name:  "config-dir",
+		Usage: "The directory to load the injector configuration from. Defaults to the directory of the current go.mod file.",
+	}
+
+	compileManifestFlag = cli.StringFlag{
+		Name:  "manifest",
+		Usage: "Write the JSON manifest to this file instead of the standard output.",
+	}
+
+	Compile = &cli.Command{
+		Name:      "compile",
+		Usage:     "Instrument the source files of a single package, for build systems other than `go build`.",
+		UsageText: "orchestrion compile -p <import-path> -importcfg <file> -o <dir> [-lang <version>] [-c <n>] [-config-dir <dir>] [-manifest <file>] <files...>",
+		Description: "Weaves aspects into the provided source files of a package, without running the go toolchain's compiler. Modified files are written " +
+			"to the output directory, and a JSON manifest lists the files to compile, the language version to compile them with, and the synthetic " +
+			"dependencies introduced by instrumentation. Build systems must make the \"import\" dependencies available in the importcfg file used to " +
+			"compile the package, and link all dependencies into the final binary. The " + linkdeps.Filename + " file should be added to the package's " +
+			"archive (using `go tool pack r`), so the synthetic dependencies of the package's dependents can be determined from their importcfg. It " +
+			"includes the " + linkdeps.Filename + " entries of the archives listed in the importcfg file, but the build system is responsible for " +
+			"the link-time dependencies of the \"import\" dependencies' own archives: running the command again with an importcfg file that lists " +
+			"them includes their entries. Source files must have distinct base names, as modified files are all written to the output directory.",
+		Args: true,
+		Flags: []cli.Flag{
+			&compilePackageFlag,
+			&compileImportCfgFlag,
+			&compileOutputFlag,
+			&compileLangFlag,
+			&compileConcurrencyFlag,
+			&compileConfigDirFlag,
+			&compileManifestFlag,
+		},
+		Action: func(clictx *cli.Context) (err error) {
+			importPath := clictx.String(compilePackageFlag.Name)
+			span, ctx := tracer.StartSpanFromContext(clictx.Context, "compile",
+				tracer.ResourceName(importPath),
+			)
+			defer func() { span.Finish(tracer.WithError(err)) }()
+
+			files := clictx.Args().Slice()
+			if len(files) == 0 {
+				return cli.ShowSubcommandHelp(clictx)
+			}
+
+			configDir := clictx.String(compileConfigDirFlag.Name)
+			if configDir == "" {
+				goMod, err := goenv.GOMOD("")
+				if err != nil {
+					return cli.Exit(fmt.Errorf("go env GOMOD: %w", err), 1)
+				}
+				configDir = filepath.Dir(goMod)
+			}
+			cfg, err := config.NewLoader(nil, configDir, false).Load(ctx)
+			if err != nil {
+				return cli.Exit(fmt.Errorf("loading injector configuration: %w", err), 1)
+			}
+
+			manifest, err := compileStandalone(ctx, standaloneCompile{
+				ImportPath:  importPath,
+				ImportCfg:   clictx.String(compileImportCfgFlag.Name),
+				OutputDir:   clictx.String(compileOutputFlag.Name),
+				Lang:        clictx.String(compileLangFlag.Name),
+				Concurrency: clictx.Int(compileConcurrencyFlag.Name),
+				Files:       files,
+			}, cfg.Aspects())
+			if err != nil {
+				return cli.Exit(fmt.Errorf("compiling %s: %w", importPath, err), 1)
+			}
+
+			out := clictx.App.Writer
+			if path := clictx.String(compileManifestFlag.Name); path != "" {
+				file, err := os.Create(path)
+				if err != nil {
+					return cli.Exit(fmt.Errorf("creating manifest: %w", err), 1)
+				}
+				defer file.Close()
+				out = file
+			}
+			return writeCompileManifest(out, manifest)
+		},
+	}
+)
+
+type (
+	// standaloneCompile describes a single package compilation, in the terms of
+	// `go tool compile`.
+	standaloneCompile struct {
+		ImportPath  string
+		ImportCfg   string
+		OutputDir   string
+		Lang        string
+		Concurrency int
+		Files       []string
+	}
+
+	// compileManifest is the JSON document produced by the compile command.
+	compileManifest struct {
+		ImportPath string `json:"importPath"`
+		// Lang is the go language version to compile the package with. It is blank
+		// if no -lang flag was provided.
+		Lang string `json:"lang,omitempty"`
+		// Files is the list of source files to compile, in the input order.
+		Files []string `json:"files"`
+		// Modified maps original source files to their modified counterpart.
+		Modified map[string]string `json:"modified,omitempty"`
+		// Aspects lists the IDs of the aspects that modified the package.
+		Aspects []string `json:"aspects,omitempty"`
+		// Dependencies lists the synthetic dependencies added by instrumentation.
+		Dependencies []compileDependency `json:"dependencies,omitempty"`
+		// LinkDeps is the path to the [linkdeps.Filename] file to add to the
+		// package's archive, if there are any dependencies.
+		LinkDeps string `json:"linkDeps,omitempty"`
+	}
+	compileDependency struct {
+		ImportPath string `json:"importPath"`
+		// Kind is "import" for dependencies that must be listed in the package's
+		// importcfg, and "relocation" for those only needed at link time.
+		Kind string `json:"kind"`
+	}
+)
+
+// compileStandalone weaves the aspects into the source files of a package the
+// same way [toolexecaspect.Weaver.OnCompile] does, except it does not resolve
+// synthetic dependencies, leaving that to the build system. The [linkdeps.Filename]
+// file it writes carries over the entries of the archives listed in the
+// importcfg file, so that dependencies satisfied by the build system once are
+// propagated to the package's dependents.
+func compileStandalone(ctx context.Context, req standaloneCompile, aspects []*aspect.Aspect) (*compileManifest, error) {
+	manifest := &compileManifest{ImportPath: req.ImportPath, Lang: req.Lang, Files: slices.Clone(req.Files)}
+
+	// Modified files are all written to the output directory, so their names must be unique.
+	seen := make(map[string]string, len(req.Files))
+	for _, file := range req.Files {
+		base := filepath.Base(file)
+		if other, dup := seen[base]; dup {
+			return nil, fmt.Errorf("source files %q and %q have the same base name", other, file)
+		}
+		seen[base] = file
+	}
+
+	imports, err := importcfg.ParseFile(ctx, req.ImportCfg)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", req.ImportCfg, err)
+	}
+	if err := os.MkdirAll(req.OutputDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	inj, aspects := toolexecaspect.NewInjector(ctx, req.ImportPath, imports.Lookup, aspects)
+	if inj == nil {
+		return manifest, nil
+	}
+	inj.ImportMap = imports.PackageFile
+	inj.GoVersion = req.Lang
+	inj.Concurrency = req.Concurrency
+	inj.ModifiedFile = func(file string) string {
+		return filepath.Join(req.OutputDir, filepath.Base(file))
+	}
+	results, goLang, err := inj.InjectFiles(ctx, req.Files, aspects)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Lang != "" && !goLang.IsAny() {
+		if curr, _ := aspectcontext.ParseGoLangVersion(req.Lang); aspectcontext.Compare(curr, goLang) < 0 {
+			manifest.Lang = goLang.String()
+		}
+	}
+
+	// Visit files in a consistent order, so that references are merged deterministically.
+	references := typed.ReferenceMap{}
+	manifest.Modified = make(map[string]string, len(results))
+	for _, file := range slices.Sorted(maps.Keys(results)) {
+		modFile := results[file]
+		manifest.Modified[file] = modFile.Filename
+		manifest.Aspects = append(manifest.Aspects, modFile.Aspects...)
+		references.Merge(modFile.References)
+	}
+	for i, file := range manifest.Files {
+		if modFile, found := results[file]; found {
+			manifest.Files[i] = modFile.Filename
+		}
+	}
+	slices.Sort(manifest.Aspects)
+	manifest.Aspects = slices.Compact(manifest.Aspects)
+
+	deps, err := linkdeps.FromImportConfig(ctx, &imports)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s closure from %s: %w", linkdeps.Filename, req.ImportCfg, err)
+	}
+	for depImportPath, kind := range references.Map() {
+		if _, satisfied := imports.PackageFile[depImportPath]; satisfied || depImportPath == "unsafe" {
+			continue
+		}
+		edgeKind := linkdeps.RelocationDependency
+		if kind == typed.ImportStatement {
+			edgeKind = linkdeps.ImportDependency
+		}
+		deps.Add(depImportPath, edgeKind)
+	}
+	if deps.Empty() {
+		return manifest, nil
+	}
+
+	for _, dep := range deps.Dependencies() {
+		kind := "relocation"
+		if deps.Kind(dep) == linkdeps.ImportDependency {
+			kind = "import"
+		}
+		manifest.Dependencies = append(manifest.Dependencies, compileDependency{ImportPath: dep, Kind: kind})
+	}
+
+	manifest.LinkDeps = filepath.Join(req.OutputDir, linkdeps.Filename)
+	file, err := os.Create(manifest.LinkDeps)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := deps.Write(file); err != nil {
+		return nil, fmt.Errorf("writing %s: %w", manifest.LinkDeps, err)
+	}
+	return manifest, file.Close()
+}
+
+func writeCompileManifest(w io.Writer, manifest *compileManifest) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(manifest)
+}
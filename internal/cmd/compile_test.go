@@ -0,0 +1,122 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/toolexec/aspect/linkdeps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// TestCompile drives the compile command the way a build system that does not
+// use `go build` would: it instruments the sources, adds the synthetic
+// dependencies to the importcfg, and runs `go tool compile` on the result.
+func TestCompile(t *testing.T) {
+	goBin, err := goenv.GoBinPath()
+	require.NoError(t, err)
+
+	moduleDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "go.mod"), []byte("module example.com/standalone\n\ngo 1.23\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(moduleDir, config.FilenameOrchestrionYML),
+		[]byte("meta: {name: name, description: description}\naspects: [{ id: ID, join-point: { package-name: main }, advice: [add-blank-import: strings] }]"), 0o644))
+	mainGo := filepath.Join(moduleDir, "main.go")
+	require.NoError(t, os.WriteFile(mainGo, []byte("package main\n\nfunc main() {}\n"), 0o644))
+
+	workDir := t.TempDir()
+	importCfg := filepath.Join(workDir, "importcfg")
+	require.NoError(t, os.WriteFile(importCfg, []byte("# import config\n"), 0o644))
+	outDir := filepath.Join(workDir, "src")
+
+	var stdout bytes.Buffer
+	app := cli.App{Writer: &stdout, Commands: []*cli.Command{Compile}}
+	require.NoError(t, app.RunContext(context.Background(), []string{
+		"orchestrion", "compile",
+		"-p", "example.com/standalone",
+		"-importcfg", importCfg,
+		"-o", outDir,
+		"-lang", "go1.23",
+		"-config-dir", moduleDir,
+		mainGo,
+	}))
+
+	var manifest compileManifest
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &manifest))
+	modified := filepath.Join(outDir, "main.go")
+	assert.Equal(t, []string{modified}, manifest.Files)
+	assert.Equal(t, map[string]string{mainGo: modified}, manifest.Modified)
+	assert.Equal(t, []string{"ID"}, manifest.Aspects)
+	assert.Equal(t, []compileDependency{{ImportPath: "strings", Kind: "import"}}, manifest.Dependencies)
+
+	deps, err := linkdeps.ReadFile(manifest.LinkDeps)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"strings"}, deps.Dependencies())
+
+	// Make the synthetic dependency available, then compile the package.
+	for _, dep := range manifest.Dependencies {
+		export, err := exec.Command(goBin, "list", "-export", "-f", "{{.Export}}", dep.ImportPath).Output()
+		require.NoError(t, err)
+		file, err := os.OpenFile(importCfg, os.O_APPEND|os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = fmt.Fprintf(file, "packagefile %s=%s\n", dep.ImportPath, strings.TrimSpace(string(export)))
+		require.NoError(t, errors.Join(err, file.Close()))
+	}
+	archive := filepath.Join(workDir, "_pkg_.a")
+	args := append([]string{"tool", "compile", "-p", "main", "-importcfg", importCfg, "-lang", manifest.Lang, "-pack", "-o", archive}, manifest.Files...)
+	output, err := exec.Command(goBin, args...).CombinedOutput()
+	require.NoError(t, err, "go tool compile:\n%s", output)
+	output, err = exec.Command(goBin, "tool", "pack", "r", archive, manifest.LinkDeps).CombinedOutput()
+	require.NoError(t, err, "go tool pack:\n%s", output)
+
+	t.Run("transitive", func(t *testing.T) {
+		// A package depending on the one compiled above inherits its synthetic dependencies.
+		depDir := t.TempDir()
+		depImportCfg := filepath.Join(depDir, "importcfg")
+		require.NoError(t, os.WriteFile(depImportCfg, []byte("packagefile example.com/standalone="+archive+"\n"), 0o644))
+		libGo := filepath.Join(moduleDir, "lib.go")
+		require.NoError(t, os.WriteFile(libGo, []byte("package lib\n"), 0o644))
+
+		manifest, err := compileStandalone(context.Background(), standaloneCompile{
+			ImportPath: "example.com/standalone/lib",
+			ImportCfg:  depImportCfg,
+			OutputDir:  filepath.Join(depDir, "src"),
+			Files:      []string{libGo},
+		}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{libGo}, manifest.Files)
+		assert.Equal(t, []compileDependency{{ImportPath: "strings", Kind: "import"}}, manifest.Dependencies)
+
+		deps, err := linkdeps.ReadFile(manifest.LinkDeps)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"strings"}, deps.Dependencies())
+	})
+
+	t.Run("duplicate-names", func(t *testing.T) {
+		otherMainGo := filepath.Join(t.TempDir(), "main.go")
+		require.NoError(t, os.WriteFile(otherMainGo, []byte("package main\n"), 0o644))
+
+		_, err := compileStandalone(context.Background(), standaloneCompile{
+			ImportPath: "example.com/standalone",
+			ImportCfg:  importCfg,
+			OutputDir:  filepath.Join(t.TempDir(), "src"),
+			Files:      []string{mainGo, otherMainGo},
+		}, nil)
+		require.ErrorContains(t, err, "have the same base name")
+	})
+}
@@ -0,0 +1,146 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/sarif"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	configFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: "Output format, one of \"text\" or \"sarif\".",
+		Value: "text",
+	}
+
+	Config = &cli.Command{
+		Name:  "config",
+		Usage: "Inspect orchestrion configuration.",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "validate",
+				Usage:     "Validate " + config.FilenameOrchestrionYML + " files and report positioned diagnostics.",
+				UsageText: "orchestrion config validate [--format text|sarif] [file.yml|package-dir...]",
+				Description: "Checks configuration documents against the JSON schema, compiles all code templates, parses type names and resolves interface names. " +
+					"Arguments can be YAML files, which are checked individually, or package directories, from which the complete configuration graph is loaded. " +
+					"When no argument is provided, the configuration of the current directory is validated.",
+				Args:  true,
+				Flags: []cli.Flag{&configFormatFlag},
+				Action: func(clictx *cli.Context) (err error) {
+					span, ctx := tracer.StartSpanFromContext(clictx.Context, "config.validate",
+						tracer.ResourceName(strings.Join(clictx.Args().Slice(), " ")),
+					)
+					defer func() { span.Finish(tracer.WithError(err)) }()
+
+					format := clictx.String(configFormatFlag.Name)
+					if format != "text" && format != "sarif" {
+						return cli.Exit(fmt.Sprintf("invalid --format value: %q", format), 2)
+					}
+
+					args := clictx.Args().Slice()
+					if len(args) == 0 {
+						args = []string{"."}
+					}
+
+					var diags []config.Diagnostic
+					for _, arg := range args {
+						found, err := diagnose(ctx, arg)
+						if err != nil {
+							return cli.Exit(err, 1)
+						}
+						diags = append(diags, found...)
+					}
+
+					if format == "sarif" {
+						err = writeDiagnosticsSARIF(clictx.App.Writer, diags)
+					} else {
+						err = writeDiagnosticsText(clictx.App.Writer, diags)
+					}
+					if err != nil {
+						return err
+					}
+
+					if config.HasErrors(diags) {
+						return cli.Exit("", 1)
+					}
+					return nil
+				},
+			},
+		},
+	}
+)
+
+// diagnose collects diagnostics for the provided path, which is either a YAML
+// file or a package directory.
+func diagnose(ctx context.Context, path string) ([]config.Diagnostic, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var diags []config.Diagnostic
+	if stat.IsDir() {
+		diags, err = config.NewLoader(nil, path, true).Diagnose(ctx)
+	} else {
+		diags, err = config.DiagnoseYMLFile(ctx, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Report paths relative to the working directory when possible, as CI
+	// annotations are typically resolved relative to the repository root.
+	if wd, err := os.Getwd(); err == nil {
+		for i := range diags {
+			if rel, err := filepath.Rel(wd, diags[i].Filename); err == nil && !strings.HasPrefix(rel, "..") {
+				diags[i].Filename = rel
+			}
+		}
+	}
+	return diags, nil
+}
+
+func writeDiagnosticsText(w io.Writer, diags []config.Diagnostic) error {
+	for _, diag := range diags {
+		if _, err := fmt.Fprintln(w, diag.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeDiagnosticsSARIF(w io.Writer, diags []config.Diagnostic) error {
+	rules := config.Rules()
+	sarifRules := make([]sarif.Rule, len(rules))
+	for i, rule := range rules {
+		sarifRules[i] = sarif.Rule{ID: rule.ID, ShortDescription: &sarif.Message{Text: rule.Description}}
+	}
+
+	run := sarif.NewRun(sarifRules...)
+	for _, diag := range diags {
+		level := sarif.LevelError
+		if diag.Severity == config.SeverityWarning {
+			level = sarif.LevelWarning
+		}
+		run.Results = append(run.Results, sarif.Result{
+			RuleID:    diag.Rule,
+			Level:     level,
+			Message:   sarif.Message{Text: diag.Message},
+			Locations: []sarif.Location{sarif.NewLocation(diag.Filename, &sarif.Region{StartLine: diag.Line, StartColumn: diag.Column})},
+		})
+	}
+	return sarif.Write(w, run)
+}
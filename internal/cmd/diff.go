@@ -6,16 +6,30 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/DataDog/orchestrion/internal/binpath"
+	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/goproxy"
 	"github.com/DataDog/orchestrion/internal/pin"
 	"github.com/DataDog/orchestrion/internal/report"
+	"github.com/DataDog/orchestrion/internal/sarif"
+	"github.com/DataDog/orchestrion/internal/toolexec/aspect"
+	"github.com/DataDog/orchestrion/internal/toolexec/aspect/injected"
+	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 )
 
@@ -47,12 +61,35 @@ var (
 
 	noCacheFlag = cli.BoolFlag{
 		Name:  "no-cache",
-		Usage: "Force a rebuild of all packages when using --build (adds -a flag). Useful for ensuring complete instrumentation coverage.",
+		Usage: "Force a rebuild of all packages when using --build (adds -a flag). Without it, the modified files of packages satisfied from the build cache are read from the copy orchestrion keeps in $GOCACHE when compiling them with --build, or with " + injected.EnvVarEnabled + " set.",
+	}
+
+	diffFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: "Output format, one of \"text\", \"json\", \"patch\" (one .patch file per package, written to --output) or \"sarif\".",
+		Value: "text",
+	}
+
+	diffOutputFlag = cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "Directory where .patch files are written when using --format patch.",
+		Value:   ".",
+	}
+
+	statFlag = cli.BoolFlag{
+		Name:  "stat",
+		Usage: "Print a summary of the lines added and removed per package and per aspect instead of the diff. Honors --format json.",
+	}
+
+	annotateFlag = cli.BoolFlag{
+		Name:  "annotate",
+		Usage: "Label each hunk with the IDs of the aspects that produced it (text and patch formats).",
 	}
 
 	Diff = &cli.Command{
 		Name:  "diff",
-		Usage: "Generates a diff between a nominal and orchestrion-instrumented build. Use --build to execute a build first, or provide a work directory path obtained from `orchestrion go build -work -a`. This is incompatible with coverage related flags.",
+		Usage: "Generates a diff between a nominal and orchestrion-instrumented build. Use --build to execute a build first, or provide a work directory path obtained from `orchestrion go build -work -a`. Coverage builds (-cover) are supported; the diff then excludes the changes made by the cover tool.",
 		Args:  true,
 		Flags: []cli.Flag{
 			&filenameFlag,
@@ -61,8 +98,18 @@ var (
 			&debugFlag,
 			&buildFlag,
 			&noCacheFlag,
+			&diffFormatFlag,
+			&diffOutputFlag,
+			&statFlag,
+			&annotateFlag,
 		},
 		Action: func(clictx *cli.Context) error {
+			switch format := clictx.String(diffFormatFlag.Name); format {
+			case "text", "json", "patch", "sarif":
+			default:
+				return cli.Exit(fmt.Sprintf("invalid --format value: %q", format), 2)
+			}
+
 			workFolder, err := workFolder(clictx)
 			if err != nil {
 				return err
@@ -74,7 +121,7 @@ var (
 			}
 
 			if report.IsEmpty() {
-				return cli.Exit("no files to diff (did you forgot the -a flag during build?)", 1)
+				return cli.Exit("no files to diff (were all packages satisfied from the build cache? use --build, or the -a flag during build)", 1)
 			}
 
 			if !clictx.Bool(debugFlag.Name) {
@@ -102,7 +149,107 @@ func workFolder(clictx *cli.Context) (string, error) {
 		return workFolder, nil
 	}
 
-	return executeBuildAndCaptureWorkDir(clictx, prepareBuildArgs(clictx.Args().Slice(), clictx.Bool(noCacheFlag.Name)))
+	buildArgs := prepareBuildArgs(clictx.Args().Slice(), clictx.Bool(noCacheFlag.Name))
+	workDir, err := executeBuildAndCaptureWorkDir(clictx, buildArgs)
+	if err != nil {
+		return "", err
+	}
+
+	if err := restoreCachedPackages(clictx.Context, workDir, buildArgs); err != nil {
+		return "", cli.Exit(fmt.Sprintf("failed to restore modified files of cached packages: %s", err), 1)
+	}
+	return workDir, nil
+}
+
+// restoreCachedPackages copies the modified files of the packages of the build
+// that were satisfied from the go build cache into workDir, from the copy saved
+// in the [injected.Store] when they were last compiled. Packages compiled with
+// coverage instrumentation are looked up in their own variant first, as the
+// cover tool only applies to some of the packages in the build.
+func restoreCachedPackages(ctx context.Context, workDir string, buildArgs []string) error {
+	log := zerolog.Ctx(ctx)
+
+	flags, patterns, err := goflags.ParseCommandArgs(ctx, ".", buildArgs)
+	if err != nil {
+		return err
+	}
+	if _, all := flags.Short["-a"]; all {
+		// Everything was re-built, so the work directory is complete.
+		return nil
+	}
+
+	variants := []injected.Variant{injected.VariantDefault}
+	_, cover := flags.Short["-cover"]
+	for _, flag := range []string{"-covermode", "-coverpkg"} {
+		if _, found := flags.Get(flag); found {
+			cover = true
+		}
+	}
+	if cover {
+		variants = []injected.Variant{injected.VariantCover, injected.VariantDefault}
+	}
+
+	fresh, err := report.FromWorkDir(ctx, workDir)
+	if err != nil {
+		return err
+	}
+
+	pkgs, err := listBuildIDs(ctx, flags, buildArgs[0] == "test", patterns)
+	if err != nil {
+		return fmt.Errorf("listing packages: %w", err)
+	}
+
+	dir, err := injected.DefaultDir()
+	if err != nil {
+		return err
+	}
+	store := injected.Open(dir)
+
+	var errs []error
+	for _, pkg := range cachedPackages(pkgs, fresh) {
+		sum := sha256.Sum256([]byte(pkg.ImportPath))
+		dest := filepath.Join(workDir, "cached-"+hex.EncodeToString(sum[:8]), aspect.OrchestrionDirPathElement)
+		for _, variant := range variants {
+			key := injected.Key{ImportPath: pkg.ImportPath, Variant: variant, ActionID: injected.ActionID(pkg.BuildID)}
+			found, err := store.Restore(key, dest)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", pkg.ImportPath, err))
+			}
+			if found || err != nil {
+				log.Debug().Str("import-path", pkg.ImportPath).Str("variant", string(variant)).Bool("found", found).Msg("Restored modified files of cached package")
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// cachedPackages returns the packages of the build that were not compiled in
+// the work directory of the fresh report, and hence were satisfied from the go
+// build cache.
+func cachedPackages(pkgs []listedPackage, fresh report.Report) []listedPackage {
+	compiled := make(map[string]bool)
+	for _, pkg := range fresh.Packages() {
+		compiled[pkg] = true
+	}
+	// The package path of main packages is always "main" when compiled, so they
+	// are identified by the directory of their source files instead.
+	compiledMainDirs := make(map[string]bool)
+	for _, file := range fresh.Files() {
+		if file.ImportPath() == "main" && file.Original() != "" {
+			compiledMainDirs[filepath.Dir(file.Original())] = true
+		}
+	}
+
+	var res []listedPackage
+	for _, pkg := range pkgs {
+		pkgPath, _, _ := strings.Cut(pkg.ImportPath, " ")
+		if pkg.BuildID == "" || compiled[pkgPath] || (pkg.Name == "main" && compiledMainDirs[pkg.Dir]) {
+			continue
+		}
+		res = append(res, pkg)
+	}
+	return res
 }
 
 func prepareBuildArgs(args []string, forceRebuild bool) []string {
@@ -153,19 +300,194 @@ func outputReport(clictx *cli.Context, rpt report.Report) error {
 		return nil
 	}
 
-	if err := rpt.Diff(clictx.App.Writer); err != nil {
+	format := clictx.String(diffFormatFlag.Name)
+	annotate := clictx.Bool(annotateFlag.Name)
+	if format == "text" && !annotate && !clictx.Bool(statFlag.Name) {
+		if err := rpt.Diff(clictx.App.Writer); err != nil {
+			return cli.Exit(fmt.Sprintf("failed to generate diff: %s", err), 1)
+		}
+		return nil
+	}
+
+	diffs, err := rpt.FileDiffs()
+	if err != nil {
 		return cli.Exit(fmt.Sprintf("failed to generate diff: %s", err), 1)
 	}
 
+	if clictx.Bool(statFlag.Name) {
+		return writeStat(clictx.App.Writer, diffs, format == "json")
+	}
+
+	switch format {
+	case "text":
+		return report.WritePatch(clictx.App.Writer, diffs, annotate)
+	case "json":
+		enc := json.NewEncoder(clictx.App.Writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diffs)
+	case "patch":
+		return writePackagePatches(clictx.App.Writer, clictx.String(diffOutputFlag.Name), diffs, annotate)
+	case "sarif":
+		return writeDiffSARIF(clictx.App.Writer, diffs)
+	}
+
+	return nil
+}
+
+func writeStat(w io.Writer, diffs []report.FileDiff, asJSON bool) error {
+	stats := report.PackageStats(diffs)
+	aspectStats := report.AspectStats(diffs)
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Packages []report.PackageStat `json:"packages"`
+			Aspects  []report.AspectStat  `json:"aspects,omitempty"`
+		}{stats, aspectStats})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	var total report.PackageStat
+	for _, stat := range stats {
+		fmt.Fprintf(tw, "%s\t%d files\t+%d\t-%d\t\n", stat.ImportPath, stat.Files, stat.Added, stat.Removed)
+		total.Files += stat.Files
+		total.Added += stat.Added
+		total.Removed += stat.Removed
+	}
+	fmt.Fprintf(tw, "%d packages\t%d files\t+%d\t-%d\t\n", len(stats), total.Files, total.Added, total.Removed)
+
+	if len(aspectStats) > 0 {
+		fmt.Fprintln(tw)
+		for _, stat := range aspectStats {
+			fmt.Fprintf(tw, "%s\t%d packages\t+%d\t\t\n", stat.Aspect, stat.Packages, stat.Added)
+		}
+	}
+	return tw.Flush()
+}
+
+// writePackagePatches writes one .patch file per package into dir, at a path
+// mirroring the package's import path, and prints the path of each written file.
+func writePackagePatches(w io.Writer, dir string, diffs []report.FileDiff, annotate bool) error {
+	byPackage := make(map[string][]report.FileDiff)
+	for _, diff := range diffs {
+		if len(diff.Hunks) > 0 {
+			byPackage[diff.ImportPath] = append(byPackage[diff.ImportPath], diff)
+		}
+	}
+
+	for _, pkg := range slices.Sorted(maps.Keys(byPackage)) {
+		filename := filepath.Join(dir, filepath.FromSlash(pkg)+".patch")
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			return cli.Exit(fmt.Sprintf("failed to create directory for %s: %s", filename, err), 1)
+		}
+		file, err := os.Create(filename)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("failed to create %s: %s", filename, err), 1)
+		}
+		err = report.WritePatch(file, byPackage[pkg], annotate)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("failed to write %s: %s", filename, err), 1)
+		}
+		_, _ = fmt.Fprintln(w, filename)
+	}
+
 	return nil
 }
 
+const diffSARIFRule = "instrumented"
+
+// writeDiffSARIF reports each hunk as a note on the corresponding region of the
+// original file.
+func writeDiffSARIF(w io.Writer, diffs []report.FileDiff) error {
+	run := sarif.NewRun(sarif.Rule{
+		ID:               diffSARIFRule,
+		ShortDescription: &sarif.Message{Text: "Code modified by orchestrion"},
+	})
+	for _, diff := range diffs {
+		for _, hunk := range diff.Hunks {
+			added, removed := hunk.Changes()
+			region := &sarif.Region{StartLine: hunk.OriginalStart, EndLine: hunk.OriginalStart + max(hunk.OriginalLines, 1) - 1}
+			result := sarif.Result{
+				RuleID:    diffSARIFRule,
+				Level:     sarif.LevelNote,
+				Message:   sarif.Message{Text: fmt.Sprintf("orchestrion added %d and removed %d lines", added, removed)},
+				Locations: []sarif.Location{sarif.NewLocation(diff.Original, region)},
+				Properties: map[string]any{
+					"importPath":    diff.ImportPath,
+					"modified":      diff.Modified,
+					"modifiedStart": hunk.ModifiedStart,
+					"modifiedLines": hunk.ModifiedLines,
+				},
+			}
+			if len(hunk.Aspects) > 0 {
+				result.Message.Text += " (" + strings.Join(hunk.Aspects, ", ") + ")"
+				result.Properties["aspects"] = hunk.Aspects
+			}
+			run.Results = append(run.Results, result)
+		}
+	}
+	return sarif.Write(w, run)
+}
+
+// listedPackage is the subset of the `go list -json` output used to restore
+// the modified files of cached packages.
+type listedPackage struct {
+	ImportPath string
+	Name       string
+	Dir        string
+	BuildID    string
+}
+
+// listBuildIDs lists the packages of the build, along with the build ID they
+// were compiled with. All packages were just built, so this is satisfied from
+// the go build cache.
+func listBuildIDs(ctx context.Context, flags goflags.CommandFlags, tests bool, patterns []string) ([]listedPackage, error) {
+	// The job server started for the command is shut down when ctx is canceled.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args := []string{"list", "-deps", "-export", "-json=ImportPath,Name,Dir,BuildID"}
+	if tests {
+		args = append(args, "-test")
+	}
+	args = append(append(args, flags.Except("-toolexec", "-work").Slice()...), patterns...)
+	cmd, err := goproxy.BuildCmd(ctx, args,
+		goproxy.WithToolexec(binpath.Orchestrion, "toolexec"),
+		goproxy.WithEnv(injected.EnvVarEnabled+"=true"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	var pkgs []listedPackage
+	for dec := json.NewDecoder(&stdout); dec.More(); {
+		var pkg listedPackage
+		if err := dec.Decode(&pkg); err != nil {
+			return nil, fmt.Errorf("parsing go list output: %w", err)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
 func executeBuildAndCaptureWorkDir(clictx *cli.Context, buildArgs []string) (string, error) {
 	if err := pin.AutoPinOrchestrion(clictx.Context, clictx.App.Writer, clictx.App.ErrWriter); err != nil {
 		return "", cli.Exit(err, -1)
 	}
 
-	cmd, err := goproxy.BuildCmd(clictx.Context, buildArgs, goproxy.WithToolexec(binpath.Orchestrion, "toolexec"))
+	// Keep a copy of the modified files, so that later runs can report on packages satisfied from the build cache.
+	cmd, err := goproxy.BuildCmd(clictx.Context, buildArgs,
+		goproxy.WithToolexec(binpath.Orchestrion, "toolexec"),
+		goproxy.WithEnv(injected.EnvVarEnabled+"=true"),
+	)
 	if err != nil {
 		return "", fmt.Errorf("building command: %w", err)
 	}
@@ -7,12 +7,17 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/DataDog/orchestrion/internal/report"
+	"github.com/DataDog/orchestrion/internal/toolexec/aspect"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -482,3 +487,33 @@ func TestTeeReaderWorkDirCapture(t *testing.T) {
 		})
 	}
 }
+
+func TestCachedPackages(t *testing.T) {
+	workDir := t.TempDir()
+	modDir := t.TempDir()
+	writeFile := func(name, contents string) {
+		t.Helper()
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755))
+		require.NoError(t, os.WriteFile(name, []byte(contents), 0o644))
+	}
+	// Only the "cmd/a" main package and the "lib" package were re-built.
+	writeFile(filepath.Join(workDir, "b001", aspect.OrchestrionDirPathElement, "main", "main.go"), "//line "+filepath.Join(modDir, "cmd", "a", "main.go")+":1:1\npackage main\n")
+	writeFile(filepath.Join(workDir, "b002", aspect.OrchestrionDirPathElement, "example.com", "lib", "lib.go"), "//line "+filepath.Join(modDir, "lib", "lib.go")+":1:1\npackage lib\n")
+
+	fresh, err := report.FromWorkDir(context.Background(), workDir)
+	require.NoError(t, err)
+
+	pkgs := []listedPackage{
+		{ImportPath: "example.com/cmd/a", Name: "main", Dir: filepath.Join(modDir, "cmd", "a"), BuildID: "a/a"},
+		{ImportPath: "example.com/cmd/b", Name: "main", Dir: filepath.Join(modDir, "cmd", "b"), BuildID: "b/b"},
+		{ImportPath: "example.com/lib", Name: "lib", Dir: filepath.Join(modDir, "lib"), BuildID: "l/l"},
+		{ImportPath: "example.com/other", Name: "other", Dir: filepath.Join(modDir, "other"), BuildID: "o/o"},
+		{ImportPath: "fmt", Name: "fmt", BuildID: ""},
+	}
+
+	var cached []string
+	for _, pkg := range cachedPackages(pkgs, fresh) {
+		cached = append(cached, pkg.ImportPath)
+	}
+	assert.Equal(t, []string{"example.com/cmd/b", "example.com/other"}, cached)
+}
@@ -0,0 +1,266 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/injector"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	toolexecaspect "github.com/DataDog/orchestrion/internal/toolexec/aspect"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/tools/go/packages"
+)
+
+var (
+	explainJSONFlag = cli.BoolFlag{
+		Name:  "json",
+		Usage: "Output the explanation as JSON.",
+	}
+
+	explainVerboseFlag = cli.BoolFlag{
+		Name:    "verbose",
+		Aliases: []string{"v"},
+		Usage:   "Also list aspects that were pruned based on the package's imports or the files' contents.",
+	}
+
+	explainTagsFlag = cli.StringFlag{
+		Name:  "tags",
+		Usage: "A comma-separated list of additional build tags to consider satisfied when loading packages.",
+	}
+
+	explainTestFlag = cli.BoolFlag{
+		Name:  "test",
+		Usage: "Also explain test variants of the packages.",
+	}
+
+	Explain = &cli.Command{
+		Name:      "explain",
+		Usage:     "Show which aspects would match which nodes of a package, without building it.",
+		UsageText: "orchestrion explain [--json] [--verbose] [--tags tags] [--test] <packages...>",
+		Description: "Loads the designated packages and runs the injector's matching phase on them, reporting, for each file, every aspect whose join point matched " +
+			"and where. Aspects that could have applied to the package but did not match anything (near misses), as well as matches suppressed by " +
+			"//orchestrion:ignore directives, are also reported.",
+		Args: true,
+		Flags: []cli.Flag{
+			&explainJSONFlag,
+			&explainVerboseFlag,
+			&explainTagsFlag,
+			&explainTestFlag,
+		},
+		Action: func(clictx *cli.Context) (err error) {
+			span, ctx := tracer.StartSpanFromContext(clictx.Context, "explain",
+				tracer.ResourceName(strings.Join(clictx.Args().Slice(), " ")),
+			)
+			defer func() { span.Finish(tracer.WithError(err)) }()
+
+			patterns := clictx.Args().Slice()
+			if len(patterns) == 0 {
+				return cli.ShowSubcommandHelp(clictx)
+			}
+
+			goMod, err := goenv.GOMOD("")
+			if err != nil {
+				return cli.Exit(fmt.Errorf("go env GOMOD: %w", err), 1)
+			}
+			cfg, err := config.NewLoader(nil, filepath.Dir(goMod), false).Load(ctx)
+			if err != nil {
+				return cli.Exit(fmt.Errorf("loading injector configuration: %w", err), 1)
+			}
+			aspects := cfg.Aspects()
+
+			var buildFlags []string
+			if tags := clictx.String(explainTagsFlag.Name); tags != "" {
+				buildFlags = append(buildFlags, "-tags="+tags)
+			}
+			pkgs, err := packages.Load(&packages.Config{
+				Context:    ctx,
+				Mode:       packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports | packages.NeedDeps | packages.NeedExportFile | packages.NeedModule,
+				BuildFlags: buildFlags,
+				Tests:      clictx.Bool(explainTestFlag.Name),
+			}, patterns...)
+			if err != nil {
+				return cli.Exit(fmt.Errorf("loading packages: %w", err), 1)
+			}
+
+			exports := make(map[string]string)
+			var loadErrs []error
+			packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+				if pkg.ExportFile != "" {
+					exports[pkg.PkgPath] = pkg.ExportFile
+				}
+				for _, e := range pkg.Errors {
+					loadErrs = append(loadErrs, e)
+				}
+			})
+			if len(loadErrs) > 0 {
+				return cli.Exit(fmt.Errorf("loading packages: %w", errors.Join(loadErrs...)), 1)
+			}
+
+			explanations := make([]*injector.Explanation, 0, len(pkgs))
+			for _, pkg := range pkgs {
+				expl, err := explainPackage(ctx, pkg, exports, aspects)
+				if err != nil {
+					return cli.Exit(fmt.Errorf("explaining %s: %w", pkg.ID, err), 1)
+				}
+				if expl != nil {
+					explanations = append(explanations, expl)
+				}
+			}
+
+			if clictx.Bool(explainJSONFlag.Name) {
+				return writeExplanationsJSON(clictx.App.Writer, explanations)
+			}
+			return writeExplanationsText(clictx.App.Writer, explanations, clictx.Bool(explainVerboseFlag.Name))
+		},
+	}
+)
+
+// explainPackage runs the injector's matching phase on the provided package. It
+// returns nil if the package is never woven into.
+func explainPackage(ctx context.Context, pkg *packages.Package, exports map[string]string, aspects []*aspect.Aspect) (*injector.Explanation, error) {
+	importPath := pkg.PkgPath
+	isTestMain := pkg.Name == "main" && strings.HasSuffix(importPath, ".test")
+
+	inj, aspects := toolexecaspect.NewInjector(ctx, importPath, toolexecaspect.ExportLookup(exports), aspects)
+	if inj == nil {
+		return nil, nil
+	}
+
+	importMap := make(map[string]string, len(pkg.Imports))
+	for path, dep := range pkg.Imports {
+		importMap[path] = dep.ExportFile
+	}
+
+	var goVersion string
+	if pkg.Module != nil && pkg.Module.GoVersion != "" {
+		goVersion = "go" + pkg.Module.GoVersion
+	}
+
+	inj.Name = pkg.Name
+	inj.GoVersion = goVersion
+	inj.TestMain = isTestMain
+	inj.ImportMap = importMap
+
+	return inj.Explain(ctx, pkg.CompiledGoFiles, aspects)
+}
+
+type (
+	explanationJSON struct {
+		ImportPath     string            `json:"importPath"`
+		TypeCheckError string            `json:"typeCheckError,omitempty"`
+		PackagePruned  []string          `json:"packagePruned,omitempty"`
+		NearMisses     []string          `json:"nearMisses,omitempty"`
+		Files          []fileExplanation `json:"files"`
+	}
+	fileExplanation struct {
+		Filename   string      `json:"filename"`
+		FilePruned []string    `json:"filePruned,omitempty"`
+		Matches    []matchJSON `json:"matches,omitempty"`
+	}
+	matchJSON struct {
+		Aspect    string `json:"aspect"`
+		Line      int    `json:"line"`
+		Column    int    `json:"column"`
+		Node      string `json:"node"`
+		IgnoredBy string `json:"ignoredBy,omitempty"`
+	}
+)
+
+func writeExplanationsJSON(w io.Writer, explanations []*injector.Explanation) error {
+	res := make([]explanationJSON, len(explanations))
+	for i, expl := range explanations {
+		res[i] = explanationJSON{
+			ImportPath:    expl.ImportPath,
+			PackagePruned: aspectIDs(expl.PackagePruned),
+			NearMisses:    aspectIDs(expl.NearMisses),
+			Files:         make([]fileExplanation, len(expl.Files)),
+		}
+		if expl.TypeCheckError != nil {
+			res[i].TypeCheckError = expl.TypeCheckError.Error()
+		}
+		for j, file := range expl.Files {
+			res[i].Files[j] = fileExplanation{
+				Filename:   file.Filename,
+				FilePruned: aspectIDs(file.FilePruned),
+			}
+			for _, match := range file.Matches {
+				m := matchJSON{
+					Aspect: match.Aspect.ID,
+					Line:   match.Position.Line,
+					Column: match.Position.Column,
+					Node:   match.Node,
+				}
+				if match.IgnoredBy != nil {
+					m.IgnoredBy = match.IgnoredBy.String()
+				}
+				res[i].Files[j].Matches = append(res[i].Files[j].Matches, m)
+			}
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
+
+func writeExplanationsText(w io.Writer, explanations []*injector.Explanation, verbose bool) error {
+	var buf strings.Builder
+	for _, expl := range explanations {
+		fmt.Fprintf(&buf, "%s\n", expl.ImportPath)
+		if expl.TypeCheckError != nil {
+			fmt.Fprintf(&buf, "  not woven, as the package fails type-checking: %v\n", expl.TypeCheckError)
+			continue
+		}
+		if verbose && len(expl.PackagePruned) > 0 {
+			fmt.Fprintf(&buf, "  pruned by package imports: %s\n", strings.Join(aspectIDs(expl.PackagePruned), ", "))
+		}
+
+		for _, file := range expl.Files {
+			fmt.Fprintf(&buf, "  %s\n", file.Filename)
+			if verbose && len(file.FilePruned) > 0 {
+				fmt.Fprintf(&buf, "    pruned by file contents: %s\n", strings.Join(aspectIDs(file.FilePruned), ", "))
+			}
+			for _, match := range file.Matches {
+				fmt.Fprintf(&buf, "    %d:%d\t%s\t%s", match.Position.Line, match.Position.Column, match.Node, match.Aspect.ID)
+				if match.IgnoredBy != nil {
+					fmt.Fprintf(&buf, "\t(suppressed by //orchestrion:ignore at %d:%d)", match.IgnoredBy.Line, match.IgnoredBy.Column)
+				}
+				buf.WriteByte('\n')
+			}
+		}
+
+		if len(expl.NearMisses) > 0 {
+			fmt.Fprintf(&buf, "  near misses (not pruned, but matched nothing): %s\n", strings.Join(aspectIDs(expl.NearMisses), ", "))
+		}
+	}
+
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// aspectIDs returns the IDs of the provided aspects, using a placeholder for
+// aspects that have no ID.
+func aspectIDs(aspects []*aspect.Aspect) []string {
+	if len(aspects) == 0 {
+		return nil
+	}
+	ids := make([]string, len(aspects))
+	for i, a := range aspects {
+		ids[i] = cmp.Or(a.ID, "<anonymous>")
+	}
+	return ids
+}
@@ -13,7 +13,10 @@ import (
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/binpath"
 	"github.com/DataDog/orchestrion/internal/goproxy"
+	"github.com/DataDog/orchestrion/internal/jobserver/buildid"
+	"github.com/DataDog/orchestrion/internal/jobserver/events"
 	"github.com/DataDog/orchestrion/internal/pin"
+	"github.com/DataDog/orchestrion/internal/timing"
 	"github.com/urfave/cli/v2"
 )
 
@@ -21,7 +24,8 @@ var (
 	Go = &cli.Command{
 		Name:            "go",
 		Usage:           "Executes standard go commands with automatic instrumentation enabled",
-		UsageText:       "orchestrion go [go command arguments...]",
+		UsageText:       "orchestrion go [--progress] [--strict] [--events-file=<path>] [--timings=<path>] [go command arguments...]",
+		Description:     "Runs the go command with -toolexec set up to instrument the build.\n\nThe --progress flag renders a live status line summarizing the packages compiled, instrumented, and re-used so far. The --events-file flag records the build events (one JSON object per line) to the designated file, for later analysis. The --timings flag measures the time spent instrumenting each package, broken down by phase and by aspect, and writes a report listing the most expensive packages and aspects first to the designated file. The --strict flag fails the build when it uses versions of modules that are outside of the ranges declared as supported by the integrations in use, instead of only logging a warning.",
 		Args:            true,
 		SkipFlagParsing: true,
 		Action: func(clictx *cli.Context) (err error) {
@@ -34,7 +38,53 @@ var (
 				return cli.Exit(err, -1)
 			}
 
-			if err := goproxy.Run(ctx, clictx.Args().Slice(), goproxy.WithToolexec(binpath.Orchestrion, "toolexec")); err != nil {
+			args, flags, err := extractGoFlags(clictx.Args().Slice())
+			if err != nil {
+				return cli.Exit(err, 2)
+			}
+
+			opts := []goproxy.Option{goproxy.WithToolexec(binpath.Orchestrion, "toolexec")}
+			var handlers []func(events.Event)
+			if flags.eventsFile != "" {
+				recorder, recErr := newEventsRecorder(flags.eventsFile)
+				if recErr != nil {
+					return cli.Exit(recErr, 1)
+				}
+				defer func() {
+					if closeErr := recorder.Close(); closeErr != nil && err == nil {
+						err = cli.Exit(closeErr, 1)
+					}
+				}()
+				handlers = append(handlers, recorder.handle)
+			}
+			if flags.timingsFile != "" {
+				timings := newTimingsRecorder(flags.timingsFile)
+				defer func() {
+					if closeErr := timings.Close(); closeErr != nil && err == nil {
+						err = cli.Exit(closeErr, 1)
+					}
+				}()
+				handlers = append(handlers, timings.handle)
+				opts = append(opts, goproxy.WithEnv(timing.EnvVarEnabled+"=true"))
+			}
+			if flags.strict {
+				opts = append(opts, goproxy.WithEnv(buildid.EnvVarStrict+"=true"))
+			}
+			if flags.progress {
+				progress := newProgressReporter(clictx.App.ErrWriter)
+				defer func() { _ = progress.Close() }()
+				handlers = append(handlers, progress.handle)
+				opts = append(opts, goproxy.WithStderr(progress))
+			}
+			if len(handlers) > 0 {
+				opts = append(opts, goproxy.WithBuildEvents(func(event events.Event) {
+					for _, handler := range handlers {
+						handler(event)
+					}
+				}))
+			}
+
+			if err := goproxy.Run(ctx, args, opts...); err != nil {
 				var exitErr *exec.ExitError
 				if errors.As(err, &exitErr) {
 					return cli.Exit(err, exitErr.ExitCode())
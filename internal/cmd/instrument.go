@@ -0,0 +1,471 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/injector"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/injector/typed"
+	toolexecaspect "github.com/DataDog/orchestrion/internal/toolexec/aspect"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// linkDepsFilename is the name of the source file that source-mode
+// instrumentation adds to packages that need link-time dependencies, so that
+// the go toolchain links them.
+const linkDepsFilename = "orchestrion_link_deps.go"
+
+var (
+	instrumentOutFlag = cli.StringFlag{
+		Name:     "out",
+		Usage:    "The directory to write the instrumented copy of the module to.",
+		Required: true,
+	}
+
+	instrumentNoLineDirectivesFlag = cli.BoolFlag{
+		Name:  "no-line-directives",
+		Usage: "Do not emit //line directives mapping instrumented code to the original source files.",
+	}
+
+	instrumentTagsFlag = cli.StringFlag{
+		Name:  "tags",
+		Usage: "A comma-separated list of additional build tags to consider satisfied when loading packages.",
+	}
+
+	instrumentTestFlag = cli.BoolFlag{
+		Name:  "test",
+		Usage: "Also instrument test files.",
+	}
+
+	Instrument = &cli.Command{
+		Name:      "instrument",
+		Usage:     "Write an instrumented copy of the current module's source code to a directory.",
+		UsageText: "orchestrion instrument --out <dir> [--no-line-directives] [--tags tags] [--test] <packages...>",
+		Description: "Copies the current module to the output directory, and weaves aspects into the source files of the designated packages of the " +
+			"module. Requirements on the modules providing injected dependencies are added to the copied go.mod file. The result can be reviewed " +
+			"and checked in, and builds without orchestrion.",
+		Args: true,
+		Flags: []cli.Flag{
+			&instrumentOutFlag,
+			&instrumentNoLineDirectivesFlag,
+			&instrumentTagsFlag,
+			&instrumentTestFlag,
+		},
+		Action: func(clictx *cli.Context) (err error) {
+			span, ctx := tracer.StartSpanFromContext(clictx.Context, "instrument",
+				tracer.ResourceName(strings.Join(clictx.Args().Slice(), " ")),
+			)
+			defer func() { span.Finish(tracer.WithError(err)) }()
+
+			patterns := clictx.Args().Slice()
+			if len(patterns) == 0 {
+				return cli.ShowSubcommandHelp(clictx)
+			}
+
+			goMod, err := goenv.GOMOD("")
+			if err != nil {
+				return cli.Exit(fmt.Errorf("go env GOMOD: %w", err), 1)
+			}
+			moduleDir := filepath.Dir(goMod)
+			outDir, err := filepath.Abs(clictx.String(instrumentOutFlag.Name))
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			if err := copyModule(moduleDir, outDir); err != nil {
+				return cli.Exit(fmt.Errorf("copying module to %q: %w", outDir, err), 1)
+			}
+
+			res, err := instrumentSources(ctx, patterns, sourceInstrumentation{
+				Tags:             clictx.String(instrumentTagsFlag.Name),
+				Tests:            clictx.Bool(instrumentTestFlag.Name),
+				NoLineDirectives: clictx.Bool(instrumentNoLineDirectivesFlag.Name),
+				Include: func(pkg *packages.Package) bool {
+					// Generated files (such as the test main) live outside the module.
+					return pkg.Module != nil && pkg.Module.GoMod == goMod && !slices.ContainsFunc(pkg.CompiledGoFiles, func(file string) bool {
+						return !strings.HasPrefix(file, moduleDir+string(filepath.Separator))
+					})
+				},
+				OutputFile: func(file string) string {
+					return filepath.Join(outDir, strings.TrimPrefix(file, moduleDir))
+				},
+			})
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			for _, pkg := range res.Packages {
+				for path, content := range pkg.Synthetic {
+					if err := os.WriteFile(path, content, 0o644); err != nil {
+						return cli.Exit(err, 1)
+					}
+				}
+				for _, file := range slices.Sorted(maps.Keys(pkg.Files)) {
+					if err := relativizeLineDirectives(pkg.Files[file].Filename, moduleDir); err != nil {
+						return cli.Exit(err, 1)
+					}
+					fmt.Fprintf(clictx.App.Writer, "%s\n", pkg.Files[file].Filename) //nolint:errcheck
+				}
+			}
+
+			if err := addModuleRequirements(ctx, outDir, res.Dependencies, clictx.String(instrumentTagsFlag.Name)); err != nil {
+				return cli.Exit(fmt.Errorf("updating %q: %w", filepath.Join(outDir, "go.mod"), err), 1)
+			}
+			return nil
+		},
+	}
+)
+
+type (
+	// sourceInstrumentation describes how to instrument the source files of
+	// packages outside of a build.
+	sourceInstrumentation struct {
+		Tags             string
+		Tests            bool
+		NoLineDirectives bool
+		// Include selects the packages to instrument.
+		Include func(*packages.Package) bool
+		// OutputFile returns the path to write the modified version of a file to.
+		OutputFile func(string) string
+	}
+
+	sourceInstrumentationResult struct {
+		Packages []instrumentedPackage
+		// Dependencies lists the import paths of all synthetic dependencies.
+		Dependencies []string
+	}
+
+	instrumentedPackage struct {
+		Package *packages.Package
+		// Files associates the original source files to the modified ones.
+		Files map[string]injector.InjectedFile
+		// Synthetic associates the (output) path of additional source files
+		// importing the package's link-time dependencies to their content.
+		Synthetic map[string][]byte
+	}
+)
+
+// instrumentSources loads the designated packages and weaves the aspects of the
+// current module's injector configuration into the source files of those that
+// are included, writing the modified files as designated by opts.
+func instrumentSources(ctx context.Context, patterns []string, opts sourceInstrumentation) (*sourceInstrumentationResult, error) {
+	log := zerolog.Ctx(ctx)
+
+	goMod, err := goenv.GOMOD("")
+	if err != nil {
+		return nil, fmt.Errorf("go env GOMOD: %w", err)
+	}
+	cfg, err := config.NewLoader(nil, filepath.Dir(goMod), false).Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading injector configuration: %w", err)
+	}
+
+	var buildFlags []string
+	if opts.Tags != "" {
+		buildFlags = append(buildFlags, "-tags="+opts.Tags)
+	}
+	pkgs, err := packages.Load(&packages.Config{
+		Context:    ctx,
+		Mode:       packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports | packages.NeedDeps | packages.NeedExportFile | packages.NeedModule,
+		BuildFlags: buildFlags,
+		Tests:      opts.Tests,
+	}, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("loading packages: %w", err)
+	}
+
+	exports := make(map[string]string)
+	var loadErrs []error
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.ExportFile != "" {
+			exports[pkg.PkgPath] = pkg.ExportFile
+		}
+		for _, e := range pkg.Errors {
+			loadErrs = append(loadErrs, e)
+		}
+	})
+	if len(loadErrs) > 0 {
+		return nil, fmt.Errorf("loading packages: %w", errors.Join(loadErrs...))
+	}
+
+	// With tests, the package under test is also loaded as a variant that is
+	// compiled with its test files; only that variant is instrumented, as it
+	// includes all the files of the plain package.
+	tested := make(map[string]bool)
+	for _, pkg := range pkgs {
+		if pkg.ID != pkg.PkgPath && opts.Include(pkg) {
+			tested[pkg.PkgPath] = true
+		}
+	}
+
+	res := &sourceInstrumentationResult{}
+	deps := make(map[string]struct{})
+	for _, pkg := range pkgs {
+		if !opts.Include(pkg) || (pkg.ID == pkg.PkgPath && tested[pkg.PkgPath]) {
+			continue
+		}
+		if slices.ContainsFunc(pkg.CompiledGoFiles, func(file string) bool { return !slices.Contains(pkg.GoFiles, file) }) {
+			log.Warn().Str("package", pkg.ID).Msg("Skipping package using cgo, which cannot be instrumented in source")
+			continue
+		}
+
+		instrumented, err := instrumentPackage(ctx, pkg, exports, cfg.Aspects(), opts)
+		if err != nil {
+			return nil, fmt.Errorf("instrumenting %s: %w", pkg.ID, err)
+		}
+		if instrumented == nil {
+			continue
+		}
+		res.Packages = append(res.Packages, *instrumented)
+		for _, file := range instrumented.Files {
+			for dep := range file.References.Map() {
+				if _, found := pkg.Imports[dep]; !found && dep != "unsafe" {
+					deps[dep] = struct{}{}
+				}
+			}
+		}
+	}
+	res.Dependencies = slices.Sorted(maps.Keys(deps))
+
+	return res, nil
+}
+
+// instrumentPackage weaves the aspects into the source files of a package. It
+// returns nil if the package was not modified.
+func instrumentPackage(ctx context.Context, pkg *packages.Package, exports map[string]string, aspects []*aspect.Aspect, opts sourceInstrumentation) (*instrumentedPackage, error) {
+	importPath := pkg.PkgPath
+	inj, aspects := toolexecaspect.NewInjector(ctx, importPath, toolexecaspect.ExportLookup(exports), aspects)
+	if inj == nil {
+		return nil, nil
+	}
+
+	importMap := make(map[string]string, len(pkg.Imports))
+	for path, dep := range pkg.Imports {
+		importMap[path] = dep.ExportFile
+	}
+
+	var goVersion string
+	if pkg.Module != nil && pkg.Module.GoVersion != "" {
+		goVersion = "go" + pkg.Module.GoVersion
+	}
+
+	inj.Name = pkg.Name
+	inj.GoVersion = goVersion
+	inj.ImportMap = importMap
+	inj.NoLineDirectives = opts.NoLineDirectives
+	inj.ModifiedFile = opts.OutputFile
+
+	results, _, err := inj.InjectFiles(ctx, pkg.CompiledGoFiles, aspects)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	// The go toolchain only links packages that are imported, so link-time
+	// dependencies are imported by an additional source file.
+	var linkDeps []string
+	for _, file := range results {
+		for dep, kind := range file.References.Map() {
+			if _, found := pkg.Imports[dep]; !found && kind == typed.RelocationTarget && !slices.Contains(linkDeps, dep) {
+				linkDeps = append(linkDeps, dep)
+			}
+		}
+	}
+	res := &instrumentedPackage{Package: pkg, Files: results}
+	if len(linkDeps) == 0 {
+		return res, nil
+	}
+	slices.Sort(linkDeps)
+	content, err := linkDepsSource(pkg.Name, linkDeps)
+	if err != nil {
+		return nil, err
+	}
+	path := opts.OutputFile(filepath.Join(filepath.Dir(pkg.CompiledGoFiles[0]), linkDepsFilename))
+	res.Synthetic = map[string][]byte{path: content}
+	return res, nil
+}
+
+// linkDepsSource produces a source file for the named package, with blank
+// imports of the provided import paths.
+func linkDepsSource(pkgName string, imports []string) ([]byte, error) {
+	genDecl := &ast.GenDecl{Tok: token.IMPORT, Specs: make([]ast.Spec, len(imports))}
+	file := &ast.File{Name: ast.NewIdent(pkgName), Decls: []ast.Decl{genDecl}, Imports: make([]*ast.ImportSpec, len(imports))}
+	for idx, path := range imports {
+		spec := &ast.ImportSpec{Name: ast.NewIdent("_"), Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}}
+		genDecl.Specs[idx] = spec
+		file.Imports[idx] = spec
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by orchestrion. DO NOT EDIT.\n\n")
+	if err := format.Node(&buf, token.NewFileSet(), file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// relativizeLineDirectives rewrites the `//line` directives of the designated
+// file that refer to files in moduleDir so they use module-relative paths,
+// which do not depend on where the module was instrumented.
+func relativizeLineDirectives(filename string, moduleDir string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	prefix := []byte("//line " + moduleDir + string(filepath.Separator))
+	lines := bytes.SplitAfter(data, []byte{'\n'})
+	var changed bool
+	for idx, line := range lines {
+		trimmed := bytes.TrimLeft(line, " \t")
+		if !bytes.HasPrefix(trimmed, prefix) {
+			continue
+		}
+		indent := line[:len(line)-len(trimmed)]
+		rel := filepath.ToSlash(string(trimmed[len(prefix):]))
+		lines[idx] = slices.Concat(indent, []byte("//line "), []byte(rel))
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	return os.WriteFile(filename, bytes.Join(lines, nil), 0o644)
+}
+
+// copyModule copies the files of the module rooted in moduleDir to outDir,
+// skipping hidden directories, nested modules, and outDir itself.
+func copyModule(moduleDir string, outDir string) error {
+	return filepath.WalkDir(moduleDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path == moduleDir {
+				return nil
+			}
+			if path == outDir || strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(moduleDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(outDir, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
+
+// addModuleRequirements adds direct requirements on the modules providing the
+// provided packages to the go.mod file of the module in dir, unless it already
+// has them. The packages are loaded with -mod=mod, so that the go command
+// records the modules that are only required indirectly, and their checksums.
+func addModuleRequirements(ctx context.Context, dir string, importPaths []string, tags string) error {
+	if len(importPaths) == 0 {
+		return nil
+	}
+
+	buildFlags := []string{"-mod=mod"}
+	if tags != "" {
+		buildFlags = append(buildFlags, "-tags="+tags)
+	}
+	pkgs, err := packages.Load(&packages.Config{
+		Context:    ctx,
+		Dir:        dir,
+		Mode:       packages.NeedName | packages.NeedModule,
+		BuildFlags: buildFlags,
+	}, importPaths...)
+	if err != nil {
+		return fmt.Errorf("loading injected dependencies: %w", err)
+	}
+
+	goModFile := filepath.Join(dir, "go.mod")
+	data, err := os.ReadFile(goModFile)
+	if err != nil {
+		return err
+	}
+	file, err := modfile.Parse(goModFile, data, nil)
+	if err != nil {
+		return err
+	}
+
+	var changed bool
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return fmt.Errorf("injected dependency %s is not available (is the integration providing it required by go.mod?): %w", pkg.PkgPath, pkg.Errors[0])
+		}
+		mod := pkg.Module
+		if mod == nil || mod.Main {
+			// Standard library, or part of the main module(s).
+			continue
+		}
+		idx := slices.IndexFunc(file.Require, func(req *modfile.Require) bool { return req.Mod.Path == mod.Path })
+		if idx >= 0 && !file.Require[idx].Indirect {
+			continue
+		}
+		if idx >= 0 {
+			// The instrumented code imports the module's packages directly.
+			if err := file.DropRequire(mod.Path); err != nil {
+				return err
+			}
+		}
+		file.AddNewRequire(mod.Path, mod.Version, false)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	file.Cleanup()
+	data, err = file.Format()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(goModFile, data, 0o644)
+}
@@ -0,0 +1,163 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/mod/modfile"
+)
+
+const instrumentTestConfig = `meta: {name: name, description: description}
+aspects:
+  - id: main-body
+    join-point:
+      function-body:
+        function:
+          - name: main
+    advice:
+      prepend-statements:
+        template: println("instrumented")
+  - id: blank-import
+    join-point: { package-name: main }
+    advice: [add-blank-import: strings]
+`
+
+func TestInstrument(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args           []string
+		files          []string
+		lineDirectives bool
+	}{
+		"line-directives":    {files: []string{"main.go"}, lineDirectives: true},
+		"no-line-directives": {args: []string{"--no-line-directives"}, files: []string{"main.go"}},
+		"test":               {args: []string{"--test"}, files: []string{"main.go", "main_test.go"}, lineDirectives: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			moduleDir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "go.mod"), []byte("module example.com/instrument\n\ngo 1.23\n"), 0o644))
+			require.NoError(t, os.WriteFile(filepath.Join(moduleDir, config.FilenameOrchestrionYML), []byte(instrumentTestConfig), 0o644))
+			require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "main.go"), []byte("package main\n\nfunc main() {\n\tprintln(\"original\")\n}\n"), 0o644))
+			require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "main_test.go"), []byte("package main\n\nimport \"testing\"\n\nfunc TestMain(*testing.T) {}\n"), 0o644))
+			require.NoError(t, os.MkdirAll(filepath.Join(moduleDir, "assets"), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "assets", "data.txt"), []byte("data"), 0o644))
+			t.Chdir(moduleDir)
+
+			outDir := filepath.Join(moduleDir, "out")
+			var stdout bytes.Buffer
+			app := cli.App{Writer: &stdout, Commands: []*cli.Command{Instrument}}
+			args := slices.Concat([]string{"orchestrion", "instrument", "--out", outDir}, tc.args, []string{"./..."})
+			require.NoError(t, app.RunContext(context.Background(), args))
+
+			// Each instrumented file is listed once, even when it is part of several package variants.
+			var expected strings.Builder
+			for _, file := range tc.files {
+				expected.WriteString(filepath.Join(outDir, file) + "\n")
+			}
+			assert.Equal(t, expected.String(), stdout.String())
+
+			// The module layout is mirrored...
+			assert.FileExists(t, filepath.Join(outDir, "go.mod"))
+			assert.FileExists(t, filepath.Join(outDir, "assets", "data.txt"))
+			assert.NoDirExists(t, filepath.Join(outDir, "out"))
+
+			// ...and the instrumented source is written there.
+			src, err := os.ReadFile(filepath.Join(outDir, "main.go"))
+			require.NoError(t, err)
+			assert.Contains(t, string(src), `_ "strings"`)
+			assert.Contains(t, string(src), `println("instrumented")`)
+			if tc.lineDirectives {
+				// Line directives refer to the original files relative to the module root.
+				assert.Contains(t, string(src), "//line main.go:")
+				assert.NotContains(t, string(src), moduleDir)
+			} else {
+				assert.NotContains(t, string(src), "//line ")
+			}
+
+			// The instrumented copy builds without orchestrion.
+			goBin, err := goenv.GoBinPath()
+			require.NoError(t, err)
+			build := exec.Command(goBin, "vet", ".")
+			build.Dir = outDir
+			output, err := build.CombinedOutput()
+			require.NoError(t, err, "go vet:\n%s", output)
+		})
+	}
+}
+
+func TestInstrumentModuleRequirements(t *testing.T) {
+	// The injected package is provided by a module that is only required by the
+	// integration module, so the instrumented module needs to require it.
+	const version = "v0.0.0-00010101000000-000000000000"
+	tmp := t.TempDir()
+	depDir := filepath.Join(tmp, "dep")
+	integrationDir := filepath.Join(tmp, "integration")
+	moduleDir := filepath.Join(tmp, "app")
+	for dir, files := range map[string]map[string]string{
+		depDir: {
+			"go.mod": "module example.com/dep\n\ngo 1.23\n",
+			"dep.go": "package dep\n",
+		},
+		integrationDir: {
+			"go.mod":         "module example.com/integration\n\ngo 1.23\n\nrequire example.com/dep " + version + "\n",
+			"integration.go": "package integration\n",
+		},
+		moduleDir: {
+			"go.mod": "module example.com/instrument\n\ngo 1.23\n\n" +
+				"require example.com/integration " + version + "\n\n" +
+				"replace example.com/integration => " + integrationDir + "\n\n" +
+				"replace example.com/dep => " + depDir + "\n",
+			config.FilenameOrchestrionYML: "meta: {name: name, description: description}\n" +
+				"aspects:\n" +
+				"  - id: dep\n" +
+				"    join-point: { package-name: main }\n" +
+				"    advice: [add-blank-import: example.com/dep]\n",
+			"main.go": "package main\n\nfunc main() {}\n",
+		},
+	} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		for name, content := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+		}
+	}
+	t.Chdir(moduleDir)
+
+	outDir := filepath.Join(moduleDir, "out")
+	app := cli.App{Writer: io.Discard, Commands: []*cli.Command{Instrument}}
+	require.NoError(t, app.RunContext(context.Background(), []string{"orchestrion", "instrument", "--out", outDir, "./..."}))
+
+	data, err := os.ReadFile(filepath.Join(outDir, "go.mod"))
+	require.NoError(t, err)
+	goMod, err := modfile.Parse("go.mod", data, nil)
+	require.NoError(t, err)
+	var requires []string
+	for _, req := range goMod.Require {
+		assert.False(t, req.Indirect, "%s is required directly", req.Mod.Path)
+		requires = append(requires, req.Mod.String())
+	}
+	assert.ElementsMatch(t, []string{"example.com/integration@" + version, "example.com/dep@" + version}, requires)
+
+	// The instrumented copy builds without orchestrion.
+	goBin, err := goenv.GoBinPath()
+	require.NoError(t, err)
+	build := exec.Command(goBin, "build", "-o", os.DevNull, ".")
+	build.Dir = outDir
+	output, err := build.CombinedOutput()
+	require.NoError(t, err, "go build:\n%s", output)
+}
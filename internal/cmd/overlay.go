@@ -0,0 +1,147 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/tools/go/packages"
+)
+
+var (
+	overlayDirFlag = cli.StringFlag{
+		Name:  "dir",
+		Usage: "The directory to write instrumented source files to. Defaults to a directory in the user cache directory, specific to the current module.",
+	}
+
+	overlayLineDirectivesFlag = cli.BoolFlag{
+		Name:  "line-directives",
+		Usage: "Emit //line directives mapping instrumented code to the original source files. Diagnostics in injected code are then reported at <generated>.",
+	}
+
+	overlayTagsFlag = cli.StringFlag{
+		Name:  "tags",
+		Usage: "A comma-separated list of additional build tags to consider satisfied when loading packages.",
+	}
+
+	overlayTestFlag = cli.BoolFlag{
+		Name:  "test",
+		Usage: "Also instrument test files.",
+	}
+
+	Overlay = &cli.Command{
+		Name:      "overlay",
+		Usage:     "Produce a go -overlay file replacing source files with their instrumented version.",
+		UsageText: "orchestrion overlay [--dir <dir>] [--line-directives] [--tags tags] [--test] <packages...> > overlay.json",
+		Description: "Weaves aspects into the source files of the designated packages, and prints a JSON document suitable for the go command's " +
+			"-overlay flag (and the gopls \"overlay\" setting), which maps each modified source file to its instrumented version. Source files " +
+			"importing link-time dependencies are added to the packages that need them. This allows tools such as `go vet` and staticcheck to " +
+			"analyze the code that orchestrion compiles.",
+		Args: true,
+		Flags: []cli.Flag{
+			&overlayDirFlag,
+			&overlayLineDirectivesFlag,
+			&overlayTagsFlag,
+			&overlayTestFlag,
+		},
+		Action: func(clictx *cli.Context) (err error) {
+			span, ctx := tracer.StartSpanFromContext(clictx.Context, "overlay",
+				tracer.ResourceName(strings.Join(clictx.Args().Slice(), " ")),
+			)
+			defer func() { span.Finish(tracer.WithError(err)) }()
+
+			patterns := clictx.Args().Slice()
+			if len(patterns) == 0 {
+				return cli.ShowSubcommandHelp(clictx)
+			}
+
+			dir := clictx.String(overlayDirFlag.Name)
+			if dir == "" {
+				if dir, err = defaultOverlayDir(); err != nil {
+					return cli.Exit(err, 1)
+				}
+			}
+			if dir, err = filepath.Abs(dir); err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			res, err := instrumentSources(ctx, patterns, sourceInstrumentation{
+				Tags:             clictx.String(overlayTagsFlag.Name),
+				Tests:            clictx.Bool(overlayTestFlag.Name),
+				NoLineDirectives: !clictx.Bool(overlayLineDirectivesFlag.Name),
+				Include: func(pkg *packages.Package) bool {
+					// The test main package is generated by the go command, it can't be overlaid.
+					return pkg.Module != nil && !strings.HasSuffix(pkg.PkgPath, ".test")
+				},
+				OutputFile: func(file string) string {
+					return overlayFile(dir, file)
+				},
+			})
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			overlay := goOverlay{Replace: make(map[string]string)}
+			for _, pkg := range res.Packages {
+				for orig, file := range pkg.Files {
+					overlay.Replace[orig] = file.Filename
+				}
+				for path, content := range pkg.Synthetic {
+					if err := os.WriteFile(path, content, 0o644); err != nil {
+						return cli.Exit(err, 1)
+					}
+					orig := filepath.Join(filepath.Dir(pkg.Package.CompiledGoFiles[0]), filepath.Base(path))
+					overlay.Replace[orig] = path
+				}
+			}
+			return writeOverlay(clictx.App.Writer, overlay)
+		},
+	}
+)
+
+// goOverlay is the format of the go command's -overlay file.
+type goOverlay struct {
+	Replace map[string]string
+}
+
+// defaultOverlayDir returns the directory to write the instrumented files of
+// the current module to.
+func defaultOverlayDir() (string, error) {
+	goMod, err := goenv.GOMOD("")
+	if err != nil {
+		return "", fmt.Errorf("go env GOMOD: %w", err)
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("determining the user cache directory: %w", err)
+	}
+	sum := sha256.Sum256([]byte(goMod))
+	return filepath.Join(cacheDir, "orchestrion", "overlay", hex.EncodeToString(sum[:8])), nil
+}
+
+// overlayFile returns the path in dir to write the instrumented version of file
+// to. Files from the same directory are kept together, so that their names
+// remain unique.
+func overlayFile(dir string, file string) string {
+	sum := sha256.Sum256([]byte(filepath.Dir(file)))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8]), filepath.Base(file))
+}
+
+func writeOverlay(w io.Writer, overlay goOverlay) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(overlay)
+}
@@ -0,0 +1,69 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestOverlay(t *testing.T) {
+	moduleDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "go.mod"), []byte("module example.com/overlay\n\ngo 1.23\n"), 0o644))
+	// The injected code has a mistake that only `go vet` reports.
+	require.NoError(t, os.WriteFile(filepath.Join(moduleDir, config.FilenameOrchestrionYML), []byte(`meta: {name: name, description: description}
+aspects:
+  - id: main-body
+    join-point:
+      function-body:
+        function:
+          - name: main
+    advice:
+      prepend-statements:
+        imports: { fmt: fmt }
+        template: fmt.Printf("%d\n", "instrumented")
+`), 0o644))
+	mainGo := filepath.Join(moduleDir, "main.go")
+	require.NoError(t, os.WriteFile(mainGo, []byte("package main\n\nfunc main() {}\n"), 0o644))
+	t.Chdir(moduleDir)
+
+	overlayDir := t.TempDir()
+	var stdout bytes.Buffer
+	app := cli.App{Writer: &stdout, Commands: []*cli.Command{Overlay}}
+	require.NoError(t, app.RunContext(context.Background(), []string{"orchestrion", "overlay", "--dir", overlayDir, "./..."}))
+
+	var overlay goOverlay
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &overlay))
+	require.Len(t, overlay.Replace, 1)
+	require.Contains(t, overlay.Replace, mainGo)
+	assert.FileExists(t, overlay.Replace[mainGo])
+
+	overlayFile := filepath.Join(t.TempDir(), "overlay.json")
+	require.NoError(t, os.WriteFile(overlayFile, stdout.Bytes(), 0o644))
+
+	goBin, err := goenv.GoBinPath()
+	require.NoError(t, err)
+
+	// The original code is fine...
+	output, err := exec.Command(goBin, "vet", ".").CombinedOutput()
+	require.NoError(t, err, "go vet:\n%s", output)
+
+	// ...but the instrumented code is not.
+	output, err = exec.Command(goBin, "vet", "-overlay", overlayFile, ".").CombinedOutput()
+	require.Error(t, err)
+	assert.Contains(t, string(output), "fmt.Printf format %d has arg \"instrumented\" of wrong type string")
+}
@@ -6,7 +6,9 @@
 package cmd
 
 import (
+	"fmt"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/injector/config"
@@ -33,7 +35,18 @@ var Pin = &cli.Command{
 			Usage: "Validate all " + config.FilenameOrchestrionYML + " files in the project.",
 			Value: false,
 		},
+		&cli.BoolFlag{
+			Name:  "workspace",
+			Usage: "Pin the workspace-level " + config.FilenameOrchestrionToolGo + " file next to go.work, which applies to all modules used by the workspace, and update the modules that have their own.",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "offline",
+			Usage: "Resolve modules from the module cache and vendor directory only, never accessing the network. This is the default when GOPROXY=off or GOFLAGS contains -mod=vendor.",
+			Value: false,
+		},
 	},
+	Subcommands: []*cli.Command{pinAdd, pinRemove, pinList},
 	Action: func(clictx *cli.Context) (err error) {
 		span, ctx := tracer.StartSpanFromContext(clictx.Context, "pin",
 			tracer.ResourceName(strings.Join(clictx.Args().Slice(), " ")),
@@ -46,6 +59,97 @@ var Pin = &cli.Command{
 			Validate:   clictx.Bool("validate"),
 			NoGenerate: !clictx.Bool("generate"),
 			NoPrune:    !clictx.Bool("prune"),
+			Workspace:  clictx.Bool("workspace"),
+			Offline:    clictx.Bool("offline"),
 		})
 	},
 }
+
+var (
+	pinAdd = &cli.Command{
+		Name:      "add",
+		Usage:     "Adds an integration package to " + config.FilenameOrchestrionToolGo,
+		UsageText: "orchestrion pin add [--validate] <import-path>[@version]",
+		Description: "Adds a blank import of the integration package to " + config.FilenameOrchestrionToolGo + " and requires its module using `go get`. " +
+			"The package must contain an " + config.FilenameOrchestrionYML + " or " + config.FilenameOrchestrionToolGo + " file. " +
+			"When the package is already imported, a version can be provided to update its module.",
+		Args: true,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "validate",
+				Usage: "Validate the " + config.FilenameOrchestrionYML + " files of the integration.",
+				Value: false,
+			},
+		},
+		Action: func(clictx *cli.Context) (err error) {
+			span, ctx := tracer.StartSpanFromContext(clictx.Context, "pin.add",
+				tracer.ResourceName(strings.Join(clictx.Args().Slice(), " ")),
+			)
+			defer func() { span.Finish(tracer.WithError(err)) }()
+
+			if clictx.NArg() != 1 {
+				return cli.Exit("expected exactly one integration package argument", 2)
+			}
+
+			return pin.AddIntegration(ctx, clictx.Args().First(), pin.Options{
+				Writer:    clictx.App.Writer,
+				ErrWriter: clictx.App.ErrWriter,
+				Validate:  clictx.Bool("validate"),
+			})
+		},
+	}
+
+	pinRemove = &cli.Command{
+		Name:      "remove",
+		Usage:     "Removes an integration package from " + config.FilenameOrchestrionToolGo,
+		UsageText: "orchestrion pin remove <import-path>",
+		Args:      true,
+		Action: func(clictx *cli.Context) (err error) {
+			span, ctx := tracer.StartSpanFromContext(clictx.Context, "pin.remove",
+				tracer.ResourceName(strings.Join(clictx.Args().Slice(), " ")),
+			)
+			defer func() { span.Finish(tracer.WithError(err)) }()
+
+			if clictx.NArg() != 1 {
+				return cli.Exit("expected exactly one integration package argument", 2)
+			}
+
+			return pin.RemoveIntegration(ctx, clictx.Args().First(), pin.Options{
+				Writer:    clictx.App.Writer,
+				ErrWriter: clictx.App.ErrWriter,
+			})
+		},
+	}
+
+	pinList = &cli.Command{
+		Name:  "list",
+		Usage: "Lists the integration packages imported by " + config.FilenameOrchestrionToolGo,
+		Action: func(clictx *cli.Context) (err error) {
+			span, ctx := tracer.StartSpanFromContext(clictx.Context, "pin.list")
+			defer func() { span.Finish(tracer.WithError(err)) }()
+
+			integrations, err := pin.ListIntegrations(ctx)
+			if err != nil {
+				return err
+			}
+
+			tw := tabwriter.NewWriter(clictx.App.Writer, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "IMPORT PATH\tVERSION\tNAME\tDESCRIPTION")
+			for _, integration := range integrations {
+				version := integration.Version
+				if version == "" {
+					version = "(local)"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", integration.ImportPath, version, integration.Name, firstLine(integration.Description))
+			}
+			return tw.Flush()
+		},
+	}
+)
+
+// firstLine returns the first line of the provided text, so that multi-line
+// descriptions do not break the table layout.
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
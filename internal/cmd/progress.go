@@ -0,0 +1,303 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/jobserver/events"
+	"github.com/DataDog/orchestrion/internal/timing"
+	"golang.org/x/term"
+)
+
+type goFlags struct {
+	// progress enables the live build progress status line.
+	progress bool
+	// eventsFile is the path of the file build events are recorded to, if any.
+	eventsFile string
+	// timingsFile is the path of the file the instrumentation timing report is
+	// written to, if any.
+	timingsFile string
+	// strict fails the build if it uses module versions that are not supported
+	// by the integrations in use.
+	strict bool
+}
+
+// goValueFlags lists the flags of the go commands `orchestrion go` is used with
+// that take their value as a separate argument, so that it is not mistaken for
+// the first positional argument.
+var goValueFlags = map[string]struct{}{
+	"C": {}, "asmflags": {}, "bench": {}, "benchtime": {}, "blockprofile": {}, "blockprofilerate": {}, "buildmode": {},
+	"compiler": {}, "count": {}, "covermode": {}, "coverpkg": {}, "coverprofile": {}, "cpu": {}, "cpuprofile": {},
+	"exec": {}, "fuzz": {}, "fuzzminimizetime": {}, "fuzztime": {}, "gccgoflags": {}, "gcflags": {}, "installsuffix": {},
+	"ldflags": {}, "list": {}, "memprofile": {}, "memprofilerate": {}, "mod": {}, "modfile": {}, "mutexprofile": {},
+	"mutexprofilefraction": {}, "o": {}, "outputdir": {}, "overlay": {}, "p": {}, "parallel": {}, "pgo": {}, "pkgdir": {},
+	"run": {}, "shuffle": {}, "skip": {}, "tags": {}, "timeout": {}, "toolexec": {}, "trace": {}, "vet": {},
+}
+
+// extractGoFlags removes the flags handled by `orchestrion go` itself from
+// args. Like those of the go command, they must appear before the first
+// positional argument following the go command name, so that arguments meant
+// for the program (`go run`) or the test binary (`go test`) are left alone.
+func extractGoFlags(args []string) ([]string, goFlags, error) {
+	var (
+		flags      goFlags
+		rest       = make([]string, 0, len(args))
+		sawCommand bool
+	)
+	for idx := 0; idx < len(args); idx++ {
+		arg := args[idx]
+		if arg == "--" || arg == "-args" || arg == "--args" {
+			rest = append(rest, args[idx:]...)
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			if sawCommand {
+				// This is the first positional argument, there are no more flags.
+				rest = append(rest, args[idx:]...)
+				break
+			}
+			sawCommand = true
+			rest = append(rest, arg)
+			continue
+		}
+
+		var err error
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+		switch name {
+		case "progress":
+			flags.progress, err = parseBoolFlag(name, value, hasValue)
+		case "strict":
+			flags.strict, err = parseBoolFlag(name, value, hasValue)
+		case "events-file", "timings":
+			if !hasValue {
+				if idx+1 >= len(args) {
+					return nil, flags, fmt.Errorf("missing value for -%s", name)
+				}
+				idx++
+				value = args[idx]
+			}
+			if name == "timings" {
+				flags.timingsFile = value
+			} else {
+				flags.eventsFile = value
+			}
+		default:
+			rest = append(rest, arg)
+			if _, takesValue := goValueFlags[name]; takesValue && !hasValue && idx+1 < len(args) {
+				idx++
+				rest = append(rest, args[idx])
+			}
+		}
+		if err != nil {
+			return nil, flags, err
+		}
+	}
+	return rest, flags, nil
+}
+
+func parseBoolFlag(name string, value string, hasValue bool) (bool, error) {
+	if !hasValue {
+		return true, nil
+	}
+	res, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for -%s: %q", name, value)
+	}
+	return res, nil
+}
+
+// progressReporter renders a compact status line summarizing build events as
+// they are received. Unless its output is a terminal, only the final summary is
+// rendered. It also implements [io.Writer], so that the go command's output can
+// be interleaved with the status line.
+type progressReporter struct {
+	mu       sync.Mutex
+	out      io.Writer
+	live     bool      // Whether the status line is rendered while the build runs
+	width    int       // Width of the terminal, if live
+	shown    bool      // Whether the status line is currently displayed
+	drawn    time.Time // When the status line was last rendered
+	start    time.Time // When the build started
+	inFlight map[string]struct{}
+	last     string // The last package that started compiling
+
+	compiled, instrumented, reused, failed int
+}
+
+// progressInterval is the minimum interval between two renders of the status
+// line.
+const progressInterval = 100 * time.Millisecond
+
+func newProgressReporter(out io.Writer) *progressReporter {
+	p := &progressReporter{out: out, start: time.Now(), inFlight: make(map[string]struct{})}
+	if file, ok := out.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		p.live = true
+		if width, _, err := term.GetSize(int(file.Fd())); err == nil {
+			p.width = width
+		}
+	}
+	return p
+}
+
+func (p *progressReporter) handle(event events.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch event.Kind {
+	case events.KindStarted:
+		p.inFlight[event.ImportPath] = struct{}{}
+		p.last = event.ImportPath
+	case events.KindReused:
+		p.reused++
+	case events.KindFinished:
+		delete(p.inFlight, event.ImportPath)
+		p.compiled++
+		if len(event.ModifiedFiles) > 0 {
+			p.instrumented++
+		}
+	case events.KindFailed:
+		delete(p.inFlight, event.ImportPath)
+		p.failed++
+	}
+
+	if p.live && time.Since(p.drawn) >= progressInterval {
+		p.draw()
+	}
+}
+
+// Write writes data to the output, making sure it does not get mixed up with the
+// status line.
+func (p *progressReporter) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+	n, err := p.out.Write(data)
+	if p.live && err == nil && bytes.HasSuffix(data, []byte{'\n'}) {
+		p.draw()
+	}
+	return n, err
+}
+
+// Close replaces the status line with a final summary of the build.
+func (p *progressReporter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+	_, err := fmt.Fprintf(p.out, "orchestrion: %s in %s\n", p.summary(), time.Since(p.start).Round(time.Millisecond))
+	return err
+}
+
+func (p *progressReporter) summary() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%d compiled (%d instrumented), %d reused", p.compiled, p.instrumented, p.reused)
+	if p.failed > 0 {
+		fmt.Fprintf(&buf, ", %d failed", p.failed)
+	}
+	return buf.String()
+}
+
+func (p *progressReporter) draw() {
+	line := "orchestrion: " + p.summary()
+	if len(p.inFlight) > 0 {
+		line += fmt.Sprintf(", %d in progress", len(p.inFlight))
+		if _, ok := p.inFlight[p.last]; ok {
+			line += " [" + p.last + "]"
+		}
+	}
+	if p.width > 0 && len(line) >= p.width {
+		line = line[:p.width-1]
+	}
+
+	p.clear()
+	_, _ = io.WriteString(p.out, line)
+	p.shown = true
+	p.drawn = time.Now()
+}
+
+func (p *progressReporter) clear() {
+	if !p.shown {
+		return
+	}
+	_, _ = io.WriteString(p.out, "\r\x1b[K")
+	p.shown = false
+}
+
+// eventsRecorder records build events to a file, one JSON object per line.
+type eventsRecorder struct {
+	file *os.File
+	buf  *bufio.Writer
+	enc  *json.Encoder
+	err  error
+}
+
+func newEventsRecorder(path string) (*eventsRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating events file: %w", err)
+	}
+	buf := bufio.NewWriter(file)
+	return &eventsRecorder{file: file, buf: buf, enc: json.NewEncoder(buf)}, nil
+}
+
+func (r *eventsRecorder) handle(event events.Event) {
+	if r.err == nil {
+		r.err = r.enc.Encode(event)
+	}
+}
+
+func (r *eventsRecorder) Close() error {
+	err := r.err
+	if err == nil {
+		err = r.buf.Flush()
+	}
+	if err != nil {
+		err = fmt.Errorf("writing events file: %w", err)
+	}
+	return errors.Join(err, r.file.Close())
+}
+
+// timingsRecorder aggregates the instrumentation timings carried by build
+// events, and writes the resulting report to a file once the build completes.
+type timingsRecorder struct {
+	path string
+	agg  timing.Aggregator
+}
+
+func newTimingsRecorder(path string) *timingsRecorder {
+	return &timingsRecorder{path: path}
+}
+
+func (r *timingsRecorder) handle(event events.Event) {
+	if event.Timings == nil || (event.Kind != events.KindFinished && event.Kind != events.KindFailed) {
+		return
+	}
+	r.agg.Add(event.ImportPath, event.Duration, *event.Timings)
+}
+
+func (r *timingsRecorder) Close() error {
+	data, err := json.MarshalIndent(r.agg.Report(), "", "  ")
+	if err == nil {
+		err = os.WriteFile(r.path, append(data, '\n'), 0o644)
+	}
+	if err != nil {
+		return fmt.Errorf("writing timings report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/jobserver/events"
+	"github.com/DataDog/orchestrion/internal/timing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractGoFlags(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args     []string
+		expected []string
+		flags    goFlags
+	}{
+		"none":           {args: []string{"build", "./..."}, expected: []string{"build", "./..."}},
+		"after-command":  {args: []string{"build", "--progress", "./..."}, expected: []string{"build", "./..."}, flags: goFlags{progress: true}},
+		"before-command": {args: []string{"-progress", "build", "./..."}, expected: []string{"build", "./..."}, flags: goFlags{progress: true}},
+		"explicit-false": {args: []string{"build", "--progress=false"}, expected: []string{"build"}},
+		"events-file":    {args: []string{"test", "--events-file", "out.jsonl", "-events-file=other.jsonl", "./..."}, expected: []string{"test", "./..."}, flags: goFlags{eventsFile: "other.jsonl"}},
+		"timings":        {args: []string{"build", "-timings", "timings.json", "./..."}, expected: []string{"build", "./..."}, flags: goFlags{timingsFile: "timings.json"}},
+		"strict":         {args: []string{"build", "--strict", "./..."}, expected: []string{"build", "./..."}, flags: goFlags{strict: true}},
+		"test-args":      {args: []string{"test", "./...", "-args", "--progress"}, expected: []string{"test", "./...", "-args", "--progress"}},
+		"run-args":       {args: []string{"run", ".", "-progress"}, expected: []string{"run", ".", "-progress"}},
+		"test-binary":    {args: []string{"test", "./x", "-timings", "f"}, expected: []string{"test", "./x", "-timings", "f"}},
+		"strict-args":    {args: []string{"run", ".", "--strict"}, expected: []string{"run", ".", "--strict"}},
+		"value-flags":    {args: []string{"-C", "dir", "build", "-o", "out", "-tags=x", "-strict", "./..."}, expected: []string{"-C", "dir", "build", "-o", "out", "-tags=x", "./..."}, flags: goFlags{strict: true}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			args, flags, err := extractGoFlags(tc.args)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, args)
+			assert.Equal(t, tc.flags, flags)
+		})
+	}
+
+	_, _, err := extractGoFlags([]string{"build", "--events-file"})
+	require.ErrorContains(t, err, "missing value")
+	_, _, err = extractGoFlags([]string{"build", "--timings"})
+	require.ErrorContains(t, err, "missing value for -timings")
+	_, _, err = extractGoFlags([]string{"build", "--strict=maybe"})
+	require.ErrorContains(t, err, `invalid value for -strict: "maybe"`)
+}
+
+func TestProgressReporter(t *testing.T) {
+	var out bytes.Buffer
+	progress := newProgressReporter(&out)
+	require.False(t, progress.live)
+
+	progress.handle(events.Event{Kind: events.KindStarted, ImportPath: "a"})
+	progress.handle(events.Event{Kind: events.KindStarted, ImportPath: "b"})
+	progress.handle(events.Event{Kind: events.KindFinished, ImportPath: "a", ModifiedFiles: []string{"a.go"}})
+	progress.handle(events.Event{Kind: events.KindFailed, ImportPath: "b", Error: "boom"})
+	progress.handle(events.Event{Kind: events.KindReused, ImportPath: "b", Source: events.SourceStore})
+	_, err := progress.Write([]byte("compiler output\n"))
+	require.NoError(t, err)
+	require.NoError(t, progress.Close())
+
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, "compiler output", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "orchestrion: 1 compiled (1 instrumented), 1 reused, 1 failed in "), lines[1])
+
+	// The live status line is cleared before other output is written.
+	out.Reset()
+	progress = newProgressReporter(&out)
+	progress.live = true
+	progress.handle(events.Event{Kind: events.KindStarted, ImportPath: "a"})
+	_, err = progress.Write([]byte("compiler output\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "orchestrion: 0 compiled (0 instrumented), 0 reused, 1 in progress [a]\r\x1b[Kcompiler output\norchestrion: 0 compiled (0 instrumented), 0 reused, 1 in progress [a]", out.String())
+}
+
+func TestEventsRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	recorder, err := newEventsRecorder(path)
+	require.NoError(t, err)
+	recorder.handle(events.Event{Kind: events.KindStarted, ImportPath: "a"})
+	recorder.handle(events.Event{Kind: events.KindReused, ImportPath: "b", Source: events.SourceBuild})
+	require.NoError(t, recorder.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`{"time":"0001-01-01T00:00:00Z","kind":"started","importPath":"a"}`+"\n"+
+			`{"time":"0001-01-01T00:00:00Z","kind":"reused","importPath":"b","source":"build"}`+"\n",
+		string(content))
+}
+
+func TestTimingsRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timings.json")
+	recorder := newTimingsRecorder(path)
+	recorder.handle(events.Event{Kind: events.KindStarted, ImportPath: "a"})
+	recorder.handle(events.Event{Kind: events.KindReused, ImportPath: "b", Source: events.SourceBuild})
+	recorder.handle(events.Event{
+		Kind:       events.KindFinished,
+		ImportPath: "a",
+		Duration:   2 * time.Second,
+		Timings:    &timing.Profile{Phases: map[timing.Phase]time.Duration{timing.PhaseParse: time.Second}},
+	})
+	require.NoError(t, recorder.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var report timing.Report
+	require.NoError(t, json.Unmarshal(content, &report))
+	require.Len(t, report.Packages, 1)
+	assert.Equal(t, "a", report.Packages[0].ImportPath)
+	assert.Equal(t, time.Second, report.Packages[0].Instrumentation)
+	assert.Equal(t, 2*time.Second, report.Packages[0].Compile)
+}
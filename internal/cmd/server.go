@@ -7,6 +7,7 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -14,10 +15,12 @@ import (
 	"os/signal"
 	"time"
 
+	"github.com/DataDog/orchestrion/internal/cacheprog"
 	"github.com/DataDog/orchestrion/internal/filelock"
 	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/jobserver"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/nbt"
 	"github.com/fsnotify/fsnotify"
 	"github.com/goccy/go-yaml"
 	"github.com/rs/zerolog"
@@ -40,6 +43,11 @@ var Server = &cli.Command{
 			Value:       -1,
 			DefaultText: "random",
 		},
+		&cli.BoolFlag{
+			Name:    "unix-socket",
+			Usage:   "Listen on a Unix domain socket that only the current user can access, instead of loopback TCP. Ignores -port.",
+			EnvVars: []string{jobserver.EnvVarUnixSocket},
+		},
 		&cli.DurationFlag{
 			Name:  "inactivity-timeout",
 			Usage: "Automatically shut down after a period without any connected client.",
@@ -62,6 +70,33 @@ var Server = &cli.Command{
 				return nil
 			},
 		},
+		&cli.BoolFlag{
+			Name:    "nbt-store",
+			Usage:   "Persist synthetic dependencies built by the job server, so they can be re-used by subsequent builds.",
+			EnvVars: []string{nbt.EnvVarStore},
+		},
+		&cli.StringFlag{
+			Name:        "nbt-store-dir",
+			Usage:       "Choose the directory where synthetic dependencies are persisted. Implies -nbt-store.",
+			EnvVars:     []string{nbt.EnvVarStoreDir},
+			DefaultText: "$GOCACHE/orchestrion/nbt",
+		},
+		&cli.StringFlag{
+			Name:    "nbt-store-max-size",
+			Usage:   "Maximum size of the persistent store; least recently used entries are evicted when it is exceeded.",
+			EnvVars: []string{nbt.EnvVarStoreMaxSize},
+			Value:   "1GiB",
+		},
+		&cli.StringFlag{
+			Name:    "cache-backend",
+			Usage:   "Share synthetic dependencies with other machines through this cache backend. Implies -nbt-store.",
+			EnvVars: []string{cacheprog.EnvVarBackend},
+		},
+		&cli.StringFlag{
+			Name:    "metrics-addr",
+			Usage:   "Serve the job server's statistics in the Prometheus text format at the /metrics path of this address (e.g, 'localhost:9090').",
+			EnvVars: []string{jobserver.EnvVarMetricsAddr},
+		},
 		&cli.IntFlag{
 			Name:        "parent-pid",
 			Usage:       "Specify which process created this server. This is useful when the server is started as a daemon, as it needs to be able to resolve the top-level go command line.",
@@ -71,7 +106,8 @@ var Server = &cli.Command{
 			},
 		},
 	},
-	Hidden: true,
+	Subcommands: []*cli.Command{serverStatus},
+	Hidden:      true,
 	Action: func(ctx *cli.Context) error {
 		log := zerolog.Ctx(ctx.Context)
 
@@ -79,6 +115,17 @@ var Server = &cli.Command{
 			Port:              ctx.Int("port"),
 			InactivityTimeout: ctx.Duration("inactivity-timeout"),
 			EnableLogging:     ctx.Bool("nats-logging"),
+			MetricsAddr:       ctx.String("metrics-addr"),
+		}
+		if err := nbtStoreOptions(ctx, &opts); err != nil {
+			return err
+		}
+		if ctx.Bool("unix-socket") {
+			socket, err := jobserver.UnixSocketPath()
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			opts.UnixSocket = socket
 		}
 
 		if urlFile := ctx.String("url-file"); urlFile != "" {
@@ -95,6 +142,66 @@ var Server = &cli.Command{
 	},
 }
 
+var serverStatus = &cli.Command{
+	Name:        "status",
+	Usage:       "Print statistics about a running job server.",
+	Description: "Connects to a running job server and prints its statistics: cache hit ratios, never-build-twice activity, and the time spent serving requests. The server is designated by its URL file, or by the " + client.EnvVarJobserverURL + " environment variable.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "url-file",
+			Usage: "The URL file of the job server (usually `.orchestrion-jobserver` in the go command's $WORK directory).",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the statistics as JSON.",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		var (
+			conn *client.Client
+			err  error
+		)
+		if urlFile := ctx.String("url-file"); urlFile != "" {
+			conn, err = client.ConnectURLFile(ctx.Context, urlFile)
+		} else if url := os.Getenv(client.EnvVarJobserverURL); url != "" {
+			conn, err = client.Connect(url)
+		} else {
+			return cli.Exit("no job server designated: use --url-file or set "+client.EnvVarJobserverURL, 2)
+		}
+		if err != nil {
+			return cli.Exit(fmt.Errorf("connecting to job server: %w", err), 1)
+		}
+		defer conn.Close()
+
+		stats, err := client.Request(ctx.Context, conn, jobserver.StatsRequest{})
+		if err != nil {
+			return cli.Exit(fmt.Errorf("requesting job server statistics: %w", err), 1)
+		}
+
+		if ctx.Bool("json") {
+			enc := json.NewEncoder(ctx.App.Writer)
+			enc.SetIndent("", "  ")
+			return enc.Encode(stats)
+		}
+		_, err = fmt.Fprint(ctx.App.Writer, stats)
+		return err
+	},
+}
+
+// nbtStoreOptions configures the persistent store of the never-build-twice
+// service according to the command line flags.
+func nbtStoreOptions(ctx *cli.Context, opts *jobserver.Options) error {
+	backend := ctx.String("cache-backend")
+	dir, maxSize, err := nbt.StoreSettings(ctx.Bool("nbt-store") || backend != "", ctx.String("nbt-store-dir"), ctx.String("nbt-store-max-size"))
+	if err != nil {
+		return cli.Exit(err, 2)
+	}
+	opts.NBTStoreDir = dir
+	opts.NBTStoreMaxSize = maxSize
+	opts.CacheBackend = backend
+	return nil
+}
+
 // start starts a new job server, and waits for it to have completely shut down if `wait` is true.
 // When `wait` is true, the server is always returned as `nil`.
 func start(ctx context.Context, opts *jobserver.Options, wait bool) (*jobserver.Server, cli.ExitCoder) {
@@ -125,7 +232,7 @@ func startWithURLFile(ctx context.Context, opts *jobserver.Options, urlFile stri
 		Msg("Acquired read lock on URL file")
 
 	// Check if there is already a server running...
-	if url, err := hasURLToRunningServer(file); err != nil {
+	if url, err := hasURLToRunningServer(ctx, file); err != nil {
 		return cli.Exit(err, 1)
 	} else if url != "" {
 		return cli.Exit(fmt.Sprintf("A server is already listening on %q", url), 2)
@@ -140,7 +247,7 @@ func startWithURLFile(ctx context.Context, opts *jobserver.Options, urlFile stri
 		Msg("Upgraded lock on URL file to write lock")
 
 	// Check again whether there is a running server; as a concurrent process might have acquired the write lock first.
-	if url, err := hasURLToRunningServer(file); err != nil {
+	if url, err := hasURLToRunningServer(ctx, file); err != nil {
 		return cli.Exit(err, 1)
 	} else if url != "" {
 		return cli.Exit(fmt.Sprintf("A server is already listening on %q", url), 2)
@@ -162,7 +269,10 @@ func startWithURLFile(ctx context.Context, opts *jobserver.Options, urlFile stri
 		Str("url", clientURL).
 		Msg("Server component successfully started")
 
-	// Write the ClientURL into the urlFile
+	// Write the ClientURL into the urlFile, replacing that of any incompatible server
+	if err := file.Truncate(0); err != nil {
+		return cli.Exit(fmt.Errorf("failed to truncate URL file at %q: %w", urlFile, err), 1)
+	}
 	if _, err := file.Write([]byte(clientURL)); err != nil {
 		return cli.Exit(fmt.Errorf("failed to write URL file at %q: %w", urlFile, err), 1)
 	}
@@ -217,8 +327,10 @@ func deleteOnInterrupt(ctx context.Context, path string) func() {
 }
 
 // hasURLToRunningServer checks whether the provided URL file contains the URL to a running server,
-// by trying to connect to it. If that is the case, it returns the URL to the running server.
-func hasURLToRunningServer(file io.ReadSeeker) (string, error) {
+// by trying to connect to it. If that is the case, it returns the URL to the running server. Servers
+// that run a different version of orchestrion are not considered to be running, so they get replaced; any other
+// failure to communicate with the server is returned.
+func hasURLToRunningServer(ctx context.Context, file io.ReadSeeker) (string, error) {
 	urlData, err := io.ReadAll(file)
 	if err != nil {
 		return "", fmt.Errorf("failed to read URL file: %w", err)
@@ -235,7 +347,14 @@ func hasURLToRunningServer(file io.ReadSeeker) (string, error) {
 	if err != nil {
 		return "", nil
 	}
-	conn.Close()
+	defer conn.Close()
+	var mismatch *client.VersionMismatchError
+	if err := conn.Handshake(ctx); errors.As(err, &mismatch) {
+		zerolog.Ctx(ctx).Info().Err(err).Str("url", url).Msg("Replacing job server")
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("checking job server at %q: %w", url, err)
+	}
 	return url, nil
 }
 
@@ -0,0 +1,60 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/jobserver"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasURLToRunningServer(t *testing.T) {
+	ctx := context.Background()
+
+	js, err := jobserver.New(ctx, nil)
+	require.NoError(t, err)
+	defer js.Shutdown()
+
+	t.Run("running", func(t *testing.T) {
+		url, err := hasURLToRunningServer(ctx, strings.NewReader(js.ClientURL()))
+		require.NoError(t, err)
+		assert.Equal(t, js.ClientURL(), url)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		url, err := hasURLToRunningServer(ctx, strings.NewReader(""))
+		require.NoError(t, err)
+		assert.Empty(t, url)
+	})
+
+	t.Run("version-mismatch", func(t *testing.T) {
+		// A bare NATS server behaves like a job server that pre-dates the handshake.
+		srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT})
+		require.NoError(t, err)
+		srv.Start()
+		defer srv.Shutdown()
+		require.True(t, srv.ReadyForConnections(5*time.Second))
+
+		url, err := hasURLToRunningServer(ctx, strings.NewReader(srv.ClientURL()))
+		require.NoError(t, err)
+		assert.Empty(t, url)
+	})
+
+	t.Run("handshake-error", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		url, err := hasURLToRunningServer(canceled, strings.NewReader(js.ClientURL()))
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Empty(t, url)
+	})
+}
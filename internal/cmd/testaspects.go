@@ -0,0 +1,98 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/aspecttest"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	testAspectsUpdateFlag = cli.BoolFlag{
+		Name:  "update",
+		Usage: "Regenerate the " + aspecttest.ExpectedFile + " golden files instead of comparing against them.",
+	}
+
+	testAspectsRunFlag = cli.StringFlag{
+		Name:  "run",
+		Usage: "Only run test cases whose name matches the provided regular expression.",
+	}
+
+	TestAspects = &cli.Command{
+		Name:      "test-aspects",
+		Usage:     "Run golden-file tests for aspect configurations.",
+		UsageText: "orchestrion test-aspects [--update] [--run regexp] <directories...>",
+		Description: "Every directory containing an " + aspecttest.InputFile + " file is a test case. The input file is instrumented using the aspects declared " +
+			"in all *.yml files found in the test case directory and its ancestors (up to the directory passed on the command line), and the result is " +
+			"compared with the " + aspecttest.ExpectedFile + " file in the same directory. Packages imported by the input file are resolved from the " +
+			"module enclosing the test case directory.",
+		Args: true,
+		Flags: []cli.Flag{
+			&testAspectsUpdateFlag,
+			&testAspectsRunFlag,
+		},
+		Action: func(clictx *cli.Context) (err error) {
+			span, ctx := tracer.StartSpanFromContext(clictx.Context, "test-aspects",
+				tracer.ResourceName(strings.Join(clictx.Args().Slice(), " ")),
+			)
+			defer func() { span.Finish(tracer.WithError(err)) }()
+
+			roots := clictx.Args().Slice()
+			if len(roots) == 0 {
+				return cli.ShowSubcommandHelp(clictx)
+			}
+
+			var filter *regexp.Regexp
+			if expr := clictx.String(testAspectsRunFlag.Name); expr != "" {
+				if filter, err = regexp.Compile(expr); err != nil {
+					return cli.Exit(fmt.Errorf("invalid --run expression: %w", err), 2)
+				}
+			}
+
+			opts := aspecttest.Options{Update: clictx.Bool(testAspectsUpdateFlag.Name)}
+			var ran, failed int
+			for _, root := range roots {
+				cases, err := aspecttest.Discover(root)
+				if err != nil {
+					return cli.Exit(fmt.Errorf("discovering test cases in %q: %w", root, err), 1)
+				}
+				for _, c := range cases {
+					if filter != nil && !filter.MatchString(c.Name) {
+						continue
+					}
+					ran++
+
+					res, err := aspecttest.Run(ctx, c, opts)
+					switch {
+					case err != nil:
+						failed++
+						fmt.Fprintf(clictx.App.Writer, "FAIL\t%s\n\t%v\n", c.Name, err)
+					case res.Updated:
+						fmt.Fprintf(clictx.App.Writer, "updated\t%s\n", c.Name)
+					case !res.Passed():
+						failed++
+						fmt.Fprintf(clictx.App.Writer, "FAIL\t%s\n%s", c.Name, res.Diff)
+					default:
+						fmt.Fprintf(clictx.App.Writer, "ok\t%s\n", c.Name)
+					}
+				}
+			}
+
+			if ran == 0 {
+				return cli.Exit("no test cases found", 1)
+			}
+			if failed > 0 {
+				return cli.Exit(fmt.Sprintf("%d of %d test cases failed", failed, ran), 1)
+			}
+			return nil
+		},
+	}
+)
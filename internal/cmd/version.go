@@ -8,7 +8,11 @@ package cmd
 import (
 	"fmt"
 	"runtime"
+	"text/tabwriter"
 
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/toolexec"
 	"github.com/DataDog/orchestrion/internal/version"
 	"github.com/urfave/cli/v2"
 )
@@ -25,7 +29,7 @@ var Version = &cli.Command{
 		&cli.BoolFlag{
 			Name:    "verbose",
 			Aliases: []string{"v"},
-			Usage:   "display the version of the orchestrion binary that started this command (if different from the current)",
+			Usage:   "display the version of the orchestrion binary that started this command (if different from the current), and whether the versions of modules used by the current module are supported by the integrations in use",
 			Hidden:  true,
 		},
 	},
@@ -44,7 +48,39 @@ var Version = &cli.Command{
 			}
 		}
 
-		_, err := fmt.Fprintln(c.App.Writer)
-		return err
+		if _, err := fmt.Fprintln(c.App.Writer); err != nil || !c.Bool("verbose") {
+			return err
+		}
+
+		// This command is not run by the go toolchain, so the build flags cannot be
+		// inferred from the parent process.
+		goflags.SetFlags(c.Context, ".", []string{"build"})
+		support, err := toolexec.SupportedVersions(c.Context)
+		if err != nil {
+			// This is informational, and fails outside of a Go module.
+			_, err = fmt.Fprintf(c.App.ErrWriter, "unable to check supported module versions: %v\n", err)
+			return err
+		}
+		return printSupport(c, support)
 	},
 }
+
+// printSupport renders the support status of the versions of the modules used
+// by the build, as declared by the integrations in use. Nothing is printed if
+// no integration declares supported versions for the modules used by the build.
+func printSupport(c *cli.Context, support []config.Support) error {
+	if len(support) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(c.App.Writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODULE\tVERSION\tSUPPORTED\tSTATUS\tINTEGRATION")
+	for _, sup := range support {
+		status := "ok"
+		if !sup.Supported {
+			status = "UNSUPPORTED"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", sup.Module, sup.Version, sup.Range, status, sup.Integration)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,168 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package ensure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/gomod"
+	"github.com/rs/zerolog"
+	"golang.org/x/mod/module"
+)
+
+// MissingModulesError is returned by [RequiredIntegrations] in offline mode
+// when some modules are neither present in the module cache, nor vendored.
+type MissingModulesError struct {
+	// Modules is the list of modules that are not available.
+	Modules []module.Version
+	// Vendored is true if the modules are vendored, but must also be present in
+	// the module cache in order to update the `go.mod` file and re-vendor them.
+	Vendored bool
+}
+
+func (e MissingModulesError) Error() string {
+	specs := make([]string, len(e.Modules))
+	for i, mod := range e.Modules {
+		specs[i] = mod.String()
+	}
+
+	var builder strings.Builder
+	if e.Vendored {
+		_, _ = builder.WriteString("updating the go.mod file of a vendored module requires the following modules to be in the module cache:\n")
+	} else {
+		_, _ = builder.WriteString("the following modules are not available offline (from the module cache or vendor/modules.txt):\n")
+	}
+	for _, spec := range specs {
+		_, _ = fmt.Fprintf(&builder, "\t%s\n", spec)
+	}
+	_, _ = fmt.Fprintf(&builder, "run `go mod download %s` where the network is available (and make the module cache available here), then try again", strings.Join(specs, " "))
+	return builder.String()
+}
+
+// UnavailableModules returns the modules from the provided list that are
+// neither present in the module cache, nor vendored at the same version by the
+// module whose `go.mod` file is provided. It does not access the network.
+func UnavailableModules(ctx context.Context, goMod string, mods ...module.Version) ([]module.Version, error) {
+	log := zerolog.Ctx(ctx)
+
+	vendored, err := gomod.VendoredModules(goMod)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	var missing []module.Version
+	for _, mod := range mods {
+		if vendor, found := vendored[mod.Path]; found && vendor.Version == mod.Version {
+			continue
+		}
+
+		cmd := exec.CommandContext(ctx, "go", "mod", "download", "-json", mod.String())
+		cmd.Dir = filepath.Dir(goMod)
+		cmd.Env = append(latestVersionEnv(os.Environ()), "GOPROXY=off")
+		cmd.Stdout = io.Discard
+		if err := cmd.Run(); err != nil {
+			log.Debug().Err(err).Stringer("module", mod).Msg("Module is not available in the module cache")
+			missing = append(missing, mod)
+		}
+	}
+	return missing, nil
+}
+
+// UncachedModules returns the modules listed in the `vendor/modules.txt` file
+// next to the provided `go.mod` file that are not present in the module cache.
+// Commands that update `go.mod` and the `vendor` directory, such as `go mod
+// tidy` and `go mod vendor`, need all of them to be. It does not access the
+// network.
+func UncachedModules(ctx context.Context, goMod string) ([]module.Version, error) {
+	vendored, err := gomod.VendoredModules(goMod)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"mod", "download", "-json"}
+	for path, mod := range vendored {
+		switch {
+		case mod.Replace.Path != "" && mod.Replace.Version == "":
+			// Replaced by a local directory, which is not fetched from the module cache.
+			continue
+		case mod.Replace.Path != "":
+			args = append(args, module.Version{Path: mod.Replace.Path, Version: mod.Replace.Version}.String())
+		case mod.Version != "":
+			args = append(args, module.Version{Path: path, Version: mod.Version}.String())
+		}
+	}
+	if len(args) == 3 {
+		return nil, nil
+	}
+	slices.Sort(args[3:])
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = filepath.Dir(goMod)
+	cmd.Env = append(latestVersionEnv(os.Environ()), "GOPROXY=off")
+	cmd.Stdout = &stdout
+	// The command fails if any module is missing, which is reported in its output.
+	runErr := cmd.Run()
+
+	var missing []module.Version
+	for dec := json.NewDecoder(&stdout); dec.More(); {
+		var mod struct {
+			Path    string
+			Version string
+			Error   string
+		}
+		if err := dec.Decode(&mod); err != nil {
+			return nil, errors.Join(fmt.Errorf("parsing `go mod download` output: %w", err), runErr)
+		}
+		if mod.Error != "" {
+			zerolog.Ctx(ctx).Debug().Str("module", mod.Path).Str("version", mod.Version).Str("error", mod.Error).Msg("Module is not available in the module cache")
+			missing = append(missing, module.Version{Path: mod.Path, Version: mod.Version})
+		}
+	}
+	if runErr != nil && len(missing) == 0 {
+		return nil, fmt.Errorf("running `go mod download`: %w", runErr)
+	}
+	return missing, nil
+}
+
+// fetchCachedLatestVersion is a [versionFetcher] that only considers the
+// versions present in the module cache, by using it as the module proxy. It
+// returns a blank string if the module is not present in the module cache.
+func fetchCachedLatestVersion(ctx context.Context, modPath string) (string, error) {
+	modCache, err := goenv.GOMODCACHE()
+	if err != nil {
+		return "", err
+	}
+	proxyDir := filepath.ToSlash(filepath.Join(modCache, "cache", "download"))
+	if !strings.HasPrefix(proxyDir, "/") {
+		// Windows paths (e.g, "C:/...") need a leading slash in a file URL.
+		proxyDir = "/" + proxyDir
+	}
+	proxy := url.URL{Scheme: "file", Path: proxyDir}
+
+	// The checksum database is not needed for modules that are already in the
+	// module cache, as they were verified when they were first downloaded.
+	env := append(latestVersionEnv(os.Environ()), "GOPROXY="+proxy.String(), "GOSUMDB=off")
+	ver, err := queryLatestVersion(ctx, modPath, env)
+	if err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Str("module", modPath).Msg("No version of the module found in the module cache")
+		return "", nil
+	}
+	return ver, nil
+}
@@ -0,0 +1,67 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package ensure
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestUnavailableModules(t *testing.T) {
+	ctx := context.Background()
+
+	tmp := t.TempDir()
+	goMod := filepath.Join(tmp, "go.mod")
+	require.NoError(t, os.WriteFile(goMod, []byte("module example.com/offline\n\ngo 1.23.0\n"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(tmp, "vendor"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "vendor", "modules.txt"), []byte("# example.invalid/vendored v1.2.3\n## explicit\nexample.invalid/vendored\n"), 0o644))
+
+	vendored := module.Version{Path: "example.invalid/vendored", Version: "v1.2.3"}
+	otherVersion := module.Version{Path: "example.invalid/vendored", Version: "v1.3.0"}
+	missing := module.Version{Path: "example.invalid/missing", Version: "v1.0.0"}
+
+	unavailable, err := UnavailableModules(ctx, goMod, vendored, otherVersion, missing)
+	require.NoError(t, err)
+	assert.Equal(t, []module.Version{otherVersion, missing}, unavailable)
+}
+
+func TestFetchCachedLatestVersion(t *testing.T) {
+	ver, err := fetchCachedLatestVersion(context.Background(), "example.invalid/missing")
+	require.NoError(t, err)
+	assert.Empty(t, ver, "modules absent from the module cache have no version")
+}
+
+func TestMissingModulesError(t *testing.T) {
+	err := MissingModulesError{Modules: []module.Version{
+		{Path: "example.com/foo", Version: "v1.0.0"},
+		{Path: "example.com/bar", Version: "v2.0.0"},
+	}}
+	assert.Contains(t, err.Error(), "\texample.com/foo@v1.0.0\n\texample.com/bar@v2.0.0\n")
+	assert.Contains(t, err.Error(), "run `go mod download example.com/foo@v1.0.0 example.com/bar@v2.0.0`")
+
+	err.Vendored = true
+	assert.Contains(t, err.Error(), "vendored module requires the following modules to be in the module cache")
+}
+
+func TestUncachedModules(t *testing.T) {
+	ctx := context.Background()
+
+	tmp := t.TempDir()
+	goMod := filepath.Join(tmp, "go.mod")
+	require.NoError(t, os.WriteFile(goMod, []byte("module example.com/offline\n\ngo 1.23.0\n\nrequire (\n\texample.invalid/local v1.0.0\n\texample.invalid/missing v1.0.0\n)\n"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(tmp, "vendor"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "vendor", "modules.txt"), []byte("# example.invalid/local v1.0.0 => ./local\n## explicit\nexample.invalid/local\n# example.invalid/missing v1.0.0\n## explicit\nexample.invalid/missing\n# example.invalid/local => ./local\n"), 0o644))
+
+	uncached, err := UncachedModules(ctx, goMod)
+	require.NoError(t, err)
+	assert.Equal(t, []module.Version{{Path: "example.invalid/missing", Version: "v1.0.0"}}, uncached)
+}
@@ -22,9 +22,17 @@ import (
 	"github.com/DataDog/orchestrion/internal/gomod"
 	"github.com/DataDog/orchestrion/internal/integrations"
 	"github.com/rs/zerolog"
+	"golang.org/x/mod/module"
 	"golang.org/x/mod/semver"
 )
 
+// RequiredIntegrations installs or upgrades the integrations required in the
+// designated `go.mod` file, and returns the additional edits to be made to it.
+//
+// If the context was obtained from [gomod.WithOffline], versions are resolved
+// from the module cache only, falling back to the versions orchestrion shipped
+// with. Modules that would need to be downloaded are reported using a
+// [MissingModulesError] instead of failing inside `go get`.
 func RequiredIntegrations(ctx context.Context, goMod string) ([]gomod.Edit, error) {
 	log := zerolog.Ctx(ctx)
 
@@ -33,19 +41,49 @@ func RequiredIntegrations(ctx context.Context, goMod string) ([]gomod.Edit, erro
 		return nil, fmt.Errorf("parsing %q: %w", goMod, err)
 	}
 
+	offline := gomod.IsOffline(ctx)
+	fetcher := fetchLatestVersion
+	if offline {
+		fetcher = fetchCachedLatestVersion
+	}
+	var missing []module.Version
+
 	// V1
 	if ver, found := curMod.Requires(integrations.DatadogTracerV1); found && semver.Compare(ver, "v1.74.0") < 0 {
-		if err := gomod.RunGet(ctx, goMod, integrations.DatadogTracerV1+"@latest"); err != nil {
-			return nil, fmt.Errorf("go get "+integrations.DatadogTracerV1+"@latest: %w", err)
+		target := integrations.DatadogTracerV1 + "@latest"
+		if offline {
+			latest, err := fetchCachedLatestVersion(ctx, integrations.DatadogTracerV1)
+			if err != nil {
+				return nil, err
+			}
+			target = integrations.DatadogTracerV1 + "@" + latest
+			if semver.Compare(latest, "v1.74.0") < 0 {
+				missing = append(missing, module.Version{Path: integrations.DatadogTracerV1, Version: "v1.74.0"})
+			}
+		}
+		if len(missing) == 0 {
+			if err := gomod.RunGet(ctx, goMod, target); err != nil {
+				return nil, fmt.Errorf("go get %s: %w", target, err)
+			}
 		}
 	}
 
 	// V2
-	ver, err := fetchVersions(ctx, curMod, integrations.DatadogTracerV2, fetchLatestVersion)
+	ver, err := fetchVersions(ctx, curMod, integrations.DatadogTracerV2, fetcher)
 	if err != nil {
 		return nil, fmt.Errorf("fetching versions for %s: %w", integrations.DatadogTracerV2, err)
 	}
 	shouldUpgrade, targetVersion := resolveIntegrationVersion(ver)
+	if shouldUpgrade && offline {
+		unavailable, err := UnavailableModules(ctx, goMod, module.Version{Path: integrations.DatadogTracerV2All, Version: targetVersion})
+		if err != nil {
+			return nil, err
+		}
+		missing = append(missing, unavailable...)
+	}
+	if len(missing) != 0 {
+		return nil, MissingModulesError{Modules: missing}
+	}
 	if shouldUpgrade {
 		log.Info().
 			Str("target", targetVersion).
@@ -161,10 +199,16 @@ func latestVersionEnv(base []string) []string {
 // fetchLatestVersion queries the Go module registry to get the actual latest version
 // of the specified module path.
 func fetchLatestVersion(ctx context.Context, modPath string) (string, error) {
+	return queryLatestVersion(ctx, modPath, latestVersionEnv(os.Environ()))
+}
+
+// queryLatestVersion runs `go list -m -json <modPath>@latest` with the provided
+// environment, and returns the resulting version.
+func queryLatestVersion(ctx context.Context, modPath string, env []string) (string, error) {
 	var stdout, stderr bytes.Buffer
 	cmd := exec.CommandContext(ctx, "go", "list", "-m", "-json", modPath+"@latest")
 
-	cmd.Env = latestVersionEnv(os.Environ())
+	cmd.Env = env
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
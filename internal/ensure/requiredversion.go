@@ -23,7 +23,7 @@ const orchestrionPkgPath = "github.com/DataDog/orchestrion"
 var orchestrionSrcDir string
 
 // IncorrectVersionError is returned by [RequiredVersion] when the version of orchestrion running
-// does not match the one required by `go.mod`.
+// does not match the one required by `go.mod` (or selected by `go.work` in workspace mode).
 type IncorrectVersionError struct {
 	// RequiredVersion is the version declared in `go.mod`, or a blank string if a `replace` directive
 	// for "github.com/DataDog/orchestrion" is present in `go.mod`.
@@ -31,7 +31,8 @@ type IncorrectVersionError struct {
 }
 
 // RequiredVersion makes sure the version of the tool currently running is the same as the one
-// required in the current working directory's "go.mod" file.
+// required in the current working directory's "go.mod" file. In workspace mode, the version
+// selected for the whole workspace is used instead, so that all its modules agree.
 //
 // If this returns `nil`, the current process is running the correct version of the tool and can
 // proceed with it's intended purpose. If it returns an [IncorrectVersionError], the caller should
@@ -76,14 +77,14 @@ func requiredVersion(
 // working directory is used. The version may be blank if a replace directive is in effect; in which
 // case the path value may indicate the location of the source code that is being used instead.
 func goModVersion(ctx context.Context, dir string) (moduleVersion string, moduleDir string, err error) {
-	gomod, err := goenv.GOMOD(dir)
+	modDir, err := versionRootDir(dir)
 	if err != nil {
 		return "", "", err
 	}
 
 	log := zerolog.Ctx(ctx)
 	cfg := &packages.Config{
-		Dir:  filepath.Dir(gomod),
+		Dir:  modDir,
 		Mode: packages.NeedModule,
 		Logf: func(format string, args ...any) { log.Trace().Str("operation", "packages.Load").Msgf(format, args...) },
 	}
@@ -117,6 +118,28 @@ func goModVersion(ctx context.Context, dir string) (moduleVersion string, module
 	return pkg.Module.Version, pkg.Module.Dir, nil
 }
 
+// versionRootDir returns the directory of the module that contains the specified
+// directory. In workspace mode, this is the directory of the `go.work` file
+// instead, so that the version of orchestrion is resolved from the build list
+// shared by all modules used by the workspace, and is hence consistent across
+// them (including when running from a directory that is not part of any of
+// them, such as the workspace root).
+func versionRootDir(dir string) (string, error) {
+	goWork, err := goenv.GOWORK(dir)
+	if err == nil {
+		return filepath.Dir(goWork), nil
+	}
+	if !errors.Is(err, goenv.ErrNoGoWork) {
+		return "", err
+	}
+
+	gomod, err := goenv.GOMOD(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(gomod), nil
+}
+
 func init() {
 	_, thisFile, _, _ := runtime.Caller(0)
 	orchestrionSrcDir = filepath.Join(thisFile, "..", "..", "..")
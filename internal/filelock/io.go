@@ -48,3 +48,10 @@ func (m *Mutex) WriteAt(b []byte, off int64) (int, error) {
 	}
 	return m.file.WriteAt(b, off)
 }
+
+func (m *Mutex) Truncate(size int64) error {
+	if m.file == nil {
+		return fs.ErrClosed
+	}
+	return m.file.Truncate(size)
+}
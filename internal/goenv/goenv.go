@@ -24,6 +24,12 @@ var (
 
 	// ErrNoModulePath is returned when no module path could be identified.
 	ErrNoModulePath = errors.New("no module path found")
+
+	// ErrNoGoWork is returned when workspace mode is not enabled.
+	ErrNoGoWork = errors.New("`go env GOWORK` returned a blank string or \"off\"")
+
+	// ErrNoGoCache is returned when the build cache is disabled.
+	ErrNoGoCache = errors.New("`go env GOCACHE` returned a blank string or \"off\"")
 )
 
 // Module represents basic information about a Go module.
@@ -55,6 +61,71 @@ func GOMOD(dir string) (string, error) {
 	return "", fmt.Errorf("in %q: %w", wd, ErrNoGoMod)
 }
 
+// GOWORK returns the current GOWORK environment variable (from running `go env GOWORK`), which is
+// the path to the `go.work` file in effect in the specified directory. It returns [ErrNoGoWork] if
+// workspace mode is not enabled there.
+func GOWORK(dir string) (string, error) {
+	cmd := exec.Command("go", "env", "GOWORK")
+	cmd.Dir = dir
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %q: %w", cmd.Args, err)
+	}
+	if goWork := strings.TrimSpace(stdout.String()); goWork != "" && goWork != "off" {
+		return goWork, nil
+	}
+	return "", ErrNoGoWork
+}
+
+// GOCACHE returns the current GOCACHE environment variable (from running `go env GOCACHE`).
+func GOCACHE() (string, error) {
+	cmd := exec.Command("go", "env", "GOCACHE")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %q: %w", cmd.Args, err)
+	}
+	if goCache := strings.TrimSpace(stdout.String()); goCache != "" && goCache != "off" {
+		return goCache, nil
+	}
+	return "", ErrNoGoCache
+}
+
+// GOMODCACHE returns the current GOMODCACHE environment variable (from running `go env GOMODCACHE`).
+func GOMODCACHE() (string, error) {
+	cmd := exec.Command("go", "env", "GOMODCACHE")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %q: %w", cmd.Args, err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Offline returns true if the go command is not expected to download modules in
+// the specified directory, which is the case when GOPROXY is "off", or when
+// GOFLAGS contains "-mod=vendor" (as is customary in hermetic environments).
+func Offline(dir string) (bool, error) {
+	cmd := exec.Command("go", "env", "GOPROXY", "GOFLAGS")
+	cmd.Dir = dir
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return false, fmt.Errorf("running %q: %w", cmd.Args, err)
+	}
+	goProxy, goFlags, _ := strings.Cut(stdout.String(), "\n")
+	if strings.TrimSpace(goProxy) == "off" {
+		return true, nil
+	}
+	for _, flag := range strings.Fields(goFlags) {
+		if flag == "-mod=vendor" || flag == "--mod=vendor" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // modulePath returns the module path of the current module using go/packages API.
 // Results are cached to avoid repeated package loading calls.
 func modulePath(ctx context.Context, dir string) (string, error) {
@@ -6,6 +6,8 @@
 package goenv
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -24,3 +26,43 @@ func TestGOMOD(t *testing.T) {
 		require.ErrorIs(t, err, ErrNoGoMod)
 	})
 }
+
+func TestGOWORK(t *testing.T) {
+	t.Run("workspace mode", func(t *testing.T) {
+		tmp := t.TempDir()
+		goWork := filepath.Join(tmp, "go.work")
+		require.NoError(t, os.WriteFile(goWork, []byte("go 1.23.0\n"), 0o644))
+		t.Setenv("GOWORK", "")
+
+		val, err := GOWORK(tmp)
+		require.NoError(t, err)
+		require.Equal(t, goWork, val)
+	})
+
+	t.Run("no GOWORK can be found", func(t *testing.T) {
+		val, err := GOWORK(t.TempDir())
+		require.Empty(t, val)
+		require.ErrorIs(t, err, ErrNoGoWork)
+	})
+}
+
+func TestOffline(t *testing.T) {
+	for name, env := range map[string]struct {
+		goProxy string
+		goFlags string
+		offline bool
+	}{
+		"online":      {goProxy: "https://proxy.golang.org,direct"},
+		"GOPROXY":     {goProxy: "off", offline: true},
+		"-mod=vendor": {goProxy: "https://proxy.golang.org,direct", goFlags: "-trimpath -mod=vendor", offline: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("GOPROXY", env.goProxy)
+			t.Setenv("GOFLAGS", env.goFlags)
+
+			offline, err := Offline(t.TempDir())
+			require.NoError(t, err)
+			require.Equal(t, env.offline, offline)
+		})
+	}
+}
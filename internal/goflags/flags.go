@@ -28,6 +28,12 @@ import (
 	"golang.org/x/tools/go/packages"
 )
 
+// EnvVarInnerToolexec is the environment variable holding a user-supplied
+// `-toolexec` command, which orchestrion runs the go toolchain's tools through
+// after it is done processing their arguments. It uses the same quoting rules
+// as the go command's `-toolexec` flag.
+const EnvVarInnerToolexec = "ORCHESTRION_INNER_TOOLEXEC"
+
 // CommandFlags represents the flags provided to a go command invocation
 type CommandFlags struct {
 	Long    map[string]string
@@ -119,6 +125,13 @@ func (f CommandFlags) Slice() []string {
 // and returns its flags. Direct arguments to the command are ignored. The value
 // of $GOFLAGS is also included in the returned flags.
 func ParseCommandFlags(ctx context.Context, wd string, args []string) (CommandFlags, error) {
+	flags, _, err := ParseCommandArgs(ctx, wd, args)
+	return flags, err
+}
+
+// ParseCommandArgs is like [ParseCommandFlags], but also returns the direct
+// (positional) arguments to the command, such as package patterns.
+func ParseCommandArgs(ctx context.Context, wd string, args []string) (CommandFlags, []string, error) {
 	log := zerolog.Ctx(ctx)
 
 	flags := CommandFlags{
@@ -209,11 +222,11 @@ func ParseCommandFlags(ctx context.Context, wd string, args []string) (CommandFl
 	}
 
 	if err := flags.inferCoverpkg(ctx, wd, positional); err != nil {
-		return flags, err
+		return flags, positional, err
 	}
 
-	log.Trace().Any("flags", flags).Msg("Parsed flags")
-	return flags, nil
+	log.Trace().Any("flags", flags).Strs("positional", positional).Msg("Parsed flags")
+	return flags, positional, nil
 }
 
 // inferCoverpkg will add the necessary `-coverpkg` argument if the `-cover` flags is present and
@@ -27,6 +27,19 @@ type (
 		Toolchain Toolchain
 		// Require is a list of all `require` directives' contents.
 		Require []Require
+		// Replace is a list of all `replace` directives' contents.
+		Replace []Replacement
+	}
+
+	// Replacement represents the content of a `replace` directive entry, as
+	// reported by `go mod edit -json`.
+	Replacement struct {
+		// Old is the module being replaced. Its version is blank if all versions
+		// are replaced.
+		Old Require
+		// New is the replacement module. Its version is blank if it is a local
+		// directory.
+		New Require
 	}
 
 	// Edit represents an edition that can be made to a `go.mod` file via `go mod edit`.
@@ -85,6 +98,17 @@ func (m *File) Requires(path string) (string, bool) {
 	return "", false
 }
 
+// Replaces returns true if the `go.mod` file contains a replace directive for
+// the designated module path.
+func (m *File) Replaces(path string) bool {
+	for _, r := range m.Replace {
+		if r.Old.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
 // commandEnv returns the environment for go subcommands that operate on an
 // explicit `-modfile`, starting from base (typically [os.Environ]).
 //
@@ -100,12 +124,23 @@ func commandEnv(base []string) []string {
 	return append(base, "GOTOOLCHAIN=local", "GOWORK=off")
 }
 
+// contextEnv returns the environment for go subcommands run with the provided
+// context, which is [commandEnv] with GOPROXY=off appended if the context is
+// [WithOffline].
+func contextEnv(ctx context.Context) []string {
+	env := commandEnv(os.Environ())
+	if IsOffline(ctx) {
+		env = append(env, "GOPROXY=off")
+	}
+	return env
+}
+
 // RunGet executes the `go get <modSpecs...>` subcommand with the provided
 // module specifications on the designated `go.mod` file.
 func RunGet(ctx context.Context, modfile string, modSpecs ...string) error {
 	cmd := exec.CommandContext(ctx, "go", "get", "-modfile", modfile)
 	cmd.Args = append(cmd.Args, modSpecs...)
-	cmd.Env = commandEnv(os.Environ())
+	cmd.Env = contextEnv(ctx)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -118,7 +153,7 @@ func RunGet(ctx context.Context, modfile string, modSpecs ...string) error {
 func Run(ctx context.Context, command string, modfile string, stdout io.Writer, args ...string) error {
 	cmd := exec.CommandContext(ctx, "go", "mod", command, "-modfile", modfile)
 	cmd.Args = append(cmd.Args, args...)
-	cmd.Env = commandEnv(os.Environ())
+	cmd.Env = contextEnv(ctx)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = stdout
 	cmd.Stderr = os.Stderr
@@ -145,6 +180,13 @@ func RunEdit(ctx context.Context, modfile string, edits ...Edit) error {
 		return fmt.Errorf("running `go mod tidy`: %w", err)
 	}
 
+	return Vendor(ctx, modfile)
+}
+
+// Vendor runs `go mod vendor` if the module of the designated `go.mod` file has
+// a `vendor` directory, so that it remains consistent with `go.mod` after it
+// was modified.
+func Vendor(ctx context.Context, modfile string) error {
 	vendorDir := filepath.Join(modfile, "..", "vendor")
 	stat, err := os.Stat(vendorDir)
 	if errors.Is(err, fs.ErrNotExist) || (err == nil && !stat.IsDir()) {
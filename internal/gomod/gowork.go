@@ -0,0 +1,67 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package gomod
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+type (
+	// Work represents some selected entries from the content of a `go.work` file.
+	Work struct {
+		// Go is the value of the `go` directive.
+		Go Version
+		// Use is a list of all `use` directives' contents.
+		Use []Use
+	}
+
+	// Use represents the target of a `use` directive entry.
+	Use struct {
+		// DiskPath is the path to the module's directory, as written in the
+		// `go.work` file. It is usually relative to the directory containing it.
+		DiskPath string
+	}
+)
+
+// ParseWork processes the contents of the designated `go.work` file using
+// `go work edit -json` and returns the corresponding parsed [Work].
+func ParseWork(ctx context.Context, workfile string) (Work, error) {
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", "work", "edit", "-json", workfile)
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return Work{}, fmt.Errorf("running `go work edit -json`: %w", err)
+	}
+
+	var work Work
+	if err := json.NewDecoder(&stdout).Decode(&work); err != nil {
+		return Work{}, fmt.Errorf("decoding output of `go work edit -json`: %w", err)
+	}
+
+	return work, nil
+}
+
+// ModFiles returns the absolute paths to the `go.mod` files of all modules
+// used by the workspace, given the path to its `go.work` file.
+func (w *Work) ModFiles(workfile string) []string {
+	res := make([]string, len(w.Use))
+	for i, use := range w.Use {
+		dir := filepath.FromSlash(use.DiskPath)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(workfile), dir)
+		}
+		res[i] = filepath.Join(dir, "go.mod")
+	}
+	return res
+}
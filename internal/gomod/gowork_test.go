@@ -0,0 +1,32 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package gomod
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWork(t *testing.T) {
+	tmp := t.TempDir()
+	external := t.TempDir()
+	goWork := filepath.Join(tmp, "go.work")
+	require.NoError(t, os.WriteFile(goWork, []byte("go 1.23.0\n\nuse (\n\t.\n\t./nested/mod\n\t"+external+"\n)\n"), 0o644))
+
+	work, err := ParseWork(context.Background(), goWork)
+	require.NoError(t, err)
+	assert.Equal(t, Version("1.23.0"), work.Go)
+	assert.Equal(t, []string{
+		filepath.Join(tmp, "go.mod"),
+		filepath.Join(tmp, "nested", "mod", "go.mod"),
+		filepath.Join(external, "go.mod"),
+	}, work.ModFiles(goWork))
+}
@@ -0,0 +1,91 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package gomod
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type offlineKey struct{}
+
+// WithOffline returns a context in which the go commands run by this package
+// do not access the network, so that modules are only resolved from the module
+// cache.
+func WithOffline(ctx context.Context) context.Context {
+	return context.WithValue(ctx, offlineKey{}, true)
+}
+
+// IsOffline returns true if the provided context was obtained from
+// [WithOffline].
+func IsOffline(ctx context.Context) bool {
+	offline, _ := ctx.Value(offlineKey{}).(bool)
+	return offline
+}
+
+// VendoredModule describes a module listed in a `vendor/modules.txt` file.
+type VendoredModule struct {
+	// Version is the version of the module, which is blank if the module is
+	// replaced by a local directory.
+	Version string
+	// Replace is the replacement of the module, if any. Its path is relative to
+	// the directory of the vendoring module if it is a local directory.
+	Replace Require
+}
+
+// VendoredModules returns the modules listed in the `vendor/modules.txt` file
+// of the module whose `go.mod` file is provided, keyed by module path. The
+// error wraps [fs.ErrNotExist] if the module is not vendored.
+func VendoredModules(modfile string) (map[string]VendoredModule, error) {
+	filename := filepath.Join(modfile, "..", "vendor", "modules.txt")
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", filename, err)
+	}
+	defer file.Close()
+
+	modules := make(map[string]VendoredModule)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Module lines are formatted as "# path [version] [=> replacement [version]]";
+		// other lines starting with "##" are annotations about the preceding module.
+		line, found := strings.CutPrefix(scanner.Text(), "# ")
+		if !found {
+			continue
+		}
+		module, replace, _ := strings.Cut(line, "=>")
+		fields := strings.Fields(module)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var mod VendoredModule
+		if len(fields) > 1 {
+			mod.Version = fields[1]
+		}
+		if fields := strings.Fields(replace); len(fields) > 0 {
+			mod.Replace.Path = fields[0]
+			if len(fields) > 1 {
+				mod.Replace.Version = fields[1]
+			}
+		}
+		// Replacements are listed both with and without the version; the former
+		// is the one that carries the most information.
+		if prev, found := modules[fields[0]]; found && prev.Version != "" {
+			continue
+		}
+		modules[fields[0]] = mod
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %q: %w", filename, err)
+	}
+
+	return modules, nil
+}
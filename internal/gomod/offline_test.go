@@ -0,0 +1,61 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package gomod
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffline(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, IsOffline(ctx))
+	assert.True(t, IsOffline(WithOffline(ctx)))
+	assert.Equal(t, "off", lastValue(contextEnv(WithOffline(ctx)), "GOPROXY"))
+}
+
+func TestVendoredModules(t *testing.T) {
+	tmp := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(tmp, "vendor"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "vendor", "modules.txt"), []byte(`# example.com/plain v1.2.3
+## explicit; go 1.23
+example.com/plain
+# example.com/local v0.0.0 => ../local
+## explicit; go 1.23
+example.com/local
+# example.com/fork v1.0.0 => example.com/other v1.1.0
+## explicit
+example.com/fork
+# example.com/local => ../local
+`), 0o644))
+
+	modules, err := VendoredModules(filepath.Join(tmp, "go.mod"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]VendoredModule{
+		"example.com/plain": {Version: "v1.2.3"},
+		"example.com/local": {Version: "v0.0.0", Replace: Require{Path: "../local"}},
+		"example.com/fork":  {Version: "v1.0.0", Replace: Require{Path: "example.com/other", Version: "v1.1.0"}},
+	}, modules)
+
+	_, err = VendoredModules(filepath.Join(t.TempDir(), "go.mod"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func lastValue(env []string, key string) string {
+	var val string
+	for _, e := range env {
+		if k, v, ok := strings.Cut(e, "="); ok && k == key {
+			val = v
+		}
+	}
+	return val
+}
@@ -8,15 +8,19 @@ package goproxy
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/binpath"
+	"github.com/DataDog/orchestrion/internal/cacheprog"
 	"github.com/DataDog/orchestrion/internal/goenv"
 	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/jobserver"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/events"
 	"github.com/DataDog/orchestrion/internal/traceutil"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
@@ -24,6 +28,14 @@ import (
 
 type config struct {
 	toolexec string
+	// onEvent receives build events published by the job server, if not nil.
+	onEvent func(events.Event)
+	// stopEvents ends the build events subscription, once all events have been
+	// delivered to onEvent. It is nil if there is no such subscription.
+	stopEvents func()
+	stderr     io.Writer
+	// env lists additional environment variables set for the command.
+	env []string
 }
 
 type Option func(*config)
@@ -54,14 +66,43 @@ func WithToolexec(bin string, args ...string) Option {
 	}
 }
 
+// WithBuildEvents subscribes the handler to the build events published by the
+// job server while the command runs (see [events.Event]). It has no effect
+// unless the command is run with -toolexec. All events are delivered before
+// [Run] returns.
+func WithBuildEvents(handler func(events.Event)) Option {
+	return func(c *config) {
+		c.onEvent = handler
+	}
+}
+
+// WithStderr sets the writer the command's standard error is sent to, instead
+// of [os.Stderr].
+func WithStderr(w io.Writer) Option {
+	return func(c *config) {
+		c.stderr = w
+	}
+}
+
+// WithEnv sets additional environment variables (in the "KEY=value" form) for
+// the command.
+func WithEnv(vars ...string) Option {
+	return func(c *config) {
+		c.env = append(c.env, vars...)
+	}
+}
+
 // BuildCmd returns a new exec.BuildCmd that will run the given goArgs, with the given opts applied.
 func BuildCmd(ctx context.Context, goArgs []string, opts ...Option) (*exec.Cmd, error) {
-	log := zerolog.Ctx(ctx)
-
 	var cfg config
 	for _, opt := range opts {
 		opt(&cfg)
 	}
+	return buildCmd(ctx, goArgs, &cfg)
+}
+
+func buildCmd(ctx context.Context, goArgs []string, cfg *config) (*exec.Cmd, error) {
+	log := zerolog.Ctx(ctx)
 
 	goArgs, err := processDashC(ctx, goArgs)
 	if err != nil {
@@ -85,13 +126,24 @@ func BuildCmd(ctx context.Context, goArgs []string, opts ...Option) (*exec.Cmd,
 	var (
 		server         *jobserver.Server
 		serverStartErr error
-		env            = os.Environ()
+		env            = append(os.Environ(), cfg.env...)
 	)
 	if len(argv) > 1 {
 		switch cmd := argv[1]; cmd {
 		// "go build" arguments are shared by build, clean, get, install, list, run, and test.
 		case "build", "clean", "get", "install", "list", "run", "test":
 			if cfg.toolexec != "" {
+				// The go command only honors the last -toolexec flag, so a user-supplied
+				// one is removed, and chained behind ours instead.
+				rest, inner, err := extractToolexec(ctx, argv[2:], os.Getenv("GOFLAGS"))
+				if err != nil {
+					return nil, err
+				}
+				argv = append(argv[:2], rest...)
+				if inner != "" {
+					env = append(env, fmt.Sprintf("%s=%s", goflags.EnvVarInnerToolexec, inner))
+				}
+
 				log.Debug().Str("-toolexec", cfg.toolexec).Msg("Adding -toolexec argument")
 
 				oldLen := len(argv)
@@ -108,7 +160,10 @@ func BuildCmd(ctx context.Context, goArgs []string, opts ...Option) (*exec.Cmd,
 				go func() {
 					// We'll need a job server to support toolexec operations
 					log.Debug().Msg("Initializing job server")
-					server, serverStartErr = jobserver.New(ctx, nil)
+					var opts *jobserver.Options
+					if opts, serverStartErr = jobserver.OptionsFromEnvironment(); serverStartErr == nil {
+						server, serverStartErr = jobserver.New(ctx, opts)
+					}
 					if serverStartErr != nil {
 						log.Error().Err(serverStartErr).Msg("Failed to start job server")
 						close(serverStarted)
@@ -118,7 +173,7 @@ func BuildCmd(ctx context.Context, goArgs []string, opts ...Option) (*exec.Cmd,
 					defer func() {
 						log.Debug().Msg("Shutting down job server")
 						server.Shutdown()
-						log.Trace().Msg(server.CacheStats.String())
+						log.Trace().Msg(server.Stats.Aggregate().String())
 						log.Debug().Msg("Job server shut down complete")
 					}()
 					close(serverStarted)
@@ -137,10 +192,24 @@ func BuildCmd(ctx context.Context, goArgs []string, opts ...Option) (*exec.Cmd,
 				if serverStartErr == nil {
 					log.Debug().Str("url", server.ClientURL()).Msg("Setting job server URL in environment")
 					env = append(env, fmt.Sprintf("%s=%s", client.EnvVarJobserverURL, server.ClientURL()))
+
+					if cfg.onEvent != nil {
+						if cfg.stopEvents, err = server.SubscribeBuildEvents(ctx, cfg.onEvent); err != nil {
+							return nil, fmt.Errorf("subscribing to build events: %w", err)
+						}
+					}
 				}
 
 				// Set the process' goflags, since we know them already...
 				goflags.SetFlags(ctx, "", argv[1:])
+
+				if backend := os.Getenv(cacheprog.EnvVarBackend); backend != "" {
+					if prog := os.Getenv("GOCACHEPROG"); prog != "" {
+						log.Warn().Str("GOCACHEPROG", prog).Msgf("Replacing GOCACHEPROG as %s is set; use %s=prog:<command> to chain to it", cacheprog.EnvVarBackend, cacheprog.EnvVarBackend)
+					}
+					log.Debug().Str(cacheprog.EnvVarBackend, backend).Msg("Using orchestrion as GOCACHEPROG")
+					env = append(env, fmt.Sprintf("GOCACHEPROG=%q cacheprog", binpath.Orchestrion))
+				}
 			}
 		}
 	}
@@ -154,6 +223,9 @@ func BuildCmd(ctx context.Context, goArgs []string, opts ...Option) (*exec.Cmd,
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	if cfg.stderr != nil {
+		cmd.Stderr = cfg.stderr
+	}
 
 	return cmd, nil
 }
@@ -165,10 +237,19 @@ func Run(ctx context.Context, goArgs []string, opts ...Option) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	cmd, err := BuildCmd(ctx, goArgs, opts...)
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cmd, err := buildCmd(ctx, goArgs, &cfg)
 	if err != nil {
 		return fmt.Errorf("building command: %w", err)
 	}
+	if cfg.stopEvents != nil {
+		// Deliver all build events before returning, as the job server shuts down
+		// when the context is canceled.
+		defer cfg.stopEvents()
+	}
 
 	span, _ := tracer.StartSpanFromContext(ctx, "exec",
 		tracer.ResourceName(cmd.String()),
@@ -0,0 +1,114 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package goproxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/binpath"
+	"github.com/DataDog/orchestrion/internal/goflags/quoted"
+	"github.com/rs/zerolog"
+)
+
+// extractToolexec gets the command line arguments passed to a "go" command
+// (without "go" itself, starting with the command name), and removes any
+// `-toolexec` flag from it, as orchestrion's own `-toolexec` must be the one the
+// go command uses. It returns the remaining arguments, and the user-supplied
+// `-toolexec` command, which is looked up in goFlags (the value of $GOFLAGS) if
+// it is not present in the arguments. A `-toolexec` command that designates
+// orchestrion itself is ignored.
+func extractToolexec(ctx context.Context, args []string, goFlags string) ([]string, string, error) {
+	log := zerolog.Ctx(ctx)
+
+	var (
+		toolexec string
+		found    bool
+		rest     = make([]string, 0, len(args))
+	)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			// Anything after "--" is not for the go command.
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		normArg := arg
+		if strings.HasPrefix(arg, "--") {
+			normArg = arg[1:]
+		}
+		switch {
+		case normArg == "-toolexec" && i+1 < len(args):
+			toolexec, found = args[i+1], true
+			i++
+		case strings.HasPrefix(normArg, "-toolexec="):
+			toolexec, found = normArg[len("-toolexec="):], true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	if !found {
+		// The go command only accepts the "-flag=value" form in GOFLAGS.
+		fields, err := quoted.Split(goFlags)
+		if err != nil {
+			return nil, "", fmt.Errorf("parsing GOFLAGS=%q: %w", goFlags, err)
+		}
+		for _, field := range fields {
+			if strings.HasPrefix(field, "--") {
+				field = field[1:]
+			}
+			if val, ok := strings.CutPrefix(field, "-toolexec="); ok {
+				toolexec = val
+			}
+		}
+	}
+
+	words, err := quoted.Split(toolexec)
+	if err != nil {
+		return nil, "", fmt.Errorf("parsing -toolexec=%q: %w", toolexec, err)
+	}
+	if len(words) == 0 {
+		return rest, "", nil
+	}
+	if isOrchestrion(words[0]) {
+		log.Debug().Str("-toolexec", toolexec).Msg("Ignoring -toolexec flag designating orchestrion")
+		return rest, "", nil
+	}
+
+	log.Debug().Str("-toolexec", toolexec).Msg("Chaining user-supplied -toolexec behind orchestrion")
+	return rest, toolexec, nil
+}
+
+// isOrchestrion returns true if the provided command designates an orchestrion
+// binary, either because it is the currently running one, or because of its
+// name.
+func isOrchestrion(cmd string) bool {
+	name := strings.TrimSuffix(filepath.Base(cmd), ".exe")
+	if name == "orchestrion" {
+		return true
+	}
+
+	path := cmd
+	if !filepath.IsAbs(path) && !strings.ContainsRune(path, filepath.Separator) {
+		// Not a path, so it'd be looked up in $PATH, and it is not named
+		// "orchestrion"...
+		return false
+	}
+	cmdInfo, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	selfInfo, err := os.Stat(binpath.Orchestrion)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(cmdInfo, selfInfo)
+}
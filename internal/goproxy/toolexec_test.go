@@ -0,0 +1,80 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package goproxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/binpath"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractToolexec(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args     []string
+		goFlags  string
+		rest     []string
+		toolexec string
+	}{
+		"none": {
+			args: []string{"build", "-o", "bin", "."},
+			rest: []string{"build", "-o", "bin", "."},
+		},
+		"separate": {
+			args:     []string{"build", "-toolexec", "wrapper -v", "."},
+			rest:     []string{"build", "."},
+			toolexec: "wrapper -v",
+		},
+		"assigned": {
+			args:     []string{"test", "--toolexec='/path to/wrapper' -v", "./..."},
+			rest:     []string{"test", "./..."},
+			toolexec: "'/path to/wrapper' -v",
+		},
+		"last-wins": {
+			args:     []string{"build", "-toolexec=first", "-toolexec", "second", "."},
+			rest:     []string{"build", "."},
+			toolexec: "second",
+		},
+		"after-dash-dash": {
+			args: []string{"run", ".", "--", "-toolexec", "arg"},
+			rest: []string{"run", ".", "--", "-toolexec", "arg"},
+		},
+		"goflags": {
+			args:     []string{"build", "."},
+			goFlags:  "-trimpath '-toolexec=wrapper -v'",
+			rest:     []string{"build", "."},
+			toolexec: "wrapper -v",
+		},
+		"args-over-goflags": {
+			args:     []string{"build", "-toolexec=wrapper", "."},
+			goFlags:  "-toolexec=other",
+			rest:     []string{"build", "."},
+			toolexec: "wrapper",
+		},
+		"orchestrion": {
+			args:    []string{"build", "."},
+			goFlags: "'-toolexec=orchestrion toolexec'",
+			rest:    []string{"build", "."},
+		},
+		"self": {
+			args: []string{"build", "-toolexec", binpath.Orchestrion + " toolexec", "."},
+			rest: []string{"build", "."},
+		},
+		"empty": {
+			args: []string{"build", "-toolexec=", "."},
+			rest: []string{"build", "."},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rest, toolexec, err := extractToolexec(context.Background(), tc.args, tc.goFlags)
+			require.NoError(t, err)
+			assert.Equal(t, tc.rest, rest)
+			assert.Equal(t, tc.toolexec, toolexec)
+		})
+	}
+}
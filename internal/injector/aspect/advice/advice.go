@@ -8,6 +8,8 @@
 package advice
 
 import (
+	"fmt"
+
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 )
@@ -40,3 +42,30 @@ type OrderableAdvice interface {
 	// Namespace returns the logical grouping namespace for this advice.
 	Namespace() string
 }
+
+// Kind returns the name of the provided advice's kind, as used in configuration
+// documents (e.g, "wrap-expression").
+func Kind(a Advice) string {
+	switch a := a.(type) {
+	case *OrderedAdvice:
+		return Kind(a.Advice)
+	case *assignValue:
+		return "assign-value"
+	case *prependStatements:
+		return "prepend-statements"
+	case *appendArgs:
+		return "append-args"
+	case *redirectCall:
+		return "replace-function"
+	case addBlankImport:
+		return "add-blank-import"
+	case injectDeclarations:
+		return "inject-declarations"
+	case *addStructField:
+		return "add-struct-field"
+	case *wrapExpression:
+		return "wrap-expression"
+	default:
+		return fmt.Sprintf("%T", a)
+	}
+}
@@ -27,6 +27,17 @@ type Aspect struct {
 	TracerInternal bool
 	// ID is the identifier of the aspect within its configuration file.
 	ID string
+
+	// source is the generic representation of the YAML document this aspect was
+	// decoded from, if any.
+	source any
+}
+
+// Source returns the generic representation (maps, slices and scalars) of the
+// YAML document this aspect was decoded from, with all aliases resolved. It
+// returns nil for aspects that were constructed programmatically.
+func (a *Aspect) Source() any {
+	return a.source
 }
 
 func (a *Aspect) Hash(h *fingerprint.Hasher) error {
@@ -123,7 +134,8 @@ func (a *Aspect) UnmarshalYAML(ctx context.Context, node ast.Node) error {
 		a.Advice = []advice.Advice{adv}
 	}
 
-	return nil
+	// Retain the source document so the aspect can be serialized again later on.
+	return yaml.NodeToValueContext(ctx, node, &a.source)
 }
 
 var (
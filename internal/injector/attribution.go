@@ -0,0 +1,151 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package injector
+
+import (
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"reflect"
+
+	"github.com/DataDog/orchestrion/internal/injector/aspect/advice"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/DataDog/orchestrion/internal/injector/attribution"
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+)
+
+type (
+	// attributor records which advice introduced which nodes in a file, so that
+	// an [attribution.Manifest] can be produced once the file is written.
+	attributor struct {
+		decorator *decorator.Decorator
+		// original is the token file of the source file being modified.
+		original *token.File
+		// origins maps synthetic nodes to the advice that introduced them.
+		origins map[dst.Node]origin
+	}
+
+	origin struct {
+		aspect string
+		advice string
+	}
+)
+
+func newAttributor(decorator *decorator.Decorator, file *dst.File) *attributor {
+	var original *token.File
+	if astFile := decorator.Ast.Nodes[file]; astFile != nil {
+		original = decorator.Fset.File(astFile.Pos())
+	}
+	return &attributor{
+		decorator: decorator,
+		original:  original,
+		origins:   make(map[dst.Node]origin),
+	}
+}
+
+// record attributes all synthetic nodes reachable from the advised node, as well
+// as synthetic top-level declarations, to the provided advice, unless they were
+// already attributed to a previously applied advice.
+func (a *attributor) record(ctx context.AdviceContext, act *advice.OrderedAdvice) {
+	if a == nil {
+		return
+	}
+
+	o := origin{aspect: act.AspectID, advice: advice.Kind(act.Advice)}
+	visit := func(node dst.Node) bool {
+		if node == nil {
+			return false
+		}
+		if _, found := a.origins[node]; !found && !a.isOriginal(node) {
+			a.origins[node] = o
+		}
+		return true
+	}
+
+	dst.Inspect(ctx.Node(), visit)
+	for _, decl := range ctx.File().Decls {
+		if !a.isOriginal(decl) {
+			dst.Inspect(decl, visit)
+		}
+	}
+}
+
+// isOriginal returns true if the node was parsed from the source file being
+// modified, as opposed to having been produced by a code template.
+func (a *attributor) isOriginal(node dst.Node) bool {
+	astNode := a.decorator.Ast.Nodes[node]
+	if astNode == nil || !astNode.Pos().IsValid() {
+		return false
+	}
+	return a.decorator.Fset.File(astNode.Pos()) == a.original
+}
+
+// manifest computes the line ranges of the attributed nodes in the output
+// source. Positions in the restorer's file set do not necessarily match the
+// formatted output, so the output is parsed again and its nodes are matched
+// with the restored ones by traversal order.
+func (a *attributor) manifest(restorer *decorator.FileRestorer, restored *ast.File, output []byte) (attribution.Manifest, error) {
+	var manifest attribution.Manifest
+	if a == nil || len(a.origins) == 0 {
+		return manifest, nil
+	}
+
+	fset := token.NewFileSet()
+	reparsed, err := goparser.ParseFile(fset, "", output, goparser.ParseComments|goparser.SkipObjectResolution)
+	if err != nil {
+		return manifest, fmt.Errorf("parsing output: %w", err)
+	}
+
+	restoredNodes, reparsedNodes := preorder(restored), preorder(reparsed)
+	if len(restoredNodes) != len(reparsedNodes) {
+		return manifest, fmt.Errorf("output has %d nodes, expected %d", len(reparsedNodes), len(restoredNodes))
+	}
+	index := make(map[ast.Node]int, len(restoredNodes))
+	for idx, node := range restoredNodes {
+		index[node] = idx
+	}
+
+	for node, o := range a.origins {
+		astNode := restorer.Ast.Nodes[node]
+		idx, found := index[astNode]
+		if !found {
+			// The node was removed by a subsequent advice.
+			continue
+		}
+		outNode := reparsedNodes[idx]
+		if reflect.TypeOf(outNode) != reflect.TypeOf(astNode) {
+			return attribution.Manifest{}, fmt.Errorf("output node %d is a %T, expected %T", idx, outNode, astNode)
+		}
+		manifest.Ranges = append(manifest.Ranges, attribution.Range{
+			StartLine: fset.PositionFor(outNode.Pos(), false).Line,
+			EndLine:   fset.PositionFor(outNode.End(), false).Line,
+			Aspect:    o.aspect,
+			Advice:    o.advice,
+		})
+	}
+	manifest.Normalize()
+
+	return manifest, nil
+}
+
+// preorder lists all nodes of the file in traversal order, excluding comments
+// as those may be attached differently after formatting.
+func preorder(file *ast.File) []ast.Node {
+	var nodes []ast.Node
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch node.(type) {
+		case nil:
+			return false
+		case *ast.CommentGroup, *ast.Comment:
+			return false
+		}
+		nodes = append(nodes, node)
+		return true
+	})
+	return nodes
+}
@@ -0,0 +1,114 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package attribution defines the sidecar manifest written next to modified
+// source files, which records which aspect produced which lines of the file.
+package attribution
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+)
+
+// sidecarSuffix is appended to the name of a modified file to obtain the name of
+// its attribution manifest.
+const sidecarSuffix = ".aspects.json"
+
+type (
+	// Manifest maps line ranges of a modified file to the aspects that produced
+	// them.
+	Manifest struct {
+		// Ranges are sorted by start line, then end line.
+		Ranges []Range `json:"ranges"`
+	}
+
+	// Range is a range of lines of a modified file that was produced by a
+	// particular advice of an aspect.
+	Range struct {
+		// StartLine is the 1-based first line of the range.
+		StartLine int `json:"startLine"`
+		// EndLine is the 1-based last line of the range (inclusive).
+		EndLine int `json:"endLine"`
+		// Aspect is the ID of the aspect that produced the range.
+		Aspect string `json:"aspect"`
+		// Advice is the kind of advice that produced the range, such as
+		// "wrap-expression".
+		Advice string `json:"advice"`
+	}
+)
+
+// SidecarPath returns the path of the manifest for the provided modified file.
+func SidecarPath(modifiedFile string) string {
+	return modifiedFile + sidecarSuffix
+}
+
+// Write writes the manifest for the provided modified file.
+func Write(modifiedFile string, manifest Manifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(SidecarPath(modifiedFile), data, 0o644)
+}
+
+// Read reads the manifest for the provided modified file from fsys. It returns
+// an empty manifest and no error if there is none.
+func Read(fsys fs.FS, modifiedFile string) (Manifest, error) {
+	data, err := fs.ReadFile(fsys, SidecarPath(modifiedFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Manifest{}, nil
+	}
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return Manifest{}, fmt.Errorf("decoding %s: %w", SidecarPath(modifiedFile), err)
+	}
+	return manifest, nil
+}
+
+// At returns all ranges containing the provided line.
+func (m Manifest) At(line int) []Range {
+	var res []Range
+	for _, r := range m.Ranges {
+		if r.StartLine > line {
+			break
+		}
+		if r.EndLine >= line {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// Normalize sorts the ranges and merges overlapping or adjacent ranges that
+// were produced by the same advice of the same aspect.
+func (m *Manifest) Normalize() {
+	slices.SortFunc(m.Ranges, func(l, r Range) int {
+		if l.StartLine != r.StartLine {
+			return l.StartLine - r.StartLine
+		}
+		return l.EndLine - r.EndLine
+	})
+
+	merged := m.Ranges[:0]
+	for _, r := range m.Ranges {
+		idx := slices.IndexFunc(merged, func(prev Range) bool {
+			return prev.Aspect == r.Aspect && prev.Advice == r.Advice && prev.EndLine+1 >= r.StartLine
+		})
+		if idx < 0 {
+			merged = append(merged, r)
+			continue
+		}
+		merged[idx].EndLine = max(merged[idx].EndLine, r.EndLine)
+	}
+	m.Ranges = merged
+}
@@ -0,0 +1,124 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package injector_test
+
+import (
+	gocontext "context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/injector"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/attribution"
+	"github.com/DataDog/orchestrion/internal/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestAttributionManifest(t *testing.T) {
+	tmp := t.TempDir()
+	runGo(t, tmp, "mod", "init", testModuleName)
+
+	inputFile := filepath.Join(tmp, "input.go")
+	require.NoError(t, os.WriteFile(inputFile, []byte(strings.Join([]string{
+		"package main",
+		"",
+		`import "fmt"`,
+		"",
+		"func main() {",
+		`	fmt.Println("Hello")`,
+		"}",
+		"",
+	}, "\n")), 0o644))
+
+	var aspects []*aspect.Aspect
+	require.NoError(t, yaml.UnmarshalContext(gocontext.Background(), strings.NewReader(`
+- id: prepend
+  join-point:
+    function-body:
+      function:
+        - name: main
+  advice:
+    prepend-statements:
+      template: println("prepended")
+- id: wrap
+  join-point:
+    function-call: fmt.Println
+  advice:
+    wrap-expression:
+      template: |-
+        func() (int, error) {
+          println("wrapped")
+          return {{ . }}
+        }()
+- id: declare
+  join-point:
+    function-body:
+      function:
+        - name: main
+  advice:
+    inject-declarations:
+      template: func injected() {}
+`), &aspects))
+
+	outDir := filepath.Join(tmp, "out")
+	inj := injector.Injector{
+		ImportPath:          testModuleName,
+		ImportMap:           map[string]string{"fmt": ""},
+		AttributionManifest: true,
+		ModifiedFile:        func(path string) string { return filepath.Join(outDir, filepath.Base(path)) },
+		Lookup: func(path string) (io.ReadCloser, error) {
+			pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedExportFile, Dir: tmp}, path)
+			if err != nil {
+				return nil, err
+			}
+			if pkgs[0].ExportFile == "" {
+				return nil, fmt.Errorf("no export file found for %q", path)
+			}
+			return os.Open(pkgs[0].ExportFile)
+		},
+	}
+
+	res, _, err := inj.InjectFiles(gocontext.Background(), []string{inputFile}, aspects)
+	require.NoError(t, err)
+	require.Contains(t, res, inputFile)
+	assert.Equal(t, []string{"declare", "prepend", "wrap"}, res[inputFile].Aspects)
+
+	modified := res[inputFile].Filename
+	content, err := os.ReadFile(modified)
+	require.NoError(t, err)
+	lines := strings.Split(string(content), "\n")
+
+	manifest, err := attribution.Read(os.DirFS("/"), strings.TrimPrefix(filepath.ToSlash(modified), "/"))
+	require.NoError(t, err)
+	require.NotEmpty(t, manifest.Ranges)
+
+	// Every line containing injected code must be attributed to the aspect that produced it.
+	attributed := func(needle string) []string {
+		for idx, line := range lines {
+			if !strings.Contains(line, needle) {
+				continue
+			}
+			var ids []string
+			for _, r := range manifest.At(idx + 1) {
+				ids = append(ids, r.Aspect+"/"+r.Advice)
+			}
+			return ids
+		}
+		t.Fatalf("%q not found in modified file:\n%s", needle, content)
+		return nil
+	}
+
+	assert.Equal(t, []string{"prepend/prepend-statements"}, attributed(`println("prepended")`))
+	assert.Equal(t, []string{"wrap/wrap-expression"}, attributed(`println("wrapped")`))
+	assert.Equal(t, []string{"declare/inject-declarations"}, attributed("func injected()"))
+	assert.Empty(t, attributed("func main()"))
+}
@@ -0,0 +1,100 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package injector_test
+
+import (
+	gocontext "context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/injector"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestInjectFilesConcurrency(t *testing.T) {
+	tmp := t.TempDir()
+	runGo(t, tmp, "mod", "init", testModuleName)
+
+	const fileCount = 32
+	files := make([]string, fileCount)
+	for idx := range files {
+		files[idx] = filepath.Join(tmp, fmt.Sprintf("file%02d.go", idx))
+		content := fmt.Sprintf("package main\n\nimport \"fmt\"\n\nfunc f%02d() {\n\tfmt.Println(%d)\n}\n", idx, idx)
+		if idx%2 == 0 {
+			// Only half of the files are modified.
+			content = fmt.Sprintf("package main\n\nfunc f%02d() {}\n", idx)
+		}
+		require.NoError(t, os.WriteFile(files[idx], []byte(content), 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+
+	var aspects []*aspect.Aspect
+	require.NoError(t, yaml.UnmarshalContext(gocontext.Background(), strings.NewReader(`
+- id: wrap
+  join-point:
+    function-call: fmt.Println
+  advice:
+    wrap-expression:
+      imports:
+        strconv: strconv
+      template: |-
+        func() (int, error) {
+          println(strconv.Itoa(42))
+          return {{ . }}
+        }()
+`), &aspects))
+
+	inject := func(concurrency int) (map[string]injector.InjectedFile, map[string]string) {
+		outDir := t.TempDir()
+		inj := injector.Injector{
+			ImportPath:   testModuleName,
+			ImportMap:    map[string]string{"fmt": ""},
+			Concurrency:  concurrency,
+			ModifiedFile: func(path string) string { return filepath.Join(outDir, filepath.Base(path)) },
+			Lookup: func(path string) (io.ReadCloser, error) {
+				pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedExportFile, Dir: tmp}, path)
+				if err != nil {
+					return nil, err
+				}
+				if pkgs[0].ExportFile == "" {
+					return nil, fmt.Errorf("no export file found for %q", path)
+				}
+				return os.Open(pkgs[0].ExportFile)
+			},
+		}
+
+		res, _, err := inj.InjectFiles(gocontext.Background(), files, aspects)
+		require.NoError(t, err)
+
+		contents := make(map[string]string, len(res))
+		for original, modified := range res {
+			data, err := os.ReadFile(modified.Filename)
+			require.NoError(t, err)
+			contents[original] = string(data)
+		}
+		return res, contents
+	}
+
+	sequential, sequentialContents := inject(1)
+	require.Len(t, sequential, fileCount/2)
+
+	concurrent, concurrentContents := inject(8)
+	require.Len(t, concurrent, len(sequential))
+	assert.Equal(t, sequentialContents, concurrentContents)
+	for original, expected := range sequential {
+		actual := concurrent[original]
+		assert.Equal(t, expected.Aspects, actual.Aspects, original)
+		assert.Equal(t, expected.References.Map(), actual.References.Map(), original)
+	}
+}
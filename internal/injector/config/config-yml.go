@@ -17,6 +17,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/injector/aspect"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/goccy/go-yaml/ast"
+	"golang.org/x/tools/go/packages"
 )
 
 const FilenameOrchestrionYML = "orchestrion.yml"
@@ -53,19 +54,38 @@ func (l *Loader) loadYMLFile(ctx context.Context, dir string, name string) (_ *c
 	for _, ext := range yml.Extends {
 		extFilename := filepath.Join(dir, ext)
 
-		if stat, err := os.Stat(extFilename); err != nil {
-			return nil, maskErrNotExist(err)
-		} else if stat.IsDir() {
-			pkgs, err := l.packages(ctx, extFilename)
-			if err != nil {
+		stat, err := os.Stat(extFilename)
+		var importPath string
+		if errors.Is(err, fs.ErrNotExist) {
+			// The target may not have been copied by `go mod vendor`.
+			var unvendored string
+			if unvendored, importPath, err = unvendoredPath(extFilename); err != nil {
 				return nil, fmt.Errorf("extends %q: %w", ext, err)
 			}
-			if len(pkgs) != 1 {
-				// This is not supposed to happen if `err == nil`.
-				panic(fmt.Errorf("extends %q: no package returned by packages.Load(%q)", ext, l.dir))
+			if importPath != "" {
+				extFilename = unvendored
+			}
+			stat, err = os.Stat(extFilename)
+		}
+		if err != nil {
+			return nil, maskErrNotExist(err)
+		} else if stat.IsDir() {
+			var pkg *packages.Package
+			if importPath != "" {
+				pkg = unvendoredPackage(extFilename, importPath)
+			} else {
+				pkgs, err := l.packages(ctx, extFilename)
+				if err != nil {
+					return nil, fmt.Errorf("extends %q: %w", ext, err)
+				}
+				if len(pkgs) != 1 {
+					// This is not supposed to happen if `err == nil`.
+					panic(fmt.Errorf("extends %q: no package returned by packages.Load(%q)", ext, l.dir))
+				}
+				pkg = pkgs[0]
 			}
 
-			cfg, err := l.loadGoPackage(ctx, pkgs[0])
+			cfg, err := l.loadGoPackage(ctx, pkg)
 			if err != nil {
 				return nil, maskErrNotExist(err)
 			}
@@ -77,7 +97,11 @@ func (l *Loader) loadYMLFile(ctx context.Context, dir string, name string) (_ *c
 			continue
 		}
 
-		cfg, err := l.loadYMLFile(ctx, dir, ext)
+		name := ext
+		if importPath != "" {
+			name = extFilename
+		}
+		cfg, err := l.loadYMLFile(ctx, dir, name)
 		if err != nil {
 			return nil, maskErrNotExist(err)
 		}
@@ -93,6 +117,7 @@ func (l *Loader) loadYMLFile(ctx context.Context, dir string, name string) (_ *c
 	cfg.meta.description = yml.Meta.Description
 	cfg.meta.icon = yml.Meta.Icon
 	cfg.meta.caveats = yml.Meta.Caveats
+	cfg.meta.supports = yml.Meta.Supports
 
 	return cfg, nil
 }
@@ -109,6 +134,7 @@ type (
 		description string
 		icon        string
 		caveats     string
+		supports    map[string]VersionRange
 	}
 )
 
@@ -154,12 +180,17 @@ type ymlFile struct {
 	Meta    struct {
 		Name        string
 		Description string
-		Icon        string // Optional
-		Caveats     string // Optional
+		Icon        string                  // Optional
+		Caveats     string                  // Optional
+		Supports    map[string]VersionRange // Optional
 	}
 }
 
 func (l *Loader) parseYMLFile(ctx context.Context, filename string) (*ymlFile, error) {
+	if l.diagnostics != nil {
+		return l.diagnoseYMLFile(ctx, filename)
+	}
+
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("open %q: %w", filename, err)
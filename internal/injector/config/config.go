@@ -9,10 +9,14 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"path/filepath"
 	"strings"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
 	"github.com/DataDog/orchestrion/internal/injector/aspect"
 	"golang.org/x/tools/go/packages"
 )
@@ -47,12 +51,44 @@ func HasConfig(ctx context.Context, pkgLoader PackageLoader, pkg *packages.Packa
 	return cfg.yaml != nil || len(cfg.imports) != 0, nil
 }
 
+// Describe returns the [File] of the [FilenameOrchestrionYML] document of the
+// specified package, which carries its metadata and own aspects. The
+// configuration it extends is not loaded. It returns nil if the package has no
+// such document.
+func Describe(ctx context.Context, pkg *packages.Package) (File, error) {
+	root := packageRoot(pkg)
+	if root == "" {
+		return nil, nil
+	}
+
+	filename := filepath.Join(root, FilenameOrchestrionYML)
+	yml, err := NewLoader(nil, root, false).parseYMLFile(ctx, filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &configYML{name: FilenameOrchestrionYML, aspects: yml.Aspects}
+	cfg.meta.name = yml.Meta.Name
+	cfg.meta.description = yml.Meta.Description
+	cfg.meta.icon = yml.Meta.Icon
+	cfg.meta.caveats = yml.Meta.Caveats
+	cfg.meta.supports = yml.Meta.Supports
+	return cfg, nil
+}
+
 // Loader is a facility to load configuration from available sources.
 type Loader struct {
 	pkgLoader PackageLoader
 	loaded    map[string]struct{}
 	dir       string
 	validate  bool
+
+	// diagnostics is non-nil while [Loader.Diagnose] is running, and collects
+	// problems found in YAML documents.
+	diagnostics *[]Diagnostic
 }
 
 func defaultPackageLoader(ctx context.Context, dir string, patterns ...string) ([]*packages.Package, error) {
@@ -108,7 +144,40 @@ func (l *Loader) Load(ctx context.Context) (_ Config, err error) {
 		panic(fmt.Errorf("no package returned by packages.Load(%q)", l.dir))
 	}
 
-	return l.loadGoPackage(ctx, pkgs[0])
+	cfg, err := l.loadGoPackage(ctx, pkgs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	wsCfgs, err := l.loadWorkspace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(wsCfgs) == 0 {
+		return cfg, nil
+	}
+	return &configGo{imports: append([]Config{cfg}, wsCfgs...), pkgPath: cfg.pkgPath}, nil
+}
+
+// loadWorkspace loads the configuration from the [FilenameOrchestrionToolGo]
+// file next to the `go.work` file in effect in this loader's directory, if any.
+// It applies to all modules used by the workspace, in addition to their own
+// configuration. Its imports are resolved from this loader's directory, which
+// is fine as all modules in a workspace share the same build list.
+func (l *Loader) loadWorkspace(ctx context.Context) ([]Config, error) {
+	goWork, err := goenv.GOWORK(l.dir)
+	if errors.Is(err, goenv.ErrNoGoWork) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfgs, err := l.loadGoFile(ctx, filepath.Join(filepath.Dir(goWork), FilenameOrchestrionToolGo))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return cfgs, nil
 }
 
 // markLoaded marks the specified file as loaded. Return true if the file was
@@ -224,6 +224,66 @@ func TestLoad(t *testing.T) {
 		require.NoError(t, err)
 		require.Len(t, cfg.Aspects(), len(builtIn.yaml.aspects)+1)
 	})
+
+	t.Run("workspace", func(t *testing.T) {
+		tmp := t.TempDir()
+		for _, mod := range []string{"app", "integration"} {
+			dir := filepath.Join(tmp, mod)
+			require.NoError(t, os.Mkdir(dir, 0o755))
+			runGo(t, dir, "mod", "init", "github.com/DataDog/orchestrion/config_test/"+mod)
+			require.NoError(t, os.WriteFile(filepath.Join(dir, mod+".go"), []byte("package "+mod), 0o644))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, "integration", FilenameOrchestrionYML), []byte(`aspects: [{ id: "ID", join-point: { package-name: main }, advice: [{ add-blank-import: unsafe }] }]`), 0o644))
+		runGo(t, tmp, "work", "init", "./app", "./integration")
+		// The workspace-level file is not part of any module, and applies to all of them.
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, FilenameOrchestrionToolGo), []byte(`
+			//go:build tools
+			package tools
+			import _ "github.com/DataDog/orchestrion/config_test/integration"
+		`), 0o644))
+		t.Setenv("GOWORK", "")
+		t.Setenv("GOFLAGS", "") // -mod=mod is not allowed in workspace mode
+
+		loader := NewLoader(nil, filepath.Join(tmp, "app"), false)
+		cfg, err := loader.Load(context.Background())
+		require.NoError(t, err)
+		require.Len(t, cfg.Aspects(), 1)
+		require.Equal(t, "ID", cfg.Aspects()[0].ID)
+	})
+
+	t.Run("vendor", func(t *testing.T) {
+		tmp := t.TempDir()
+		integ := filepath.Join(tmp, "integration")
+		require.NoError(t, os.MkdirAll(filepath.Join(integ, "extended"), 0o755))
+		runGo(t, integ, "mod", "init", "github.com/DataDog/orchestrion/config_test/integration")
+		require.NoError(t, os.WriteFile(filepath.Join(integ, "integration.go"), []byte("package integration"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(integ, FilenameOrchestrionYML), []byte(`{ extends: [./extended], aspects: [{ id: "ID", join-point: { package-name: main }, advice: [{ add-blank-import: unsafe }] }] }`), 0o644))
+		// This package is not imported by any Go code, so `go mod vendor` does not copy it.
+		require.NoError(t, os.WriteFile(filepath.Join(integ, "extended", "extended.go"), []byte("package extended"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(integ, "extended", FilenameOrchestrionYML), []byte(`aspects: [{ id: "EXT", join-point: { package-name: main }, advice: [{ add-blank-import: unsafe }] }]`), 0o644))
+
+		app := filepath.Join(tmp, "app")
+		require.NoError(t, os.Mkdir(app, 0o755))
+		runGo(t, app, "mod", "init", "github.com/DataDog/orchestrion/config_test/app")
+		runGo(t, app, "mod", "edit", "-require=github.com/DataDog/orchestrion/config_test/integration@v0.0.0", "-replace=github.com/DataDog/orchestrion/config_test/integration=../integration")
+		require.NoError(t, os.WriteFile(filepath.Join(app, FilenameOrchestrionToolGo), []byte(`
+			//go:build tools
+			package tools
+			import _ "github.com/DataDog/orchestrion/config_test/integration"
+		`), 0o644))
+		runGo(t, app, "mod", "vendor")
+		require.NoDirExists(t, filepath.Join(app, "vendor", "github.com", "DataDog", "orchestrion", "config_test", "integration", "extended"))
+		t.Setenv("GOFLAGS", "-mod=vendor")
+
+		loader := NewLoader(nil, app, false)
+		cfg, err := loader.Load(context.Background())
+		require.NoError(t, err)
+		ids := make([]string, 0, 2)
+		for _, a := range cfg.Aspects() {
+			ids = append(ids, a.ID)
+		}
+		require.ElementsMatch(t, []string{"ID", "EXT"}, ids)
+	})
 }
 
 func runGo(t *testing.T, tmp string, args ...string) {
@@ -0,0 +1,456 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package config
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/injector/aspect/advice"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/join"
+	"github.com/DataDog/orchestrion/internal/injector/typed"
+	"github.com/DataDog/orchestrion/internal/yaml"
+	goyaml "github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Severity qualifies how serious a [Diagnostic] is.
+type Severity string
+
+const (
+	// SeverityError is used for problems that will cause the configuration to
+	// fail loading, or to behave incorrectly.
+	SeverityError Severity = "error"
+	// SeverityWarning is used for problems that may only surface in some build
+	// environments.
+	SeverityWarning Severity = "warning"
+)
+
+// Rules identify the kind of check that produced a [Diagnostic].
+const (
+	RuleSyntax    = "yaml-syntax"
+	RuleSchema    = "json-schema"
+	RuleAspect    = "aspect"
+	RuleInterface = "interface-resolution"
+	RuleSupports  = "version-range"
+)
+
+// Rule describes a kind of check that produces [Diagnostic] values.
+type Rule struct {
+	// ID is the identifier used as [Diagnostic.Rule].
+	ID string
+	// Description is a short, human-readable description of the check.
+	Description string
+}
+
+// Rules returns the description of all rules that may be referenced by a
+// [Diagnostic].
+func Rules() []Rule {
+	return []Rule{
+		{ID: RuleSyntax, Description: "YAML syntax error"},
+		{ID: RuleSchema, Description: "Document does not conform to the JSON schema"},
+		{ID: RuleAspect, Description: "Invalid join point or advice"},
+		{ID: RuleInterface, Description: "Interface name cannot be resolved"},
+		{ID: RuleSupports, Description: "Invalid supported version range"},
+	}
+}
+
+// Diagnostic is a problem found in a [FilenameOrchestrionYML] file, positioned
+// at the YAML node that is responsible for it.
+type Diagnostic struct {
+	Filename string
+	Line     int
+	Column   int
+	Severity Severity
+	Rule     string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s (%s)", d.Filename, d.Line, d.Column, d.Severity, d.Message, d.Rule)
+}
+
+// HasErrors returns true if any of the provided diagnostics has
+// [SeverityError].
+func HasErrors(diags []Diagnostic) bool {
+	return slices.ContainsFunc(diags, func(d Diagnostic) bool { return d.Severity == SeverityError })
+}
+
+// Diagnose loads the configuration from this loader's directory in the same way
+// as [Loader.Load] does, but collects all problems found in YAML documents as
+// [Diagnostic] values instead of stopping at the first one. The returned error
+// is only non-nil for failures that are not related to the contents of YAML
+// documents (e.g, package loading errors).
+func (l *Loader) Diagnose(ctx context.Context) ([]Diagnostic, error) {
+	var diags []Diagnostic
+	l.diagnostics = &diags
+	defer func() { l.diagnostics = nil }()
+
+	_, err := l.Load(ctx)
+	sortDiagnostics(diags)
+	return diags, err
+}
+
+// DiagnoseYMLFile checks the specified YAML configuration document, and returns
+// all problems found in it. It does not follow any `extends` it contains.
+func DiagnoseYMLFile(ctx context.Context, filename string) ([]Diagnostic, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", filename, err)
+	}
+	diags := diagnoseYML(ctx, filename, data)
+	sortDiagnostics(diags)
+	return diags, nil
+}
+
+// diagnoseYMLFile is used instead of [Loader.parseYMLFile] when the loader is
+// collecting diagnostics. If the file contains errors, only its `extends` are
+// returned, so that the rest of the configuration graph can still be checked.
+func (l *Loader) diagnoseYMLFile(ctx context.Context, filename string) (*ymlFile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", filename, err)
+	}
+
+	diags := diagnoseYML(ctx, filename, data)
+	*l.diagnostics = append(*l.diagnostics, diags...)
+
+	if HasErrors(diags) {
+		var partial struct{ Extends []string }
+		_ = yaml.UnmarshalContext(ctx, bytes.NewReader(data), &partial)
+		return &ymlFile{Extends: partial.Extends}, nil
+	}
+
+	var yml ymlFile
+	if err := yaml.UnmarshalContext(ctx, bytes.NewReader(data), &yml); err != nil {
+		return nil, fmt.Errorf("yaml.Decode %q: %w", filename, err)
+	}
+	return &yml, nil
+}
+
+func diagnoseYML(ctx context.Context, filename string, data []byte) []Diagnostic {
+	d := diagnoser{filename: filename, lines: strings.Split(string(data), "\n")}
+
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		d.report(nil, err, SeverityError, RuleSyntax)
+		return d.diags
+	}
+	if len(file.Docs) == 0 || file.Docs[0].Body == nil {
+		d.add(nil, SeverityError, RuleSchema, "document is empty")
+		return d.diags
+	}
+	body := file.Docs[0].Body
+
+	// Run the JSON schema first, keeping track of which aspects it found to be
+	// invalid, as these would otherwise produce redundant decoding errors.
+	invalidAspects := make(map[int]struct{})
+	var simple map[string]any
+	if err := goyaml.NodeToValue(body, &simple); err != nil {
+		d.report(body, err, SeverityError, RuleSchema)
+		return d.diags
+	}
+	resErrs, err := schemaErrors(simple)
+	if err != nil {
+		d.report(body, err, SeverityError, RuleSchema)
+		return d.diags
+	}
+	for _, resErr := range pruneCombinatorErrors(resErrs) {
+		path := resErr.Field()
+		if rest, ok := strings.CutPrefix(path, "aspects."); ok {
+			idx, _, _ := strings.Cut(rest, ".")
+			if i, err := strconv.Atoi(idx); err == nil {
+				invalidAspects[i] = struct{}{}
+			}
+		}
+		d.add(lookupNode(body, path), SeverityError, RuleSchema, fmt.Sprintf("%s: %s", path, resErr.Description()))
+	}
+
+	if meta := childNode(body, "meta"); meta != nil {
+		if supports := childNode(meta, "supports"); supports != nil {
+			d.supports(supports)
+		}
+	}
+
+	aspects, _ := lookupNode(body, "aspects").(*ast.SequenceNode)
+	if aspects == nil {
+		return d.diags
+	}
+	for i, node := range aspects.Values {
+		if _, invalid := invalidAspects[i]; invalid {
+			continue
+		}
+		d.aspect(ctx, node)
+	}
+
+	return d.diags
+}
+
+type diagnoser struct {
+	filename string
+	lines    []string
+	diags    []Diagnostic
+}
+
+// aspect decodes the join point and each advice of an aspect independently, so
+// that errors are reported as close to their origin as possible.
+func (d *diagnoser) aspect(ctx context.Context, node ast.Node) {
+	if jp := lookupNode(node, "join-point"); jp != node {
+		if _, err := join.FromYAML(ctx, jp); err != nil {
+			d.report(jp, err, SeverityError, RuleAspect)
+		}
+		d.interfaces(jp)
+	}
+
+	adv := lookupNode(node, "advice")
+	if adv == node {
+		return
+	}
+	list := []ast.Node{adv}
+	if seq, ok := adv.(*ast.SequenceNode); ok {
+		list = seq.Values
+	}
+	for _, node := range list {
+		if _, err := advice.FromYAML(ctx, node); err != nil {
+			d.report(d.templateErrorNode(node, err), err, SeverityError, RuleAspect)
+		}
+	}
+}
+
+// supports parses each of the version ranges of a `meta.supports` block, which
+// would otherwise fail decoding the whole document.
+func (d *diagnoser) supports(node ast.Node) {
+	var values []*ast.MappingValueNode
+	switch n := node.(type) {
+	case *ast.MappingValueNode:
+		values = []*ast.MappingValueNode{n}
+	case *ast.MappingNode:
+		values = n.Values
+	}
+	for _, mv := range values {
+		var text string
+		if err := goyaml.NodeToValue(mv.Value, &text); err != nil {
+			// This is reported by the JSON schema.
+			continue
+		}
+		if _, err := ParseVersionRange(text); err != nil {
+			d.add(mv.Value, SeverityError, RuleSupports, fmt.Sprintf("%s: %v", keyOf(mv), err))
+		}
+	}
+}
+
+// implementsKeys are the join point keys whose value names an interface type
+// that is resolved at compile time.
+var implementsKeys = []string{"argument-implements", "final-result-implements", "result-implements"}
+
+// interfaces attempts to resolve all interface names referenced by the join
+// point rooted at the provided node. Failures to resolve interfaces are
+// silently ignored at compile time, so they are reported here.
+func (d *diagnoser) interfaces(node ast.Node) {
+	ast.Walk(visitorFunc(func(node ast.Node) bool {
+		mv, ok := node.(*ast.MappingValueNode)
+		if !ok || !slices.Contains(implementsKeys, keyOf(mv)) {
+			return true
+		}
+		var name string
+		if err := goyaml.NodeToValue(mv.Value, &name); err != nil || name == "" {
+			// This is reported as a decoding error of the join point.
+			return false
+		}
+		if _, err := typed.ResolveInterfaceTypeByName(name); err != nil {
+			severity := SeverityError
+			if pkgPath, _ := typed.SplitPackageAndName(name); isThirdParty(pkgPath) {
+				// Resolving third-party interfaces depends on the availability of
+				// export data, which is environment-dependent.
+				severity = SeverityWarning
+			}
+			d.add(mv.Value, severity, RuleInterface, fmt.Sprintf("%s: %v", keyOf(mv), err))
+		}
+		return false
+	}), node)
+}
+
+// report adds a diagnostic for the provided error. If the error carries its own
+// position, it is used instead of the node's.
+func (d *diagnoser) report(node ast.Node, err error, severity Severity, rule string) {
+	var yErr goyaml.Error
+	if errors.As(err, &yErr) && yErr.GetToken() != nil {
+		d.addAt(yErr.GetToken().Position, severity, rule, yErr.GetMessage())
+		return
+	}
+	d.add(node, severity, rule, err.Error())
+}
+
+func (d *diagnoser) add(node ast.Node, severity Severity, rule string, msg string) {
+	var pos *token.Position
+	if node != nil && node.GetToken() != nil {
+		pos = node.GetToken().Position
+	}
+	d.addAt(pos, severity, rule, msg)
+}
+
+func (d *diagnoser) addAt(pos *token.Position, severity Severity, rule string, msg string) {
+	diag := Diagnostic{Filename: d.filename, Severity: severity, Rule: rule, Message: msg, Line: 1, Column: 1}
+	if pos != nil {
+		diag.Line = pos.Line
+		diag.Column = pos.Column
+	}
+	d.diags = append(d.diags, diag)
+}
+
+// pruneCombinatorErrors removes errors produced by schema combinators (allOf,
+// anyOf, oneOf), which only summarize other errors, unless there are no other
+// errors to report.
+func pruneCombinatorErrors(errs []gojsonschema.ResultError) []gojsonschema.ResultError {
+	isCombinator := func(err gojsonschema.ResultError) bool {
+		switch err.Type() {
+		case "number_all_of", "number_any_of", "number_one_of":
+			return true
+		default:
+			return false
+		}
+	}
+	if !slices.ContainsFunc(errs, func(err gojsonschema.ResultError) bool { return !isCombinator(err) }) {
+		return errs
+	}
+	return slices.DeleteFunc(slices.Clone(errs), isCombinator)
+}
+
+// lookupNode finds the node designated by a JSON schema field path (such as
+// `aspects.0.advice`) within the provided node. If the path cannot be fully
+// resolved, the closest ancestor found is returned.
+func lookupNode(node ast.Node, path string) ast.Node {
+	if path == "" || path == "(root)" {
+		return node
+	}
+
+	for _, elem := range strings.Split(path, ".") {
+		next := childNode(node, elem)
+		if next == nil {
+			return node
+		}
+		node = next
+	}
+	return node
+}
+
+func childNode(node ast.Node, elem string) ast.Node {
+	switch n := node.(type) {
+	case *ast.TagNode:
+		return childNode(n.Value, elem)
+	case *ast.AnchorNode:
+		return childNode(n.Value, elem)
+	case *ast.MappingValueNode:
+		if keyOf(n) == elem {
+			return n.Value
+		}
+	case *ast.MappingNode:
+		for _, mv := range n.Values {
+			if keyOf(mv) == elem {
+				return mv.Value
+			}
+		}
+	case *ast.SequenceNode:
+		if idx, err := strconv.Atoi(elem); err == nil && idx >= 0 && idx < len(n.Values) {
+			return n.Values[idx]
+		}
+	}
+	return nil
+}
+
+func keyOf(mv *ast.MappingValueNode) string {
+	if mv.Key == nil || mv.Key.GetToken() == nil {
+		return ""
+	}
+	return mv.Key.GetToken().Value
+}
+
+// templateLineRe matches the position information in [text/template] parse
+// errors for [code.Template] values.
+var templateLineRe = regexp.MustCompile(`\btemplate: code\.Template:(\d+):`)
+
+// templateErrorNode returns a node positioned on the template line responsible
+// for the provided error, if it is a template parse error. Otherwise, it
+// returns the provided node.
+func (d *diagnoser) templateErrorNode(node ast.Node, err error) ast.Node {
+	match := templateLineRe.FindStringSubmatch(err.Error())
+	if match == nil {
+		return node
+	}
+	line, _ := strconv.Atoi(match[1])
+
+	var tmpl ast.Node
+	ast.Walk(visitorFunc(func(n ast.Node) bool {
+		if mv, ok := n.(*ast.MappingValueNode); ok && keyOf(mv) == "template" {
+			tmpl = mv.Value
+		}
+		return tmpl == nil
+	}), node)
+	if tmpl == nil || tmpl.GetToken() == nil {
+		return node
+	}
+
+	pos := *tmpl.GetToken().Position
+	if _, isLiteral := tmpl.(*ast.LiteralNode); isLiteral {
+		// Block scalars start on the line following the indicator, and the
+		// reported column is that of the first non-blank character.
+		pos.Line += line
+		if pos.Line <= len(d.lines) {
+			text := d.lines[pos.Line-1]
+			pos.Column = len(text) - len(strings.TrimLeft(text, " \t")) + 1
+		}
+	} else {
+		pos.Line += line - 1
+	}
+	return positioned{tmpl, &pos}
+}
+
+// positioned overrides the reported position of a node.
+type positioned struct {
+	ast.Node
+	pos *token.Position
+}
+
+func (p positioned) GetToken() *token.Token {
+	return &token.Token{Position: p.pos}
+}
+
+// isThirdParty returns true if the provided import path is not part of the
+// standard library, i.e, its first path element contains a dot.
+func isThirdParty(pkgPath string) bool {
+	first, _, _ := strings.Cut(pkgPath, "/")
+	return strings.Contains(first, ".")
+}
+
+type visitorFunc func(ast.Node) bool
+
+func (f visitorFunc) Visit(node ast.Node) ast.Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+func sortDiagnostics(diags []Diagnostic) {
+	slices.SortStableFunc(diags, func(l, r Diagnostic) int {
+		return cmp.Or(
+			cmp.Compare(l.Filename, r.Filename),
+			cmp.Compare(l.Line, r.Line),
+			cmp.Compare(l.Column, r.Column),
+		)
+	})
+}
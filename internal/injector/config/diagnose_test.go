@@ -0,0 +1,144 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnoseYMLFile(t *testing.T) {
+	t.Parallel()
+
+	type expected struct {
+		line, column int
+		severity     Severity
+		rule         string
+		message      string
+	}
+
+	for name, tc := range map[string]struct {
+		source   string
+		expected []expected
+	}{
+		"valid": {
+			source: "meta: {name: name, description: description}\naspects: [{ id: ID, join-point: { package-name: main }, advice: [add-blank-import: unsafe] }]",
+		},
+		"syntax": {
+			source:   "meta: {name: name, description: description\n",
+			expected: []expected{{line: 1, column: 7, severity: SeverityError, rule: RuleSyntax}},
+		},
+		"schema": {
+			source: "meta:\n  name: name\n  description: description\naspects:\n  - id: ID\n    join-point: { package-name: main }\n    advice: [add-blank-import: unsafe]\n    unexpected: true\n",
+			expected: []expected{{
+				line:     5,
+				column:   7,
+				severity: SeverityError,
+				rule:     RuleSchema,
+				message:  "aspects.0: Additional property unexpected is not allowed",
+			}},
+		},
+		"template": {
+			source: "meta:\n  name: name\n  description: description\naspects:\n  - id: ID\n    join-point:\n      function-body:\n        function:\n          - name: main\n    advice:\n      - prepend-statements:\n          template: |-\n            foo()\n            {{ .Bar\n",
+			expected: []expected{{
+				line:     14,
+				column:   13,
+				severity: SeverityError,
+				rule:     RuleAspect,
+				message:  "template: code.Template:2: unclosed action",
+			}},
+		},
+		"interface": {
+			source: "meta:\n  name: name\n  description: description\naspects:\n  - id: ID\n    join-point:\n      function-body:\n        function:\n          - result-implements: io.NotAnInterface\n    advice:\n      - prepend-statements:\n          template: foo()\n",
+			expected: []expected{{
+				line:     9,
+				column:   32,
+				severity: SeverityError,
+				rule:     RuleInterface,
+				message:  `result-implements: type "NotAnInterface" not found in package "io"`,
+			}},
+		},
+		"supports": {
+			source: "meta:\n  name: name\n  description: description\n  supports:\n    example.com/module: \">=v1.2.0 <2.0.0\"\n    example.com/other: \">=v1.0.0 || ~v2.0.0\"\naspects: [{ id: ID, join-point: { package-name: main }, advice: [add-blank-import: unsafe] }]\n",
+			expected: []expected{
+				{
+					line:     5,
+					column:   25,
+					severity: SeverityError,
+					rule:     RuleSupports,
+					message:  `example.com/module: invalid version range ">=v1.2.0 <2.0.0": "2.0.0" is not a valid semantic version`,
+				},
+				{
+					line:     6,
+					column:   24,
+					severity: SeverityError,
+					rule:     RuleSupports,
+					message:  `example.com/other: invalid version range ">=v1.0.0 || ~v2.0.0": "~v2.0.0" is not a valid semantic version`,
+				},
+			},
+		},
+		"third-party interface": {
+			source: "meta:\n  name: name\n  description: description\naspects:\n  - id: ID\n    join-point:\n      function-body:\n        function:\n          - argument-implements: example.com/not/a/module.Iface\n    advice:\n      - prepend-statements:\n          template: foo()\n",
+			expected: []expected{{
+				line:     9,
+				column:   34,
+				severity: SeverityWarning,
+				rule:     RuleInterface,
+			}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			filename := filepath.Join(t.TempDir(), FilenameOrchestrionYML)
+			require.NoError(t, os.WriteFile(filename, []byte(tc.source), 0o644))
+
+			diags, err := DiagnoseYMLFile(context.Background(), filename)
+			require.NoError(t, err)
+			require.Len(t, diags, len(tc.expected), "diagnostics: %v", diags)
+			for i, exp := range tc.expected {
+				diag := diags[i]
+				assert.Equal(t, filename, diag.Filename)
+				assert.Equal(t, exp.line, diag.Line, "line of %s", diag)
+				assert.Equal(t, exp.column, diag.Column, "column of %s", diag)
+				assert.Equal(t, exp.severity, diag.Severity)
+				assert.Equal(t, exp.rule, diag.Rule)
+				assert.True(t, slices.ContainsFunc(Rules(), func(r Rule) bool { return r.ID == diag.Rule }), "rule %q is not listed by Rules()", diag.Rule)
+				if exp.message != "" {
+					assert.Equal(t, exp.message, diag.Message)
+				}
+			}
+			wantErrors := len(tc.expected) != 0 && tc.expected[0].severity == SeverityError
+			assert.Equal(t, wantErrors, HasErrors(diags))
+		})
+	}
+}
+
+func TestLoaderDiagnose(t *testing.T) {
+	tmp := t.TempDir()
+	runGo(t, tmp, "mod", "init", "github.com/DataDog/orchestrion/config_test")
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "main.go"), []byte(`package main`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, FilenameOrchestrionYML), []byte("meta: {name: name, description: description}\nextends: [./broken.yml, ./other.yml]\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "broken.yml"), []byte("meta: {name: name, description: description}\naspects: [{ id: ID, join-point: { package-name: main }, advice: [{ bogus-advice: true }] }]\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "other.yml"), []byte("meta: {name: name}\n"), 0o644))
+
+	diags, err := NewLoader(nil, tmp, false).Diagnose(context.Background())
+	require.NoError(t, err)
+	require.True(t, HasErrors(diags))
+
+	files := make(map[string]struct{}, len(diags))
+	for _, diag := range diags {
+		files[filepath.Base(diag.Filename)] = struct{}{}
+	}
+	// Both erroneous files are reported, despite the first one failing to load.
+	assert.Equal(t, map[string]struct{}{"broken.yml": {}, "other.yml": {}}, files)
+}
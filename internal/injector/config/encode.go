@@ -0,0 +1,79 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/yaml"
+)
+
+// encodedAspect is the serialized form of an [aspect.Aspect]. Built-in aspects
+// are constructed programmatically and have no source document, so they are
+// referenced by ID instead.
+type encodedAspect struct {
+	BuiltIn string          `json:"builtin,omitempty"`
+	Aspect  json.RawMessage `json:"aspect,omitempty"`
+}
+
+// EncodeAspects serializes the provided list of aspects so that it can be
+// decoded by [DecodeAspects], typically in another process. All aspects must
+// either have been decoded from YAML, or be built-in.
+func EncodeAspects(aspects []*aspect.Aspect) ([]byte, error) {
+	encoded := make([]encodedAspect, len(aspects))
+	for idx, a := range aspects {
+		if slices.Contains(builtIn.yaml.aspects, a) {
+			encoded[idx].BuiltIn = a.ID
+			continue
+		}
+
+		src := a.Source()
+		if src == nil {
+			return nil, fmt.Errorf("aspect %q has no source document", a.ID)
+		}
+		data, err := json.Marshal(src)
+		if err != nil {
+			return nil, fmt.Errorf("encoding aspect %q: %w", a.ID, err)
+		}
+		encoded[idx].Aspect = data
+	}
+	return json.Marshal(encoded)
+}
+
+// DecodeAspects deserializes a list of aspects produced by [EncodeAspects].
+// The source documents are not validated again, as they were when originally
+// loaded.
+func DecodeAspects(ctx context.Context, data []byte) ([]*aspect.Aspect, error) {
+	var encoded []encodedAspect
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, err
+	}
+
+	aspects := make([]*aspect.Aspect, len(encoded))
+	for idx, enc := range encoded {
+		if enc.BuiltIn != "" {
+			builtInIdx := slices.IndexFunc(builtIn.yaml.aspects, func(a *aspect.Aspect) bool { return a.ID == enc.BuiltIn })
+			if builtInIdx < 0 {
+				return nil, fmt.Errorf("unknown built-in aspect %q", enc.BuiltIn)
+			}
+			aspects[idx] = builtIn.yaml.aspects[builtInIdx]
+			continue
+		}
+
+		// JSON is valid YAML, so the regular YAML decoding path can be re-used.
+		var a aspect.Aspect
+		if err := yaml.UnmarshalContext(ctx, bytes.NewReader(enc.Aspect), &a); err != nil {
+			return nil, fmt.Errorf("decoding aspect #%d: %w", idx, err)
+		}
+		aspects[idx] = &a
+	}
+	return aspects, nil
+}
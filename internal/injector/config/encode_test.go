@@ -0,0 +1,137 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/fingerprint"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestEncodeAspects(t *testing.T) {
+	// The injector test cases exercise most join points and advice kinds, and
+	// some of them make use of YAML anchors & aliases.
+	testCases, err := filepath.Glob(filepath.Join(repoRoot(), "internal", "injector", "testdata", "injector", "*", "config.yml"))
+	require.NoError(t, err)
+	require.NotEmpty(t, testCases)
+
+	for _, filename := range testCases {
+		t.Run(filepath.Base(filepath.Dir(filename)), func(t *testing.T) {
+			file, err := os.Open(filename)
+			require.NoError(t, err)
+			defer file.Close()
+
+			var cfg struct {
+				Aspects []*aspect.Aspect `yaml:"aspects"`
+			}
+			require.NoError(t, yaml.UnmarshalContext(context.Background(), file, &cfg))
+
+			// The built-in aspects are always present in a loaded configuration.
+			aspects := append(slices.Clone(builtIn.yaml.aspects), cfg.Aspects...)
+
+			data, err := EncodeAspects(aspects)
+			require.NoError(t, err)
+
+			decoded, err := DecodeAspects(context.Background(), data)
+			require.NoError(t, err)
+			require.Len(t, decoded, len(aspects))
+			assert.Equal(t, aspectsFingerprint(t, aspects), aspectsFingerprint(t, decoded))
+		})
+	}
+
+	t.Run("no source", func(t *testing.T) {
+		_, err := EncodeAspects([]*aspect.Aspect{{ID: "synthetic"}})
+		require.ErrorContains(t, err, `aspect "synthetic" has no source document`)
+	})
+
+	t.Run("unknown built-in", func(t *testing.T) {
+		_, err := DecodeAspects(context.Background(), []byte(`[{"builtin":"unknown"}]`))
+		require.ErrorContains(t, err, `unknown built-in aspect "unknown"`)
+	})
+}
+
+// BenchmarkLoad measures the cost of loading the injector configuration of the
+// samples module, as is done by the job server once per build. Package loading
+// is memoized, as the job server does, so this mostly measures YAML parsing and
+// template compilation.
+func BenchmarkLoad(b *testing.B) {
+	dir := samplesDir()
+	ctx := context.Background()
+
+	var (
+		mu     sync.Mutex
+		loaded = make(map[string][]*packages.Package)
+	)
+	pkgLoader := func(ctx context.Context, dir string, patterns ...string) ([]*packages.Package, error) {
+		key := dir + "\x00" + strings.Join(patterns, "\x00")
+		mu.Lock()
+		defer mu.Unlock()
+		if pkgs, found := loaded[key]; found {
+			return pkgs, nil
+		}
+		pkgs, err := defaultPackageLoader(ctx, dir, patterns...)
+		if err == nil {
+			loaded[key] = pkgs
+		}
+		return pkgs, err
+	}
+	_, err := NewLoader(pkgLoader, dir, false).Load(ctx)
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for range b.N {
+		if _, err := NewLoader(pkgLoader, dir, false).Load(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeAspects measures the cost of decoding the injector
+// configuration of the samples module as served by the job server, as is done
+// in every compile process.
+func BenchmarkDecodeAspects(b *testing.B) {
+	cfg, err := NewLoader(nil, samplesDir(), false).Load(context.Background())
+	require.NoError(b, err)
+	data, err := EncodeAspects(cfg.Aspects())
+	require.NoError(b, err)
+	b.SetBytes(int64(len(data)))
+
+	ctx := context.Background()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := DecodeAspects(ctx, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func repoRoot() string {
+	_, thisFile, _, _ := runtime.Caller(0)
+	return filepath.Join(thisFile, "..", "..", "..", "..")
+}
+
+func samplesDir() string {
+	return filepath.Join(repoRoot(), "samples")
+}
+
+func aspectsFingerprint(tb testing.TB, aspects []*aspect.Aspect) string {
+	fptr := fingerprint.New()
+	defer fptr.Close()
+	require.NoError(tb, fptr.Named("aspects", fingerprint.List[*aspect.Aspect](aspects)))
+	return fptr.Finish()
+}
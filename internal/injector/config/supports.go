@@ -0,0 +1,175 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/yaml"
+	"github.com/goccy/go-yaml/ast"
+	"golang.org/x/mod/semver"
+)
+
+// VersionRange is a set of module versions, as declared in the `meta.supports`
+// block of [FilenameOrchestrionYML] files. It is a list of alternatives
+// separated by `||`, each of which is a space-separated list of constraints
+// that must all be satisfied, such as `>=v1.7.0 <v2.0.0 || >=v2.1.0`. Each
+// constraint is a semantic version, optionally prefixed by one of the `=`,
+// `<`, `<=`, `>` or `>=` operators.
+type VersionRange struct {
+	text         string
+	alternatives [][]versionConstraint
+}
+
+type versionConstraint struct {
+	operator string
+	version  string
+}
+
+// ParseVersionRange parses the provided text as a [VersionRange].
+func ParseVersionRange(text string) (VersionRange, error) {
+	res := VersionRange{text: strings.TrimSpace(text)}
+	if res.text == "" {
+		return VersionRange{}, errors.New("empty version range")
+	}
+
+	for _, alt := range strings.Split(res.text, "||") {
+		fields := strings.Fields(alt)
+		if len(fields) == 0 {
+			return VersionRange{}, fmt.Errorf("invalid version range %q: empty alternative", text)
+		}
+		constraints := make([]versionConstraint, 0, len(fields))
+		for _, field := range fields {
+			version := strings.TrimLeft(field, "<>=")
+			operator := field[:len(field)-len(version)]
+			switch operator {
+			case "":
+				operator = "="
+			case "=", "<", "<=", ">", ">=":
+			default:
+				return VersionRange{}, fmt.Errorf("invalid version range %q: unknown operator %q", text, operator)
+			}
+			if !semver.IsValid(version) {
+				return VersionRange{}, fmt.Errorf("invalid version range %q: %q is not a valid semantic version", text, version)
+			}
+			constraints = append(constraints, versionConstraint{operator: operator, version: version})
+		}
+		res.alternatives = append(res.alternatives, constraints)
+	}
+
+	return res, nil
+}
+
+// Contains returns true if the provided version is part of the range.
+func (r VersionRange) Contains(version string) bool {
+	return slices.ContainsFunc(r.alternatives, func(constraints []versionConstraint) bool {
+		for _, c := range constraints {
+			if !c.matches(version) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (r VersionRange) String() string {
+	return r.text
+}
+
+func (c versionConstraint) matches(version string) bool {
+	cmp := semver.Compare(version, c.version)
+	switch c.operator {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return cmp == 0
+	}
+}
+
+var _ yaml.NodeUnmarshalerContext = (*VersionRange)(nil)
+
+func (r *VersionRange) UnmarshalYAML(ctx context.Context, node ast.Node) error {
+	var text string
+	if err := yaml.NodeToValueContext(ctx, node, &text); err != nil {
+		return err
+	}
+
+	var err error
+	*r, err = ParseVersionRange(text)
+	return err
+}
+
+// Support is the result of checking the version of a module used by the build
+// against the range declared by an integration in its `meta.supports` block.
+type Support struct {
+	// Integration is the name of the integration declaring the range.
+	Integration string `json:"integration"`
+	// PkgPath is the import path of the package the integration belongs to.
+	PkgPath string `json:"pkgPath,omitempty"`
+	// Module is the path of the module the range applies to.
+	Module string `json:"module"`
+	// Version is the version of the module used by the build.
+	Version string `json:"version"`
+	// Range is the range of versions supported by the integration.
+	Range string `json:"range"`
+	// Supported is true if the version is part of the range.
+	Supported bool `json:"supported"`
+}
+
+func (s Support) String() string {
+	status := "supported"
+	if !s.Supported {
+		status = "unsupported"
+	}
+	return fmt.Sprintf("%s: %s@%s is %s (expecting %s)", s.Integration, s.Module, s.Version, status, s.Range)
+}
+
+// CheckSupport checks the provided module versions against the ranges
+// declared by all integrations of the configuration. Modules for which no
+// version is provided are not used by the build, or are replaced by a local
+// directory, and are ignored. Results are sorted by module path, then by
+// integration name.
+func CheckSupport(cfg Config, versions map[string]string) ([]Support, error) {
+	var res []Support
+	err := Visit(cfg, func(file File, pkgPath string) error {
+		for modPath, versionRange := range file.Supports() {
+			version := versions[modPath]
+			if version == "" {
+				continue
+			}
+			res = append(res, Support{
+				Integration: file.Name(),
+				PkgPath:     pkgPath,
+				Module:      modPath,
+				Version:     version,
+				Range:       versionRange.String(),
+				Supported:   versionRange.Contains(version),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(res, func(l, r Support) int {
+		if cmp := strings.Compare(l.Module, r.Module); cmp != 0 {
+			return cmp
+		}
+		return strings.Compare(l.Integration, r.Integration)
+	})
+	return res, nil
+}
@@ -0,0 +1,64 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionRange(t *testing.T) {
+	t.Parallel()
+
+	for text, tc := range map[string]struct {
+		contains    []string
+		notContains []string
+		err         string
+	}{
+		"v1.2.3": {
+			contains:    []string{"v1.2.3"},
+			notContains: []string{"v1.2.4", "v1.2.2"},
+		},
+		">=v1.7.0 <v2.0.0": {
+			contains:    []string{"v1.7.0", "v1.9.1", "v1.99.0"},
+			notContains: []string{"v1.6.9", "v2.0.0", "v1.7.0-rc.1"},
+		},
+		">v1.0.0 <=v1.1.0 || >=v2.1.0": {
+			contains:    []string{"v1.0.1", "v1.1.0", "v2.1.0", "v3.0.0"},
+			notContains: []string{"v1.0.0", "v1.1.1", "v2.0.0"},
+		},
+		">=v1.2.0": {
+			contains: []string{"v1.2.1-0.20240101000000-abcdefabcdef", "v1.3.0+incompatible"},
+		},
+		"":                    {err: "empty version range"},
+		">=v1.0.0 ||":         {err: "empty alternative"},
+		"~v1.0.0":             {err: `"~v1.0.0" is not a valid semantic version`},
+		"=>v1.0.0":            {err: `unknown operator "=>"`},
+		">=1.0.0":             {err: `"1.0.0" is not a valid semantic version`},
+		">=v1.0.0 <v2.0.0 ||": {err: "empty alternative"},
+	} {
+		t.Run(text, func(t *testing.T) {
+			t.Parallel()
+
+			vr, err := ParseVersionRange(text)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, text, vr.String())
+
+			for _, version := range tc.contains {
+				assert.True(t, vr.Contains(version), "expected %q to contain %s", text, version)
+			}
+			for _, version := range tc.notContains {
+				assert.False(t, vr.Contains(version), "expected %q not to contain %s", text, version)
+			}
+		})
+	}
+}
@@ -17,14 +17,14 @@ import (
 // ValidateObject checks the provided object for conformance to the embedded
 // JSON schema. Returns an error if the object does not conform to the schema.
 func ValidateObject(obj map[string]any) error {
-	res, err := getSchema().Validate(gojsonschema.NewGoLoader(obj))
+	resErrs, err := schemaErrors(obj)
 	if err != nil {
-		return fmt.Errorf("unknown object type for schema validation: %w", err)
+		return err
 	}
 
-	if !res.Valid() {
-		errs := make([]error, len(res.Errors()))
-		for i, err := range res.Errors() {
+	if len(resErrs) != 0 {
+		errs := make([]error, len(resErrs))
+		for i, err := range resErrs {
 			errs[i] = fmt.Errorf("error at %s: %s", err.Field(), err.Description())
 		}
 		return fmt.Errorf("object does not conform to schema: %w", errors.Join(errs...))
@@ -33,6 +33,16 @@ func ValidateObject(obj map[string]any) error {
 	return nil
 }
 
+// schemaErrors validates the provided object against the embedded JSON schema,
+// and returns the list of all conformance errors found.
+func schemaErrors(obj map[string]any) ([]gojsonschema.ResultError, error) {
+	res, err := getSchema().Validate(gojsonschema.NewGoLoader(obj))
+	if err != nil {
+		return nil, fmt.Errorf("unknown object type for schema validation: %w", err)
+	}
+	return res.Errors(), nil
+}
+
 var (
 	//go:embed "schema.json"
 	schemaBytes []byte
@@ -0,0 +1,117 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/gomod"
+	"golang.org/x/mod/module"
+	"golang.org/x/tools/go/packages"
+)
+
+// unvendoredPath maps a path within a `vendor` directory that does not exist to
+// the same path in the source of the vendored module it belongs to, according
+// to `vendor/modules.txt`. This is necessary because `go mod vendor` only copies
+// packages that are imported by Go code, while configuration may reference
+// other directories of a module (e.g, using `extends`). It returns the import
+// path corresponding to the path, which is blank if it is not within a
+// `vendor` directory.
+func unvendoredPath(path string) (string, string, error) {
+	vendorDir := filepath.Dir(path)
+	for filepath.Base(vendorDir) != "vendor" {
+		parent := filepath.Dir(vendorDir)
+		if parent == vendorDir {
+			return "", "", nil
+		}
+		vendorDir = parent
+	}
+
+	modules, err := gomod.VendoredModules(filepath.Join(vendorDir, "..", "go.mod"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	rel, err := filepath.Rel(vendorDir, path)
+	if err != nil {
+		return "", "", err
+	}
+	importPath := filepath.ToSlash(rel)
+
+	var modPath string
+	for path := range modules {
+		if (importPath == path || strings.HasPrefix(importPath, path+"/")) && len(path) > len(modPath) {
+			modPath = path
+		}
+	}
+	if modPath == "" {
+		return "", "", fmt.Errorf("%q is not vendored, and no module providing it is listed in %q", importPath, filepath.Join(vendorDir, "modules.txt"))
+	}
+
+	mod := modules[modPath]
+	var srcDir string
+	switch {
+	case mod.Replace.Path != "" && mod.Replace.Version == "":
+		// Replaced by a local directory, relative to the vendoring module.
+		srcDir = mod.Replace.Path
+		if !filepath.IsAbs(srcDir) {
+			srcDir = filepath.Join(vendorDir, "..", srcDir)
+		}
+	default:
+		ver := module.Version{Path: modPath, Version: mod.Version}
+		if mod.Replace.Path != "" {
+			ver = module.Version{Path: mod.Replace.Path, Version: mod.Replace.Version}
+		}
+		if srcDir, err = moduleCacheDir(ver); err != nil {
+			return "", "", err
+		}
+	}
+
+	if _, err := os.Stat(srcDir); err != nil {
+		return "", "", fmt.Errorf("%q is not vendored, and the source of module %s is not available: %w", importPath, modPath, err)
+	}
+
+	return filepath.Join(srcDir, filepath.FromSlash(strings.TrimPrefix(importPath, modPath))), importPath, nil
+}
+
+// moduleCacheDir returns the directory of the specified module version in the
+// module cache.
+func moduleCacheDir(mod module.Version) (string, error) {
+	modCache, err := goenv.GOMODCACHE()
+	if err != nil {
+		return "", err
+	}
+	path, err := module.EscapePath(mod.Path)
+	if err != nil {
+		return "", err
+	}
+	ver, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(modCache, filepath.FromSlash(path)+"@"+ver), nil
+}
+
+// unvendoredPackage returns a package describing the directory returned by
+// [unvendoredPath], which cannot be obtained from the [PackageLoader] since it
+// does not belong to the build. Only its [FilenameOrchestrionToolGo] file is
+// listed, which is enough to load configuration from it.
+func unvendoredPackage(dir string, importPath string) *packages.Package {
+	return &packages.Package{
+		ID:           importPath,
+		PkgPath:      importPath,
+		IgnoredFiles: []string{filepath.Join(dir, FilenameOrchestrionToolGo)},
+	}
+}
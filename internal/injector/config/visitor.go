@@ -17,6 +17,9 @@ type (
 		Description() string
 		Caveats() string
 		Icon() string
+		// Supports returns the ranges of versions of modules the configuration is
+		// known to support, keyed by module path.
+		Supports() map[string]VersionRange
 
 		OwnAspects() []*aspect.Aspect
 	}
@@ -44,6 +47,10 @@ func (c *configYML) Icon() string {
 	return c.meta.icon
 }
 
+func (c *configYML) Supports() map[string]VersionRange {
+	return c.meta.supports
+}
+
 func (c *configYML) OwnAspects() []*aspect.Aspect {
 	res := make([]*aspect.Aspect, len(c.aspects))
 	copy(res, c.aspects)
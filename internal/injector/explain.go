@@ -0,0 +1,274 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package injector
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/parse"
+	"github.com/DataDog/orchestrion/internal/injector/typed"
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/dave/dst/decorator/resolver/gotypes"
+	"github.com/dave/dst/dstutil"
+)
+
+type (
+	// Explanation describes how aspects would be applied to a package by
+	// [Injector.InjectFiles], without actually modifying anything.
+	Explanation struct {
+		// ImportPath is the import path of the explained package.
+		ImportPath string
+		// PackagePruned lists aspects that were excluded because their join point
+		// can never match this package, based on its import path and imports.
+		PackagePruned []*aspect.Aspect
+		// NearMisses lists aspects that were not excluded from the package, but did
+		// not match any node in any file (excluding nodes suppressed by an
+		// `//orchestrion:ignore` directive).
+		NearMisses []*aspect.Aspect
+		// Files contains the explanation for each of the package's files.
+		Files []FileExplanation
+		// TypeCheckError is set if the package failed type-checking, in which case
+		// [Injector.InjectFiles] would skip the package entirely, and no matches
+		// are reported.
+		TypeCheckError error
+	}
+
+	// FileExplanation describes how aspects would be applied to a single file.
+	FileExplanation struct {
+		// Filename is the path to the file, as provided to [Injector.Explain].
+		Filename string
+		// FilePruned lists aspects that were excluded because their join point can
+		// never match this file, based on its package name and contents.
+		FilePruned []*aspect.Aspect
+		// Matches lists all nodes where an aspect's join point matched, in source
+		// order.
+		Matches []Match
+	}
+
+	// Match is a node where an aspect's join point matched.
+	Match struct {
+		// Aspect is the aspect whose join point matched.
+		Aspect *aspect.Aspect
+		// Position is the position of the matched node in the source file.
+		Position token.Position
+		// Node is a short description of the matched node's type.
+		Node string
+		// IgnoredBy is the position of the node carrying the
+		// `//orchestrion:ignore` directive that suppresses this match, if any.
+		IgnoredBy *token.Position
+	}
+)
+
+// Explain runs the matching phase of [Injector.InjectFiles] on the specified
+// files and reports which aspects would be applied where, and which were
+// pruned, without applying any advice.
+func (i *Injector) Explain(ctx gocontext.Context, files []string, aspects []*aspect.Aspect) (_ *Explanation, err error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "Explain",
+		tracer.ServiceName("github.com/DataDog/orchestrion/internal/injector"),
+		tracer.ResourceName(i.ImportPath),
+	)
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	if err := i.validate(); err != nil {
+		return nil, err
+	}
+
+	res := &Explanation{ImportPath: i.ImportPath}
+	candidates := i.packageFilterAspects(aspects)
+	for _, a := range aspects {
+		if !slices.Contains(candidates, a) {
+			res.PackagePruned = append(res.PackagePruned, a)
+		}
+	}
+
+	// Contrary to [parse.Parser], all files are parsed eagerly, as we want to
+	// report on all of them regardless of whether pruning would have skipped them.
+	fset := token.NewFileSet()
+	parsedFiles := make([]parse.File, len(files))
+	res.Files = make([]FileExplanation, len(files))
+	for idx, filename := range files {
+		astFile, content, err := parseForExplain(fset, filename)
+		if err != nil {
+			return nil, err
+		}
+
+		fileCtx := &may.FileContext{FileContent: content, PackageName: astFile.Name.Name}
+		fileAspects := make([]*aspect.Aspect, 0, len(candidates))
+		res.Files[idx].Filename = filename
+		for _, a := range candidates {
+			if a.JoinPoint.FileMayMatch(fileCtx) == may.NeverMatch {
+				res.Files[idx].FilePruned = append(res.Files[idx].FilePruned, a)
+				continue
+			}
+			fileAspects = append(fileAspects, a)
+		}
+		parsedFiles[idx] = parse.File{Name: filename, AstFile: astFile, Aspects: fileAspects}
+	}
+
+	typeInfo, err := i.typeCheck(ctx, fset, parsedFiles)
+	if errors.Is(err, typeCheckingError{}) {
+		res.TypeCheckError = err
+		return res, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	matched := make(map[*aspect.Aspect]struct{}, len(candidates))
+	for idx, parsedFile := range parsedFiles {
+		decorator := decorator.NewDecoratorWithImports(fset, i.ImportPath, gotypes.New(typeInfo.Uses))
+		dstFile, err := decorator.DecorateFile(parsedFile.AstFile)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Files[idx].Matches = i.explainFile(ctx, fset, decorator, dstFile, typeInfo, parsedFile.Aspects)
+		for _, match := range res.Files[idx].Matches {
+			if match.IgnoredBy == nil {
+				matched[match.Aspect] = struct{}{}
+			}
+		}
+	}
+
+	for _, a := range candidates {
+		if _, found := matched[a]; !found {
+			res.NearMisses = append(res.NearMisses, a)
+		}
+	}
+
+	return res, nil
+}
+
+// explainFile traverses the file in the same way [Injector.applyAspects] does,
+// but only records join point matches. Contrary to [Injector.applyAspects], it
+// also traverses nodes suppressed by `//orchestrion:ignore` directives, so that
+// suppressed matches can be reported.
+func (i *Injector) explainFile(ctx gocontext.Context, fset *token.FileSet, decorator *decorator.Decorator, file *dst.File, typeInfo types.Info, aspects []*aspect.Aspect) []Match {
+	var (
+		chain      *context.NodeChain
+		ignored    []dst.Node
+		matches    []Match
+		references = typed.NewReferenceMap(decorator.Ast.Nodes, typeInfo.Scopes)
+		minGoLang  context.GoLangVersion
+	)
+
+	position := func(node dst.Node) token.Position {
+		if astNode := decorator.Ast.Nodes[node]; astNode != nil {
+			return fset.Position(astNode.Pos())
+		}
+		return token.Position{Filename: decorator.Filenames[file]}
+	}
+
+	pre := func(csor *dstutil.Cursor) bool {
+		if csor.Node() == nil {
+			return false
+		}
+		if isIgnored(ctx, csor.Node()) {
+			ignored = append(ignored, csor.Node())
+		}
+
+		root := chain == nil
+		chain = chain.Child(csor)
+		if root {
+			chain.SetConfig(i.RootConfig)
+		}
+		return true
+	}
+
+	post := func(csor *dstutil.Cursor) bool {
+		defer func() {
+			old := chain
+			chain = chain.Parent()
+			old.Release()
+			if len(ignored) > 0 && ignored[len(ignored)-1] == csor.Node() {
+				ignored = ignored[:len(ignored)-1]
+			}
+		}()
+
+		ctx := chain.Context(ctx, context.ContextArgs{
+			Cursor:       csor,
+			ImportPath:   decorator.Path,
+			File:         file,
+			RefMap:       &references,
+			SourceParser: decorator,
+			MinGoLang:    &minGoLang,
+			TestMain:     i.TestMain,
+			TypeInfo:     typeInfo,
+			NodeMap:      decorator.Ast.Nodes,
+		})
+		defer ctx.Release()
+
+		for _, a := range aspects {
+			if !a.JoinPoint.Matches(ctx) {
+				continue
+			}
+			match := Match{
+				Aspect:   a,
+				Position: position(csor.Node()),
+				Node:     strings.TrimPrefix(fmt.Sprintf("%T", csor.Node()), "*dst."),
+			}
+			if len(ignored) > 0 {
+				pos := position(ignored[0])
+				match.IgnoredBy = &pos
+			}
+			matches = append(matches, match)
+		}
+		return true
+	}
+
+	dstutil.Apply(file, pre, post)
+
+	// Nodes are visited in post-order, so we re-order matches by position.
+	slices.SortStableFunc(matches, func(l, r Match) int {
+		if l.Position.Line != r.Position.Line {
+			return l.Position.Line - r.Position.Line
+		}
+		return l.Position.Column - r.Position.Column
+	})
+	return matches
+}
+
+// parseForExplain parses the specified file, honoring any leading `//line`
+// directive in the same way [parse.Parser] does.
+func parseForExplain(fset *token.FileSet, filename string) (*ast.File, []byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open %q: %w", filename, err)
+	}
+	defer file.Close()
+
+	mappedFilename := filename
+	if mapped, err := parse.ConsumeLineDirective(file); err != nil {
+		return nil, nil, fmt.Errorf("peeking at first line of %q: %w", filename, err)
+	} else if mapped != "" {
+		mappedFilename = mapped
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading %q: %w", filename, err)
+	}
+
+	astFile, err := goparser.ParseFile(fset, mappedFilename, content, goparser.ParseComments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing %q: %w", filename, err)
+	}
+	return astFile, content, nil
+}
@@ -0,0 +1,118 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package injector_test
+
+import (
+	gocontext "context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/injector"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestExplain(t *testing.T) {
+	tmp := t.TempDir()
+	runGo(t, tmp, "mod", "init", testModuleName)
+
+	inputFile := filepath.Join(tmp, "input.go")
+	require.NoError(t, os.WriteFile(inputFile, []byte(strings.Join([]string{
+		"package main",
+		"",
+		`import "fmt"`,
+		"",
+		"func main() {",
+		`	fmt.Println("matched")`,
+		"	//orchestrion:ignore",
+		`	fmt.Println("suppressed")`,
+		"}",
+		"",
+	}, "\n")), 0o644))
+
+	var aspects []*aspect.Aspect
+	require.NoError(t, yaml.UnmarshalContext(gocontext.Background(), strings.NewReader(`
+- id: main-body
+  join-point:
+    function-body:
+      function:
+        - name: main
+  advice:
+    prepend-statements:
+      template: println()
+- id: println
+  join-point:
+    function-call: fmt.Println
+  advice:
+    wrap-expression:
+      template: '{{ .AST }}'
+- id: printf
+  join-point:
+    function-call: fmt.Printf
+  advice:
+    wrap-expression:
+      template: '{{ .AST }}'
+- id: http-get
+  join-point:
+    function-call: net/http.Get
+  advice:
+    wrap-expression:
+      template: '{{ .AST }}'
+`), &aspects))
+
+	inj := injector.Injector{
+		ImportPath: testModuleName,
+		ImportMap:  map[string]string{"fmt": ""},
+		Lookup: func(path string) (io.ReadCloser, error) {
+			pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedExportFile, Dir: tmp}, path)
+			if err != nil {
+				return nil, err
+			}
+			if pkgs[0].ExportFile == "" {
+				return nil, fmt.Errorf("no export file found for %q", path)
+			}
+			return os.Open(pkgs[0].ExportFile)
+		},
+	}
+
+	expl, err := inj.Explain(gocontext.Background(), []string{inputFile}, aspects)
+	require.NoError(t, err)
+	require.NoError(t, expl.TypeCheckError)
+
+	ids := func(list []*aspect.Aspect) []string {
+		res := make([]string, len(list))
+		for i, a := range list {
+			res[i] = a.ID
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"http-get"}, ids(expl.PackagePruned))
+	assert.Equal(t, []string{"printf"}, ids(expl.NearMisses))
+	require.Len(t, expl.Files, 1)
+
+	type match struct {
+		ID      string
+		Line    int
+		Ignored bool
+	}
+	var matches []match
+	for _, m := range expl.Files[0].Matches {
+		matches = append(matches, match{m.Aspect.ID, m.Position.Line, m.IgnoredBy != nil})
+	}
+	assert.Equal(t, []match{
+		{"main-body", 5, false},
+		{"println", 6, false},
+		{"println", 8, true},
+	}, matches)
+}
@@ -15,7 +15,10 @@ import (
 	"go/importer"
 	"go/token"
 	"go/types"
-	"sync"
+	"maps"
+	"runtime"
+	"slices"
+	"time"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/injector/aspect"
@@ -23,12 +26,14 @@ import (
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/parse"
 	"github.com/DataDog/orchestrion/internal/injector/typed"
+	"github.com/DataDog/orchestrion/internal/timing"
 	"github.com/dave/dst"
 	"github.com/dave/dst/decorator"
 	"github.com/dave/dst/decorator/resolver"
 	"github.com/dave/dst/decorator/resolver/gotypes"
 	"github.com/dave/dst/dstutil"
 	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
 )
 
 type (
@@ -54,8 +59,20 @@ type (
 		Lookup importer.Lookup
 		// RootConfig is the root configuration value to use.
 		RootConfig map[string]string
-
-		// restorerResolver is used to restore modified files. It's created on-demand then re-used.
+		// AttributionManifest causes an [attribution.Manifest] to be written next to each modified file, recording which
+		// aspect produced which lines of the file.
+		AttributionManifest bool
+		// Timings records the time spent in each phase of the injection, and by each aspect, if not nil.
+		Timings *timing.Recorder
+		// Concurrency is the maximum number of files that are injected concurrently, such as the value of the compiler's `-c`
+		// flag. If zero, [runtime.GOMAXPROCS] is used.
+		Concurrency int
+		// NoLineDirectives disables the `//line` directives that map the code of modified files to its location in the
+		// original source files, making the modified files suitable for being checked in.
+		NoLineDirectives bool
+
+		// restorerResolver is used to restore modified files. It's created on-demand then re-used, including by concurrent
+		// calls to injectFile, so it must be safe for concurrent use.
 		restorerResolver resolver.RestorerResolver
 	}
 
@@ -66,6 +83,8 @@ type (
 		// Filename is the name of the file that needs to be compiled in place of the original one. It may be identical to
 		// the input file if the Injector.ModifiedFile function is nil or returns identity.
 		Filename string
+		// Aspects lists the IDs of the aspects whose advice modified the file, in sorted order.
+		Aspects []string
 	}
 
 	parameters struct {
@@ -73,6 +92,10 @@ type (
 		File      *dst.File
 		TypeInfo  types.Info
 		Aspects   []*aspect.Aspect
+		// Attributor records the origin of synthetic nodes. It is nil unless [Injector.AttributionManifest] is set.
+		Attributor *attributor
+		// Profile records the time spent matching and applying aspects. It is nil unless [Injector.Timings] is set.
+		Profile *timing.Profile
 	}
 
 	result struct {
@@ -101,7 +124,9 @@ func (i *Injector) InjectFiles(ctx gocontext.Context, files []string, aspects []
 
 	fset := token.NewFileSet()
 	parser := parse.NewParser(fset, len(files))
+	start := time.Now()
 	parsedFiles, err := parser.ParseFiles(ctx, files, aspects)
+	i.Timings.Since(timing.PhaseParse, start)
 	if err != nil {
 		return nil, context.GoLangVersion{}, err
 	}
@@ -111,7 +136,9 @@ func (i *Injector) InjectFiles(ctx gocontext.Context, files []string, aspects []
 		return nil, context.GoLangVersion{}, nil
 	}
 
+	start = time.Now()
 	typeInfo, err := i.typeCheck(ctx, fset, parsedFiles)
+	i.Timings.Since(timing.PhaseTypeCheck, start)
 	if errors.Is(err, typeCheckingError{}) {
 		// We don't want to fail here on type-checking errors... Instead do nothing and let the standard
 		// go compiler/toolchain surface the error to the user in a canonical way.
@@ -121,50 +148,50 @@ func (i *Injector) InjectFiles(ctx gocontext.Context, files []string, aspects []
 		return nil, context.GoLangVersion{}, err
 	}
 
+	// Each worker only writes to its own file's slots, so that results (and errors) can be collected in the order of the
+	// input files, regardless of the order in which workers complete.
 	var (
-		wg           sync.WaitGroup
-		errs         []error
-		errsMu       sync.Mutex
-		result       = make(map[string]InjectedFile, len(parsedFiles))
-		resultGoLang context.GoLangVersion
-		resultMu     sync.Mutex
+		pool    errgroup.Group
+		results = make([]result, len(parsedFiles))
+		errs    = make([]error, len(parsedFiles))
 	)
-
-	wg.Add(len(parsedFiles))
-	for _, parsedFile := range parsedFiles {
-		go func(parsedFile parse.File) {
-			defer wg.Done()
-
+	pool.SetLimit(i.concurrency())
+	for idx, parsedFile := range parsedFiles {
+		pool.Go(func() error {
 			decorator := decorator.NewDecoratorWithImports(fset, i.ImportPath, gotypes.New(typeInfo.Uses))
 			dstFile, err := decorator.DecorateFile(parsedFile.AstFile)
 			if err != nil {
-				errsMu.Lock()
-				defer errsMu.Unlock()
-				errs = append(errs, err)
-				return
+				errs[idx] = err
+				return nil
 			}
 
-			res, err := i.injectFile(ctx, decorator, dstFile, typeInfo, parsedFile.Aspects)
-			if err != nil {
-				errsMu.Lock()
-				defer errsMu.Unlock()
-				errs = append(errs, err)
-				return
-			}
-
-			if !res.Modified {
-				return
-			}
+			results[idx], errs[idx] = i.injectFile(ctx, decorator, dstFile, typeInfo, parsedFile.Aspects)
+			return nil
+		})
+	}
+	_ = pool.Wait() // Workers never return an error, they are recorded in errs instead.
 
-			resultMu.Lock()
-			defer resultMu.Unlock()
-			result[parsedFile.Name] = res.InjectedFile
-			resultGoLang.SetAtLeast(res.GoLang)
-		}(parsedFile)
+	var (
+		injected     = make(map[string]InjectedFile, len(parsedFiles))
+		resultGoLang context.GoLangVersion
+	)
+	for idx, res := range results {
+		if errs[idx] != nil || !res.Modified {
+			continue
+		}
+		injected[parsedFiles[idx].Name] = res.InjectedFile
+		resultGoLang.SetAtLeast(res.GoLang)
 	}
-	wg.Wait()
 
-	return result, resultGoLang, errors.Join(errs...)
+	return injected, resultGoLang, errors.Join(errs...)
+}
+
+// concurrency returns the maximum number of files to inject concurrently.
+func (i *Injector) concurrency() int {
+	if i.Concurrency > 0 {
+		return i.Concurrency
+	}
+	return runtime.GOMAXPROCS(0)
 }
 
 func (i *Injector) validate() error {
@@ -182,20 +209,36 @@ func (i *Injector) validate() error {
 	return err
 }
 
-// injectFile injects code in the specified file. This method can be called concurrently by multiple goroutines,
-// as is guarded by a sync.Mutex.
+// injectFile injects code in the specified file. This method can be called concurrently by multiple goroutines, as
+// long as each one uses its own decorator; the state shared between calls is safe for concurrent use by itself: the
+// restorerResolver locks its own cache, and the Timings recorder has its own lock.
 func (i *Injector) injectFile(ctx gocontext.Context, decorator *decorator.Decorator, file *dst.File, typeInfo types.Info, aspects []*aspect.Aspect) (result, error) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "Injector.injectFile",
 		tracer.ResourceName(decorator.Filenames[file]),
 	)
 	defer span.Finish()
 
+	var attr *attributor
+	if i.AttributionManifest {
+		attr = newAttributor(decorator, file)
+	}
+
+	var profile *timing.Profile
+	if i.Timings.Enabled() {
+		profile = &timing.Profile{}
+	}
+
 	result, err := i.applyAspects(ctx, parameters{
-		Decorator: decorator,
-		File:      file,
-		TypeInfo:  typeInfo,
-		Aspects:   aspects,
+		Decorator:  decorator,
+		File:       file,
+		TypeInfo:   typeInfo,
+		Aspects:    aspects,
+		Attributor: attr,
+		Profile:    profile,
 	})
+	if profile != nil {
+		i.Timings.Merge(*profile)
+	}
 	if err != nil {
 		return result, fmt.Errorf("%q: %w", result.Filename, err)
 	}
@@ -203,7 +246,9 @@ func (i *Injector) injectFile(ctx gocontext.Context, decorator *decorator.Decora
 	if result.Modified {
 		span.SetTag("modified", true)
 
-		result.Filename, err = i.writeModifiedFile(ctx, decorator, file)
+		start := time.Now()
+		result.Filename, err = i.writeModifiedFile(ctx, decorator, file, attr)
+		i.Timings.Since(timing.PhaseWrite, start)
 		if err != nil {
 			return result, err
 		}
@@ -217,6 +262,7 @@ func (i *Injector) applyAspects(ctx gocontext.Context, params parameters) (resul
 		chain      *context.NodeChain
 		modified   bool
 		references = typed.NewReferenceMap(params.Decorator.Ast.Nodes, params.TypeInfo.Scopes)
+		applied    = make(map[string]struct{})
 		err        error
 	)
 
@@ -256,7 +302,7 @@ func (i *Injector) applyAspects(ctx gocontext.Context, params parameters) (resul
 		})
 		defer ctx.Release()
 
-		changed, err = injectNode(ctx, params.Aspects)
+		changed, err = injectNode(ctx, params.Aspects, params.Attributor, applied, params.Profile)
 		modified = modified || changed
 
 		return err == nil
@@ -278,6 +324,7 @@ func (i *Injector) applyAspects(ctx gocontext.Context, params parameters) (resul
 		InjectedFile: InjectedFile{
 			References: references,
 			Filename:   params.Decorator.Filenames[params.File],
+			Aspects:    slices.Sorted(maps.Keys(applied)),
 		},
 		Modified: modified,
 		GoLang:   minGoLang,
@@ -286,12 +333,24 @@ func (i *Injector) applyAspects(ctx gocontext.Context, params parameters) (resul
 
 // injectNode assesses all configured aspects against the current node, and performs any AST
 // transformations. It returns whether the AST was indeed modified. In case of an error, the
-// injector aborts immediately and returns the error.
-func injectNode(ctx context.AdviceContext, aspects []*aspect.Aspect) (mod bool, err error) {
+// injector aborts immediately and returns the error. If attr is not nil, nodes introduced by each
+// advice are recorded in it. The IDs of aspects that changed the AST are added to applied. If profile is not nil, the
+// time spent matching and applying each aspect is recorded in it.
+func injectNode(ctx context.AdviceContext, aspects []*aspect.Aspect, attr *attributor, applied map[string]struct{}, profile *timing.Profile) (mod bool, err error) {
 	var orderedAdvice []*advice.OrderedAdvice
 	var index int
+	var start time.Time
 	for _, inj := range aspects {
-		if !inj.JoinPoint.Matches(ctx) {
+		if profile != nil {
+			start = time.Now()
+		}
+		matches := inj.JoinPoint.Matches(ctx)
+		if profile != nil {
+			d := time.Since(start)
+			profile.AddPhase(timing.PhaseMatch, d)
+			profile.AddAspect(inj.ID, d)
+		}
+		if !matches {
 			continue
 		}
 
@@ -307,12 +366,23 @@ func injectNode(ctx context.AdviceContext, aspects []*aspect.Aspect) (mod bool,
 
 	advice.Sort(orderedAdvice)
 	for _, act := range orderedAdvice {
-		var changed bool
+		if profile != nil {
+			start = time.Now()
+		}
 		changed, err := act.Apply(ctx)
+		if profile != nil {
+			d := time.Since(start)
+			profile.AddPhase(timing.PhaseAdvice, d)
+			profile.AddAspect(act.AspectID, d)
+		}
 		mod = mod || changed
 		if err != nil {
 			return mod, fmt.Errorf("%q[%d]: %w", act.AspectID, act.Index, err)
 		}
+		if changed {
+			applied[act.AspectID] = struct{}{}
+			attr.record(ctx, act)
+		}
 	}
 	return mod, nil
 }
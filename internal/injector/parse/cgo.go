@@ -0,0 +1,77 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cgoHeader is the comment cmd/cgo starts the Go files it generates with.
+const cgoHeader = "// Code generated by cmd/cgo; DO NOT EDIT."
+
+// IsCgoSupportFile returns true if the provided file is one of the support
+// files cmd/cgo generates for a package (e.g, `_cgo_gotypes.go`), which contain
+// the Go declarations of the C symbols it uses. These are never subject to
+// aspects, as they do not correspond to any user code.
+func IsCgoSupportFile(filename string) bool {
+	return strings.HasPrefix(filepath.Base(filename), "_cgo_")
+}
+
+// isCgoTranslation returns true if the provided file is the translation of a
+// user source file by cmd/cgo.
+func isCgoTranslation(filename string) bool {
+	return strings.HasSuffix(filename, ".cgo1.go")
+}
+
+// trimCgoHeader removes the leading header of a file translated by cmd/cgo, so
+// that it starts with the "//line <original>:1:1" directive that follows it.
+func trimCgoHeader(filename string, content []byte) []byte {
+	if !isCgoTranslation(filename) {
+		return content
+	}
+	rest, found := bytes.CutPrefix(content, []byte(cgoHeader))
+	if !found {
+		return content
+	}
+	rest = bytes.TrimLeft(rest, "\r\n")
+	if !bytes.HasPrefix(rest, []byte("//line ")) {
+		return content
+	}
+	return rest
+}
+
+// ReadMappedFile reads the provided file, and returns the name of the original
+// source file it was generated from according to its leading "//line"
+// directive (or a blank string if there is none), along with its content. The
+// header of files translated by cmd/cgo is removed from the content, so that
+// they are handled like any other file starting with a "//line" directive.
+func ReadMappedFile(filename string) (string, []byte, error) {
+	mapped, content, _, err := readMappedFile(filename)
+	return mapped, content, err
+}
+
+// readMappedFile is like [ReadMappedFile], but also returns the content that
+// follows the leading "//line" directive, if any.
+func readMappedFile(filename string) (mapped string, content []byte, body []byte, err error) {
+	content, err = os.ReadFile(filename)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("reading %q: %w", filename, err)
+	}
+	content = trimCgoHeader(filename, content)
+	if len(content) == 0 {
+		return "", content, content, nil
+	}
+
+	reader := bytes.NewReader(content)
+	if mapped, err = ConsumeLineDirective(reader); err != nil {
+		return "", nil, nil, fmt.Errorf("peeking at first line of %q: %w", filename, err)
+	}
+	return mapped, content, content[len(content)-reader.Len():], nil
+}
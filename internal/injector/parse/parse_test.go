@@ -7,10 +7,16 @@ package parse
 
 import (
 	"bytes"
+	"context"
+	"go/token"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/join"
 	"github.com/stretchr/testify/require"
 )
 
@@ -70,3 +76,42 @@ func TestConsumeLineDirective(t *testing.T) {
 		})
 	}
 }
+
+func TestCgo(t *testing.T) {
+	dir := t.TempDir()
+	original := filepath.Join(dir, "db.go")
+	translated := filepath.Join(dir, "db.cgo1.go")
+	require.NoError(t, os.WriteFile(translated, []byte("// Code generated by cmd/cgo; DO NOT EDIT.\n\n//line "+original+":1:1\npackage db\n\nfunc Query() int {\n\treturn int(( /*line :4:13*/_Cfunc_query /*line :4:21*/)())\n}\n"), 0o644))
+	support := filepath.Join(dir, "_cgo_gotypes.go")
+	require.NoError(t, os.WriteFile(support, []byte("// Code generated by cmd/cgo; DO NOT EDIT.\n\npackage db\n\nfunc _Cfunc_query() int32 { return 0 }\n"), 0o644))
+
+	t.Run("ReadMappedFile", func(t *testing.T) {
+		mapped, content, err := ReadMappedFile(translated)
+		require.NoError(t, err)
+		require.Equal(t, original, mapped)
+		require.True(t, strings.HasPrefix(string(content), "//line "+original+":1:1\npackage db\n"))
+
+		mapped, content, err = ReadMappedFile(support)
+		require.NoError(t, err)
+		require.Empty(t, mapped)
+		require.True(t, strings.HasPrefix(string(content), "// Code generated by cmd/cgo; DO NOT EDIT."))
+	})
+
+	t.Run("ParseFiles", func(t *testing.T) {
+		aspects := []*aspect.Aspect{{ID: "any-function", JoinPoint: join.FunctionBody(join.Function())}}
+		fset := token.NewFileSet()
+		files, err := NewParser(fset, 2).ParseFiles(context.Background(), []string{translated, support}, aspects)
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+
+		// The translated file is mapped to the original, so that positions (and the modified file) refer to it...
+		require.Equal(t, translated, files[0].Name)
+		require.Equal(t, original, fset.Position(files[0].AstFile.Package).Filename)
+		require.Equal(t, 1, fset.Position(files[0].AstFile.Package).Line)
+		require.Equal(t, aspects, files[0].Aspects)
+
+		// ...and the support file is parsed for type-checking, but aspects never apply to it.
+		require.NotNil(t, files[1].AstFile)
+		require.Empty(t, files[1].Aspects)
+	})
+}
@@ -11,8 +11,6 @@ import (
 	"go/ast"
 	goparser "go/parser"
 	"go/token"
-	"io"
-	"os"
 	"slices"
 	"sync/atomic"
 
@@ -86,6 +84,10 @@ func (p *Parser) ParseFiles(ctx context.Context, files []string, aspects []*aspe
 			}
 
 			fileAspects := aspects
+			if IsCgoSupportFile(file) {
+				// These files are only needed for type-checking, aspects never apply to them.
+				fileAspects = nil
+			}
 			p.filesBytesCount.Add(uint64(len(p.rawFiles[idx].content)))
 			if !p.hasApplicableAspects() {
 				// While the current package still has a chance to not require all files to be parsed, we can try to filter out
@@ -186,27 +188,19 @@ func (p *Parser) fileFilterAspects(aspects []*aspect.Aspect, file rawFile) ([]*a
 }
 
 func readFile(filename string) (rawFile, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return rawFile{}, fmt.Errorf("open %q: %w", filename, err)
-	}
-	defer file.Close()
-
 	// If the file begins with a "//line <path>:1:1" directive, we consume it and
 	// then pretend the "<path>" was our filename all along. This simplifies
 	// handling of line offsets further down the line and removes some duplicated
 	// effort to do it early.
-	mappedFilename := filename
-	if mapped, err := ConsumeLineDirective(file); err != nil {
-		return rawFile{}, fmt.Errorf("peeking at first line of %q: %w", filename, err)
-	} else if mapped != "" {
-		mappedFilename = mapped
+	mapped, _, content, err := readMappedFile(filename)
+	if err != nil {
+		return rawFile{}, err
 	}
 
-	fileContent, err := io.ReadAll(file)
-	if err != nil {
-		return rawFile{}, fmt.Errorf("reading %q: %w", filename, err)
+	mappedFilename := filename
+	if mapped != "" {
+		mappedFilename = mapped
 	}
 
-	return rawFile{filename, mappedFilename, fileContent}, nil
+	return rawFile{filename, mappedFilename, content}, nil
 }
@@ -7,13 +7,19 @@ package injector
 
 import (
 	"bytes"
+	"go/scanner"
+	"go/token"
 )
 
-var lineDirectivePrefix = []byte("//line ")
+var (
+	lineDirectivePrefix       = []byte("//line ")
+	inlineLineDirectivePrefix = []byte("/*line ")
+)
 
 // postProcess modifies the provided source text to remove leading white space ahead of //line directives, as they are
 // otherwise ignored by the compiler (directives must begin at the first column of a line). It modifies the input slice
-// to avoid re-allocating (since the output is guaranteed to be the same size or smaller than the input).
+// to avoid re-allocating (since the output is guaranteed to be the same size or smaller than the input). Inline
+// directives are then re-attached to the token they apply to (see [anchorInlineDirectives]).
 func postProcess(src []byte) []byte {
 	for i := 0; i < len(src); {
 		slice := src[i:]
@@ -38,5 +44,78 @@ func postProcess(src []byte) []byte {
 		i += lf + 1
 	}
 
-	return src
+	return anchorInlineDirectives(src)
+}
+
+// anchorInlineDirectives moves inline /*line ...*/ directives, which cmd/cgo emits right before the token they apply
+// to, back against that token. The printer separates them from the following token with a blank, and prints those that
+// follow a comma before that comma, both of which shift the position of the tokens that follow. It modifies the input
+// slice, as the output is guaranteed to be the same size or smaller than the input.
+func anchorInlineDirectives(src []byte) []byte {
+	if !bytes.Contains(src, inlineLineDirectivePrefix) {
+		return src
+	}
+
+	type edit struct {
+		start, end  int
+		replacement []byte
+	}
+	var edits []edit
+
+	var scan scanner.Scanner
+	fset := token.NewFileSet()
+	scan.Init(fset.AddFile("", -1, len(src)), src, nil, scanner.ScanComments)
+
+	directive, directiveEnd := -1, -1
+	for {
+		pos, tok, lit := scan.Scan()
+		if tok == token.EOF {
+			break
+		}
+		offset := fset.Position(pos).Offset
+
+		if directive >= 0 {
+			gap := src[directiveEnd:offset]
+			switch {
+			case bytes.ContainsAny(gap, "\r\n"):
+				// The directive is at the end of the line, nothing to do.
+			case tok == token.COMMA:
+				// The directive applies to the token after the comma: "x /*line :1:2*/, y" => "x, /*line :1:2*/y"
+				start := len(bytes.TrimRight(src[:directive], " \t"))
+				end := offset + 1
+				for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+					end++
+				}
+				sep := ", "
+				if end-start < len(sep)+directiveEnd-directive {
+					// Not enough room for a blank, which is not required anyway.
+					sep = ","
+				}
+				edits = append(edits, edit{start, end, append([]byte(sep), src[directive:directiveEnd]...)})
+			case offset == directiveEnd:
+				// The directive is already against the next token.
+			default:
+				// The directive applies to the next token: "/*line :1:2*/ x" => "/*line :1:2*/x"
+				edits = append(edits, edit{directiveEnd, offset, nil})
+			}
+			directive = -1
+		}
+
+		if tok == token.COMMENT && bytes.HasPrefix([]byte(lit), inlineLineDirectivePrefix) && !bytes.ContainsAny([]byte(lit), "\r\n") {
+			directive, directiveEnd = offset, offset+len(lit)
+		}
+	}
+
+	// Apply the edits in order, compacting the source in place.
+	var (
+		write int
+		read  int
+	)
+	for _, edit := range edits {
+		write += copy(src[write:], src[read:edit.start])
+		write += copy(src[write:], edit.replacement)
+		read = edit.end
+	}
+	write += copy(src[write:], src[read:])
+	return src[:write]
 }
@@ -13,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/DataDog/orchestrion/internal/injector/attribution"
 	"github.com/DataDog/orchestrion/internal/injector/lineinfo"
 	"github.com/dave/dst"
 	"github.com/dave/dst/decorator"
@@ -20,8 +21,9 @@ import (
 )
 
 // writeModifiedFile writes the modified file to disk after having restored it to Go source code,
-// and returns the path to the modified file.
-func (i *Injector) writeModifiedFile(ctx context.Context, decorator *decorator.Decorator, file *dst.File) (string, error) {
+// and returns the path to the modified file. If attr is not nil, the corresponding attribution manifest is written next
+// to the modified file.
+func (i *Injector) writeModifiedFile(ctx context.Context, decorator *decorator.Decorator, file *dst.File, attr *attributor) (string, error) {
 	log := zerolog.Ctx(ctx)
 
 	filename := decorator.Filenames[file]
@@ -29,8 +31,10 @@ func (i *Injector) writeModifiedFile(ctx context.Context, decorator *decorator.D
 	log.Trace().Str("path", filename).Msg("Writing modified file")
 	canonicalizeImports(ctx, file)
 
-	if err := lineinfo.AnnotateMovedNodes(decorator, file, i.newRestorer); err != nil {
-		return filename, fmt.Errorf("annotating moved nodes in %q: %w", filename, err)
+	if !i.NoLineDirectives {
+		if err := lineinfo.AnnotateMovedNodes(decorator, file, i.newRestorer); err != nil {
+			return filename, fmt.Errorf("annotating moved nodes in %q: %w", filename, err)
+		}
 	}
 
 	restorer := i.newRestorer(filename)
@@ -52,9 +56,20 @@ func (i *Injector) writeModifiedFile(ctx context.Context, decorator *decorator.D
 		}
 	}
 
-	if err := os.WriteFile(filename, postProcess(buf.Bytes()), 0o644); err != nil {
+	output := postProcess(buf.Bytes())
+	if err := os.WriteFile(filename, output, 0o644); err != nil {
 		return filename, fmt.Errorf("writing %q: %w", filename, err)
 	}
 
+	if attr != nil {
+		manifest, err := attr.manifest(restorer, astFile, output)
+		if err != nil {
+			// Attribution is a diagnostic aid, failing to produce it must not fail the build.
+			log.Debug().Str("path", filename).Err(err).Msg("Unable to attribute modified code to aspects")
+		} else if err := attribution.Write(filename, manifest); err != nil {
+			return filename, fmt.Errorf("writing attribution manifest for %q: %w", filename, err)
+		}
+	}
+
 	return filename, nil
 }
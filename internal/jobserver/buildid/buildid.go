@@ -19,18 +19,30 @@ const (
 	subjectPrefix = "buildid."
 
 	versionSubject = subjectPrefix + "versionSuffix"
+	supportSubject = subjectPrefix + "support"
 )
 
-type service struct {
-	packageLoader   config.PackageLoader
-	stats           *common.CacheStats
-	resolvedVersion VersionSuffixResponse
-	mu              sync.Mutex
-}
+type (
+	service struct {
+		packageLoader config.PackageLoader
+		stats         *common.CacheStats
+		resolved      map[string]*resolution // Keyed by the directory of the build
+		mu            sync.Mutex
+	}
+	resolution struct {
+		version VersionSuffixResponse
+		support SupportResponse
+	}
+)
 
-func Subscribe(ctx context.Context, conn *nats.Conn, pkgLoader config.PackageLoader, stats *common.CacheStats) error {
-	s := &service{packageLoader: pkgLoader, stats: stats}
-	ctx = zerolog.Ctx(ctx).With().Str("nats.subject", versionSubject).Logger().WithContext(ctx)
-	_, err := conn.Subscribe(versionSubject, common.HandleRequest(ctx, s.versionSuffix))
+func Subscribe(ctx context.Context, conn *nats.Conn, pkgLoader config.PackageLoader, stats *common.Stats) error {
+	s := &service{packageLoader: pkgLoader, stats: stats.Cache(versionSubject), resolved: make(map[string]*resolution)}
+	log := zerolog.Ctx(ctx)
+	versionCtx := log.With().Str("nats.subject", versionSubject).Logger().WithContext(ctx)
+	if _, err := conn.Subscribe(versionSubject, common.HandleRequest(versionCtx, s.versionSuffix)); err != nil {
+		return err
+	}
+	supportCtx := log.With().Str("nats.subject", supportSubject).Logger().WithContext(ctx)
+	_, err := conn.Subscribe(supportSubject, common.HandleRequest(supportCtx, s.checkSupport))
 	return err
 }
@@ -0,0 +1,168 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package buildid
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/gomod"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"golang.org/x/tools/go/packages"
+)
+
+// EnvVarStrict is the environment variable that causes toolexec processes to
+// fail the build when it uses versions of modules that are not supported by
+// the integrations in use. It is set by `orchestrion go --strict`.
+const EnvVarStrict = "ORCHESTRION_STRICT"
+
+type (
+	// SupportRequest obtains the support status of the versions of the modules
+	// used by the build, according to the `meta.supports` blocks of the
+	// integrations in use.
+	SupportRequest struct {
+		// Dir is the directory of the build. The job server's working directory
+		// is used if it is blank.
+		Dir string `json:"dir,omitempty"`
+	}
+	SupportResponse []config.Support
+)
+
+func (SupportRequest) Subject() string            { return supportSubject }
+func (SupportRequest) ResponseIs(SupportResponse) {}
+func (r SupportRequest) ForeachSpanTag(set func(string, any)) {
+	if r.Dir != "" {
+		set("request.dir", r.Dir)
+	}
+}
+
+func (s *service) checkSupport(ctx context.Context, req SupportRequest) (SupportResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, found := s.resolved[dirOrDefault(req.Dir)]
+	if !found {
+		var err error
+		if res, err = s.resolve(ctx, dirOrDefault(req.Dir)); err != nil {
+			return nil, err
+		}
+	}
+	return res.support, nil
+}
+
+// err returns an error listing the unsupported module versions, if any.
+func (r SupportResponse) err() error {
+	var unsupported []string
+	for _, sup := range r {
+		if !sup.Supported {
+			unsupported = append(unsupported, "\t"+sup.String())
+		}
+	}
+	if len(unsupported) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the build uses module versions that are not supported by the integrations in use:\n%s", strings.Join(unsupported, "\n"))
+}
+
+// mainModuleVersions returns the versions of the modules in the build list of
+// the main module of dir, keyed by module path, as reported by `go list -m
+// all`. Main modules and modules replaced by a local directory have no
+// meaningful version, and are omitted. It fails in vendor mode, where the build list is not known
+// (see [vendoredVersions]).
+func mainModuleVersions(ctx context.Context, dir string) (map[string]string, error) {
+	flags, err := goflags.Flags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"list", "-m", "-json"}
+	for _, flag := range [...]string{"-mod", "-modfile"} {
+		if val, found := flags.Get(flag); found {
+			args = append(args, flag+"="+val)
+		}
+	}
+	args = append(args, "all")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running `go %s`: %w\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+
+	versions := make(map[string]string)
+	for dec := json.NewDecoder(&stdout); dec.More(); {
+		var mod packages.Module
+		if err := dec.Decode(&mod); err != nil {
+			return nil, fmt.Errorf("parsing `go list -m` output: %w", err)
+		}
+		if mod.Main {
+			continue
+		}
+		version := mod.Version
+		if mod.Replace != nil {
+			version = mod.Replace.Version
+		}
+		if version == "" {
+			continue
+		}
+		versions[mod.Path] = version
+	}
+	return versions, nil
+}
+
+// vendoredVersions returns the versions of the modules listed in the
+// `vendor/modules.txt` file of the main module of dir, keyed by module path. These are
+// all the modules providing packages to the build in vendor mode.
+func vendoredVersions(dir string) (map[string]string, error) {
+	goMod, err := goenv.GOMOD(dir)
+	if err != nil {
+		return nil, err
+	}
+	vendored, err := gomod.VendoredModules(goMod)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]string, len(vendored))
+	for path, mod := range vendored {
+		version := mod.Version
+		if mod.Replace.Path != "" {
+			version = mod.Replace.Version
+		}
+		if version == "" {
+			continue
+		}
+		versions[path] = version
+	}
+	return versions, nil
+}
+
+// moduleVersions returns the versions of the provided modules, keyed by module
+// path. Modules replaced by a local directory have no meaningful version, and
+// are omitted.
+func moduleVersions(modules map[string]*moduleInfo) map[string]string {
+	versions := make(map[string]string, len(modules))
+	for path, mod := range modules {
+		if mod.shouldHashContent() {
+			continue
+		}
+		version := mod.Version
+		if mod.Replace != nil {
+			version = mod.Replace.Version
+		}
+		versions[path] = version
+	}
+	return versions
+}
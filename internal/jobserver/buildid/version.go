@@ -31,47 +31,88 @@ import (
 )
 
 type (
-	VersionSuffixRequest  struct{}
+	VersionSuffixRequest struct {
+		// Strict causes the request to fail if the build uses versions of modules
+		// that are not supported by the integrations in use (see
+		// [config.CheckSupport]).
+		Strict bool `json:"strict,omitempty"`
+		// Dir is the directory of the build. The job server's working directory
+		// is used if it is blank.
+		Dir string `json:"dir,omitempty"`
+	}
 	VersionSuffixResponse string
 )
 
 func (VersionSuffixRequest) Subject() string                  { return versionSubject }
 func (VersionSuffixRequest) ResponseIs(VersionSuffixResponse) {}
-func (VersionSuffixRequest) ForeachSpanTag(func(string, any)) {}
-
-func (s *service) versionSuffix(ctx context.Context, _ VersionSuffixRequest) (VersionSuffixResponse, error) {
-	log := zerolog.Ctx(ctx)
+func (r VersionSuffixRequest) ForeachSpanTag(set func(string, any)) {
+	if r.Strict {
+		set("request.strict", true)
+	}
+	if r.Dir != "" {
+		set("request.dir", r.Dir)
+	}
+}
 
+func (s *service) versionSuffix(ctx context.Context, req VersionSuffixRequest) (VersionSuffixResponse, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.resolvedVersion != "" {
+	res, found := s.resolved[dirOrDefault(req.Dir)]
+	if found {
 		s.stats.RecordHit()
-		return s.resolvedVersion, nil
+	} else {
+		s.stats.RecordMiss()
+		var err error
+		if res, err = s.resolve(ctx, dirOrDefault(req.Dir)); err != nil {
+			return "", err
+		}
+	}
+
+	if req.Strict {
+		if err := res.support.err(); err != nil {
+			return "", err
+		}
 	}
-	s.stats.RecordMiss()
+	return res.version, nil
+}
+
+// dirOrDefault returns dir, or the working directory if it is blank.
+func dirOrDefault(dir string) string {
+	if dir == "" {
+		return "."
+	}
+	return dir
+}
+
+// resolve computes the version suffix, as well as the support status of the
+// modules used by the build of the provided directory, and records them in the
+// service's cache. It must be called while holding the service's lock.
+func (s *service) resolve(ctx context.Context, dir string) (*resolution, error) {
+	log := zerolog.Ctx(ctx)
 
-	cfg, err := config.NewLoader(s.packageLoader, ".", false).Load(ctx)
+	cfg, err := config.NewLoader(s.packageLoader, dir, false).Load(ctx)
 	if err != nil {
-		return "", fmt.Errorf("loading injector configuration: %w", err)
+		return nil, fmt.Errorf("loading injector configuration: %w", err)
 	}
 	aspects := cfg.Aspects()
 
 	fptr := fingerprint.New()
 	defer fptr.Close()
 	if err := fptr.Named("aspects", fingerprint.List[*aspect.Aspect](aspects)); err != nil {
-		return "", fmt.Errorf("computing injector configuration fingerprint: %w", err)
+		return nil, fmt.Errorf("computing injector configuration fingerprint: %w", err)
 	}
 
 	var pkgs []*packages.Package
 	if paths := aspect.InjectedPaths(aspects); len(paths) != 0 {
 		flags, err := goflags.Flags(ctx)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		pkgs, err = packages.Load(
 			&packages.Config{
+				Dir:        dir,
 				Mode:       packages.NeedDeps | packages.NeedEmbedFiles | packages.NeedFiles | packages.NeedImports | packages.NeedModule,
 				BuildFlags: append(flags.Except("-toolexec").Slice(), "-toolexec="), // Explicitly disable toolexec to avoid infinite recursion
 				Logf:       func(format string, args ...any) { log.Trace().Str("operation", "packages.Load").Msgf(format, args...) },
@@ -79,7 +120,7 @@ func (s *service) versionSuffix(ctx context.Context, _ VersionSuffixRequest) (Ve
 			paths...,
 		)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
@@ -97,16 +138,44 @@ func (s *service) versionSuffix(ctx context.Context, _ VersionSuffixRequest) (Ve
 		mod := modules[name]
 		jsonMod, err := json.Marshal(mod)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		log.Trace().RawJSON("module", jsonMod).Msg("Adding module to fingerprint...")
 		if err := fptr.Named(name, fingerprint.String(jsonMod)); err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
-	s.resolvedVersion = VersionSuffixResponse(fmt.Sprintf("orchestrion@%s%s;%s", version.Tag(), getTagSuffix(ctx), fptr.Finish()))
-	return s.resolvedVersion, nil
+	versions, err := mainModuleVersions(ctx, dir)
+	if err != nil {
+		if vendored, vendorErr := vendoredVersions(dir); vendorErr == nil {
+			versions = vendored
+		} else {
+			log.Warn().Err(err).Msg("Unable to list the modules of the main module; only checking the support of modules providing injected packages")
+			versions = moduleVersions(modules)
+		}
+	}
+	support, err := config.CheckSupport(cfg, versions)
+	if err != nil {
+		return nil, fmt.Errorf("checking supported module versions: %w", err)
+	}
+	for _, sup := range support {
+		if !sup.Supported {
+			log.Warn().
+				Str("integration", sup.Integration).
+				Str("module", sup.Module).
+				Str("version", sup.Version).
+				Str("range", sup.Range).
+				Msg("The build uses a module version that is not supported by this integration")
+		}
+	}
+
+	res := &resolution{
+		version: VersionSuffixResponse(fmt.Sprintf("orchestrion@%s%s;%s", version.Tag(), getTagSuffix(ctx), fptr.Finish())),
+		support: support,
+	}
+	s.resolved[dir] = res
+	return res, nil
 }
 
 type moduleInfo struct {
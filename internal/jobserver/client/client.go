@@ -9,7 +9,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/ext"
@@ -23,15 +25,24 @@ import (
 const (
 	Username   = "orchestrion"
 	NoPassword = "" // We only use account management to have access to system events, not for security.
+
+	unixSocketScheme = "unix://"
 )
 
 type Client struct {
 	conn *nats.Conn
 }
 
+// UnixSocketURL returns the URL of a job server listening on the Unix domain
+// socket at the specified path.
+func UnixSocketURL(path string) string {
+	return unixSocketScheme + path
+}
+
 // Connect creates a new client connected to the NATS server at the specified
-// address. It implements exponential backoff retry logic to handle temporary
-// connection issues, especially on slower CI environments.
+// address, which may be a URL returned by [UnixSocketURL]. It implements
+// exponential backoff retry logic to handle temporary connection issues,
+// especially on slower CI environments.
 func Connect(addr string) (*Client, error) {
 	const (
 		maxRetries     = 15                    // Increased for very slow CI environments
@@ -40,16 +51,24 @@ func Connect(addr string) (*Client, error) {
 		natsTimeout    = 3 * time.Second       // Increased connection timeout
 	)
 
+	url := addr
+	opts := []nats.Option{
+		nats.Name(fmt.Sprintf("orchestrion[%d]", os.Getpid())),
+		nats.UserInfo(Username, NoPassword),
+		nats.Timeout(natsTimeout),
+	}
+	if path, ok := strings.CutPrefix(addr, unixSocketScheme); ok {
+		// The NATS client only knows about TCP, so we dial the socket ourselves
+		// and give it a placeholder URL.
+		url = "nats://localhost:0"
+		opts = append(opts, nats.SetCustomDialer(unixDialer{path: path, timeout: natsTimeout}))
+	}
+
 	var lastErr error
 	backoff := initialBackoff
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		conn, err := nats.Connect(
-			addr,
-			nats.Name(fmt.Sprintf("orchestrion[%d]", os.Getpid())),
-			nats.UserInfo(Username, NoPassword),
-			nats.Timeout(natsTimeout),
-		)
+		conn, err := nats.Connect(url, opts...)
 		if err == nil {
 			if attempt > 0 {
 				log.Debug().
@@ -85,6 +104,17 @@ func Connect(addr string) (*Client, error) {
 	return nil, fmt.Errorf("failed to connect to NATS job server at %s after %d attempts: %w", addr, maxRetries, lastErr)
 }
 
+// unixDialer is a [nats.CustomDialer] that connects to a Unix domain socket,
+// regardless of the address it is asked to dial.
+type unixDialer struct {
+	path    string
+	timeout time.Duration
+}
+
+func (d unixDialer) Dial(string, string) (net.Conn, error) {
+	return net.DialTimeout("unix", d.path, d.timeout)
+}
+
 func New(conn *nats.Conn) *Client {
 	return &Client{conn: conn}
 }
@@ -58,8 +58,19 @@ func FromEnvironment(ctx context.Context, workDir string) (*Client, error) {
 		if err != nil {
 			return nil, err
 		}
-		client = c
-		return client, nil
+		var mismatch *VersionMismatchError
+		if err := c.Handshake(ctx); errors.As(err, &mismatch) && workDir != "" {
+			// Fall back to a job server rooted in the working directory, which will
+			// be running the expected version.
+			log.Warn().Err(err).Str(EnvVarJobserverURL, url).Msg("Ignoring incompatible job server")
+			c.Close()
+		} else if err != nil {
+			c.Close()
+			return nil, err
+		} else {
+			client = c
+			return client, nil
+		}
 	}
 
 	if workDir == "" {
@@ -120,6 +131,14 @@ func FromEnvironment(ctx context.Context, workDir string) (*Client, error) {
 	return client, nil
 }
 
+// ConnectURLFile returns a new client connected to the job server whose URL is
+// recorded in the designated URL file. Callers are responsible for calling
+// [Client.Close] on the returned client.
+func ConnectURLFile(ctx context.Context, path string) (*Client, error) {
+	c, _, err := clientFromURLFile(ctx, path)
+	return c, err
+}
+
 func clientFromURLFile(ctx context.Context, path string) (*Client, string, error) {
 	log := zerolog.Ctx(ctx)
 
@@ -162,6 +181,20 @@ func waitForURLFile(ctx context.Context, path string, cmd *exec.Cmd, exitChan <-
 	for {
 		// First, try to connect to the client from the URL file.
 		c, url, err := clientFromURLFile(ctx, path)
+		if err == nil {
+			err = c.Handshake(ctx)
+			var mismatch *VersionMismatchError
+			if errors.As(err, &mismatch) {
+				// The URL file designates a server left over by another version of
+				// orchestrion. The server process we started replaces it, so we keep
+				// waiting for it to update the URL file.
+				log.Debug().Err(err).Str("url-file", path).Str("url", url).Msg("Job server is incompatible, waiting for it to be replaced...")
+				c.Close()
+				url = ""
+			} else if err != nil {
+				c.Close()
+			}
+		}
 		if err == nil {
 			// There was no error, so we are good to go!
 			client = c
@@ -0,0 +1,90 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/version"
+	"github.com/nats-io/nats.go"
+)
+
+// ProtocolVersion is the version of the job server protocol: the set of
+// subjects served by the job server, and the schema of their requests and
+// responses. It must be incremented whenever any of these changes in a way
+// that is not compatible with older clients or servers.
+const ProtocolVersion = 1
+
+const (
+	HandshakeSubject = "server.handshake"
+
+	handshakeTimeout = 5 * time.Second
+)
+
+type (
+	// HandshakeRequest requests the versions of the job server.
+	HandshakeRequest struct{}
+	// HandshakeResponse describes the versions of the job server.
+	HandshakeResponse struct {
+		// Version is the orchestrion version the job server was built from.
+		Version string `json:"version"`
+		// ProtocolVersion is the job server's [ProtocolVersion].
+		ProtocolVersion int `json:"protocolVersion"`
+	}
+
+	// VersionMismatchError is returned by [Handshake] when the job server is not
+	// compatible with this client.
+	VersionMismatchError struct {
+		// Server describes the job server's versions. Servers that pre-date the
+		// handshake have a blank version and a protocol version of 0.
+		Server HandshakeResponse
+	}
+)
+
+func (HandshakeRequest) Subject() string                  { return HandshakeSubject }
+func (HandshakeRequest) ResponseIs(*HandshakeResponse)    {}
+func (HandshakeRequest) ForeachSpanTag(func(string, any)) {}
+
+// CurrentHandshake returns the versions of the running orchestrion build.
+func CurrentHandshake() *HandshakeResponse {
+	return &HandshakeResponse{Version: version.Tag(), ProtocolVersion: ProtocolVersion}
+}
+
+func (e *VersionMismatchError) Error() string {
+	current := CurrentHandshake()
+	if e.Server.ProtocolVersion == 0 {
+		return fmt.Sprintf("job server pre-dates protocol versioning, expected orchestrion %s (protocol %d)", current.Version, current.ProtocolVersion)
+	}
+	return fmt.Sprintf(
+		"job server runs orchestrion %s (protocol %d), expected orchestrion %s (protocol %d)",
+		e.Server.Version, e.Server.ProtocolVersion, current.Version, current.ProtocolVersion,
+	)
+}
+
+// Handshake verifies that the job server the client is connected to runs the
+// same orchestrion version and protocol as this process. It returns a
+// [*VersionMismatchError] if that is not the case.
+func (c *Client) Handshake(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	res, err := Request(ctx, c, HandshakeRequest{})
+	if errors.Is(err, nats.ErrNoResponders) {
+		// Servers that pre-date the handshake don't respond to it at all.
+		return &VersionMismatchError{}
+	}
+	if err != nil {
+		return fmt.Errorf("job server handshake: %w", err)
+	}
+
+	if current := CurrentHandshake(); *res != *current {
+		return &VersionMismatchError{Server: *res}
+	}
+	return nil
+}
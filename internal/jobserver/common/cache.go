@@ -24,8 +24,9 @@ type (
 	}
 
 	CacheStats struct {
-		total atomic.Uint64
-		hits  atomic.Uint64
+		total  atomic.Uint64
+		hits   atomic.Uint64
+		parent *CacheStats // Aggregated statistics this is part of, if any
 	}
 )
 
@@ -41,16 +42,15 @@ func NewCache[V any](stats *CacheStats) Cache[V] {
 // returns an error, the cache slot is not marked as loaded, and the error is
 // returned as-is.
 func (c *Cache[V]) Load(key string, loader func() (V, error)) (V, error) {
-	c.stats.total.Add(1)
-
 	s := c.slot(key)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if s.loaded {
-		c.stats.hits.Add(1)
+		c.stats.RecordHit()
 		return s.value, nil
 	}
+	c.stats.RecordMiss()
 
 	v, err := loader()
 	if err != nil {
@@ -84,12 +84,16 @@ func (c *Cache[V]) slot(key string) *slot[V] {
 }
 
 func (c *CacheStats) RecordHit() {
-	c.total.Add(1)
-	c.hits.Add(1)
+	for ; c != nil; c = c.parent {
+		c.total.Add(1)
+		c.hits.Add(1)
+	}
 }
 
 func (c *CacheStats) RecordMiss() {
-	c.total.Add(1)
+	for ; c != nil; c = c.parent {
+		c.total.Add(1)
+	}
 }
 
 // Hits returns the count of cache accesses that resulted in a hit.
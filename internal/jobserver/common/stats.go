@@ -0,0 +1,169 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package common
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Stats is a registry of named statistics about the activity of job server
+	// services. The zero value is ready to use, and all methods are safe for
+	// concurrent use. A nil *Stats discards all statistics.
+	Stats struct {
+		aggregate CacheStats // Aggregated statistics of all caches
+
+		mu       sync.Mutex
+		caches   map[string]*CacheStats
+		counters map[string]*atomic.Uint64
+		timers   map[string]*Timer
+	}
+
+	// Timer records the number and duration of occurrences of an operation.
+	Timer struct {
+		count atomic.Uint64
+		total atomic.Int64 // Nanoseconds
+		max   atomic.Int64 // Nanoseconds
+	}
+
+	// StatsSnapshot is a point-in-time copy of the content of [Stats].
+	StatsSnapshot struct {
+		Caches   map[string]CacheSnapshot `json:"caches,omitempty"`
+		Counters map[string]uint64        `json:"counters,omitempty"`
+		Timers   map[string]TimerSnapshot `json:"timers,omitempty"`
+	}
+	CacheSnapshot struct {
+		Hits  uint64 `json:"hits"`
+		Total uint64 `json:"total"`
+	}
+	TimerSnapshot struct {
+		Count uint64        `json:"count"`
+		Total time.Duration `json:"total"`
+		Max   time.Duration `json:"max"`
+	}
+)
+
+// Cache returns the [CacheStats] with the given name, creating it if needed.
+// Hits and misses recorded by it are also accounted for in [Stats.Aggregate].
+func (s *Stats) Cache(name string) *CacheStats {
+	if s == nil {
+		return &CacheStats{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.caches == nil {
+		s.caches = make(map[string]*CacheStats)
+	}
+	c, found := s.caches[name]
+	if !found {
+		c = &CacheStats{parent: &s.aggregate}
+		s.caches[name] = c
+	}
+	return c
+}
+
+// Aggregate returns the statistics of all caches combined.
+func (s *Stats) Aggregate() *CacheStats {
+	if s == nil {
+		return &CacheStats{}
+	}
+	return &s.aggregate
+}
+
+// Count increments the counter with the given name.
+func (s *Stats) Count(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counters == nil {
+		s.counters = make(map[string]*atomic.Uint64)
+	}
+	c, found := s.counters[name]
+	if !found {
+		c = &atomic.Uint64{}
+		s.counters[name] = c
+	}
+	c.Add(1)
+}
+
+// Observe records an occurrence of the operation with the given name, which
+// started at the given time and just completed.
+func (s *Stats) Observe(name string, start time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.timers == nil {
+		s.timers = make(map[string]*Timer)
+	}
+	t, found := s.timers[name]
+	if !found {
+		t = &Timer{}
+		s.timers[name] = t
+	}
+	s.mu.Unlock()
+
+	t.record(time.Since(start))
+}
+
+// ObserveCache records an occurrence of the cached operation with the given
+// name, separating the durations of cache hits and misses.
+func (s *Stats) ObserveCache(name string, start time.Time, hit bool) {
+	if hit {
+		s.Observe(name+".hit", start)
+	} else {
+		s.Observe(name+".miss", start)
+	}
+}
+
+// Snapshot returns a copy of the current statistics.
+func (s *Stats) Snapshot() StatsSnapshot {
+	var snap StatsSnapshot
+	if s == nil {
+		return snap
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.caches) > 0 {
+		snap.Caches = make(map[string]CacheSnapshot, len(s.caches))
+		for name, c := range s.caches {
+			snap.Caches[name] = CacheSnapshot{Hits: c.Hits(), Total: c.Count()}
+		}
+	}
+	if len(s.counters) > 0 {
+		snap.Counters = make(map[string]uint64, len(s.counters))
+		for name, c := range s.counters {
+			snap.Counters[name] = c.Load()
+		}
+	}
+	if len(s.timers) > 0 {
+		snap.Timers = make(map[string]TimerSnapshot, len(s.timers))
+		for name, t := range s.timers {
+			snap.Timers[name] = TimerSnapshot{
+				Count: t.count.Load(),
+				Total: time.Duration(t.total.Load()),
+				Max:   time.Duration(t.max.Load()),
+			}
+		}
+	}
+	return snap
+}
+
+func (t *Timer) record(d time.Duration) {
+	t.count.Add(1)
+	t.total.Add(int64(d))
+	for {
+		current := t.max.Load()
+		if int64(d) <= current || t.max.CompareAndSwap(current, int64(d)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package common_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	var stats common.Stats
+
+	cache := common.NewCache[int](stats.Cache("test.cache"))
+	for range 3 {
+		_, err := cache.Load("key", func() (int, error) { return 42, nil })
+		require.NoError(t, err)
+	}
+	stats.Cache("other.cache").RecordMiss()
+
+	stats.Count("test.event")
+	stats.Count("test.event")
+	stats.ObserveCache("test.op", time.Now().Add(-time.Second), false)
+	stats.ObserveCache("test.op", time.Now().Add(-3*time.Second), false)
+
+	snap := stats.Snapshot()
+	assert.Equal(t, map[string]common.CacheSnapshot{
+		"test.cache":  {Hits: 2, Total: 3},
+		"other.cache": {Hits: 0, Total: 1},
+	}, snap.Caches)
+	assert.Equal(t, map[string]uint64{"test.event": 2}, snap.Counters)
+	require.Contains(t, snap.Timers, "test.op.miss")
+	assert.NotContains(t, snap.Timers, "test.op.hit")
+	timer := snap.Timers["test.op.miss"]
+	assert.EqualValues(t, 2, timer.Count)
+	assert.GreaterOrEqual(t, timer.Total, 4*time.Second)
+	assert.GreaterOrEqual(t, timer.Max, 3*time.Second)
+	assert.Less(t, timer.Max, timer.Total)
+
+	// All caches are accounted for in the aggregate statistics.
+	assert.EqualValues(t, 2, stats.Aggregate().Hits())
+	assert.EqualValues(t, 4, stats.Aggregate().Count())
+
+	// A nil registry discards everything.
+	var nilStats *common.Stats
+	nilStats.Count("test.event")
+	nilStats.Cache("test.cache").RecordHit()
+	assert.Equal(t, common.StatsSnapshot{}, nilStats.Snapshot())
+}
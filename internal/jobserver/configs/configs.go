@@ -0,0 +1,39 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package configs
+
+import (
+	"context"
+
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	subjectPrefix = "config."
+
+	loadSubject = subjectPrefix + "load"
+)
+
+type service struct {
+	packageLoader config.PackageLoader
+	loaded        common.Cache[[]*aspect.Aspect]
+	stats         *common.Stats
+}
+
+func Subscribe(ctx context.Context, conn *nats.Conn, pkgLoader config.PackageLoader, stats *common.Stats) error {
+	s := &service{
+		packageLoader: pkgLoader,
+		loaded:        common.NewCache[[]*aspect.Aspect](stats.Cache(loadSubject)),
+		stats:         stats,
+	}
+	ctx = zerolog.Ctx(ctx).With().Str("nats.subject", loadSubject).Logger().WithContext(ctx)
+	_, err := conn.Subscribe(loadSubject, common.HandleRequest(ctx, s.load))
+	return err
+}
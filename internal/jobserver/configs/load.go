@@ -0,0 +1,117 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package configs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/rs/zerolog"
+)
+
+type (
+	// LoadRequest is a request to load the injector configuration from a given
+	// directory (usually where `go.mod` is). The result is cached for a given
+	// directory and set of build flags, so the configuration is only parsed once
+	// per build, instead of once per compiled package.
+	LoadRequest struct {
+		Dir string `json:"dir"`
+		// Package, if set, restricts the response to the aspects that may match
+		// the designated package, so that the compile process only decodes those.
+		Package *Package `json:"package,omitempty"`
+	}
+	// Package describes the package being compiled, as needed to determine which
+	// aspects may match it (see [join.Point.PackageMayMatch]).
+	Package struct {
+		// ImportPath is the import path of the package.
+		ImportPath string `json:"importPath"`
+		// Imports is the list of import paths listed in the package's `-importcfg`
+		// file.
+		Imports []string `json:"imports,omitempty"`
+		// TestMain is true if the package is a test main package.
+		TestMain bool `json:"testMain,omitempty"`
+	}
+	// LoadResponse is the response to a [LoadRequest]. The aspects can be
+	// obtained using [config.DecodeAspects].
+	LoadResponse struct {
+		Aspects json.RawMessage `json:"aspects"`
+	}
+)
+
+func (LoadRequest) Subject() string         { return loadSubject }
+func (LoadRequest) ResponseIs(LoadResponse) {}
+func (r LoadRequest) ForeachSpanTag(set func(key string, value any)) {
+	set("request.dir", r.Dir)
+	if r.Package != nil {
+		set("request.import-path", r.Package.ImportPath)
+	}
+}
+
+func (s *service) load(ctx context.Context, req LoadRequest) (LoadResponse, error) {
+	log := zerolog.Ctx(ctx)
+
+	goFlags, err := goflags.Flags(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to obtain go build flags")
+	}
+	// Flags that do not affect which packages are resolved are not part of the cache key.
+	flags := goFlags.Except("-a", "-toolexec").Slice()
+
+	start, hit := time.Now(), true
+	defer func() { s.stats.ObserveCache(loadSubject, start, hit) }()
+
+	aspects, err := s.loaded.Load(req.Dir+"\u0000"+strings.Join(flags, "\u0000"), func() ([]*aspect.Aspect, error) {
+		hit = false
+		cfg, err := config.NewLoader(s.packageLoader, req.Dir, false).Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("loading injector configuration: %w", err)
+		}
+		aspects := cfg.Aspects()
+		log.Debug().Str("dir", req.Dir).Int("aspects", len(aspects)).Msg("Loaded injector configuration")
+		return aspects, nil
+	})
+	if err != nil {
+		return LoadResponse{}, err
+	}
+
+	if req.Package != nil {
+		aspects = req.Package.filter(aspects)
+	}
+	data, err := config.EncodeAspects(aspects)
+	if err != nil {
+		return LoadResponse{}, fmt.Errorf("encoding injector configuration: %w", err)
+	}
+	return LoadResponse{Aspects: data}, nil
+}
+
+// filter returns the aspects that may match the package. Decoding aspects is
+// comparatively expensive, and most packages are not matched by any aspect.
+func (p *Package) filter(aspects []*aspect.Aspect) []*aspect.Aspect {
+	ctx := &may.PackageContext{
+		ImportPath: p.ImportPath,
+		ImportMap:  make(map[string]string, len(p.Imports)),
+		TestMain:   p.TestMain,
+	}
+	for _, path := range p.Imports {
+		// Only the keys of the import map are used to determine matches.
+		ctx.ImportMap[path] = ""
+	}
+
+	res := make([]*aspect.Aspect, 0, len(aspects))
+	for _, a := range aspects {
+		if a.JoinPoint.PackageMayMatch(ctx) != may.NeverMatch {
+			res = append(res, a)
+		}
+	}
+	return res
+}
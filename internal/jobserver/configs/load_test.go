@@ -0,0 +1,86 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package configs
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	goflags.SetFlags(ctx, ".", []string{"build"})
+
+	_, thisFile, _, _ := runtime.Caller(0)
+	repoRoot := filepath.Join(thisFile, "..", "..", "..", "..")
+
+	var stats common.CacheStats
+	subject := &service{loaded: common.NewCache[[]*aspect.Aspect](&stats)}
+
+	res, err := subject.load(ctx, LoadRequest{Dir: repoRoot})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), stats.Hits())
+
+	aspects, err := config.DecodeAspects(ctx, res.Aspects)
+	require.NoError(t, err)
+	ids := make([]string, len(aspects))
+	for idx, a := range aspects {
+		ids[idx] = a.ID
+	}
+	assert.Equal(t, []string{"built.WithOrchestrion", "built.WithOrchestrionVersion"}, ids)
+
+	// Subsequent requests for the same directory are served from the cache.
+	again, err := subject.load(ctx, LoadRequest{Dir: repoRoot})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), stats.Hits())
+	assert.Equal(t, res, again)
+
+}
+
+func TestLoadPackage(t *testing.T) {
+	ctx := context.Background()
+	goflags.SetFlags(ctx, ".", []string{"build"})
+
+	_, thisFile, _, _ := runtime.Caller(0)
+	samplesDir := filepath.Join(thisFile, "..", "..", "..", "..", "samples")
+
+	var stats common.CacheStats
+	subject := &service{loaded: common.NewCache[[]*aspect.Aspect](&stats)}
+
+	load := func(pkg *Package) []string {
+		t.Helper()
+		res, err := subject.load(ctx, LoadRequest{Dir: samplesDir, Package: pkg})
+		require.NoError(t, err)
+		aspects, err := config.DecodeAspects(ctx, res.Aspects)
+		require.NoError(t, err)
+		ids := make([]string, len(aspects))
+		for idx, a := range aspects {
+			ids[idx] = a.ID
+		}
+		return ids
+	}
+
+	all := load(nil)
+	unrelated := load(&Package{ImportPath: "example.com/unrelated"})
+	http := load(&Package{ImportPath: "example.com/server", Imports: []string{"net/http"}})
+
+	// Only the aspects that may match the package are served.
+	assert.Less(t, len(unrelated), len(http))
+	assert.Less(t, len(http), len(all))
+	assert.Subset(t, all, http)
+	assert.Subset(t, http, unrelated)
+	// The configuration itself is only loaded once.
+	assert.Equal(t, uint64(2), stats.Hits())
+}
@@ -0,0 +1,104 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package events defines the build events published by the job server as
+// packages are compiled, which can be used to report on the progress of a
+// build, or to analyze where instrumentation time is spent.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/timing"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+// Subject is the NATS subject on which build events are published.
+const Subject = "build.events"
+
+type (
+	// Event describes something that happened to a package during the build.
+	Event struct {
+		// Time is the time at which the event occurred.
+		Time time.Time `json:"time"`
+		// Kind is the kind of event.
+		Kind Kind `json:"kind"`
+		// ImportPath is the import path of the package the event is about.
+		ImportPath string `json:"importPath"`
+		// Source identifies where artifacts were re-used from, for [KindReused]
+		// events.
+		Source Source `json:"source,omitempty"`
+		// Aspects lists the IDs of the aspects that modified the package, for
+		// [KindFinished] events.
+		Aspects []string `json:"aspects,omitempty"`
+		// ModifiedFiles lists the source files of the package that were modified,
+		// for [KindFinished] events.
+		ModifiedFiles []string `json:"modifiedFiles,omitempty"`
+		// Timings is the time spent instrumenting the package, for [KindFinished]
+		// and [KindFailed] events of builds that measure it.
+		Timings *timing.Profile `json:"timings,omitempty"`
+		// Duration is the time elapsed since the package compilation started, for
+		// [KindFinished] and [KindFailed] events.
+		Duration time.Duration `json:"duration,omitempty"`
+		// Error is the error message of [KindFailed] events.
+		Error string `json:"error,omitempty"`
+	}
+
+	Kind   string
+	Source string
+)
+
+const (
+	// KindStarted is emitted when the compilation of a package starts.
+	KindStarted Kind = "started"
+	// KindReused is emitted when a package is not compiled, and artifacts from a
+	// previous compilation are re-used instead.
+	KindReused Kind = "reused"
+	// KindFinished is emitted when the compilation of a package succeeds.
+	KindFinished Kind = "finished"
+	// KindFailed is emitted when the compilation of a package fails.
+	KindFailed Kind = "failed"
+)
+
+const (
+	// SourceBuild designates artifacts produced earlier in the same build.
+	SourceBuild Source = "build"
+	// SourceStore designates artifacts obtained from the persistent store.
+	SourceStore Source = "store"
+)
+
+// Publish publishes the event on the provided connection. Failures are logged,
+// as build events are purely informational. If the event has no time, it is set
+// to the current time.
+func Publish(ctx context.Context, conn *nats.Conn, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	data, err := json.Marshal(event)
+	if err == nil {
+		err = conn.Publish(Subject, data)
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Str("import-path", event.ImportPath).Msg("Failed to publish build event")
+	}
+}
+
+// Subscribe calls handler with every build event published on the provided
+// connection. The handler is called sequentially, in the order events were
+// received.
+func Subscribe(ctx context.Context, conn *nats.Conn, handler func(Event)) (*nats.Subscription, error) {
+	return conn.Subscribe(Subject, func(msg *nats.Msg) {
+		var event Event
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to decode build event")
+			return
+		}
+		handler(event)
+	})
+}
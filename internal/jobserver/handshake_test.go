@@ -0,0 +1,59 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package jobserver_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/jobserver"
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/version"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandshake(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("compatible", func(t *testing.T) {
+		server, err := jobserver.New(ctx, &jobserver.Options{NoListener: true})
+		require.NoError(t, err)
+		defer server.Shutdown()
+
+		conn, err := server.Connect()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		require.NoError(t, conn.Handshake(ctx))
+
+		stats, err := client.Request(ctx, conn, jobserver.StatsRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, version.Tag(), stats.Version)
+		assert.Equal(t, client.ProtocolVersion, stats.ProtocolVersion)
+	})
+
+	t.Run("pre-dates handshake", func(t *testing.T) {
+		// A bare NATS server behaves like a job server without a handshake handler.
+		srv, err := server.NewServer(&server.Options{DontListen: true})
+		require.NoError(t, err)
+		srv.Start()
+		defer srv.Shutdown()
+		require.True(t, srv.ReadyForConnections(5*time.Second))
+
+		nc, err := nats.Connect("nats://localhost:0", nats.InProcessServer(srv))
+		require.NoError(t, err)
+		conn := client.New(nc)
+		defer conn.Close()
+
+		var mismatch *client.VersionMismatchError
+		require.ErrorAs(t, conn.Handshake(ctx), &mismatch)
+		assert.Zero(t, mismatch.Server.ProtocolVersion)
+	})
+}
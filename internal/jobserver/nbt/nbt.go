@@ -13,9 +13,12 @@ import (
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/DataDog/orchestrion/internal/files"
 	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/DataDog/orchestrion/internal/jobserver/events"
+	"github.com/DataDog/orchestrion/internal/timing"
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
@@ -26,16 +29,28 @@ const (
 
 	startSubject  = subjectPrefix + "start"
 	finishSubject = subjectPrefix + "finish"
+
+	// Names of the statistics recorded by the service.
+	statReuse      = subjectPrefix + "reuse"
+	statStoreReuse = subjectPrefix + "store.reuse"
+	statError      = subjectPrefix + "error"
+	statWait       = subjectPrefix + "wait"
 )
 
 type (
 	service struct {
 		state sync.Map
 		dir   string
+		store *Store // Optional persistent store, shared across builds
+		stats *common.Stats
+		// publish publishes build events. It may be nil, in which case no events are
+		// published.
+		publish func(events.Event)
 	}
 	buildState struct {
 		initOnce sync.Once
 		buildID  string
+		started  time.Time       // When the original task started
 		token    string          // Finalization token
 		onDone   func()          // Called once the original task has completed
 		done     <-chan struct{} // Blocks until the original task has completed
@@ -46,7 +61,10 @@ type (
 	}
 )
 
-func Subscribe(ctx context.Context, conn *nats.Conn) (cleanup func(context.Context) error, resErr error) {
+// Subscribe installs the never-build-twice service handlers on the provided
+// connection. If store is not nil, produced files are persisted in it so they
+// can be re-used by subsequent builds.
+func Subscribe(ctx context.Context, conn *nats.Conn, store *Store, stats *common.Stats) (cleanup func(context.Context) error, resErr error) {
 	dir, err := os.MkdirTemp("", "orchestrion.nbt-*")
 	if err != nil {
 		return nil, fmt.Errorf("creating storage directory: %w", err)
@@ -60,7 +78,12 @@ func Subscribe(ctx context.Context, conn *nats.Conn) (cleanup func(context.Conte
 		}
 	}()
 
-	s := &service{dir: dir}
+	s := &service{
+		dir:     dir,
+		store:   store,
+		stats:   stats,
+		publish: func(event events.Event) { events.Publish(ctx, conn, event) },
+	}
 	_, err = conn.Subscribe(startSubject,
 		common.HandleRequest(
 			zerolog.Ctx(ctx).With().Str("nats.subject", startSubject).Logger().WithContext(ctx),
@@ -134,6 +157,7 @@ func (s *service) start(ctx context.Context, req StartRequest) (*StartResponse,
 	if req.ImportPath == "" || req.BuildID == "" {
 		return nil, fmt.Errorf("invalid request: %#v", req)
 	}
+	s.stats.Count(startSubject)
 
 	key := cacheKey(req.ImportPath, req.BuildID)
 	rawState, reused := s.state.LoadOrStore(key, &buildState{buildID: req.BuildID})
@@ -141,6 +165,7 @@ func (s *service) start(ctx context.Context, req StartRequest) (*StartResponse,
 
 	// Initialize the build state.
 	state.initOnce.Do(func() {
+		state.started = time.Now()
 		state.token = uuid.NewString()
 		// We use a cancellable context as a barrier here...
 		ctx, isDone := context.WithCancel(ctx)
@@ -157,7 +182,9 @@ func (s *service) start(ctx context.Context, req StartRequest) (*StartResponse,
 		zerolog.Ctx(ctx).Trace().Str("token", state.token).Str("import-path", req.ImportPath).Msg("Waiting for concurrent task to complete...")
 		defer zerolog.Ctx(ctx).Trace().Str("token", state.token).Str("import-path", req.ImportPath).Msg("Concurrent was completed!")
 
+		start := time.Now()
 		<-state.done
+		s.stats.Observe(statWait, start)
 		if state.error != nil {
 			return nil, state.error
 		}
@@ -168,11 +195,24 @@ func (s *service) start(ctx context.Context, req StartRequest) (*StartResponse,
 			return nil, context.Canceled
 		}
 
+		s.stats.Count(statReuse)
+		s.emit(events.Event{Kind: events.KindReused, ImportPath: req.ImportPath, Source: events.SourceBuild})
 		return &StartResponse{Files: state.files}, nil
 	}
 
+	// Otherwise, try to re-use the outcome of a previous build...
+	if files := s.lookup(ctx, req); files != nil {
+		state.files = files
+		state.isDone.Store(true)
+		state.onDone()
+		s.stats.Count(statStoreReuse)
+		s.emit(events.Event{Kind: events.KindReused, ImportPath: req.ImportPath, Source: events.SourceStore})
+		return &StartResponse{Files: files}, nil
+	}
+
 	// Otherwise, return a finalization token, etc...
 	zerolog.Ctx(ctx).Trace().Str("token", state.token).Str("import-path", req.ImportPath).Msg("Compile task started")
+	s.emit(events.Event{Time: state.started, Kind: events.KindStarted, ImportPath: req.ImportPath})
 	return &StartResponse{FinishToken: state.token}, nil
 }
 
@@ -190,6 +230,13 @@ type (
 		// Files is a list of files produced by the compilation task, associated to
 		// a user-defined label.
 		Files map[Label]string `json:"extra,omitempty"`
+		// Aspects lists the IDs of the aspects that modified the package, if any.
+		Aspects []string `json:"aspects,omitempty"`
+		// ModifiedFiles lists the source files of the package that were modified,
+		// if any.
+		ModifiedFiles []string `json:"modifiedFiles,omitempty"`
+		// Timings is the time spent instrumenting the package, if measured.
+		Timings *timing.Profile `json:"timings,omitempty"`
 		// Error is the error that occurred as a result of this compilation task, if
 		// any.
 		Error *string `json:"error,omitempty"`
@@ -244,12 +291,28 @@ func (s *service) finish(ctx context.Context, req FinishRequest) (*FinishRespons
 	}
 
 	defer state.onDone()
+	defer func() {
+		event := events.Event{
+			Kind:          events.KindFinished,
+			ImportPath:    req.ImportPath,
+			Aspects:       req.Aspects,
+			ModifiedFiles: req.ModifiedFiles,
+			Timings:       req.Timings,
+			Duration:      time.Since(state.started),
+		}
+		if state.error != nil {
+			event.Kind, event.Error = events.KindFailed, state.error.Error()
+		}
+		s.emit(event)
+	}()
+	s.stats.Count(finishSubject)
 	log.Debug().
 		Any("files", req.Files).
 		Any("error", req.Error).
 		Msg("Compile task finished")
 
 	if req.Error != nil {
+		s.stats.Count(statError)
 		state.error = errors.New(*req.Error)
 		return &FinishResponse{}, nil
 	}
@@ -259,8 +322,7 @@ func (s *service) finish(ctx context.Context, req FinishRequest) (*FinishRespons
 		return nil, state.error
 	}
 
-	// Use composite key for storage directory to support different build IDs (e.g., with/without PGO)
-	dir := filepath.Join(s.dir, uuid.NewSHA1(ns, []byte(cacheKey(req.ImportPath, req.BuildID))).String())
+	dir := s.storageDir(req.ImportPath, req.BuildID)
 	if err := os.Mkdir(dir, 0o755); err != nil {
 		state.error = fmt.Errorf("creating storage directory: %w", err)
 		return nil, state.error
@@ -277,9 +339,58 @@ func (s *service) finish(ctx context.Context, req FinishRequest) (*FinishRespons
 		state.files[label] = filename
 	}
 
+	if s.store != nil {
+		if err := s.store.Insert(ctx, req.ImportPath, req.BuildID, state.files); err != nil {
+			log.Warn().Err(err).Msg("Failed to persist files in the persistent store")
+		}
+	}
+
 	return &FinishResponse{}, nil
 }
 
+// emit publishes the provided build event, if the service publishes events.
+func (s *service) emit(event events.Event) {
+	if s.publish != nil {
+		s.publish(event)
+	}
+}
+
+// lookup attempts to retrieve the files produced by a previous build from the
+// persistent store, if there is one. It returns nil if no usable files were
+// found.
+func (s *service) lookup(ctx context.Context, req StartRequest) map[Label]string {
+	if s.store == nil {
+		return nil
+	}
+
+	log := zerolog.Ctx(ctx).With().Str("import-path", req.ImportPath).Logger()
+	dir := s.storageDir(req.ImportPath, req.BuildID)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		log.Warn().Err(err).Msg("Failed to create storage directory")
+		return nil
+	}
+
+	files, found, err := s.store.Lookup(ctx, req.ImportPath, req.BuildID, dir)
+	if err != nil || !found {
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to look up the persistent store")
+		}
+		// Clean up, so that the storage directory can be re-used by [service.finish].
+		if err := os.RemoveAll(dir); err != nil {
+			log.Warn().Err(err).Msg("Failed to remove storage directory")
+		}
+		return nil
+	}
+	return files
+}
+
+// storageDir returns the directory in which files produced by the build of the
+// specified package are stored. It uses a composite key to support different
+// build IDs (e.g., with/without PGO).
+func (s *service) storageDir(importPath string, buildID string) string {
+	return filepath.Join(s.dir, uuid.NewSHA1(ns, []byte(cacheKey(importPath, buildID))).String())
+}
+
 // ns is an arbitrary UUID used as a namespace for hashing import paths when storing artifacts in
 // the temporary storage location.
 var ns = uuid.MustParse("4BFB6F4B-212C-43A0-A581-A29C8B3D3BE4")
@@ -11,7 +11,10 @@ import (
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/DataDog/orchestrion/internal/jobserver/events"
+	"github.com/DataDog/orchestrion/internal/timing"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -90,6 +93,49 @@ func Test(t *testing.T) {
 		require.NotNil(t, res)
 	})
 
+	t.Run("events", func(t *testing.T) {
+		var (
+			mu       sync.Mutex
+			received []events.Event
+		)
+		subject := &service{dir: t.TempDir(), publish: func(event events.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, event)
+		}}
+		buildID := uuid.NewString()
+
+		start, err := subject.start(ctx, StartRequest{ImportPath: importPath, BuildID: buildID})
+		require.NoError(t, err)
+
+		archive := filepath.Join(t.TempDir(), "_pkg_.a")
+		require.NoError(t, os.WriteFile(archive, []byte(uuid.NewString()), 0o644))
+		_, err = subject.finish(ctx, FinishRequest{
+			ImportPath:    importPath,
+			BuildID:       buildID,
+			FinishToken:   start.FinishToken,
+			Files:         map[Label]string{LabelArchive: archive},
+			Aspects:       []string{"test-aspect"},
+			ModifiedFiles: []string{"main.go"},
+			Timings:       &timing.Profile{Phases: map[timing.Phase]time.Duration{timing.PhaseParse: time.Millisecond}},
+		})
+		require.NoError(t, err)
+
+		_, err = subject.start(ctx, StartRequest{ImportPath: importPath, BuildID: buildID})
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, received, 3)
+		assert.Equal(t, events.KindStarted, received[0].Kind)
+		assert.Equal(t, events.KindFinished, received[1].Kind)
+		assert.Equal(t, []string{"test-aspect"}, received[1].Aspects)
+		assert.Equal(t, []string{"main.go"}, received[1].ModifiedFiles)
+		assert.Positive(t, received[1].Duration)
+		assert.Equal(t, time.Millisecond, received[1].Timings.Total())
+		assert.Equal(t, events.Event{Kind: events.KindReused, ImportPath: importPath, Source: events.SourceBuild}, received[2])
+	})
+
 	t.Run("start-finish-finish", func(t *testing.T) {
 		const importPath = "github.com/DataDog/orchestrion.test"
 		subject := &service{dir: t.TempDir()}
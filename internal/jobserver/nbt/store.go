@@ -0,0 +1,555 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package nbt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/cacheprog"
+	"github.com/DataDog/orchestrion/internal/filelock"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/dustin/go-humanize"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// DefaultStoreMaxSize is the default maximum size of a persistent [Store].
+const DefaultStoreMaxSize int64 = 1 << 30 // 1 GiB
+
+const (
+	// EnvVarStore enables the persistent store when set to a true value.
+	EnvVarStore = "ORCHESTRION_NBT_STORE"
+	// EnvVarStoreDir sets the directory of the persistent store, and implies
+	// [EnvVarStore].
+	EnvVarStoreDir = "ORCHESTRION_NBT_STORE_DIR"
+	// EnvVarStoreMaxSize sets the maximum size of the persistent store, in
+	// human-readable form (e.g, "1GiB").
+	EnvVarStoreMaxSize = "ORCHESTRION_NBT_STORE_MAX_SIZE"
+)
+
+const (
+	storeLockFile     = ".lock"
+	storeSizeFile     = ".size"
+	storeStagingDir   = ".staging"
+	storeManifestFile = "manifest.json"
+)
+
+type (
+	// Store is a persistent, content-addressed store for the files produced by
+	// compilation tasks, keyed by import path and build ID. It can be shared by
+	// several job servers (including concurrently running ones), and allows
+	// re-using synthetic dependencies across builds.
+	Store struct {
+		dir     string
+		maxSize int64
+		remote  cacheprog.Backend // Optional backend shared by several machines
+		uploads sync.WaitGroup    // Uploads to remote being processed
+
+		// mu guards the file lock, which is not safe for concurrent use by several
+		// goroutines.
+		mu   sync.Mutex
+		lock *filelock.Mutex
+	}
+
+	// manifest describes the content of a [Store] entry.
+	manifest struct {
+		ImportPath string               `json:"importPath"`
+		BuildID    string               `json:"buildID"`
+		Files      map[Label]fileDigest `json:"files"`
+	}
+	fileDigest struct {
+		Size   int64  `json:"size"`
+		SHA256 string `json:"sha256"`
+	}
+)
+
+// StoreSettings resolves the directory and maximum size of the persistent
+// store from user-provided settings. It returns a blank directory if the store
+// is not enabled. The default directory is `$GOCACHE/orchestrion/nbt`.
+func StoreSettings(enabled bool, dir string, maxSize string) (string, int64, error) {
+	if dir == "" && !enabled {
+		return "", 0, nil
+	}
+
+	if dir == "" {
+		goCache, err := goenv.GOCACHE()
+		if err != nil {
+			return "", 0, fmt.Errorf("locating the persistent store directory: %w", err)
+		}
+		dir = filepath.Join(goCache, "orchestrion", "nbt")
+	}
+
+	if maxSize == "" {
+		return dir, DefaultStoreMaxSize, nil
+	}
+	size, err := humanize.ParseBytes(maxSize)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid maximum size %q: %w", maxSize, err)
+	}
+	return dir, int64(size), nil
+}
+
+// OpenStore opens (creating it if necessary) a persistent [Store] rooted in
+// the provided directory. The store is trimmed to at most maxSize bytes by
+// evicting least recently used entries when new entries are added. If maxSize
+// is not positive, [DefaultStoreMaxSize] is used. If remote is not nil, entries
+// are also shared through it.
+func OpenStore(dir string, maxSize int64, remote cacheprog.Backend) (*Store, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultStoreMaxSize
+	}
+	if err := os.MkdirAll(filepath.Join(dir, storeStagingDir), 0o755); err != nil {
+		return nil, fmt.Errorf("creating store directory: %w", err)
+	}
+	return &Store{
+		dir:     dir,
+		maxSize: maxSize,
+		remote:  remote,
+		lock:    filelock.MutexAt(filepath.Join(dir, storeLockFile)),
+	}, nil
+}
+
+// Lookup copies the files stored for the given import path and build ID into
+// destDir, verifying their integrity in the process. It returns false if the
+// store has no such entry. Corrupted entries are removed from the store and
+// reported as missing. If the store has a remote backend, entries missing
+// locally are fetched from it.
+func (s *Store) Lookup(ctx context.Context, importPath string, buildID string, destDir string) (map[Label]string, bool, error) {
+	files, found, err := s.lookup(ctx, importPath, buildID, destDir)
+	if found || err != nil || s.remote == nil {
+		return files, found, err
+	}
+
+	if err := s.fetch(ctx, importPath, buildID); err != nil {
+		if !errors.Is(err, cacheprog.ErrNotFound) {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("import-path", importPath).Msg("Failed to fetch entry from remote cache")
+		}
+		return nil, false, nil
+	}
+	return s.lookup(ctx, importPath, buildID, destDir)
+}
+
+func (s *Store) lookup(ctx context.Context, importPath string, buildID string, destDir string) (map[Label]string, bool, error) {
+	log := zerolog.Ctx(ctx).With().Str("import-path", importPath).Logger()
+	entryDir := s.entryDir(importPath, buildID)
+
+	files, err := s.withLock(ctx, false, func() (map[Label]string, error) {
+		man, err := readManifest(entryDir)
+		if err != nil {
+			return nil, err
+		}
+		if err := man.validate(importPath, buildID); err != nil {
+			return nil, err
+		}
+
+		files := make(map[Label]string, len(man.Files))
+		for label, digest := range man.Files {
+			filename := filepath.Join(destDir, string(label))
+			if err := copyVerified(filepath.Join(entryDir, string(label)), filename, digest); err != nil {
+				return nil, err
+			}
+			files[label] = filename
+		}
+
+		// Record the access, so that least recently used entries are evicted first.
+		now := time.Now()
+		if err := os.Chtimes(filepath.Join(entryDir, storeManifestFile), now, now); err != nil {
+			log.Warn().Err(err).Msg("Failed to record access to persistent store entry")
+		}
+		return files, nil
+	})
+
+	switch {
+	case err == nil:
+		log.Debug().Str("entry", entryDir).Msg("Re-using files from persistent store")
+		return files, true, nil
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, false, nil
+	case errors.Is(err, errCorrupted):
+		log.Warn().Err(err).Str("entry", entryDir).Msg("Removing corrupted persistent store entry")
+		_, err := s.withLock(ctx, true, func() (map[Label]string, error) { return nil, os.RemoveAll(entryDir) })
+		return nil, false, err
+	default:
+		return nil, false, err
+	}
+}
+
+// Insert adds the provided files to the store for the given import path and
+// build ID, then evicts least recently used entries until the store fits its
+// maximum size. Inserting an entry that already exists is a no-op. If the store
+// has a remote backend, the entry is also stored there in the background (see
+// [Store.Wait]).
+func (s *Store) Insert(ctx context.Context, importPath string, buildID string, files map[Label]string) error {
+	man, err := s.install(ctx, importPath, buildID, func(staging string) (map[Label]fileDigest, error) {
+		digests := make(map[Label]fileDigest, len(files))
+		for label, path := range files {
+			digest, err := copyDigest(path, filepath.Join(staging, string(label)))
+			if err != nil {
+				return nil, fmt.Errorf("staging %q (%q): %w", path, label, err)
+			}
+			digests[label] = digest
+		}
+		return digests, nil
+	})
+	if err != nil || s.remote == nil {
+		return err
+	}
+
+	// Uploads happen in the background, so they do not slow down the build.
+	s.uploads.Add(1)
+	go func() {
+		defer s.uploads.Done()
+		if err := s.upload(context.WithoutCancel(ctx), man, files); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("import-path", importPath).Msg("Failed to store entry in remote cache")
+		}
+	}()
+	return nil
+}
+
+// Wait blocks until all uploads to the remote backend have completed. The files
+// inserted in the store must remain available until then.
+func (s *Store) Wait() {
+	s.uploads.Wait()
+}
+
+// install creates a new entry for the given import path and build ID, using
+// stage to populate it, then evicts least recently used entries until the
+// store fits its maximum size.
+func (s *Store) install(ctx context.Context, importPath string, buildID string, stage func(staging string) (map[Label]fileDigest, error)) (manifest, error) {
+	staging, err := os.MkdirTemp(filepath.Join(s.dir, storeStagingDir), "entry-*")
+	if err != nil {
+		return manifest{}, fmt.Errorf("creating staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	digests, err := stage(staging)
+	if err != nil {
+		return manifest{}, err
+	}
+	man := manifest{ImportPath: importPath, BuildID: buildID, Files: digests}
+	data, err := json.Marshal(man)
+	if err != nil {
+		return manifest{}, err
+	}
+	// The manifest is written last, so its presence indicates a complete entry.
+	if err := os.WriteFile(filepath.Join(staging, storeManifestFile), data, 0o644); err != nil {
+		return manifest{}, fmt.Errorf("writing manifest: %w", err)
+	}
+	size := int64(len(data))
+	for _, digest := range digests {
+		size += digest.Size
+	}
+
+	entryDir := s.entryDir(importPath, buildID)
+	_, err = s.withLock(ctx, true, func() (map[Label]string, error) {
+		if _, err := os.Stat(entryDir); err == nil {
+			// Another process has already stored this entry.
+			return nil, nil
+		}
+		if err := os.MkdirAll(filepath.Dir(entryDir), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(staging, entryDir); err != nil {
+			return nil, fmt.Errorf("moving entry into place: %w", err)
+		}
+		return nil, s.grow(ctx, size)
+	})
+	return man, err
+}
+
+// fetch retrieves an entry from the remote backend, and installs it in the
+// store. It returns [cacheprog.ErrNotFound] if the remote has no such entry.
+func (s *Store) fetch(ctx context.Context, importPath string, buildID string) error {
+	_, body, err := s.remote.Get(ctx, remoteManifestID(importPath, buildID))
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return err
+	}
+
+	var man manifest
+	if err := json.Unmarshal(data, &man); err != nil {
+		return fmt.Errorf("%w: invalid manifest: %w", errCorrupted, err)
+	}
+	if err := man.validate(importPath, buildID); err != nil {
+		return err
+	}
+
+	_, err = s.install(ctx, importPath, buildID, func(staging string) (map[Label]fileDigest, error) {
+		for label, digest := range man.Files {
+			_, body, err := s.remote.Get(ctx, remoteFileID(digest))
+			if err != nil {
+				return nil, fmt.Errorf("fetching %q: %w", label, err)
+			}
+			actual, err := writeDigest(body, filepath.Join(staging, string(label)))
+			body.Close()
+			if err != nil {
+				return nil, err
+			}
+			if actual != digest {
+				return nil, fmt.Errorf("%w: digest mismatch for %q", errCorrupted, label)
+			}
+		}
+		return man.Files, nil
+	})
+	return err
+}
+
+// upload stores an entry in the remote backend. The manifest is stored last, so
+// that its presence indicates all files are available.
+func (s *Store) upload(ctx context.Context, man manifest, files map[Label]string) error {
+	now := time.Now()
+	for label, digest := range man.Files {
+		outputID, err := hex.DecodeString(digest.SHA256)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(files[label])
+		if err != nil {
+			return err
+		}
+		err = s.remote.Put(ctx, cacheprog.Entry{ActionID: remoteFileID(digest), OutputID: outputID, Size: digest.Size, Time: now}, file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("storing %q: %w", label, err)
+		}
+	}
+
+	data, err := json.Marshal(man)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	entry := cacheprog.Entry{ActionID: remoteManifestID(man.ImportPath, man.BuildID), OutputID: sum[:], Size: int64(len(data)), Time: now}
+	return s.remote.Put(ctx, entry, bytes.NewReader(data))
+}
+
+// grow records that size bytes were added to the store, and evicts least
+// recently used entries if it no longer fits within its maximum size. The total
+// size of the store is tracked in a file, so that the whole store only needs to
+// be scanned when entries must be evicted, or when that file is missing. It
+// must be called while holding the write lock.
+func (s *Store) grow(ctx context.Context, size int64) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, storeSizeFile))
+	if err != nil {
+		return s.evict(ctx)
+	}
+	total, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return s.evict(ctx)
+	}
+
+	total += size
+	if total > s.maxSize {
+		return s.evict(ctx)
+	}
+	return s.writeSize(total)
+}
+
+// writeSize records the total size of the store. It must be called while
+// holding the write lock.
+func (s *Store) writeSize(total int64) error {
+	return os.WriteFile(filepath.Join(s.dir, storeSizeFile), []byte(strconv.FormatInt(total, 10)), 0o644)
+}
+
+// evict computes the total size of the store, and removes least recently used
+// entries until it fits within 90% of its maximum size if it exceeds it, so
+// that eviction does not happen again on the next insertion. It must be called
+// while holding the write lock.
+func (s *Store) evict(ctx context.Context) error {
+	type entry struct {
+		dir     string
+		size    int64
+		lastUse time.Time
+	}
+
+	var (
+		entries []entry
+		total   int64
+	)
+	manifests, err := filepath.Glob(filepath.Join(s.dir, "*", "*", storeManifestFile))
+	if err != nil {
+		return err
+	}
+	for _, path := range manifests {
+		dir := filepath.Dir(path)
+		if filepath.Base(filepath.Dir(dir)) == storeStagingDir {
+			// Entries being staged are not part of the store yet.
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		size, err := dirSize(dir)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{dir: dir, size: size, lastUse: stat.ModTime()})
+		total += size
+	}
+	if total <= s.maxSize {
+		return s.writeSize(total)
+	}
+
+	slices.SortFunc(entries, func(l, r entry) int { return l.lastUse.Compare(r.lastUse) })
+	log := zerolog.Ctx(ctx)
+	target := s.maxSize / 10 * 9
+	for _, e := range entries {
+		if total <= target {
+			break
+		}
+		log.Debug().Str("entry", e.dir).Int64("size", e.size).Msg("Evicting persistent store entry")
+		if err := os.RemoveAll(e.dir); err != nil {
+			return errors.Join(fmt.Errorf("evicting %q: %w", e.dir, err), s.writeSize(total))
+		}
+		total -= e.size
+	}
+	return s.writeSize(total)
+}
+
+// withLock calls cb while holding the store's lock, for writing if exclusive is
+// true, or for reading otherwise.
+func (s *Store) withLock(ctx context.Context, exclusive bool, cb func() (map[Label]string, error)) (res map[Label]string, resErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock := s.lock.RLock
+	if exclusive {
+		lock = s.lock.Lock
+	}
+	if err := lock(ctx); err != nil {
+		return nil, fmt.Errorf("locking persistent store: %w", err)
+	}
+	defer func() {
+		resErr = errors.Join(resErr, s.lock.Unlock(ctx))
+	}()
+
+	return cb()
+}
+
+func (s *Store) entryDir(importPath string, buildID string) string {
+	id := uuid.NewSHA1(ns, []byte(cacheKey(importPath, buildID))).String()
+	return filepath.Join(s.dir, id[:2], id)
+}
+
+var errCorrupted = errors.New("corrupted store entry")
+
+// validate checks that the manifest describes the entry for the given import
+// path and build ID, and that its labels are valid file names.
+func (m manifest) validate(importPath string, buildID string) error {
+	if m.ImportPath != importPath || m.BuildID != buildID {
+		return fmt.Errorf("%w: entry is for %q (%q)", errCorrupted, m.ImportPath, m.BuildID)
+	}
+	for label := range m.Files {
+		if name := string(label); name == "" || name == "." || name == ".." || name == storeManifestFile || filepath.Base(name) != name {
+			return fmt.Errorf("%w: invalid label %q", errCorrupted, label)
+		}
+	}
+	return nil
+}
+
+// remoteManifestID returns the action ID under which the manifest of an entry
+// is stored in a remote backend.
+func remoteManifestID(importPath string, buildID string) []byte {
+	sum := sha256.Sum256([]byte("orchestrion nbt manifest\x00" + cacheKey(importPath, buildID)))
+	return sum[:]
+}
+
+// remoteFileID returns the action ID under which a file with the given digest
+// is stored in a remote backend.
+func remoteFileID(digest fileDigest) []byte {
+	sum := sha256.Sum256([]byte("orchestrion nbt file\x00" + digest.SHA256))
+	return sum[:]
+}
+
+func readManifest(dir string) (manifest, error) {
+	var man manifest
+	data, err := os.ReadFile(filepath.Join(dir, storeManifestFile))
+	if err != nil {
+		return man, err
+	}
+	if err := json.Unmarshal(data, &man); err != nil {
+		return man, fmt.Errorf("%w: invalid manifest: %w", errCorrupted, err)
+	}
+	return man, nil
+}
+
+// copyDigest copies oldname to newname, and returns the digest of the copied
+// content.
+func copyDigest(oldname string, newname string) (fileDigest, error) {
+	in, err := os.Open(oldname)
+	if err != nil {
+		return fileDigest{}, err
+	}
+	defer in.Close()
+	return writeDigest(in, newname)
+}
+
+// writeDigest writes the content of in to newname, and returns its digest.
+func writeDigest(in io.Reader, newname string) (fileDigest, error) {
+	out, err := os.Create(newname)
+	if err != nil {
+		return fileDigest{}, err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), in)
+	if err != nil {
+		return fileDigest{}, err
+	}
+	return fileDigest{Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, out.Close()
+}
+
+// copyVerified copies oldname to newname, and returns an error wrapping
+// [errCorrupted] if the copied content does not match the expected digest.
+func copyVerified(oldname string, newname string, expected fileDigest) error {
+	actual, err := copyDigest(oldname, newname)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: missing %q", errCorrupted, oldname)
+	}
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("%w: digest mismatch for %q", errCorrupted, oldname)
+	}
+	return nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,200 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package nbt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/cacheprog"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	const importPath = "github.com/DataDog/orchestrion.test"
+
+	writeFile := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "_pkg_.a")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	t.Run("insert-lookup", func(t *testing.T) {
+		store, err := OpenStore(t.TempDir(), 0, nil)
+		require.NoError(t, err)
+		buildID := uuid.NewString()
+
+		_, found, err := store.Lookup(ctx, importPath, buildID, t.TempDir())
+		require.NoError(t, err)
+		require.False(t, found)
+
+		content := uuid.NewString()
+		require.NoError(t, store.Insert(ctx, importPath, buildID, map[Label]string{LabelArchive: writeFile(t, content)}))
+
+		files, found, err := store.Lookup(ctx, importPath, buildID, t.TempDir())
+		require.NoError(t, err)
+		require.True(t, found)
+		actual, err := os.ReadFile(files[LabelArchive])
+		require.NoError(t, err)
+		assert.Equal(t, content, string(actual))
+
+		// A different build ID of the same package is a different entry.
+		_, found, err = store.Lookup(ctx, importPath, uuid.NewString(), t.TempDir())
+		require.NoError(t, err)
+		require.False(t, found)
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		store, err := OpenStore(t.TempDir(), 0, nil)
+		require.NoError(t, err)
+		buildID := uuid.NewString()
+
+		require.NoError(t, store.Insert(ctx, importPath, buildID, map[Label]string{LabelArchive: writeFile(t, uuid.NewString())}))
+
+		// Tamper with the stored archive...
+		entryDir := store.entryDir(importPath, buildID)
+		require.NoError(t, os.WriteFile(filepath.Join(entryDir, string(LabelArchive)), []byte("tampered"), 0o644))
+
+		_, found, err := store.Lookup(ctx, importPath, buildID, t.TempDir())
+		require.NoError(t, err)
+		require.False(t, found)
+		assert.NoDirExists(t, entryDir)
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		const entrySize = 1_024
+		// Large enough for two entries (including their manifest), not three.
+		store, err := OpenStore(t.TempDir(), 3*entrySize, nil)
+		require.NoError(t, err)
+
+		buildIDs := []string{uuid.NewString(), uuid.NewString(), uuid.NewString()}
+		content := string(make([]byte, entrySize))
+
+		require.NoError(t, store.Insert(ctx, importPath, buildIDs[0], map[Label]string{LabelArchive: writeFile(t, content)}))
+		require.NoError(t, store.Insert(ctx, importPath, buildIDs[1], map[Label]string{LabelArchive: writeFile(t, content)}))
+
+		// Make the first entry the most recently used one...
+		past := time.Now().Add(-time.Hour)
+		require.NoError(t, os.Chtimes(filepath.Join(store.entryDir(importPath, buildIDs[1]), storeManifestFile), past, past))
+		_, found, err := store.Lookup(ctx, importPath, buildIDs[0], t.TempDir())
+		require.NoError(t, err)
+		require.True(t, found)
+
+		// Inserting a third entry evicts the least recently used one.
+		require.NoError(t, store.Insert(ctx, importPath, buildIDs[2], map[Label]string{LabelArchive: writeFile(t, content)}))
+
+		for idx, found := range []bool{true, false, true} {
+			_, actual, err := store.Lookup(ctx, importPath, buildIDs[idx], t.TempDir())
+			require.NoError(t, err)
+			assert.Equal(t, found, actual, "entry #%d", idx)
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := OpenStore(dir, 0, nil)
+		require.NoError(t, err)
+
+		storedSize := func() string {
+			data, err := os.ReadFile(filepath.Join(dir, storeSizeFile))
+			require.NoError(t, err)
+			return string(data)
+		}
+		actualSize := func(buildIDs ...string) string {
+			var total int64
+			for _, buildID := range buildIDs {
+				size, err := dirSize(store.entryDir(importPath, buildID))
+				require.NoError(t, err)
+				total += size
+			}
+			return strconv.FormatInt(total, 10)
+		}
+
+		// The total size of the store is tracked as entries are inserted...
+		require.NoError(t, store.Insert(ctx, importPath, "a", map[Label]string{LabelArchive: writeFile(t, uuid.NewString())}))
+		require.NoError(t, store.Insert(ctx, importPath, "b", map[Label]string{LabelArchive: writeFile(t, uuid.NewString())}))
+		assert.Equal(t, actualSize("a", "b"), storedSize())
+
+		// ... and computed again if it is unknown.
+		require.NoError(t, os.Remove(filepath.Join(dir, storeSizeFile)))
+		require.NoError(t, store.Insert(ctx, importPath, "c", map[Label]string{LabelArchive: writeFile(t, uuid.NewString())}))
+		assert.Equal(t, actualSize("a", "b", "c"), storedSize())
+
+		// Inserting an existing entry does not change the size.
+		require.NoError(t, store.Insert(ctx, importPath, "b", map[Label]string{LabelArchive: writeFile(t, uuid.NewString())}))
+		assert.Equal(t, actualSize("a", "b", "c"), storedSize())
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		remote, err := cacheprog.NewDir(t.TempDir())
+		require.NoError(t, err)
+		buildID := uuid.NewString()
+		content := uuid.NewString()
+
+		// A first machine stores an entry...
+		first, err := OpenStore(t.TempDir(), 0, remote)
+		require.NoError(t, err)
+		require.NoError(t, first.Insert(ctx, importPath, buildID, map[Label]string{LabelArchive: writeFile(t, content)}))
+		// Uploads happen in the background.
+		first.Wait()
+
+		// Another machine, with a separate local store, re-uses it...
+		second, err := OpenStore(t.TempDir(), 0, remote)
+		require.NoError(t, err)
+		files, found, err := second.Lookup(ctx, importPath, buildID, t.TempDir())
+		require.NoError(t, err)
+		require.True(t, found)
+		actual, err := os.ReadFile(files[LabelArchive])
+		require.NoError(t, err)
+		assert.Equal(t, content, string(actual))
+		assert.FileExists(t, filepath.Join(second.entryDir(importPath, buildID), storeManifestFile))
+
+		_, found, err = second.Lookup(ctx, importPath, uuid.NewString(), t.TempDir())
+		require.NoError(t, err)
+		require.False(t, found)
+	})
+
+	t.Run("service", func(t *testing.T) {
+		store, err := OpenStore(t.TempDir(), 0, nil)
+		require.NoError(t, err)
+		buildID := uuid.NewString()
+		content := uuid.NewString()
+
+		// A first job server builds the package...
+		first := &service{dir: t.TempDir(), store: store}
+		start, err := first.start(ctx, StartRequest{ImportPath: importPath, BuildID: buildID})
+		require.NoError(t, err)
+		require.NotEmpty(t, start.FinishToken)
+		_, err = first.finish(ctx, FinishRequest{
+			ImportPath:  importPath,
+			BuildID:     buildID,
+			FinishToken: start.FinishToken,
+			Files:       map[Label]string{LabelArchive: writeFile(t, content)},
+		})
+		require.NoError(t, err)
+
+		// A subsequent job server re-uses the persisted archive...
+		var stats common.Stats
+		second := &service{dir: t.TempDir(), store: store, stats: &stats}
+		for range 2 {
+			res, err := second.start(ctx, StartRequest{ImportPath: importPath, BuildID: buildID})
+			require.NoError(t, err)
+			assert.Empty(t, res.FinishToken)
+			actual, err := os.ReadFile(res.Files[LabelArchive])
+			require.NoError(t, err)
+			assert.Equal(t, content, string(actual))
+		}
+		assert.Equal(t, map[string]uint64{startSubject: 2, statStoreReuse: 1, statReuse: 1}, stats.Snapshot().Counters)
+	})
+}
@@ -34,13 +34,22 @@ type service struct {
 	loaded    common.Cache[*packages.Package]
 	graph     common.Graph
 	serverURL string
+	conn      *nats.Conn
+	store     *ResolveStore // Optional persistent store, shared across builds
+	stats     *common.Stats
 }
 
-func Subscribe(ctx context.Context, serverURL string, conn *nats.Conn, stats *common.CacheStats) (config.PackageLoader, error) {
+// Subscribe installs the package resolution handlers on the provided
+// connection. If store is not nil, resolution results are persisted in it so
+// they can be re-used by subsequent builds.
+func Subscribe(ctx context.Context, serverURL string, conn *nats.Conn, store *ResolveStore, stats *common.Stats) (config.PackageLoader, error) {
 	s := &service{
-		loaded:    common.NewCache[*packages.Package](stats),
-		resolved:  common.NewCache[resolvedPackageSet](stats),
+		loaded:    common.NewCache[*packages.Package](stats.Cache(loadSubject)),
+		resolved:  common.NewCache[resolvedPackageSet](stats.Cache(resolveSubject)),
 		serverURL: serverURL,
+		conn:      conn,
+		store:     store,
+		stats:     stats,
 	}
 
 	ctx = zerolog.Ctx(ctx).With().Str("nats.subject", resolveSubject).Logger().WithContext(ctx)
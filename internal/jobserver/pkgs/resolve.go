@@ -16,6 +16,7 @@ import (
 	"os"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/binpath"
@@ -133,9 +134,13 @@ func (s *service) resolve(ctx context.Context, req *ResolveRequest) (ResolveResp
 		defer s.graph.RemoveEdge(req.resolveParentID, req.toolexecImportpath)
 	}
 
+	start, hit := time.Now(), true
+	defer func() { s.stats.ObserveCache(resolveSubject, start, hit) }()
+
 	resolved, err := s.resolved.Load(reqHash, func() (_ resolvedPackageSet, err error) {
+		hit = false
 		if req.TestVariantFor == "" {
-			return loadResolvedPackages(ctx, req, *log)
+			return s.loadOrdinary(ctx, req, *log)
 		}
 
 		ordinaryReq := *req
@@ -150,6 +155,13 @@ func (s *service) resolve(ctx context.Context, req *ResolveRequest) (ResolveResp
 		if err != nil {
 			return resolvedPackageSet{}, err
 		}
+		if ordinary.packages == nil {
+			// Results re-used from the persistent store don't include the loaded
+			// packages, which are needed to construct the test variant.
+			if ordinary, err = loadResolvedPackages(ctx, &ordinaryReq, *log); err != nil {
+				return resolvedPackageSet{}, err
+			}
+		}
 		if ordinary.buildFlagsErr != "" {
 			return resolvedPackageSet{}, fmt.Errorf("obtaining Go build flags for test variant resolution: %s", ordinary.buildFlagsErr)
 		}
@@ -169,6 +181,34 @@ func (s *service) resolve(ctx context.Context, req *ResolveRequest) (ResolveResp
 	return resolved.response, nil
 }
 
+// loadOrdinary resolves an ordinary (not test variant) request, re-using the
+// result from the persistent store if possible, and persisting it otherwise.
+func (s *service) loadOrdinary(ctx context.Context, req *ResolveRequest, log zerolog.Logger) (resolvedPackageSet, error) {
+	if s.store == nil {
+		return loadResolvedPackages(ctx, req, log)
+	}
+
+	key, err := s.storeKey(ctx, req)
+	if err != nil {
+		log.Warn().Err(err).Str("pattern", req.Pattern).Msg("Unable to use the persistent resolve store")
+		return loadResolvedPackages(ctx, req, log)
+	}
+	if resp, found := s.store.Lookup(log.WithContext(ctx), key); found {
+		log.Debug().Str("pattern", req.Pattern).Msg("Re-using resolution from persistent store")
+		s.stats.Count(statStoreReuse)
+		return resolvedPackageSet{response: resp}, nil
+	}
+
+	resolved, err := loadResolvedPackages(ctx, req, log)
+	if err != nil || !isPersistable(resolved.packages) {
+		return resolved, err
+	}
+	if err := s.store.Insert(key, resolved.response); err != nil {
+		log.Warn().Err(err).Str("pattern", req.Pattern).Msg("Failed to persist resolution")
+	}
+	return resolved, nil
+}
+
 func loadResolvedPackages(ctx context.Context, req *ResolveRequest, log zerolog.Logger) (_ resolvedPackageSet, err error) {
 	log = log.With().Str("pattern", req.Pattern).Logger()
 	ctx = log.WithContext(ctx)
@@ -200,7 +240,7 @@ func loadResolvedPackages(ctx context.Context, req *ResolveRequest, log zerolog.
 		Context: ctx,
 		Mode: packages.NeedExportFile | packages.NeedFiles |
 			packages.NeedCompiledGoFiles | packages.NeedDeps | packages.NeedImports |
-			packages.NeedName,
+			packages.NeedModule | packages.NeedName,
 		Dir:        req.Dir,
 		Env:        env,
 		BuildFlags: buildFlags,
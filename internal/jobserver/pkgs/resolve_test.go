@@ -50,8 +50,8 @@ func Test(t *testing.T) {
 		)
 		require.NoError(t, err)
 		assert.GreaterOrEqual(t, len(resp), 2)
-		assert.EqualValues(t, 1, server.CacheStats.Count())
-		assert.EqualValues(t, 0, server.CacheStats.Hits())
+		assert.EqualValues(t, 1, server.Stats.Aggregate().Count())
+		assert.EqualValues(t, 0, server.Stats.Aggregate().Hits())
 
 		// Second request is equivalent, and should result in a cache hit. The order
 		// of entries in `env` is also shuffled, which should have no impact on the
@@ -67,8 +67,8 @@ func Test(t *testing.T) {
 		)
 		require.NoError(t, err)
 		assert.GreaterOrEqual(t, len(resp), 2)
-		assert.EqualValues(t, 2, server.CacheStats.Count())
-		assert.EqualValues(t, 1, server.CacheStats.Hits())
+		assert.EqualValues(t, 2, server.Stats.Aggregate().Count())
+		assert.EqualValues(t, 1, server.Stats.Aggregate().Hits())
 
 		// Third request is different, should result in a cache miss again
 		resp, err = client.Request(
@@ -81,8 +81,8 @@ func Test(t *testing.T) {
 		)
 		require.NoError(t, err)
 		assert.GreaterOrEqual(t, len(resp), 3)
-		assert.EqualValues(t, 3, server.CacheStats.Count())
-		assert.EqualValues(t, 1, server.CacheStats.Hits())
+		assert.EqualValues(t, 3, server.Stats.Aggregate().Count())
+		assert.EqualValues(t, 1, server.Stats.Aggregate().Hits())
 	})
 
 	t.Run("TestVariants", func(t *testing.T) {
@@ -129,7 +129,7 @@ func Test(t *testing.T) {
 
 		// A different test target reuses the cached ordinary package graph before
 		// applying target-specific refinement.
-		hitsBefore := server.CacheStats.Hits()
+		hitsBefore := server.Stats.Aggregate().Hits()
 		_, err = client.Request(
 			context.Background(),
 			conn,
@@ -141,7 +141,7 @@ func Test(t *testing.T) {
 			},
 		)
 		require.NoError(t, err)
-		assert.Equal(t, hitsBefore+1, server.CacheStats.Hits())
+		assert.Equal(t, hitsBefore+1, server.Stats.Aggregate().Hits())
 
 		resp, err = client.Request(
 			context.Background(),
@@ -217,6 +217,32 @@ func Test(t *testing.T) {
 		assert.Empty(t, resp["example.com/testvariants/externalsubject"].ForTest)
 	})
 
+	t.Run("PersistentStore", func(t *testing.T) {
+		storeDir := t.TempDir()
+		resolve := func() (pkgs.ResolveResponse, *jobserver.Server) {
+			server, err := jobserver.New(context.Background(), &jobserver.Options{NBTStoreDir: storeDir})
+			require.NoError(t, err)
+			t.Cleanup(server.Shutdown)
+
+			conn, err := server.Connect()
+			require.NoError(t, err)
+			defer conn.Close()
+
+			resp, err := client.Request(context.Background(), conn, &pkgs.ResolveRequest{Pattern: "net/http", Env: os.Environ()})
+			require.NoError(t, err)
+			return resp, server
+		}
+
+		// The first server resolves the package, and persists the result...
+		expected, server := resolve()
+		assert.Zero(t, server.Stats.Snapshot().Counters["packages.resolve.store.reuse"])
+
+		// ... which a fresh server re-uses instead of resolving it again.
+		actual, server := resolve()
+		assert.EqualValues(t, 1, server.Stats.Snapshot().Counters["packages.resolve.store.reuse"])
+		assert.Equal(t, expected, actual)
+	})
+
 	t.Run("Error", func(t *testing.T) {
 		server, err := jobserver.New(context.Background(), nil)
 		require.NoError(t, err)
@@ -232,7 +258,7 @@ func Test(t *testing.T) {
 			&pkgs.ResolveRequest{Pattern: "definitely.not/a@valid\x01package"},
 		)
 		assert.Nil(t, resp)
-		assert.EqualValues(t, 0, server.CacheStats.Hits())
+		assert.EqualValues(t, 0, server.Stats.Aggregate().Hits())
 		require.Error(t, err)
 	})
 }
@@ -0,0 +1,269 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package pkgs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/jobserver/buildid"
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/rs/zerolog"
+	"golang.org/x/tools/go/packages"
+)
+
+// statStoreReuse is the name of the statistic counting resolutions re-used from
+// the persistent [ResolveStore].
+const statStoreReuse = resolveSubject + ".store.reuse"
+
+type (
+	// ResolveStore is a persistent store for the results of [ResolveRequest]s,
+	// keyed by the module graph (`go.mod` and `go.sum` files), the Go build flags
+	// and toolchain version, and the injector configuration. It allows builds to
+	// skip the nested `go/packages` loads for synthetic dependencies that a
+	// previous build already resolved. The export files themselves live in the
+	// `GOCACHE`, so entries whose export files no longer exist are discarded.
+	ResolveStore struct {
+		dir string
+	}
+
+	// resolveStoreKey contains everything that contributes to the result of a
+	// [ResolveRequest] outside of the source files of the resolved packages.
+	resolveStoreKey struct {
+		Dir            string   `json:"dir"`
+		Pattern        string   `json:"pattern"`
+		Env            []string `json:"env"`
+		BuildFlags     []string `json:"buildFlags"`
+		GoVersion      string   `json:"goVersion"`
+		ModuleFiles    []string `json:"moduleFiles"`
+		InjectorConfig string   `json:"injectorConfig"`
+	}
+)
+
+// OpenResolveStore opens (creating it if necessary) a persistent
+// [ResolveStore] rooted in the provided directory.
+func OpenResolveStore(dir string) (*ResolveStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating resolve store directory: %w", err)
+	}
+	return &ResolveStore{dir: dir}, nil
+}
+
+// Lookup returns the response stored under the provided key, if all the export
+// files it references still exist. Entries referencing missing export files are
+// removed from the store.
+func (s *ResolveStore) Lookup(ctx context.Context, key string) (ResolveResponse, bool) {
+	log := zerolog.Ctx(ctx).With().Str("entry", s.entryPath(key)).Logger()
+
+	data, err := os.ReadFile(s.entryPath(key))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warn().Err(err).Msg("Failed to read resolve store entry")
+		}
+		return nil, false
+	}
+
+	var resp ResolveResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		log.Warn().Err(err).Msg("Removing corrupted resolve store entry")
+		s.remove(log, key)
+		return nil, false
+	}
+	for importPath, archive := range resp {
+		if _, err := os.Stat(archive.ExportFile); err != nil {
+			log.Debug().Err(err).Str("import-path", importPath).Msg("Removing stale resolve store entry")
+			s.remove(log, key)
+			return nil, false
+		}
+	}
+
+	// Record the access, so stale entries can be told apart.
+	now := time.Now()
+	if err := os.Chtimes(s.entryPath(key), now, now); err != nil {
+		log.Warn().Err(err).Msg("Failed to record access to resolve store entry")
+	}
+	return resp, true
+}
+
+// Insert stores the response under the provided key, replacing any existing
+// entry.
+func (s *ResolveStore) Insert(key string, resp ResolveResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	path := s.entryPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so concurrent readers never observe a
+	// partially written entry.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".entry-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *ResolveStore) remove(log zerolog.Logger, key string) {
+	if err := os.Remove(s.entryPath(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warn().Err(err).Msg("Failed to remove resolve store entry")
+	}
+}
+
+func (s *ResolveStore) entryPath(key string) string {
+	return filepath.Join(s.dir, key[:2], key+".json")
+}
+
+// storeKey computes the key under which the result of req is persisted. The
+// request must have been canonicalized.
+func (s *service) storeKey(ctx context.Context, req *ResolveRequest) (string, error) {
+	key := resolveStoreKey{Dir: req.Dir, Pattern: req.Pattern}
+
+	// Only the go command's own settings (and the inner toolexec, which affects
+	// the export files) are relevant; other variables (such as the job server
+	// URL) change from one build to the next.
+	for _, kv := range req.Env {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "GO") || strings.HasPrefix(name, "CGO_") || name == goflags.EnvVarInnerToolexec {
+			key.Env = append(key.Env, kv)
+		}
+	}
+
+	goFlags, err := goflags.Flags(ctx)
+	if err != nil {
+		return "", fmt.Errorf("obtaining go build flags: %w", err)
+	}
+	key.BuildFlags = goFlags.Except("-a", "-toolexec").Slice()
+
+	goEnv, err := goEnv(ctx, req, "GOVERSION", "GOMOD", "GOWORK")
+	if err != nil {
+		return "", err
+	}
+	key.GoVersion = goEnv[0]
+	var moduleFiles []string
+	if goMod := goEnv[1]; goMod != "" && goMod != os.DevNull {
+		moduleFiles = append(moduleFiles, goMod, strings.TrimSuffix(goMod, ".mod")+".sum")
+	}
+	if goWork := goEnv[2]; goWork != "" && goWork != "off" {
+		moduleFiles = append(moduleFiles, goWork, goWork+".sum")
+	}
+	for _, path := range moduleFiles {
+		digest, err := fileDigest(path)
+		if err != nil {
+			return "", err
+		}
+		key.ModuleFiles = append(key.ModuleFiles, digest)
+	}
+
+	// The version suffix accounts for the orchestrion version and the injector
+	// configuration, both of which influence the instrumented export files.
+	suffix, err := client.Request(ctx, client.New(s.conn), buildid.VersionSuffixRequest{Dir: req.Dir})
+	if err != nil {
+		return "", fmt.Errorf("obtaining injector configuration fingerprint: %w", err)
+	}
+	key.InjectorConfig = string(suffix)
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// goEnv returns the values of the named `go env` variables for the request's
+// directory and environment.
+func goEnv(ctx context.Context, req *ResolveRequest, names ...string) ([]string, error) {
+	goBin, err := goenv.GoBinPath()
+	if err != nil {
+		return nil, fmt.Errorf("locating the go command: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, goBin, append([]string{"env"}, names...)...)
+	cmd.Dir = req.Dir
+	cmd.Env = req.Env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running `go env`: %w: %s", err, stderr.String())
+	}
+
+	values := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	if len(values) != len(names) {
+		return nil, fmt.Errorf("`go env` returned %d values, expected %d", len(values), len(names))
+	}
+	return values, nil
+}
+
+// fileDigest returns the path and SHA-256 digest of a file, or only its path if
+// it does not exist.
+func fileDigest(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return path, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return path + "=" + hex.EncodeToString(sum[:]), nil
+}
+
+// isPersistable returns true if the packages (and their dependencies) are all
+// from the standard library or from versioned modules, whose content is fully
+// accounted for by the `go.sum` file. Packages from the main module or from
+// locally replaced modules may change without affecting the store key.
+func isPersistable(pkgs []*packages.Package) bool {
+	seen := make(map[string]struct{})
+	var visit func(*packages.Package) bool
+	visit = func(pkg *packages.Package) bool {
+		if _, done := seen[pkg.ID]; done {
+			return true
+		}
+		seen[pkg.ID] = struct{}{}
+
+		if mod := pkg.Module; mod != nil {
+			if mod.Main || mod.Version == "" || (mod.Replace != nil && mod.Replace.Version == "") {
+				return false
+			}
+		}
+		for _, dep := range pkg.Imports {
+			if !visit(dep) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, pkg := range pkgs {
+		if !visit(pkg) {
+			return false
+		}
+	}
+	return true
+}
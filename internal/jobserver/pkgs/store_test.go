@@ -0,0 +1,67 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package pkgs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestResolveStore(t *testing.T) {
+	ctx := context.Background()
+	const key = "0123456789abcdef"
+
+	store, err := OpenResolveStore(t.TempDir())
+	require.NoError(t, err)
+
+	_, found := store.Lookup(ctx, key)
+	require.False(t, found)
+
+	exportFile := filepath.Join(t.TempDir(), "_pkg_.a")
+	require.NoError(t, os.WriteFile(exportFile, []byte("!<arch>\n"), 0o644))
+	resp := ResolveResponse{"example.com/pkg": {ExportFile: exportFile}}
+	require.NoError(t, store.Insert(key, resp))
+
+	actual, found := store.Lookup(ctx, key)
+	require.True(t, found)
+	assert.Equal(t, resp, actual)
+
+	// Entries referring to export files that no longer exist are discarded.
+	require.NoError(t, os.Remove(exportFile))
+	_, found = store.Lookup(ctx, key)
+	require.False(t, found)
+	assert.NoFileExists(t, store.entryPath(key))
+}
+
+func TestIsPersistable(t *testing.T) {
+	versioned := &packages.Package{ID: "example.com/dep", Module: &packages.Module{Path: "example.com/dep", Version: "v1.2.3"}}
+	stdlib := &packages.Package{ID: "fmt"}
+
+	assert.True(t, isPersistable([]*packages.Package{{
+		ID:      "example.com/versioned",
+		Module:  &packages.Module{Path: "example.com/versioned", Version: "v1.0.0"},
+		Imports: map[string]*packages.Package{"example.com/dep": versioned, "fmt": stdlib},
+	}}))
+	assert.False(t, isPersistable([]*packages.Package{{
+		ID:      "example.com/main",
+		Module:  &packages.Module{Path: "example.com/main", Main: true},
+		Imports: map[string]*packages.Package{"example.com/dep": versioned},
+	}}))
+	assert.False(t, isPersistable([]*packages.Package{{
+		ID:     "example.com/versioned",
+		Module: &packages.Module{Path: "example.com/versioned", Version: "v1.0.0"},
+		Imports: map[string]*packages.Package{"example.com/replaced": {
+			ID:     "example.com/replaced",
+			Module: &packages.Module{Path: "example.com/replaced", Version: "v1.0.0", Replace: &packages.Module{Path: "../replaced"}},
+		}},
+	}}))
+}
@@ -12,12 +12,17 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/DataDog/orchestrion/internal/cacheprog"
 	"github.com/DataDog/orchestrion/internal/jobserver/buildid"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
 	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/DataDog/orchestrion/internal/jobserver/configs"
+	"github.com/DataDog/orchestrion/internal/jobserver/events"
 	"github.com/DataDog/orchestrion/internal/jobserver/nbt"
 	"github.com/DataDog/orchestrion/internal/jobserver/pkgs"
 	"github.com/nats-io/nats-server/v2/server"
@@ -31,16 +36,27 @@ const (
 	noPassword     = ""       // We don't need passwords, this is only to have access to system events, not for security.
 )
 
+// resolveStoreDir is the directory of the persistent store of package
+// resolutions, relative to [Options.NBTStoreDir].
+const resolveStoreDir = "resolve"
+
+// EnvVarMetricsAddr is the environment variable used to configure
+// [Options.MetricsAddr] for servers that are not started by the
+// `orchestrion server` command.
+const EnvVarMetricsAddr = "ORCHESTRION_JOBSERVER_METRICS_ADDR"
+
 var (
 	loopback = "127.0.0.1"
 )
 
 type (
 	Server struct {
-		server     *server.Server     // The underlying NATS server
-		CacheStats *common.CacheStats // Cache statistics
-		clientURL  string             // The client URL to use for connecting to this server
-		log        zerolog.Logger
+		server    *server.Server // The underlying NATS server
+		Stats     *common.Stats  // Statistics about the activity of services
+		clientURL string         // The client URL to use for connecting to this server
+		localURL  string         // The URL to use for in-process connections to this server
+		startTime time.Time      // The time at which the server was started
+		log       zerolog.Logger
 
 		shutdownHooks []func(context.Context) error
 
@@ -67,11 +83,63 @@ type (
 		// NoListener disables the network listener, only allowing in-process
 		// connections to be made to this server instead.
 		NoListener bool
+		// UnixSocket is the path of a Unix domain socket on which the server
+		// listens for connections instead of loopback TCP, so that only the
+		// current user can connect to it (see [UnixSocketPath]). It is ignored if
+		// NoListener is set.
+		UnixSocket string
+		// NBTStoreDir is the directory of the persistent store used by the
+		// never-build-twice service to re-use synthetic dependencies across builds.
+		// Package resolutions are also persisted there. If blank, artifacts are only
+		// re-used within the lifetime of this server.
+		NBTStoreDir string
+		// NBTStoreMaxSize is the maximum size, in bytes, of the persistent store. If
+		// zero, [nbt.DefaultStoreMaxSize] is used.
+		NBTStoreMaxSize int64
+		// CacheBackend describes the backend through which the persistent store
+		// shares artifacts with other machines (see [cacheprog.Open]). It requires
+		// NBTStoreDir to be set.
+		CacheBackend string
+		// MetricsAddr is the address on which the server's statistics are served in
+		// the Prometheus text exposition format, at the `/metrics` path. If blank,
+		// metrics are not served.
+		MetricsAddr string
 	}
 )
 
+// OptionsFromEnvironment returns the [Options] configured by environment
+// variables, for servers that are not started by the `orchestrion server`
+// command.
+func OptionsFromEnvironment() (*Options, error) {
+	var enabled bool
+	if val := os.Getenv(nbt.EnvVarStore); val != "" {
+		var err error
+		if enabled, err = strconv.ParseBool(val); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", nbt.EnvVarStore, err)
+		}
+	}
+	// A cache backend implies the persistent store, through which it is used.
+	backend := os.Getenv(cacheprog.EnvVarBackend)
+	dir, maxSize, err := nbt.StoreSettings(enabled || backend != "", os.Getenv(nbt.EnvVarStoreDir), os.Getenv(nbt.EnvVarStoreMaxSize))
+	if err != nil {
+		return nil, err
+	}
+	var socket string
+	if val := os.Getenv(EnvVarUnixSocket); val != "" {
+		if enabled, err := strconv.ParseBool(val); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", EnvVarUnixSocket, err)
+		} else if enabled {
+			if socket, err = UnixSocketPath(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &Options{NBTStoreDir: dir, NBTStoreMaxSize: maxSize, CacheBackend: backend, MetricsAddr: os.Getenv(EnvVarMetricsAddr), UnixSocket: socket}, nil
+}
+
 // New initializes and starts a new NATS server with the provided options. The
-// server only listens on the loopback interface.
+// server only listens on the loopback interface, or on a Unix domain socket if
+// [Options.UnixSocket] is set.
 func New(ctx context.Context, opts *Options) (srv *Server, err error) {
 	log := zerolog.Ctx(ctx).With().Str("process", "server").Logger()
 	ctx = log.WithContext(ctx)
@@ -89,6 +157,10 @@ func New(ctx context.Context, opts *Options) (srv *Server, err error) {
 	if startTimeout == 0 {
 		startTimeout = 10 * time.Second
 	}
+	socket := opts.UnixSocket
+	if opts.NoListener {
+		socket = ""
+	}
 
 	// Creating the server instance
 	userAccount := server.NewAccount("USERS")
@@ -98,7 +170,7 @@ func New(ctx context.Context, opts *Options) (srv *Server, err error) {
 		ServerName: fmt.Sprintf("github.com/DataDog/orchestrion/internal/jobserver[%d]", os.Getpid()),
 		Host:       getLoopback(log),
 		Port:       port,
-		DontListen: opts.NoListener,
+		DontListen: opts.NoListener || socket != "",
 		Accounts:   []*server.Account{userAccount, systemAccount},
 		Users: []*server.User{
 			{Username: client.Username, Password: client.NoPassword, Account: userAccount},
@@ -135,6 +207,8 @@ func New(ctx context.Context, opts *Options) (srv *Server, err error) {
 	if opts.NoListener {
 		// "Any" URL will do here, it's not actually used...
 		clientURL = "nats://localhost:0"
+	} else if socket != "" {
+		clientURL = client.UnixSocketURL(socket)
 	} else {
 		// We don't use `server.ClientURL()` here because it currently returns an invalid URL is the
 		// listener address is IPv6 (see: https://github.com/nats-io/nats-server/issues/5721)
@@ -143,27 +217,75 @@ func New(ctx context.Context, opts *Options) (srv *Server, err error) {
 
 	log.Trace().Str("url", clientURL).Msg("NATS Server ready for connections")
 
+	// In-process connections don't go through the listener, but the NATS client
+	// does not understand our Unix socket URLs.
+	localURL := clientURL
+	if socket != "" {
+		localURL = "nats://localhost:0"
+	}
+
 	// Obtaining the local server connection
-	conn, err := nats.Connect(clientURL, nats.UserInfo(serverUsername, noPassword), nats.InProcessServer(server))
+	conn, err := nats.Connect(localURL, nats.UserInfo(serverUsername, noPassword), nats.InProcessServer(server))
 	if err != nil {
 		return nil, fmt.Errorf("connecting to in-process NATS server instance: %w", err)
 	}
 
 	// Installing the handlers
 	res := Server{
-		server:     server,
-		CacheStats: &common.CacheStats{},
-		clientURL:  clientURL,
-		log:        log,
+		server:    server,
+		Stats:     &common.Stats{},
+		clientURL: clientURL,
+		localURL:  localURL,
+		startTime: time.Now(),
+		log:       log,
+	}
+	if socket != "" {
+		if err := res.listenUnix(ctx, server, socket); err != nil {
+			return nil, err
+		}
+	}
+	var resolveStore *pkgs.ResolveStore
+	if opts.NBTStoreDir != "" {
+		// Resolutions refer to the synthetic dependencies persisted in the store, so
+		// they are persisted alongside them.
+		if resolveStore, err = pkgs.OpenResolveStore(filepath.Join(opts.NBTStoreDir, resolveStoreDir)); err != nil {
+			return nil, err
+		}
 	}
-	pkgLoader, err := pkgs.Subscribe(ctx, clientURL, conn, res.CacheStats)
+	pkgLoader, err := pkgs.Subscribe(ctx, clientURL, conn, resolveStore, res.Stats)
 	if err != nil {
 		return nil, err
 	}
-	if err := buildid.Subscribe(ctx, conn, pkgLoader, res.CacheStats); err != nil {
+	if err := buildid.Subscribe(ctx, conn, pkgLoader, res.Stats); err != nil {
 		return nil, err
 	}
-	cleanup, err := nbt.Subscribe(ctx, conn)
+	if err := configs.Subscribe(ctx, conn, pkgLoader, res.Stats); err != nil {
+		return nil, err
+	}
+	var nbtStore *nbt.Store
+	if opts.NBTStoreDir != "" {
+		var backend cacheprog.Backend
+		if opts.CacheBackend != "" {
+			if backend, err = cacheprog.Open(ctx, opts.CacheBackend); err != nil {
+				return nil, err
+			}
+		}
+		if nbtStore, err = nbt.OpenStore(opts.NBTStoreDir, opts.NBTStoreMaxSize, backend); err != nil {
+			if backend != nil {
+				err = errors.Join(err, backend.Close())
+			}
+			return nil, err
+		}
+		res.onShutdown(func(context.Context) error {
+			// Background uploads must complete before the backend is closed.
+			nbtStore.Wait()
+			if backend == nil {
+				return nil
+			}
+			return backend.Close()
+		})
+	}
+	cleanup, err := nbt.Subscribe(ctx, conn, nbtStore, res.Stats)
 	if err != nil {
 		return nil, err
 	}
@@ -171,6 +293,17 @@ func New(ctx context.Context, opts *Options) (srv *Server, err error) {
 	if _, err := conn.Subscribe("clients", res.handleClients); err != nil {
 		return nil, err
 	}
+	if _, err := conn.Subscribe(client.HandshakeSubject, common.HandleRequest(ctx, handshake)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Subscribe(statsSubject, common.HandleRequest(log.With().Str("nats.subject", statsSubject).Logger().WithContext(ctx), res.stats)); err != nil {
+		return nil, err
+	}
+	if opts.MetricsAddr != "" {
+		if err := res.serveMetrics(ctx, opts.MetricsAddr); err != nil {
+			return nil, err
+		}
+	}
 
 	// Wait until all subscriptions have been processed by the server...
 	if err := conn.Flush(); err != nil {
@@ -178,7 +311,7 @@ func New(ctx context.Context, opts *Options) (srv *Server, err error) {
 	}
 
 	if opts.InactivityTimeout > 0 {
-		sysConn, err := nats.Connect(clientURL, nats.Name("server-local-admin"), nats.UserInfo(sysUser, noPassword), nats.InProcessServer(server))
+		sysConn, err := nats.Connect(localURL, nats.Name("server-local-admin"), nats.UserInfo(sysUser, noPassword), nats.InProcessServer(server))
 		if err != nil {
 			return nil, err
 		}
@@ -206,6 +339,10 @@ func New(ctx context.Context, opts *Options) (srv *Server, err error) {
 	return &res, nil
 }
 
+func handshake(context.Context, client.HandshakeRequest) (*client.HandshakeResponse, error) {
+	return client.CurrentHandshake(), nil
+}
+
 func (s *Server) onShutdown(cb func(context.Context) error) {
 	s.shutdownHooks = append(s.shutdownHooks, cb)
 }
@@ -213,7 +350,7 @@ func (s *Server) onShutdown(cb func(context.Context) error) {
 // Connect returns a client using the in-process connection to the server.
 func (s *Server) Connect() (*client.Client, error) {
 	conn, err := nats.Connect(
-		s.clientURL,
+		s.localURL,
 		nats.Name("local-connect"),
 		nats.UserInfo(client.Username, client.NoPassword),
 		nats.InProcessServer(s.server),
@@ -224,6 +361,43 @@ func (s *Server) Connect() (*client.Client, error) {
 	return client.New(conn), nil
 }
 
+// SubscribeBuildEvents calls handler with every build event published by this
+// server, in order. The returned function ends the subscription, after all
+// events published so far have been handled.
+func (s *Server) SubscribeBuildEvents(ctx context.Context, handler func(events.Event)) (stop func(), err error) {
+	closed := make(chan struct{})
+	conn, err := nats.Connect(
+		s.localURL,
+		nats.Name("build-events"),
+		nats.UserInfo(client.Username, client.NoPassword),
+		nats.InProcessServer(s.server),
+		nats.ClosedHandler(func(*nats.Conn) { close(closed) }),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := events.Subscribe(ctx, conn, handler); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Make sure the subscription is effective before returning...
+	if err := conn.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			if err := conn.Drain(); err != nil {
+				conn.Close()
+			}
+			<-closed
+		})
+	}
+	return stop, nil
+}
+
 // ClientURL returns the URL connection string clients should use to connect to
 // this NATS server.
 func (s *Server) ClientURL() string {
@@ -239,7 +413,7 @@ func (s *Server) Shutdown() {
 // WaitForShutdown waits indefinitely for this server to have shut down.
 func (s *Server) WaitForShutdown() {
 	s.server.WaitForShutdown()
-	s.log.Trace().Msg(s.CacheStats.String())
+	s.log.Trace().Msg(s.Stats.Aggregate().String())
 
 	ctx := s.log.WithContext(context.Background())
 	for _, cb := range s.shutdownHooks {
@@ -0,0 +1,119 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package jobserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/rs/zerolog"
+)
+
+// EnvVarUnixSocket is the environment variable used to make job servers listen
+// on a Unix domain socket (see [UnixSocketPath]) instead of loopback TCP.
+const EnvVarUnixSocket = "ORCHESTRION_JOBSERVER_UNIX_SOCKET"
+
+// maxUnixSocketPath is the most conservative limit on the length of a Unix
+// domain socket path across supported platforms (it is 104 on darwin and BSDs).
+const maxUnixSocketPath = 103
+
+// UnixSocketPath returns the path of a Unix domain socket for a job server
+// started by this process. The socket is located in a per-user directory that
+// only the current user can access, which is created if needed.
+func UnixSocketPath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("determining the user cache directory: %w", err)
+	}
+	dir := filepath.Join(cacheDir, "orchestrion", "jobserver")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("creating socket directory: %w", err)
+	}
+	// The directory may have been created by an earlier version with a more
+	// permissive mode; make sure other users can't traverse it.
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return "", fmt.Errorf("restricting access to socket directory: %w", err)
+	}
+
+	path := filepath.Join(dir, strconv.Itoa(os.Getpid())+".sock")
+	if len(path) > maxUnixSocketPath {
+		return "", fmt.Errorf("socket path %q is longer than %d bytes", path, maxUnixSocketPath)
+	}
+	return path, nil
+}
+
+// listenUnix accepts connections on a Unix domain socket at the designated
+// path, and forwards them to the NATS server through in-process connections.
+// The socket file is only accessible to the current user.
+func (s *Server) listenUnix(ctx context.Context, natsServer *server.Server, path string) error {
+	// A socket left over by a process that was killed would prevent listening.
+	if info, err := os.Lstat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("removing stale socket %q: %w", path, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("listening on unix socket %q: %w", path, err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		return errors.Join(fmt.Errorf("restricting access to unix socket %q: %w", path, err), listener.Close())
+	}
+
+	log := zerolog.Ctx(ctx)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Error().Err(err).Str("socket", path).Msg("Failed to accept connection")
+				}
+				return
+			}
+			go forwardConn(ctx, natsServer, conn)
+		}
+	}()
+	// Closing the listener also removes the socket file.
+	s.onShutdown(func(context.Context) error { return listener.Close() })
+
+	return nil
+}
+
+// forwardConn relays traffic between conn and a new in-process connection to
+// the NATS server, until either side is closed.
+func forwardConn(ctx context.Context, natsServer *server.Server, conn net.Conn) {
+	defer conn.Close()
+
+	local, err := natsServer.InProcessConn()
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to create in-process connection")
+		return
+	}
+	defer local.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	relay := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+		// Unblock the other direction, as this connection is done for...
+		_ = dst.Close()
+		_ = src.Close()
+	}
+	go relay(local, conn)
+	go relay(conn, local)
+	wg.Wait()
+}
@@ -0,0 +1,47 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+//go:build unix
+
+package jobserver_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/jobserver"
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/nbt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixSocket(t *testing.T) {
+	ctx := context.Background()
+	socket := filepath.Join(t.TempDir(), "jobserver.sock")
+
+	server, err := jobserver.New(ctx, &jobserver.Options{UnixSocket: socket})
+	require.NoError(t, err)
+	require.Equal(t, client.UnixSocketURL(socket), server.ClientURL())
+
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeSocket|0o600, info.Mode())
+
+	conn, err := client.Connect(server.ClientURL())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	start, err := client.Request(ctx, conn, nbt.StartRequest{ImportPath: "github.com/DataDog/orchestrion.test", BuildID: uuid.NewString()})
+	require.NoError(t, err)
+	assert.NotEmpty(t, start.FinishToken)
+
+	server.Shutdown()
+	server.WaitForShutdown()
+	assert.NoFileExists(t, socket)
+}
@@ -0,0 +1,179 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package jobserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/rs/zerolog"
+)
+
+const statsSubject = "server.stats"
+
+type (
+	// StatsRequest requests the statistics of the job server's activity so far.
+	StatsRequest struct{}
+	// StatsResponse contains the statistics of the job server's activity.
+	StatsResponse struct {
+		// Uptime is the time elapsed since the server was started.
+		Uptime time.Duration `json:"uptime"`
+		// Clients is the number of clients currently connected to the server. It is
+		// only tracked by servers configured with an inactivity timeout.
+		Clients int `json:"clients"`
+		client.HandshakeResponse
+		common.StatsSnapshot
+	}
+)
+
+func (StatsRequest) Subject() string                  { return statsSubject }
+func (StatsRequest) ResponseIs(*StatsResponse)        {}
+func (StatsRequest) ForeachSpanTag(func(string, any)) {}
+
+func (s *Server) stats(context.Context, StatsRequest) (*StatsResponse, error) {
+	s.clientsMu.Lock()
+	clients := len(s.clients)
+	s.clientsMu.Unlock()
+
+	return &StatsResponse{
+		Uptime:            time.Since(s.startTime),
+		Clients:           clients,
+		HandshakeResponse: *client.CurrentHandshake(),
+		StatsSnapshot:     s.Stats.Snapshot(),
+	}, nil
+}
+
+// serveMetrics serves the server's statistics in the Prometheus text
+// exposition format on the provided address, until the server shuts down.
+func (s *Server) serveMetrics(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening for metrics on %q: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		stats, _ := s.stats(r.Context(), StatsRequest{})
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := stats.WritePrometheus(w); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to write metrics")
+		}
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Metrics server failed")
+		}
+	}()
+	s.onShutdown(srv.Shutdown)
+
+	zerolog.Ctx(ctx).Info().Stringer("addr", listener.Addr()).Msg("Serving metrics")
+	return nil
+}
+
+// WritePrometheus writes the statistics to w in the Prometheus text exposition
+// format.
+func (r *StatsResponse) WritePrometheus(w io.Writer) error {
+	const prefix = "orchestrion_jobserver_"
+	bw := bufio.NewWriter(w)
+
+	header := func(name, kind, help string) {
+		fmt.Fprintf(bw, "# HELP %s%s %s\n# TYPE %s%s %s\n", prefix, name, help, prefix, name, kind)
+	}
+
+	header("uptime_seconds", "gauge", "Time elapsed since the job server started.")
+	fmt.Fprintf(bw, "%suptime_seconds %g\n", prefix, r.Uptime.Seconds())
+	header("clients", "gauge", "Number of clients connected to the job server.")
+	fmt.Fprintf(bw, "%sclients %d\n", prefix, r.Clients)
+
+	if len(r.Caches) > 0 {
+		header("cache_requests_total", "counter", "Number of cache lookups.")
+		for _, name := range slices.Sorted(maps.Keys(r.Caches)) {
+			fmt.Fprintf(bw, "%scache_requests_total{cache=%q} %d\n", prefix, name, r.Caches[name].Total)
+		}
+		header("cache_hits_total", "counter", "Number of cache lookups that resulted in a hit.")
+		for _, name := range slices.Sorted(maps.Keys(r.Caches)) {
+			fmt.Fprintf(bw, "%scache_hits_total{cache=%q} %d\n", prefix, name, r.Caches[name].Hits)
+		}
+	}
+
+	if len(r.Counters) > 0 {
+		header("events_total", "counter", "Number of occurrences of job server events.")
+		for _, name := range slices.Sorted(maps.Keys(r.Counters)) {
+			fmt.Fprintf(bw, "%sevents_total{event=%q} %d\n", prefix, name, r.Counters[name])
+		}
+	}
+
+	if len(r.Timers) > 0 {
+		header("operation_duration_seconds", "summary", "Duration of job server operations.")
+		for _, name := range slices.Sorted(maps.Keys(r.Timers)) {
+			timer := r.Timers[name]
+			fmt.Fprintf(bw, "%soperation_duration_seconds_sum{operation=%q} %g\n", prefix, name, timer.Total.Seconds())
+			fmt.Fprintf(bw, "%soperation_duration_seconds_count{operation=%q} %d\n", prefix, name, timer.Count)
+		}
+		header("operation_duration_max_seconds", "gauge", "Longest duration of job server operations.")
+		for _, name := range slices.Sorted(maps.Keys(r.Timers)) {
+			fmt.Fprintf(bw, "%soperation_duration_max_seconds{operation=%q} %g\n", prefix, name, r.Timers[name].Max.Seconds())
+		}
+	}
+
+	return bw.Flush()
+}
+
+// String returns a human-readable summary of the statistics.
+func (r *StatsResponse) String() string {
+	var buf strings.Builder
+
+	fmt.Fprintf(&buf, "Version: %s (protocol %d)\n", r.Version, r.ProtocolVersion)
+	fmt.Fprintf(&buf, "Uptime:  %s\n", r.Uptime.Round(time.Second))
+	fmt.Fprintf(&buf, "Clients: %d\n", r.Clients)
+
+	if len(r.Caches) > 0 {
+		fmt.Fprintf(&buf, "\n%-32s %10s %10s %8s\n", "CACHE", "HITS", "TOTAL", "RATIO")
+		for _, name := range slices.Sorted(maps.Keys(r.Caches)) {
+			cache := r.Caches[name]
+			ratio := 0.0
+			if cache.Total > 0 {
+				ratio = 100 * float64(cache.Hits) / float64(cache.Total)
+			}
+			fmt.Fprintf(&buf, "%-32s %10d %10d %7.2f%%\n", name, cache.Hits, cache.Total, ratio)
+		}
+	}
+
+	if len(r.Counters) > 0 {
+		fmt.Fprintf(&buf, "\n%-32s %10s\n", "EVENT", "COUNT")
+		for _, name := range slices.Sorted(maps.Keys(r.Counters)) {
+			fmt.Fprintf(&buf, "%-32s %10d\n", name, r.Counters[name])
+		}
+	}
+
+	if len(r.Timers) > 0 {
+		fmt.Fprintf(&buf, "\n%-32s %10s %12s %12s %12s\n", "OPERATION", "COUNT", "TOTAL", "MEAN", "MAX")
+		for _, name := range slices.Sorted(maps.Keys(r.Timers)) {
+			timer := r.Timers[name]
+			mean := time.Duration(0)
+			if timer.Count > 0 {
+				mean = timer.Total / time.Duration(timer.Count)
+			}
+			fmt.Fprintf(&buf, "%-32s %10d %12s %12s %12s\n", name, timer.Count,
+				timer.Total.Round(time.Millisecond), mean.Round(time.Microsecond), timer.Max.Round(time.Microsecond))
+		}
+	}
+
+	return buf.String()
+}
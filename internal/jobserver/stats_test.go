@@ -0,0 +1,104 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package jobserver_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/jobserver"
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/DataDog/orchestrion/internal/jobserver/nbt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	addr := freeAddr(t)
+
+	server, err := jobserver.New(ctx, &jobserver.Options{MetricsAddr: addr})
+	require.NoError(t, err)
+	defer server.Shutdown()
+
+	conn, err := server.Connect()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	start, err := client.Request(ctx, conn, nbt.StartRequest{ImportPath: "github.com/DataDog/orchestrion.test", BuildID: uuid.NewString()})
+	require.NoError(t, err)
+	require.NotEmpty(t, start.FinishToken)
+
+	stats, err := client.Request(ctx, conn, jobserver.StatsRequest{})
+	require.NoError(t, err)
+	assert.Positive(t, stats.Uptime)
+	assert.Equal(t, map[string]uint64{"never-build-twice.start": 1}, stats.Counters)
+
+	res, err := http.Get("http://" + addr + "/metrics")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "\norchestrion_jobserver_events_total{event=\"never-build-twice.start\"} 1\n")
+}
+
+func TestStatsResponse(t *testing.T) {
+	stats := jobserver.StatsResponse{
+		Uptime:  90 * time.Second,
+		Clients: 2,
+		StatsSnapshot: common.StatsSnapshot{
+			Caches:   map[string]common.CacheSnapshot{"packages.resolve": {Hits: 3, Total: 4}},
+			Counters: map[string]uint64{"never-build-twice.start": 5},
+			Timers:   map[string]common.TimerSnapshot{"packages.resolve.miss": {Count: 1, Total: 1500 * time.Millisecond, Max: 1500 * time.Millisecond}},
+		},
+	}
+
+	var buf strings.Builder
+	require.NoError(t, stats.WritePrometheus(&buf))
+	assert.Equal(t, strings.Join([]string{
+		"# HELP orchestrion_jobserver_uptime_seconds Time elapsed since the job server started.",
+		"# TYPE orchestrion_jobserver_uptime_seconds gauge",
+		"orchestrion_jobserver_uptime_seconds 90",
+		"# HELP orchestrion_jobserver_clients Number of clients connected to the job server.",
+		"# TYPE orchestrion_jobserver_clients gauge",
+		"orchestrion_jobserver_clients 2",
+		"# HELP orchestrion_jobserver_cache_requests_total Number of cache lookups.",
+		"# TYPE orchestrion_jobserver_cache_requests_total counter",
+		`orchestrion_jobserver_cache_requests_total{cache="packages.resolve"} 4`,
+		"# HELP orchestrion_jobserver_cache_hits_total Number of cache lookups that resulted in a hit.",
+		"# TYPE orchestrion_jobserver_cache_hits_total counter",
+		`orchestrion_jobserver_cache_hits_total{cache="packages.resolve"} 3`,
+		"# HELP orchestrion_jobserver_events_total Number of occurrences of job server events.",
+		"# TYPE orchestrion_jobserver_events_total counter",
+		`orchestrion_jobserver_events_total{event="never-build-twice.start"} 5`,
+		"# HELP orchestrion_jobserver_operation_duration_seconds Duration of job server operations.",
+		"# TYPE orchestrion_jobserver_operation_duration_seconds summary",
+		`orchestrion_jobserver_operation_duration_seconds_sum{operation="packages.resolve.miss"} 1.5`,
+		`orchestrion_jobserver_operation_duration_seconds_count{operation="packages.resolve.miss"} 1`,
+		"# HELP orchestrion_jobserver_operation_duration_max_seconds Longest duration of job server operations.",
+		"# TYPE orchestrion_jobserver_operation_duration_max_seconds gauge",
+		`orchestrion_jobserver_operation_duration_max_seconds{operation="packages.resolve.miss"} 1.5`,
+		"",
+	}, "\n"), buf.String())
+
+	assert.Contains(t, stats.String(), "packages.resolve                          3          4   75.00%")
+}
+
+// freeAddr returns a loopback address with a port that is currently available.
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().String()
+}
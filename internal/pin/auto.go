@@ -11,9 +11,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/DataDog/orchestrion/internal/ensure"
+	"github.com/DataDog/orchestrion/internal/goenv"
 	"github.com/DataDog/orchestrion/internal/injector/config"
 	"github.com/DataDog/orchestrion/internal/version"
 	"github.com/charmbracelet/lipgloss"
@@ -55,6 +57,12 @@ func AutoPinOrchestrion(ctx context.Context, stdout io.Writer, stderr io.Writer)
 	} else {
 		log.Trace().Msg("Skipping ensure.RequiredVersion because this is a development build")
 		_, err := os.Stat(config.FilenameOrchestrionToolGo)
+		if errors.Is(err, os.ErrNotExist) {
+			// In workspace mode, the workspace-level file applies to all modules.
+			if goWork, wsErr := goenv.GOWORK(""); wsErr == nil {
+				_, err = os.Stat(filepath.Join(goWork, "..", config.FilenameOrchestrionToolGo))
+			}
+		}
 		if err == nil {
 			log.Trace().Msg("Found " + config.FilenameOrchestrionToolGo + " file, no automatic pinning required")
 			return nil
@@ -11,6 +11,7 @@ import (
 	"go/token"
 	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/dave/dst"
 	"github.com/dave/dst/dstutil"
@@ -145,6 +146,55 @@ func (s *importSet) Remove(toRemove string) bool {
 	return removed
 }
 
+// Sort orders the specs of the receiver's import declaration by import path,
+// keeping the `github.com/DataDog/orchestrion` import first, separated from the
+// others by an empty line.
+func (s *importSet) Sort() {
+	specs := s.imports.Specs
+	slices.SortStableFunc(specs, func(l, r dst.Spec) int {
+		lPath, rPath := specPath(l), specPath(r)
+		switch {
+		case lPath == rPath:
+			return 0
+		case lPath == orchestrionImportPath:
+			return -1
+		case rPath == orchestrionImportPath:
+			return 1
+		default:
+			return strings.Compare(lPath, rPath)
+		}
+	})
+
+	for i, spec := range specs {
+		decs := spec.Decorations()
+		switch {
+		case i == 0:
+			continue
+		case specPath(specs[i-1]) == orchestrionImportPath:
+			decs.Before = dst.EmptyLine
+		case len(decs.Start) == 0:
+			decs.Before = dst.NewLine
+		}
+		// The empty line after the orchestrion import is carried by the next spec.
+		if i+1 < len(specs) {
+			decs.After = dst.NewLine
+		}
+	}
+	if len(specs) > 1 && specPath(specs[0]) == orchestrionImportPath {
+		specs[0].Decorations().After = dst.EmptyLine
+	}
+}
+
+// specPath returns the import path of the provided import spec.
+func specPath(spec dst.Spec) string {
+	importSpec, ok := spec.(*dst.ImportSpec)
+	if !ok || importSpec.Path == nil {
+		return ""
+	}
+	path, _ := strconv.Unquote(importSpec.Path.Value)
+	return path
+}
+
 // firstImportIn returns the first import declaration found in the provided
 // [*dst.File]. If no import declaration is present, returns `nil`.
 func firstImportIn(file *dst.File) *dst.GenDecl {
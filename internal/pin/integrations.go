@@ -0,0 +1,277 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package pin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/gomod"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/rs/zerolog"
+	"golang.org/x/tools/go/packages"
+)
+
+// Integration describes an integration imported by the [orchestrionToolGo]
+// file.
+type Integration struct {
+	// ImportPath is the import path of the integration package.
+	ImportPath string
+	// Version is the version of the module providing the integration package,
+	// which is blank if it is replaced by a local directory.
+	Version string
+	// Name is the name declared in the integration's [orchestrionDotYML] file.
+	Name string
+	// Description is the description declared in the integration's
+	// [orchestrionDotYML] file.
+	Description string
+}
+
+// AddIntegration adds the integration package designated by spec, which is an
+// import path optionally followed by "@version", to the [orchestrionToolGo]
+// file of the current module. The module providing it is added to `go.mod`
+// using `go get`, and the package is verified to contain injector
+// configuration; `go.mod` and `go.sum` are left unchanged if it does not. If
+// the package is already imported, a version may be provided to update it.
+func AddIntegration(ctx context.Context, spec string, opts Options) error {
+	path, _, hasVersion := strings.Cut(spec, "@")
+	if path == orchestrionImportPath {
+		return fmt.Errorf("%q is always imported by %s", path, config.FilenameOrchestrionToolGo)
+	}
+
+	return editToolFile(ctx, func(ctx context.Context, goMod string, importSet *importSet) (bool, error) {
+		if importSet.Find(path) != nil && !hasVersion {
+			_, _ = fmt.Fprintf(opts.Writer, "%q is already imported by %s\n", path, config.FilenameOrchestrionToolGo)
+			return false, nil
+		}
+
+		restore, err := snapshotGoMod(goMod)
+		if err != nil {
+			return false, err
+		}
+		if err := gomod.RunGet(ctx, goMod, spec); err != nil {
+			return false, errors.Join(fmt.Errorf("go get %s: %w", spec, err), restore())
+		}
+
+		pkg, err := loadPackage(ctx, filepath.Dir(goMod), path)
+		if err == nil {
+			var hasConfig bool
+			if hasConfig, err = config.HasConfig(ctx, nil, pkg, opts.Validate); err == nil && !hasConfig {
+				err = fmt.Errorf("there is no %s nor %s file in %q", config.FilenameOrchestrionYML, config.FilenameOrchestrionToolGo, path)
+			}
+		}
+		if err != nil {
+			return false, errors.Join(fmt.Errorf("%q is not a valid integration: %w", path, err), restore())
+		}
+
+		newSpec, isNew := importSet.Add(path)
+		newSpec.Decs.End.Replace("// integration")
+		if isNew {
+			_, _ = fmt.Fprintf(opts.Writer, "added %q to %s\n", path, config.FilenameOrchestrionToolGo)
+		} else {
+			_, _ = fmt.Fprintf(opts.Writer, "updated %q to %s\n", path, spec)
+		}
+		return true, nil
+	})
+}
+
+// RemoveIntegration removes the integration package with the provided import
+// path from the [orchestrionToolGo] file of the current module, and tidies
+// `go.mod` accordingly.
+func RemoveIntegration(ctx context.Context, path string, opts Options) error {
+	if path == orchestrionImportPath {
+		return fmt.Errorf("%q cannot be removed from %s", path, config.FilenameOrchestrionToolGo)
+	}
+
+	return editToolFile(ctx, func(_ context.Context, _ string, importSet *importSet) (bool, error) {
+		if !importSet.Remove(path) {
+			return false, fmt.Errorf("%q is not imported by %s", path, config.FilenameOrchestrionToolGo)
+		}
+		_, _ = fmt.Fprintf(opts.Writer, "removed %q from %s\n", path, config.FilenameOrchestrionToolGo)
+		return true, nil
+	})
+}
+
+// ListIntegrations returns the integrations imported by the
+// [orchestrionToolGo] file of the current module, sorted by import path.
+func ListIntegrations(ctx context.Context) ([]Integration, error) {
+	goMod, err := goenv.GOMOD("")
+	if err != nil {
+		return nil, fmt.Errorf("getting GOMOD: %w", err)
+	}
+	toolFile := filepath.Join(goMod, "..", config.FilenameOrchestrionToolGo)
+	dstFile, err := parseOrchestrionToolGo(toolFile)
+	if err != nil {
+		return nil, err
+	}
+
+	importPaths := importSetFrom(dstFile).Except(orchestrionImportPath)
+	if len(importPaths) == 0 {
+		return nil, nil
+	}
+
+	log := zerolog.Ctx(ctx)
+	pkgs, err := packages.Load(
+		&packages.Config{
+			BuildFlags: []string{"-toolexec="},
+			Context:    ctx,
+			Dir:        filepath.Dir(goMod),
+			Logf:       func(format string, args ...any) { log.Trace().Str("operation", "packages.Load").Msgf(format, args...) },
+			Mode:       packages.NeedName | packages.NeedFiles | packages.NeedModule,
+		},
+		importPaths...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("loading integrations: %w", err)
+	}
+
+	res := make([]Integration, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		integration := Integration{ImportPath: pkg.PkgPath}
+		if mod := pkg.Module; mod != nil {
+			integration.Version = mod.Version
+			if mod.Replace != nil {
+				integration.Version = mod.Replace.Version
+			}
+		}
+		file, err := config.Describe(ctx, pkg)
+		if err != nil {
+			return nil, fmt.Errorf("in %q: %w", pkg.PkgPath, err)
+		}
+		if file != nil {
+			integration.Name = file.Name()
+			integration.Description = file.Description()
+		}
+		res = append(res, integration)
+	}
+	slices.SortFunc(res, func(l, r Integration) int { return strings.Compare(l.ImportPath, r.ImportPath) })
+
+	return res, nil
+}
+
+// editToolFile applies the edit function to the imports of the
+// [orchestrionToolGo] file of the current module. If it reports a change, the
+// imports are sorted, the file is written back, and `go mod tidy` is run, as
+// well as `go mod vendor` if the module is vendored. The [orchestrionToolGo],
+// `go.mod` and `go.sum` files are restored if these commands fail.
+func editToolFile(ctx context.Context, edit func(context.Context, string, *importSet) (bool, error)) error {
+	goMod, err := goenv.GOMOD("")
+	if err != nil {
+		return fmt.Errorf("getting GOMOD: %w", err)
+	}
+
+	unlock, err := lockGoMod(ctx, goMod)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	toolFile := filepath.Join(goMod, "..", config.FilenameOrchestrionToolGo)
+	dstFile, err := parseOrchestrionToolGo(toolFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no %s file found, run `orchestrion pin` first: %w", config.FilenameOrchestrionToolGo, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	original, err := os.ReadFile(toolFile)
+	if err != nil {
+		return err
+	}
+	restore, err := snapshotGoMod(goMod)
+	if err != nil {
+		return err
+	}
+
+	importSet := importSetFrom(dstFile)
+	changed, err := edit(ctx, goMod, importSet)
+	if err != nil || !changed {
+		return err
+	}
+	importSet.Sort()
+
+	if err := writeUpdated(toolFile, dstFile); err != nil {
+		return fmt.Errorf("updating %q: %w", toolFile, err)
+	}
+	if err := gomod.Run(ctx, "tidy", goMod, nil); err != nil {
+		err = fmt.Errorf("running `go mod tidy`: %w", err)
+		return errors.Join(err, restore(), os.WriteFile(toolFile, original, 0o644))
+	}
+	// The vendor directory, if any, must list the modules now required.
+	if err := gomod.Vendor(ctx, goMod); err != nil {
+		return errors.Join(err, restore(), os.WriteFile(toolFile, original, 0o644))
+	}
+	return nil
+}
+
+// snapshotGoMod saves the current content of the `go.mod` file and of the
+// `go.sum` file next to it, and returns a function that restores it.
+func snapshotGoMod(goMod string) (func() error, error) {
+	files := []string{goMod, filepath.Join(goMod, "..", "go.sum")}
+	contents := make([][]byte, len(files))
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		contents[i] = data
+	}
+
+	return func() error {
+		var errs error
+		for i, file := range files {
+			if contents[i] == nil {
+				if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+					errs = errors.Join(errs, err)
+				}
+				continue
+			}
+			errs = errors.Join(errs, os.WriteFile(file, contents[i], 0o644))
+		}
+		return errs
+	}, nil
+}
+
+// loadPackage loads the package with the provided import path from the
+// specified directory.
+func loadPackage(ctx context.Context, dir string, path string) (*packages.Package, error) {
+	log := zerolog.Ctx(ctx)
+	pkgs, err := packages.Load(
+		&packages.Config{
+			// The vendor directory, if any, is only updated once `go.mod` is final.
+			BuildFlags: []string{"-toolexec=", "-mod=mod"},
+			Context:    ctx,
+			Dir:        dir,
+			Logf:       func(format string, args ...any) { log.Trace().Str("operation", "packages.Load").Msgf(format, args...) },
+			Mode:       packages.NeedName | packages.NeedFiles,
+		},
+		path,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("packages.Load(%q) returned %d packages", path, len(pkgs))
+	}
+	pkg := pkgs[0]
+	if len(pkg.GoFiles) != 0 || len(pkg.IgnoredFiles) != 0 {
+		// Integration packages may only contain files excluded by build
+		// constraints (e.g, "orchestrion.tool.go"), which is reported as an error.
+		return pkg, nil
+	}
+	var errs error
+	for _, e := range pkg.Errors {
+		errs = errors.Join(errs, e)
+	}
+	return pkg, errs
+}
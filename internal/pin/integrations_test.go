@@ -0,0 +1,235 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package pin
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/gomod"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrations(t *testing.T) {
+	ctx := context.Background()
+	if d, ok := t.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, d)
+		defer cancel()
+	}
+
+	// Local modules are resolved to the zero pseudo-version, so no network access
+	// is needed by `go get`.
+	const localVersion = "v0.0.0-00010101000000-000000000000"
+
+	t.Run("add-list-remove", func(t *testing.T) {
+		tmp := scaffoldIntegrations(t)
+		chdir(t, tmp)
+
+		var out bytes.Buffer
+		require.NoError(t, AddIntegration(ctx, "example.com/integration@"+localVersion, Options{Writer: &out, ErrWriter: io.Discard}))
+		assert.Contains(t, out.String(), `added "example.com/integration"`)
+
+		content, err := os.ReadFile(filepath.Join(tmp, config.FilenameOrchestrionToolGo))
+		require.NoError(t, err)
+		assert.Equal(t, `//go:build tools
+
+package tools
+
+import (
+	_ "github.com/DataDog/orchestrion"
+
+	_ "example.com/integration" // integration
+)
+`, string(content))
+
+		data, err := gomod.Parse(ctx, filepath.Join(tmp, "go.mod"))
+		require.NoError(t, err)
+		assert.Contains(t, data.Require, gomod.Require{Path: "example.com/integration", Version: localVersion})
+
+		integrations, err := ListIntegrations(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []Integration{{
+			ImportPath:  "example.com/integration",
+			Name:        "example.com/integration",
+			Description: "An example integration.",
+		}}, integrations)
+
+		out.Reset()
+		require.NoError(t, RemoveIntegration(ctx, "example.com/integration", Options{Writer: &out, ErrWriter: io.Discard}))
+		assert.Contains(t, out.String(), `removed "example.com/integration"`)
+
+		data, err = gomod.Parse(ctx, filepath.Join(tmp, "go.mod"))
+		require.NoError(t, err)
+		assert.NotContains(t, data.Require, gomod.Require{Path: "example.com/integration", Version: localVersion})
+
+		require.ErrorContains(t, RemoveIntegration(ctx, "example.com/integration", Options{Writer: io.Discard, ErrWriter: io.Discard}), "is not imported by")
+	})
+
+	t.Run("not-an-integration", func(t *testing.T) {
+		tmp := scaffoldIntegrations(t)
+		chdir(t, tmp)
+
+		goMod, err := os.ReadFile(filepath.Join(tmp, "go.mod"))
+		require.NoError(t, err)
+
+		require.ErrorContains(t,
+			AddIntegration(ctx, "example.com/empty@"+localVersion, Options{Writer: io.Discard, ErrWriter: io.Discard}),
+			`"example.com/empty" is not a valid integration`,
+		)
+
+		after, err := os.ReadFile(filepath.Join(tmp, "go.mod"))
+		require.NoError(t, err)
+		assert.Equal(t, string(goMod), string(after))
+	})
+
+	t.Run("vendored", func(t *testing.T) {
+		// Let the go command use the vendor directory, as it does by default.
+		t.Setenv("GOFLAGS", "")
+		tmp := scaffoldIntegrations(t)
+		chdir(t, tmp)
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+		goMod := filepath.Join(tmp, "go.mod")
+		require.NoError(t, gomod.Run(ctx, "tidy", goMod, io.Discard))
+		require.NoError(t, gomod.Run(ctx, "vendor", goMod, io.Discard))
+
+		require.NoError(t, AddIntegration(ctx, "example.com/integration@"+localVersion, Options{Writer: io.Discard, ErrWriter: io.Discard}))
+		vendored, err := gomod.VendoredModules(goMod)
+		require.NoError(t, err)
+		assert.Contains(t, vendored, "example.com/integration")
+		assertBuilds(t, tmp)
+
+		require.NoError(t, RemoveIntegration(ctx, "example.com/integration", Options{Writer: io.Discard, ErrWriter: io.Discard}))
+		data, err := gomod.Parse(ctx, goMod)
+		require.NoError(t, err)
+		assert.NotContains(t, data.Require, gomod.Require{Path: "example.com/integration", Version: localVersion})
+		assertBuilds(t, tmp)
+	})
+
+	t.Run("no-tool-dot-go", func(t *testing.T) {
+		tmp := scaffoldIntegrations(t)
+		require.NoError(t, os.Remove(filepath.Join(tmp, config.FilenameOrchestrionToolGo)))
+		chdir(t, tmp)
+
+		require.ErrorContains(t, RemoveIntegration(ctx, "example.com/integration", Options{Writer: io.Discard, ErrWriter: io.Discard}), "run `orchestrion pin` first")
+	})
+}
+
+func TestImportSetSort(t *testing.T) {
+	dstFile, err := parseOrchestrionToolGo(writeToolFile(t, t.TempDir(), `//go:build tools
+
+package tools
+
+import (
+	_ "github.com/example/zzz" // integration
+	// A comment about this import
+	_ "github.com/example/bbb"
+	_ "github.com/DataDog/orchestrion"
+	_ "github.com/example/aaa" // integration
+)
+`))
+	require.NoError(t, err)
+
+	importSet := importSetFrom(dstFile)
+	importSet.Sort()
+
+	filename := filepath.Join(t.TempDir(), config.FilenameOrchestrionToolGo)
+	require.NoError(t, writeUpdated(filename, dstFile))
+	content, err := os.ReadFile(filename)
+	require.NoError(t, err)
+
+	assert.Equal(t, `//go:build tools
+
+package tools
+
+import (
+	_ "github.com/DataDog/orchestrion"
+
+	_ "github.com/example/aaa" // integration
+	// A comment about this import
+	_ "github.com/example/bbb"
+	_ "github.com/example/zzz" // integration
+)
+`, string(content))
+}
+
+// scaffoldIntegrations creates a module that requires orchestrion and has an
+// [orchestrionToolGo] file, as well as a local `example.com/integration` module
+// it can add, and a local `example.com/empty` module without any configuration.
+func scaffoldIntegrations(t *testing.T) string {
+	t.Helper()
+
+	rawTag, _ := version.TagInfo()
+	tmp := scaffold(t, map[string]string{"github.com/DataDog/orchestrion": rawTag})
+
+	integration := filepath.Join(tmp, "integration")
+	require.NoError(t, os.Mkdir(integration, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(integration, "go.mod"), []byte("module example.com/integration\n\ngo 1.23\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(integration, config.FilenameOrchestrionToolGo), []byte("//go:build tools\n\npackage integration\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(integration, config.FilenameOrchestrionYML), []byte(`meta:
+  name: example.com/integration
+  description: An example integration.
+aspects:
+  - id: Example
+    join-point:
+      function-body:
+        function:
+          - name: main
+    advice:
+      - prepend-statements:
+          template: println("example")
+`), 0o644))
+
+	empty := filepath.Join(tmp, "empty")
+	require.NoError(t, os.Mkdir(empty, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(empty, "go.mod"), []byte("module example.com/empty\n\ngo 1.23\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(empty, "empty.go"), []byte("package empty\n"), 0o644))
+
+	goMod, err := os.OpenFile(filepath.Join(tmp, "go.mod"), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	defer goMod.Close()
+	_, err = goMod.WriteString("\nreplace example.com/integration => ./integration\n\nreplace example.com/empty => ./empty\n")
+	require.NoError(t, err)
+
+	writeToolFile(t, tmp, `//go:build tools
+
+package tools
+
+import (
+	_ "github.com/DataDog/orchestrion"
+)
+`)
+
+	return tmp
+}
+
+// assertBuilds checks that the module in dir builds using its vendor directory.
+func assertBuilds(t *testing.T, dir string) {
+	t.Helper()
+
+	cmd := exec.Command("go", "build", "-mod=vendor", "./...")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "go build:\n%s", output)
+}
+
+// writeToolFile writes an [orchestrionToolGo] file with the provided content in
+// the specified directory, and returns its path.
+func writeToolFile(t *testing.T, dir string, content string) string {
+	t.Helper()
+
+	filename := filepath.Join(dir, config.FilenameOrchestrionToolGo)
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+	return filename
+}
@@ -16,8 +16,10 @@ import (
 	"go/token"
 	goversion "go/version"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/DataDog/orchestrion/internal/ensure"
@@ -30,6 +32,7 @@ import (
 	"github.com/dave/dst"
 	"github.com/dave/dst/decorator"
 	"github.com/rs/zerolog"
+	"golang.org/x/mod/module"
 	"golang.org/x/mod/semver"
 	"golang.org/x/tools/go/packages"
 )
@@ -54,6 +57,14 @@ type Options struct {
 	// NoPrune disables removing unnecessary imports from the [orchestrionToolGo]
 	// file. It will instead only print warnings about these.
 	NoPrune bool
+	// Workspace pins the workspace-level [orchestrionToolGo] file, located next
+	// to the `go.work` file, which applies to all modules used by the workspace.
+	// Modules that have their own [orchestrionToolGo] file are updated too.
+	Workspace bool
+	// Offline resolves modules from the module cache and `vendor` directory
+	// only, never accessing the network. This is automatically enabled when
+	// GOPROXY is "off" or GOFLAGS contains "-mod=vendor".
+	Offline bool
 }
 
 // PinOrchestrion applies or update the orchestrion pin file in the current
@@ -67,28 +78,93 @@ func PinOrchestrion(ctx context.Context, opts Options) error {
 		opts.ErrWriter = os.Stderr
 	}
 
-	log := zerolog.Ctx(ctx)
+	if !opts.Offline {
+		offline, err := goenv.Offline("")
+		if err != nil {
+			return err
+		}
+		opts.Offline = offline
+	}
+	if opts.Offline {
+		zerolog.Ctx(ctx).Debug().Msg("Pinning in offline mode, modules are resolved from the module cache and vendor directory only")
+		ctx = gomod.WithOffline(ctx)
+	}
+
+	if opts.Workspace {
+		return pinWorkspace(ctx, opts)
+	}
 
 	goMod, err := goenv.GOMOD("")
+	if errors.Is(err, goenv.ErrNoGoMod) {
+		if goWork, wsErr := goenv.GOWORK(""); wsErr == nil {
+			return fmt.Errorf("getting GOMOD: %w (use -workspace to pin all modules used by %q)", err, goWork)
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("getting GOMOD: %w", err)
 	}
 
-	// Acquire an advisory lock on the `go.mod` file, so that in `-toolexec` mode,
-	// multiple attempts to auto-pin don't try to modify the files at the same
-	// time. The `go mod tidy` command takes an advisory write-lock on `go.mod`,
-	// so we are using a separate file under [os.TempDir] to avoid deadlocking.
-	sha := sha512.Sum512([]byte(goMod))
-	flockname := filepath.Join(os.TempDir(), "orchestrion-pin_"+base64.URLEncoding.EncodeToString(sha[:])+"_go.mod.lock")
-	flock := filelock.MutexAt(flockname)
-	if err := flock.Lock(ctx); err != nil {
-		return fmt.Errorf("failed to acquire lock on %q: %w", goMod, err)
+	return pinModule(ctx, goMod, opts)
+}
+
+// pinWorkspace applies or updates the workspace-level orchestrion pin file,
+// which is located next to the `go.work` file in effect in the current working
+// directory, and applies to all modules used by the workspace. Modules that
+// have their own pin file are updated as well, so that they all agree on the
+// versions of orchestrion and of the integrations.
+func pinWorkspace(ctx context.Context, opts Options) error {
+	log := zerolog.Ctx(ctx)
+
+	goWork, err := goenv.GOWORK("")
+	if err != nil {
+		return fmt.Errorf("getting GOWORK: %w", err)
 	}
-	defer func() {
-		if err := flock.Unlock(ctx); err != nil {
-			log.Error().Err(err).Str("lock-file", goMod).Msg("Failed to release file lock")
+	work, err := gomod.ParseWork(ctx, goWork)
+	if err != nil {
+		return fmt.Errorf("parsing %q: %w", goWork, err)
+	}
+
+	// The workspace-level pin file must belong to a module, so that its
+	// requirements are recorded somewhere.
+	rootMod := filepath.Join(goWork, "..", "go.mod")
+	modFiles := work.ModFiles(goWork)
+	if !slices.Contains(modFiles, rootMod) {
+		return fmt.Errorf("the directory of %q is not a module used by the workspace; run `go mod init` and `go work use .` in it first", goWork)
+	}
+
+	if err := pinModule(ctx, rootMod, opts); err != nil {
+		return err
+	}
+
+	memberOpts := opts
+	memberOpts.Workspace = false
+	for _, goMod := range modFiles {
+		if goMod == rootMod {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(goMod, "..", config.FilenameOrchestrionToolGo)); errors.Is(err, fs.ErrNotExist) {
+			log.Debug().Str("go.mod", goMod).Msg("Module has no " + config.FilenameOrchestrionToolGo + " file of its own, the workspace-level one applies")
+			continue
+		}
+		log.Info().Str("go.mod", goMod).Msg("Updating module's own " + config.FilenameOrchestrionToolGo + " file")
+		if err := pinModule(ctx, goMod, memberOpts); err != nil {
+			return fmt.Errorf("in %q: %w", goMod, err)
 		}
-	}()
+	}
+
+	return nil
+}
+
+// pinModule applies or updates the orchestrion pin file of the module whose
+// `go.mod` file is provided.
+func pinModule(ctx context.Context, goMod string, opts Options) error {
+	log := zerolog.Ctx(ctx)
+
+	unlock, err := lockGoMod(ctx, goMod)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	toolFile := filepath.Join(goMod, "..", config.FilenameOrchestrionToolGo)
 	dstFile, err := parseOrchestrionToolGo(toolFile)
@@ -120,8 +196,9 @@ func PinOrchestrion(ctx context.Context, opts Options) error {
 		return fmt.Errorf("parsing %q: %w", goMod, err)
 	}
 
+	var missing ensure.MissingModulesError
 	integrationEdits, err := ensure.RequiredIntegrations(ctx, goMod)
-	if err != nil {
+	if err != nil && !errors.As(err, &missing) {
 		return fmt.Errorf("ensuring required integrations in %q: %w", goMod, err)
 	}
 	// If the current version is the same as the target version, this will be a no-op.
@@ -134,15 +211,40 @@ func PinOrchestrion(ctx context.Context, opts Options) error {
 
 	if ver, found := curMod.Requires(orchestrionImportPath); !found || semver.Compare(ver, version.Tag()) < 0 {
 		log.Info().Str("current", ver).Msg("Adding/updating require entry for " + orchestrionImportPath)
-		version, _, _ := strings.Cut(version.Tag(), "+")
-		edits = append(edits, gomod.Require{Path: orchestrionImportPath, Version: version})
+		tag, _, _ := strings.Cut(version.Tag(), "+")
+		edits = append(edits, gomod.Require{Path: orchestrionImportPath, Version: tag})
+
+		// Development builds are expected to be substituted by a replace directive.
+		if _, isDev := version.TagInfo(); gomod.IsOffline(ctx) && !isDev && !curMod.Replaces(orchestrionImportPath) {
+			unavailable, err := ensure.UnavailableModules(ctx, goMod, module.Version{Path: orchestrionImportPath, Version: tag})
+			if err != nil {
+				return err
+			}
+			missing.Modules = append(missing.Modules, unavailable...)
+		}
+	}
+
+	if len(missing.Modules) != 0 {
+		return fmt.Errorf("pinning orchestrion in %q: %w", goMod, missing)
+	}
+
+	// Editing the `go.mod` file of a vendored module requires re-vendoring it,
+	// which the go toolchain can only do from the module cache.
+	if gomod.IsOffline(ctx) && len(edits) != 0 {
+		uncached, err := ensure.UncachedModules(ctx, goMod)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("checking the module cache for %q: %w", goMod, err)
+		}
+		if len(uncached) != 0 {
+			return fmt.Errorf("pinning orchestrion in %q: %w", goMod, ensure.MissingModulesError{Modules: uncached, Vendored: true})
+		}
 	}
 
 	if err := gomod.RunEdit(ctx, goMod, edits...); err != nil {
 		return fmt.Errorf("editing %q: %w", goMod, err)
 	}
 
-	pruned, err := pruneImports(ctx, importSet, opts)
+	pruned, err := pruneImports(ctx, filepath.Dir(goMod), importSet, opts)
 	if err != nil {
 		return fmt.Errorf("pruning imports from %q: %w", toolFile, err)
 	}
@@ -152,6 +254,9 @@ func PinOrchestrion(ctx context.Context, opts Options) error {
 		if err := gomod.Run(ctx, "tidy", goMod, nil); err != nil {
 			return fmt.Errorf("running `go mod tidy`: %w", err)
 		}
+		if err := gomod.Vendor(ctx, goMod); err != nil {
+			return fmt.Errorf("running `go mod vendor`: %w", err)
+		}
 	}
 
 	// Restore the previous toolchain directive if `go mod tidy` had the nerve to touch it...
@@ -162,6 +267,25 @@ func PinOrchestrion(ctx context.Context, opts Options) error {
 	return nil
 }
 
+// lockGoMod acquires an advisory lock on the `go.mod` file, so that in
+// `-toolexec` mode, multiple attempts to auto-pin don't try to modify the files
+// at the same time. The `go mod tidy` command takes an advisory write-lock on
+// `go.mod`, so we are using a separate file under [os.TempDir] to avoid
+// deadlocking. The returned function releases the lock.
+func lockGoMod(ctx context.Context, goMod string) (func(), error) {
+	sha := sha512.Sum512([]byte(goMod))
+	flockname := filepath.Join(os.TempDir(), "orchestrion-pin_"+base64.URLEncoding.EncodeToString(sha[:])+"_go.mod.lock")
+	flock := filelock.MutexAt(flockname)
+	if err := flock.Lock(ctx); err != nil {
+		return nil, fmt.Errorf("failed to acquire lock on %q: %w", goMod, err)
+	}
+	return func() {
+		if err := flock.Unlock(ctx); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Str("lock-file", goMod).Msg("Failed to release file lock")
+		}
+	}, nil
+}
+
 // parseOrchestrionToolGo reads the contents of the orchestrion tool file at the given path
 // and returns the corresponding [*dst.File]
 func parseOrchestrionToolGo(path string) (*dst.File, error) {
@@ -246,6 +370,9 @@ func updateGoGenerateDirective(opts Options, file *dst.File) {
 		if opts.Validate {
 			newDirective += " -validate"
 		}
+		if opts.Workspace {
+			newDirective += " -workspace"
+		}
 	}
 
 	found := false
@@ -286,7 +413,7 @@ func updateGoGenerateDirective(opts Options, file *dst.File) {
 // pruneImports removes unnecessary or invalid imports from the provided
 // [*importSet]; unless the [*Options.NoPrune] field is true, in which case it
 // only outputs a message informing the user about uncalled-for imports.
-func pruneImports(ctx context.Context, importSet *importSet, opts Options) (bool, error) {
+func pruneImports(ctx context.Context, dir string, importSet *importSet, opts Options) (bool, error) {
 	importPaths := importSet.Except(orchestrionImportPath)
 	if len(importPaths) == 0 {
 		// Nothing to do!
@@ -297,6 +424,7 @@ func pruneImports(ctx context.Context, importSet *importSet, opts Options) (bool
 	pkgs, err := packages.Load(
 		&packages.Config{
 			BuildFlags: []string{"-toolexec="},
+			Dir:        dir,
 			Logf:       func(format string, args ...any) { log.Trace().Str("operation", "packages.Load").Msgf(format, args...) },
 			Mode:       packages.NeedName | packages.NeedFiles,
 		},
@@ -6,6 +6,7 @@
 package pin
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"os"
@@ -155,6 +156,37 @@ func main() {}
 
 		require.ErrorContains(t, PinOrchestrion(ctx, Options{Writer: io.Discard, ErrWriter: io.Discard}), "expected 'package', found 'EOF'")
 	})
+
+	t.Run("workspace", func(t *testing.T) {
+		tmp := scaffold(t, make(map[string]string))
+		member := scaffoldWorkspace(t, tmp)
+		require.NoError(t, os.WriteFile(filepath.Join(member, config.FilenameOrchestrionToolGo), []byte("//go:build tools\npackage tools\n"), 0o644))
+		chdir(t, member)
+
+		require.NoError(t, PinOrchestrion(ctx, Options{Writer: io.Discard, ErrWriter: io.Discard, Workspace: true}))
+
+		content, err := os.ReadFile(filepath.Join(tmp, config.FilenameOrchestrionToolGo))
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "//go:generate go run github.com/DataDog/orchestrion pin -generate -workspace")
+
+		// The member's own pin file is updated as well, so that both agree.
+		rawTag, _ := version.TagInfo()
+		for _, dir := range []string{tmp, member} {
+			data, err := gomod.Parse(ctx, filepath.Join(dir, "go.mod"))
+			require.NoError(t, err)
+			assert.Contains(t, data.Require, gomod.Require{Path: "github.com/DataDog/orchestrion", Version: rawTag})
+		}
+	})
+
+	t.Run("workspace-root-not-a-module", func(t *testing.T) {
+		tmp := t.TempDir()
+		member := scaffold(t, make(map[string]string))
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, "go.work"), []byte("go 1.23.0\n\nuse "+member+"\n"), 0o644))
+		t.Setenv("GOWORK", filepath.Join(tmp, "go.work"))
+		chdir(t, member)
+
+		require.ErrorContains(t, PinOrchestrion(ctx, Options{Writer: io.Discard, ErrWriter: io.Discard, Workspace: true}), "is not a module used by the workspace")
+	})
 }
 
 var goModTemplate = template.Must(template.New("go-mod").Parse(`module github.com/DataDog/orchestrion/pin-test
@@ -211,3 +243,21 @@ func scaffold(t *testing.T, requires map[string]string) string {
 
 	return tmp
 }
+
+// scaffoldWorkspace creates a `go.work` file in root that uses it as well as a
+// new member module, and returns the member module's directory.
+func scaffoldWorkspace(t *testing.T, root string) string {
+	t.Helper()
+
+	member := filepath.Join(root, "member")
+	require.NoError(t, os.Mkdir(member, 0o755))
+	goMod, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	require.NoError(t, err)
+	goMod = bytes.Replace(goMod, []byte("pin-test"), []byte("pin-test/member"), 1)
+	require.NoError(t, os.WriteFile(filepath.Join(member, "go.mod"), goMod, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "go.work"), []byte("go "+runtime.Version()[2:6]+"\n\nuse (\n\t.\n\t./member\n)\n"), 0o644))
+	t.Setenv("GOWORK", "")
+	t.Setenv("GOFLAGS", "") // -mod=mod is not allowed in workspace mode
+
+	return member
+}
@@ -0,0 +1,418 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package report
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/DataDog/orchestrion/internal/injector/attribution"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// hunkContext is the number of unchanged lines surrounding changes in a hunk,
+// consistent with the default of `diff -u`.
+const hunkContext = 3
+
+type (
+	// FileDiff is the structured difference between an original file and the
+	// file Orchestrion generated from it.
+	FileDiff struct {
+		// Original is the path to the original file.
+		Original string `json:"original"`
+		// Modified is the path to the modified file, relative to the work
+		// directory.
+		Modified string `json:"modified"`
+		// ImportPath is the import path of the package the file belongs to.
+		ImportPath string `json:"importPath"`
+		// Hunks are the changed regions of the file.
+		Hunks []Hunk `json:"hunks"`
+		// InjectedImports are the import paths present in the modified file, but
+		// not in the original file.
+		InjectedImports []string `json:"injectedImports,omitempty"`
+		// Added is the total number of added lines in all hunks.
+		Added int `json:"added"`
+		// Removed is the total number of removed lines in all hunks.
+		Removed int `json:"removed"`
+		// AddedByAspect is the number of added lines attributed to each aspect, as
+		// recorded in the modified file's [attribution.Manifest]. Lines that could
+		// not be attributed are counted under [Unattributed]. It is nil if the
+		// modified file has no manifest.
+		AddedByAspect map[string]int `json:"addedByAspect,omitempty"`
+	}
+
+	// Hunk is a single changed region of a file. Blank lines, whitespace-only
+	// changes and lines containing only a `//line` directive are ignored, in the
+	// same way [Report.Diff] ignores them.
+	Hunk struct {
+		// OriginalStart is the 1-based line number of the hunk's first line in
+		// the original file.
+		OriginalStart int `json:"originalStart"`
+		// OriginalLines is the number of lines of the original file in the hunk.
+		OriginalLines int `json:"originalLines"`
+		// ModifiedStart is the 1-based line number of the hunk's first line in
+		// the modified file.
+		ModifiedStart int `json:"modifiedStart"`
+		// ModifiedLines is the number of lines of the modified file in the hunk.
+		ModifiedLines int `json:"modifiedLines"`
+		// Lines are the lines of the hunk, prefixed with ' ' (context), '-'
+		// (removed) or '+' (added), without trailing newline.
+		Lines []string `json:"lines"`
+		// Aspects are the sorted IDs of the aspects that produced the added lines
+		// of the hunk, if known.
+		Aspects []string `json:"aspects,omitempty"`
+	}
+)
+
+// Unattributed is the key used in [FileDiff.AddedByAspect] for lines that are
+// not attributed to any aspect.
+const Unattributed = "(unattributed)"
+
+// Changes returns the number of added and removed lines in the hunk.
+func (h Hunk) Changes() (added int, removed int) {
+	for _, line := range h.Lines {
+		switch line[0] {
+		case '+':
+			added++
+		case '-':
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// errNoOriginal is returned by [Report.fileDiff] when the original file of a
+// modified file does not exist.
+var errNoOriginal = errors.New("original file does not exist")
+
+// FileDiffs computes the structured differences of all files in the report.
+// Files whose original is missing (such as CGo-generated files) are skipped;
+// failing to read any other file is an error.
+func (r Report) FileDiffs() ([]FileDiff, error) {
+	var (
+		res  []FileDiff
+		errs []error
+	)
+	for _, file := range r.Files() {
+		diff, err := r.fileDiff(file)
+		if errors.Is(err, errNoOriginal) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res = append(res, diff)
+	}
+	return res, errors.Join(errs...)
+}
+
+func (r Report) fileDiff(file ModifiedFile) (FileDiff, error) {
+	var (
+		original []byte
+		err      error
+	)
+	if file.input != "" {
+		original, err = fs.ReadFile(r.fs, file.input)
+		if err != nil {
+			return FileDiff{}, fmt.Errorf("read input file %s: %w", file.input, err)
+		}
+	} else {
+		original, err = os.ReadFile(file.original)
+		if errors.Is(err, fs.ErrNotExist) {
+			return FileDiff{}, fmt.Errorf("%s: %w", file.original, errNoOriginal)
+		}
+		if err != nil {
+			return FileDiff{}, fmt.Errorf("read original file: %w", err)
+		}
+	}
+	modified, err := fs.ReadFile(r.fs, file.modified)
+	if err != nil {
+		return FileDiff{}, fmt.Errorf("read modified file %s: %w", file.modified, err)
+	}
+
+	manifest, err := attribution.Read(r.fs, file.modified)
+	if err != nil {
+		return FileDiff{}, fmt.Errorf("read attribution manifest: %w", err)
+	}
+
+	res := FileDiff{
+		Original:   file.original,
+		Modified:   file.modified,
+		ImportPath: file.ImportPath(),
+	}
+	res.Hunks, res.AddedByAspect = computeHunks(original, modified, manifest)
+	for _, hunk := range res.Hunks {
+		added, removed := hunk.Changes()
+		res.Added += added
+		res.Removed += removed
+	}
+
+	if res.InjectedImports, err = injectedImports(original, modified); err != nil {
+		return FileDiff{}, fmt.Errorf("%s: %w", file.modified, err)
+	}
+
+	return res, nil
+}
+
+// diffLines holds the lines of a file that are relevant for comparison, along
+// with their 1-based line numbers and comparison keys.
+type diffLines struct {
+	text  []string
+	lines []int
+	keys  []string
+}
+
+func newDiffLines(content []byte) diffLines {
+	var res diffLines
+	for idx, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		key := strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, line)
+		if key == "" || strings.HasPrefix(strings.TrimSpace(line), "//line ") {
+			continue
+		}
+		res.text = append(res.text, line)
+		res.lines = append(res.lines, idx+1)
+		res.keys = append(res.keys, key)
+	}
+	return res
+}
+
+// lineAt returns the line number corresponding to the provided index, which
+// may be one past the last relevant line.
+func (d diffLines) lineAt(idx int) int {
+	if idx < len(d.lines) {
+		return d.lines[idx]
+	}
+	if len(d.lines) == 0 {
+		return 1
+	}
+	return d.lines[len(d.lines)-1] + 1
+}
+
+// computeHunks computes the hunks between original and modified, and attributes
+// added lines using the provided manifest. The returned map is nil if the
+// manifest is empty.
+func computeHunks(original []byte, modified []byte, manifest attribution.Manifest) ([]Hunk, map[string]int) {
+	a, b := newDiffLines(original), newDiffLines(modified)
+	matcher := difflib.NewMatcherWithJunk(a.keys, b.keys, false, nil)
+
+	var byAspect map[string]int
+	if len(manifest.Ranges) > 0 {
+		byAspect = make(map[string]int)
+	}
+
+	var hunks []Hunk
+	for _, group := range matcher.GetGroupedOpCodes(hunkContext) {
+		hunk := Hunk{
+			OriginalStart: a.lineAt(group[0].I1),
+			ModifiedStart: b.lineAt(group[0].J1),
+		}
+		for _, op := range group {
+			if op.Tag == 'e' {
+				for _, line := range a.text[op.I1:op.I2] {
+					hunk.Lines = append(hunk.Lines, " "+line)
+				}
+				hunk.OriginalLines += op.I2 - op.I1
+				hunk.ModifiedLines += op.J2 - op.J1
+				continue
+			}
+			if op.Tag == 'r' || op.Tag == 'd' {
+				for _, line := range a.text[op.I1:op.I2] {
+					hunk.Lines = append(hunk.Lines, "-"+line)
+				}
+				hunk.OriginalLines += op.I2 - op.I1
+			}
+			if op.Tag == 'r' || op.Tag == 'i' {
+				for idx, line := range b.text[op.J1:op.J2] {
+					hunk.Lines = append(hunk.Lines, "+"+line)
+					if byAspect == nil {
+						continue
+					}
+					aspects := lineAspects(manifest, b.lines[op.J1+idx])
+					if len(aspects) == 0 {
+						byAspect[Unattributed]++
+					}
+					for _, id := range aspects {
+						byAspect[id]++
+						if !slices.Contains(hunk.Aspects, id) {
+							hunk.Aspects = append(hunk.Aspects, id)
+						}
+					}
+				}
+				hunk.ModifiedLines += op.J2 - op.J1
+			}
+		}
+		slices.Sort(hunk.Aspects)
+		hunks = append(hunks, hunk)
+	}
+	return hunks, byAspect
+}
+
+// lineAspects returns the unique IDs of the aspects the manifest attributes the
+// provided line to. A line may be attributed to several aspects when the code
+// produced by one aspect is further modified by another.
+func lineAspects(manifest attribution.Manifest, line int) []string {
+	var res []string
+	for _, r := range manifest.At(line) {
+		if !slices.Contains(res, r.Aspect) {
+			res = append(res, r.Aspect)
+		}
+	}
+	return res
+}
+
+// injectedImports returns the sorted list of import paths present in modified,
+// but not in original.
+func injectedImports(original []byte, modified []byte) ([]string, error) {
+	before, err := importPaths(original)
+	if err != nil {
+		return nil, fmt.Errorf("parse original imports: %w", err)
+	}
+	after, err := importPaths(modified)
+	if err != nil {
+		return nil, fmt.Errorf("parse modified imports: %w", err)
+	}
+
+	var res []string
+	for _, path := range after {
+		if !slices.Contains(before, path) && !slices.Contains(res, path) {
+			res = append(res, path)
+		}
+	}
+	slices.Sort(res)
+	return res, nil
+}
+
+func importPaths(content []byte) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", content, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(file.Imports))
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, path)
+	}
+	return res, nil
+}
+
+// WritePatch writes the provided file differences in the unified diff format.
+// If annotate is true, the IDs of the aspects that produced each hunk are
+// written after its range information.
+func WritePatch(w io.Writer, diffs []FileDiff, annotate bool) error {
+	var buf bytes.Buffer
+	for _, diff := range diffs {
+		if len(diff.Hunks) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "--- %s\n+++ %s\n", diff.Original, diff.Modified)
+		for _, hunk := range diff.Hunks {
+			fmt.Fprintf(&buf, "@@ -%s +%s @@", hunkRange(hunk.OriginalStart, hunk.OriginalLines), hunkRange(hunk.ModifiedStart, hunk.ModifiedLines))
+			if annotate && len(hunk.Aspects) > 0 {
+				fmt.Fprintf(&buf, " %s", strings.Join(hunk.Aspects, ", "))
+			}
+			buf.WriteByte('\n')
+			for _, line := range hunk.Lines {
+				buf.WriteString(line)
+				buf.WriteByte('\n')
+			}
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func hunkRange(start int, count int) string {
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	if count == 0 {
+		// By convention, empty ranges designate the line before the change.
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// PackageStat summarizes the changes made to a package.
+type PackageStat struct {
+	ImportPath string `json:"importPath"`
+	Files      int    `json:"files"`
+	Added      int    `json:"added"`
+	Removed    int    `json:"removed"`
+}
+
+// PackageStats summarizes the provided file differences per package, sorted by
+// import path. Files without any hunk are not counted.
+func PackageStats(diffs []FileDiff) []PackageStat {
+	var res []PackageStat
+	for _, diff := range diffs {
+		if len(diff.Hunks) == 0 {
+			continue
+		}
+		idx, found := slices.BinarySearchFunc(res, diff.ImportPath, func(s PackageStat, path string) int {
+			return strings.Compare(s.ImportPath, path)
+		})
+		if !found {
+			res = slices.Insert(res, idx, PackageStat{ImportPath: diff.ImportPath})
+		}
+		res[idx].Files++
+		res[idx].Added += diff.Added
+		res[idx].Removed += diff.Removed
+	}
+	return res
+}
+
+// AspectStat summarizes the changes attributed to an aspect.
+type AspectStat struct {
+	Aspect   string `json:"aspect"`
+	Packages int    `json:"packages"`
+	Added    int    `json:"added"`
+}
+
+// AspectStats summarizes the lines added by each aspect in the provided file
+// differences, sorted by aspect ID. Files without an attribution manifest are
+// not counted.
+func AspectStats(diffs []FileDiff) []AspectStat {
+	var (
+		res      []AspectStat
+		packages = make(map[string]map[string]struct{})
+	)
+	for _, diff := range diffs {
+		for id, added := range diff.AddedByAspect {
+			idx, found := slices.BinarySearchFunc(res, id, func(s AspectStat, id string) int {
+				return strings.Compare(s.Aspect, id)
+			})
+			if !found {
+				res = slices.Insert(res, idx, AspectStat{Aspect: id})
+				packages[id] = make(map[string]struct{})
+			}
+			res[idx].Added += added
+			packages[id][diff.ImportPath] = struct{}{}
+		}
+	}
+	for idx := range res {
+		res[idx].Packages = len(packages[res[idx].Aspect])
+	}
+	return res
+}
@@ -0,0 +1,127 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package report
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/injector/attribution"
+	"github.com/DataDog/orchestrion/internal/toolexec/aspect"
+	"github.com/liamg/memoryfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileDiffs(t *testing.T) {
+	original := filepath.Join(t.TempDir(), "main.go")
+	require.NoError(t, os.WriteFile(original, []byte(strings.Join([]string{
+		"package main",
+		"",
+		`import "fmt"`,
+		"",
+		"func main() {",
+		`	fmt.Println("Hello")`,
+		"}",
+		"",
+	}, "\n")), 0o644))
+
+	fsys := memoryfs.New()
+	dir := filepath.Join("b001", aspect.OrchestrionDirPathElement, "example.com", "main")
+	require.NoError(t, fsys.MkdirAll(dir, 0o755))
+	require.NoError(t, fsys.WriteFile(filepath.Join(dir, "main.go"), []byte(strings.Join([]string{
+		"//line " + original + ":1:1",
+		"package main",
+		"",
+		"import (",
+		`	"fmt"`,
+		"//line <generated>:1",
+		`	__orchestrion_log "log"`,
+		")",
+		"",
+		"//line " + original + ":5",
+		"func main() {",
+		"//line <generated>:1",
+		`	__orchestrion_log.Print("calling")`,
+		"//line " + original + ":6",
+		`	fmt.Println("Hello")`,
+		"}",
+		"",
+	}, "\n")), 0o644))
+	require.NoError(t, fsys.WriteFile(attribution.SidecarPath(filepath.Join(dir, "main.go")),
+		[]byte(`{"ranges":[{"startLine":13,"endLine":13,"aspect":"log-call","advice":"prepend-statements"}]}`), 0o644))
+
+	rpt, err := fromWorkFS(context.Background(), "/tmp/build", fsys)
+	require.NoError(t, err)
+
+	diffs, err := rpt.FileDiffs()
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+
+	diff := diffs[0]
+	assert.Equal(t, original, diff.Original)
+	assert.Equal(t, "example.com/main", diff.ImportPath)
+	assert.Equal(t, []string{"log"}, diff.InjectedImports)
+	assert.Equal(t, 5, diff.Added)
+	assert.Equal(t, 1, diff.Removed)
+	assert.Equal(t, map[string]int{"log-call": 1, Unattributed: 4}, diff.AddedByAspect)
+	assert.Equal(t, []Hunk{{
+		OriginalStart: 1,
+		OriginalLines: 5,
+		ModifiedStart: 2,
+		ModifiedLines: 9,
+		Lines: []string{
+			" package main",
+			`-import "fmt"`,
+			"+import (",
+			`+	"fmt"`,
+			`+	__orchestrion_log "log"`,
+			"+)",
+			" func main() {",
+			`+	__orchestrion_log.Print("calling")`,
+			` 	fmt.Println("Hello")`,
+			" }",
+		},
+		Aspects: []string{"log-call"},
+	}}, diff.Hunks)
+
+	var patch strings.Builder
+	require.NoError(t, WritePatch(&patch, diffs, true))
+	assert.True(t, strings.HasPrefix(patch.String(), "--- "+original+"\n+++ "+diff.Modified+"\n@@ -1,5 +2,9 @@ log-call\n"))
+
+	assert.Equal(t, []PackageStat{{ImportPath: "example.com/main", Files: 1, Added: 5, Removed: 1}}, PackageStats(diffs))
+	assert.Equal(t, []AspectStat{
+		{Aspect: Unattributed, Packages: 1, Added: 4},
+		{Aspect: "log-call", Packages: 1, Added: 1},
+	}, AspectStats(diffs))
+}
+
+func TestFileDiffsMissingFiles(t *testing.T) {
+	original := filepath.Join(t.TempDir(), "main.go")
+	require.NoError(t, os.WriteFile(original, []byte("package main\n"), 0o644))
+
+	fsys := memoryfs.New()
+	dir := filepath.Join("b001", aspect.OrchestrionDirPathElement, "example.com", "main")
+	require.NoError(t, fsys.MkdirAll(dir, 0o755))
+	// The original of a CGo-generated file does not exist, and it is skipped.
+	require.NoError(t, fsys.WriteFile(filepath.Join(dir, "cgo.go"), []byte("//line "+filepath.Join(filepath.Dir(original), "_cgo_gotypes.go")+":1:1\npackage main\n"), 0o644))
+	require.NoError(t, fsys.WriteFile(filepath.Join(dir, "main.go"), []byte("//line "+original+":1:1\npackage main\n"), 0o644))
+
+	rpt, err := fromWorkFS(context.Background(), "/tmp/build", fsys)
+	require.NoError(t, err)
+	diffs, err := rpt.FileDiffs()
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.Equal(t, original, diffs[0].Original)
+
+	// Failing to read any other file is reported.
+	require.NoError(t, fsys.Remove(filepath.Join(dir, "main.go")))
+	_, err = rpt.FileDiffs()
+	require.ErrorContains(t, err, "read modified file")
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/DataDog/orchestrion/internal/injector/parse"
 	"github.com/DataDog/orchestrion/internal/toolexec/aspect"
+	"github.com/DataDog/orchestrion/internal/toolexec/aspect/injected"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -86,6 +87,10 @@ type (
 		// modified is the fullpath of the modified file that was generated by Orchestrion. It can be missing
 		// if a build was made without the `-work` flag.
 		modified string
+
+		// input is the path of a copy of the file the compiler was originally given, relative to the report's root,
+		// when it is not the original file (e.g, when it is the output of the cover tool). It is blank otherwise.
+		input string
 	}
 
 	// Report represents a collection of modified files that were generated by Orchestrion.
@@ -118,10 +123,14 @@ func NewModifiedFile(fsys fs.FS, modifiedPath string) (ModifiedFile, error) {
 		originalPath = filepath.Clean(originalPath)
 	}
 
-	return ModifiedFile{
+	res := ModifiedFile{
 		original: originalPath,
 		modified: filepath.Clean(modifiedPath),
-	}, nil
+	}
+	if _, err := fs.Stat(fsys, injected.InputPath(res.modified)); err == nil {
+		res.input = injected.InputPath(res.modified)
+	}
+	return res, nil
 }
 
 func (m ModifiedFile) String() string {
@@ -132,6 +141,12 @@ func (m ModifiedFile) String() string {
 	return fmt.Sprintf("%s -> %s", original, m.modified)
 }
 
+// Original returns the full path of the original file, which is blank if it
+// could not be inferred from the modified file's line directive.
+func (m ModifiedFile) Original() string {
+	return m.original
+}
+
 // ImportPath converts the modified file path to an import path.
 func (m ModifiedFile) ImportPath() string {
 	dir := filepath.Dir(m.modified)
@@ -209,8 +224,11 @@ func (r Report) Diff(writer io.Writer) error {
 }
 
 func (r Report) diff(writer io.Writer, file ModifiedFile) error {
-	// If originalPath does not exists, it means that we have cgo files in there, just skip it
-	if _, err := os.Open(file.original); os.IsNotExist(err) {
+	left := file.original
+	if file.input != "" {
+		left = filepath.Join(r.root, file.input)
+	} else if _, err := os.Stat(file.original); os.IsNotExist(err) {
+		// If originalPath does not exists, it means that we have cgo files in there, just skip it
 		return nil
 	}
 
@@ -225,7 +243,7 @@ func (r Report) diff(writer io.Writer, file ModifiedFile) error {
 		"-I", "^//line", // Don't print line directives in the diff when they would end up being alone in a fragment
 		"--label", file.original, // Label the original file without timestamp for reproducibility
 		"--label", file.modified, // Label the modified file without timestamp for reproducibility
-		file.original, filepath.Join(r.root, file.modified),
+		left, filepath.Join(r.root, file.modified),
 	}
 
 	log.Trace().Any("args", args).Str("root", r.root).Msg("running diff command")
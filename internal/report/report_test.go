@@ -123,6 +123,23 @@ func TestFromWorkFS(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "compiler-input",
+			args: func() fs.FS {
+				fsys := memoryfs.New()
+				fsys.MkdirAll(filepath.Join("b001", aspect.OrchestrionDirPathElement, "pkg"), 0755)
+				fsys.WriteFile(filepath.Join("b001", aspect.OrchestrionDirPathElement, "pkg", "file.go"), []byte("//line pkg/file.go\npackage pkg\nfunc File() {}"), 0644)
+				fsys.WriteFile(filepath.Join("b001", aspect.OrchestrionDirPathElement, "pkg", "file.go.input"), []byte("//line pkg/file.go:1:1\npackage pkg\nfunc File() {}"), 0644)
+				return fsys
+			}(),
+			want: []ModifiedFile{
+				{
+					modified: filepath.Join("b001", aspect.OrchestrionDirPathElement, "pkg", "file.go"),
+					original: filepath.Join("pkg", "file.go"),
+					input:    filepath.Join("b001", aspect.OrchestrionDirPathElement, "pkg", "file.go.input"),
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,132 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package sarif provides a minimal model of the Static Analysis Results
+// Interchange Format (SARIF) version 2.1.0, sufficient for orchestrion commands
+// to produce reports that CI systems can use to annotate source files.
+package sarif
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+
+	"github.com/DataDog/orchestrion/internal/version"
+)
+
+const (
+	schemaURI   = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifFormat = "2.1.0"
+	toolURI     = "https://datadoghq.dev/orchestrion"
+)
+
+// Level is the severity level of a [Result].
+type Level string
+
+const (
+	LevelError   Level = "error"
+	LevelWarning Level = "warning"
+	LevelNote    Level = "note"
+)
+
+type (
+	// Log is the top-level SARIF document.
+	Log struct {
+		Schema  string `json:"$schema"`
+		Version string `json:"version"`
+		Runs    []Run  `json:"runs"`
+	}
+
+	// Run represents a single invocation of an analysis tool.
+	Run struct {
+		Tool    Tool     `json:"tool"`
+		Results []Result `json:"results"`
+	}
+
+	Tool struct {
+		Driver Driver `json:"driver"`
+	}
+
+	Driver struct {
+		Name           string `json:"name"`
+		Version        string `json:"version,omitempty"`
+		InformationURI string `json:"informationUri,omitempty"`
+		Rules          []Rule `json:"rules,omitempty"`
+	}
+
+	Rule struct {
+		ID               string   `json:"id"`
+		ShortDescription *Message `json:"shortDescription,omitempty"`
+	}
+
+	// Result is a single finding produced by the tool.
+	Result struct {
+		RuleID     string         `json:"ruleId,omitempty"`
+		Level      Level          `json:"level,omitempty"`
+		Message    Message        `json:"message"`
+		Locations  []Location     `json:"locations,omitempty"`
+		Properties map[string]any `json:"properties,omitempty"`
+	}
+
+	Message struct {
+		Text string `json:"text"`
+	}
+
+	Location struct {
+		PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+	}
+
+	PhysicalLocation struct {
+		ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+		Region           *Region          `json:"region,omitempty"`
+	}
+
+	ArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+
+	// Region identifies a portion of an artifact. Lines and columns are 1-based;
+	// zero values are omitted.
+	Region struct {
+		StartLine   int `json:"startLine,omitempty"`
+		StartColumn int `json:"startColumn,omitempty"`
+		EndLine     int `json:"endLine,omitempty"`
+		EndColumn   int `json:"endColumn,omitempty"`
+	}
+)
+
+// NewRun creates a new [Run] for the orchestrion tool, with the provided
+// rules declared on its driver.
+func NewRun(rules ...Rule) Run {
+	return Run{
+		Tool: Tool{Driver: Driver{
+			Name:           "orchestrion",
+			Version:        version.Tag(),
+			InformationURI: toolURI,
+			Rules:          rules,
+		}},
+		Results: []Result{},
+	}
+}
+
+// NewLocation creates a [Location] for the provided file and region. Paths are
+// converted to forward-slash URIs, as required by the format.
+func NewLocation(filename string, region *Region) Location {
+	return Location{PhysicalLocation: PhysicalLocation{
+		ArtifactLocation: ArtifactLocation{URI: filepath.ToSlash(filename)},
+		Region:           region,
+	}}
+}
+
+// Write serializes a SARIF [Log] containing the provided runs to the writer.
+func Write(w io.Writer, runs ...Run) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Log{
+		Schema:  schemaURI,
+		Version: sarifFormat,
+		Runs:    runs,
+	})
+}
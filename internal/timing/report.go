@@ -0,0 +1,111 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package timing
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+type (
+	// Report is an aggregated timing report for a build. Packages and aspects are
+	// sorted by decreasing instrumentation time.
+	Report struct {
+		// Phases is the total time spent in each phase, across all packages.
+		Phases map[Phase]time.Duration `json:"phases"`
+		// Packages lists the instrumented packages, most expensive first.
+		Packages []PackageReport `json:"packages"`
+		// Aspects lists the aspects that were evaluated, most expensive first.
+		Aspects []AspectReport `json:"aspects"`
+	}
+
+	// PackageReport is the timing report of a single package.
+	PackageReport struct {
+		// ImportPath is the import path of the package.
+		ImportPath string `json:"importPath"`
+		// Instrumentation is the total time spent instrumenting the package.
+		Instrumentation time.Duration `json:"instrumentation"`
+		// Compile is the total time spent compiling the package, including its
+		// instrumentation.
+		Compile time.Duration `json:"compile"`
+		// Phases is the time spent in each phase.
+		Phases map[Phase]time.Duration `json:"phases"`
+		// Aspects is the time spent matching and applying each aspect, by ID.
+		Aspects map[string]time.Duration `json:"aspects,omitempty"`
+	}
+
+	// AspectReport is the timing report of a single aspect.
+	AspectReport struct {
+		// ID is the ID of the aspect.
+		ID string `json:"id"`
+		// Duration is the total time spent matching and applying the aspect.
+		Duration time.Duration `json:"duration"`
+		// Packages is the number of packages the aspect was evaluated against.
+		Packages int `json:"packages"`
+	}
+
+	// Aggregator builds a [Report] from the profiles of individual packages. It
+	// is safe for concurrent use.
+	Aggregator struct {
+		mu       sync.Mutex
+		packages []PackageReport
+	}
+)
+
+// Add records the profile of a package, which took compile to be compiled.
+func (a *Aggregator) Add(importPath string, compile time.Duration, profile Profile) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.packages = append(a.packages, PackageReport{
+		ImportPath:      importPath,
+		Instrumentation: profile.Total(),
+		Compile:         compile,
+		Phases:          profile.Phases,
+		Aspects:         profile.Aspects,
+	})
+}
+
+// Report returns the aggregated report of all profiles added so far.
+func (a *Aggregator) Report() Report {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	report := Report{
+		Phases:   make(map[Phase]time.Duration),
+		Packages: slices.Clone(a.packages),
+	}
+	aspects := make(map[string]*AspectReport)
+	for _, pkg := range a.packages {
+		for phase, d := range pkg.Phases {
+			report.Phases[phase] += d
+		}
+		for id, d := range pkg.Aspects {
+			aspect, found := aspects[id]
+			if !found {
+				aspect = &AspectReport{ID: id}
+				aspects[id] = aspect
+			}
+			aspect.Duration += d
+			aspect.Packages++
+		}
+	}
+
+	slices.SortFunc(report.Packages, func(l, r PackageReport) int {
+		return cmp.Or(cmp.Compare(r.Instrumentation, l.Instrumentation), cmp.Compare(l.ImportPath, r.ImportPath))
+	})
+	report.Aspects = make([]AspectReport, 0, len(aspects))
+	for _, aspect := range aspects {
+		report.Aspects = append(report.Aspects, *aspect)
+	}
+	slices.SortFunc(report.Aspects, func(l, r AspectReport) int {
+		return cmp.Or(cmp.Compare(r.Duration, l.Duration), cmp.Compare(l.ID, r.ID))
+	})
+
+	return report
+}
@@ -0,0 +1,142 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package timing measures the time spent instrumenting packages, broken down by
+// phase and by aspect, so that expensive packages and aspects can be identified.
+package timing
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EnvVarEnabled is the environment variable that enables timing measurements in
+// toolexec processes. It is set by `orchestrion go --timings`.
+const EnvVarEnabled = "ORCHESTRION_TIMINGS"
+
+// Phase identifies a phase of the instrumentation of a package.
+type Phase string
+
+const (
+	// PhaseConfig is the loading of the injector configuration.
+	PhaseConfig Phase = "config"
+	// PhaseParse is the parsing of source files.
+	PhaseParse Phase = "parse"
+	// PhaseTypeCheck is the type-checking of parsed source files.
+	PhaseTypeCheck Phase = "typecheck"
+	// PhaseMatch is the evaluation of aspects' join points against AST nodes.
+	PhaseMatch Phase = "match"
+	// PhaseAdvice is the application of aspects' advice to matched AST nodes.
+	PhaseAdvice Phase = "advice"
+	// PhaseWrite is the writing of modified source files.
+	PhaseWrite Phase = "write"
+	// PhaseResolve is the resolution of dependencies introduced by injected code.
+	PhaseResolve Phase = "resolve"
+)
+
+// Profile records the time spent in each phase and by each aspect. Durations
+// are cumulative, and may exceed the wall-clock time when source files are
+// processed concurrently. The zero value is ready to use.
+type Profile struct {
+	// Phases is the time spent in each phase.
+	Phases map[Phase]time.Duration `json:"phases,omitempty"`
+	// Aspects is the time spent matching and applying each aspect, by ID.
+	Aspects map[string]time.Duration `json:"aspects,omitempty"`
+}
+
+// AddPhase records time spent in the specified phase.
+func (p *Profile) AddPhase(phase Phase, d time.Duration) {
+	if p.Phases == nil {
+		p.Phases = make(map[Phase]time.Duration)
+	}
+	p.Phases[phase] += d
+}
+
+// AddAspect records time spent matching or applying the specified aspect.
+func (p *Profile) AddAspect(id string, d time.Duration) {
+	if p.Aspects == nil {
+		p.Aspects = make(map[string]time.Duration)
+	}
+	p.Aspects[id] += d
+}
+
+// Merge adds all durations recorded in other to p.
+func (p *Profile) Merge(other Profile) {
+	for phase, d := range other.Phases {
+		p.AddPhase(phase, d)
+	}
+	for id, d := range other.Aspects {
+		p.AddAspect(id, d)
+	}
+}
+
+// Total returns the total time spent in all phases.
+func (p *Profile) Total() time.Duration {
+	var total time.Duration
+	for _, d := range p.Phases {
+		total += d
+	}
+	return total
+}
+
+// Recorder accumulates a [Profile] and is safe for concurrent use. A nil
+// *Recorder discards all measurements, so callers can skip measuring when
+// [Recorder.Enabled] returns false.
+type Recorder struct {
+	mu      sync.Mutex
+	profile Profile
+}
+
+// FromEnvironment returns a new [Recorder] if timing measurements are enabled
+// by the [EnvVarEnabled] environment variable, or nil otherwise.
+func FromEnvironment() *Recorder {
+	if enabled, _ := strconv.ParseBool(os.Getenv(EnvVarEnabled)); enabled {
+		return &Recorder{}
+	}
+	return nil
+}
+
+// Enabled returns true if r records measurements.
+func (r *Recorder) Enabled() bool {
+	return r != nil
+}
+
+// Since records the time elapsed since start as spent in the specified phase.
+func (r *Recorder) Since(phase Phase, start time.Time) {
+	if r == nil {
+		return
+	}
+	d := time.Since(start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.profile.AddPhase(phase, d)
+}
+
+// Merge adds all durations recorded in p to the recorder.
+func (r *Recorder) Merge(p Profile) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.profile.Merge(p)
+}
+
+// Profile returns a copy of the recorded profile, or nil if r is nil.
+func (r *Recorder) Profile() *Profile {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var p Profile
+	p.Merge(r.profile)
+	return &p
+}
@@ -0,0 +1,76 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package timing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv(EnvVarEnabled, "")
+		rec := FromEnvironment()
+		require.False(t, rec.Enabled())
+		rec.Since(PhaseParse, time.Now())
+		rec.Merge(Profile{Phases: map[Phase]time.Duration{PhaseMatch: time.Second}})
+		assert.Nil(t, rec.Profile())
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Setenv(EnvVarEnabled, "true")
+		rec := FromEnvironment()
+		require.True(t, rec.Enabled())
+		rec.Since(PhaseParse, time.Now().Add(-time.Second))
+		rec.Merge(Profile{
+			Phases:  map[Phase]time.Duration{PhaseMatch: time.Second, PhaseAdvice: time.Second},
+			Aspects: map[string]time.Duration{"a": 2 * time.Second},
+		})
+
+		profile := rec.Profile()
+		require.NotNil(t, profile)
+		assert.GreaterOrEqual(t, profile.Phases[PhaseParse], time.Second)
+		assert.Equal(t, time.Second, profile.Phases[PhaseMatch])
+		assert.Equal(t, map[string]time.Duration{"a": 2 * time.Second}, profile.Aspects)
+		assert.Equal(t, profile.Phases[PhaseParse]+2*time.Second, profile.Total())
+
+		// The returned profile is a copy.
+		profile.AddAspect("a", time.Second)
+		assert.Equal(t, 2*time.Second, rec.Profile().Aspects["a"])
+	})
+}
+
+func TestAggregator(t *testing.T) {
+	var agg Aggregator
+	agg.Add("cheap", 3*time.Second, Profile{
+		Phases:  map[Phase]time.Duration{PhaseParse: time.Second},
+		Aspects: map[string]time.Duration{"x": time.Millisecond},
+	})
+	agg.Add("expensive", 5*time.Second, Profile{
+		Phases:  map[Phase]time.Duration{PhaseParse: time.Second, PhaseMatch: 2 * time.Second},
+		Aspects: map[string]time.Duration{"x": time.Millisecond, "y": 2 * time.Second},
+	})
+	agg.Add("also-cheap", 2*time.Second, Profile{Phases: map[Phase]time.Duration{PhaseParse: time.Second}})
+
+	report := agg.Report()
+	assert.Equal(t, map[Phase]time.Duration{PhaseParse: 3 * time.Second, PhaseMatch: 2 * time.Second}, report.Phases)
+
+	paths := make([]string, 0, len(report.Packages))
+	for _, pkg := range report.Packages {
+		paths = append(paths, pkg.ImportPath)
+	}
+	assert.Equal(t, []string{"expensive", "also-cheap", "cheap"}, paths)
+	assert.Equal(t, 3*time.Second, report.Packages[0].Instrumentation)
+	assert.Equal(t, 5*time.Second, report.Packages[0].Compile)
+
+	assert.Equal(t, []AspectReport{
+		{ID: "y", Duration: 2 * time.Second, Packages: 1},
+		{ID: "x", Duration: 2 * time.Millisecond, Packages: 2},
+	}, report.Aspects)
+}
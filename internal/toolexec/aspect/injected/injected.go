@@ -0,0 +1,351 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package injected keeps a copy of the source files produced by orchestrion for
+// each package it compiles, so that `orchestrion diff` can report on packages
+// whose compilation was satisfied from the go build cache (and hence did not
+// leave any modified file in the build's work directory). Copies are only
+// kept when [EnvVarEnabled] is set.
+package injected
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/injector/attribution"
+)
+
+// EnvVarEnabled is the environment variable that causes toolexec processes to
+// save the modified files of the packages they compile in the [Store]. It is
+// set by `orchestrion diff --build`.
+const EnvVarEnabled = "ORCHESTRION_SAVE_INJECTED"
+
+// Enabled returns true if [EnvVarEnabled] is set to a true value.
+func Enabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(EnvVarEnabled))
+	return enabled
+}
+
+// Variant distinguishes the different ways a given package may be compiled, as
+// these result in different compiler inputs.
+type Variant string
+
+const (
+	// VariantDefault is the variant of packages compiled without coverage
+	// instrumentation.
+	VariantDefault Variant = "default"
+	// VariantCover is the variant of packages compiled with coverage
+	// instrumentation, where the compiler receives the output of the cover tool
+	// instead of the original source files.
+	VariantCover Variant = "cover"
+)
+
+// inputSuffix is appended to the name of a modified file to obtain the name of
+// the copy of the file the compiler was originally given, when it is not the
+// original source file (e.g, the output of the cover tool).
+const inputSuffix = ".input"
+
+// InputPath returns the path of the copy of the compiler input the provided
+// modified file was produced from.
+func InputPath(modifiedFile string) string {
+	return modifiedFile + inputSuffix
+}
+
+const (
+	manifestFile = "manifest.json"
+	stagingDir   = ".staging"
+	trimFile     = ".trimmed"
+
+	// trimInterval is how often the store is trimmed.
+	trimInterval = 24 * time.Hour
+	// trimUnused is how long an entry may go unused before it's trimmed. This
+	// mirrors the go build cache, which trims entries unused for 5 days.
+	trimUnused = 5 * 24 * time.Hour
+)
+
+type (
+	// Store is a directory holding the modified source files of compiled
+	// packages, keyed by [Key].
+	Store struct {
+		dir string
+	}
+
+	// Key identifies a compilation of a package in the [Store].
+	Key struct {
+		// ImportPath is the import path of the package, as reported by the go
+		// command (e.g, "foo [foo.test]").
+		ImportPath string
+		// Variant is the variant of the package's compilation.
+		Variant Variant
+		// ActionID is the action ID of the compilation, as obtained from its build
+		// ID using [ActionID]. It covers all inputs of the compilation, including
+		// the orchestrion version and configuration.
+		ActionID string
+	}
+
+	// File describes a modified file to be saved in the [Store].
+	File struct {
+		// Original is the path of the original source file.
+		Original string
+		// Modified is the path of the modified file.
+		Modified string
+		// Input is the path of the file the compiler was originally given, if it
+		// is not Original. It is blank otherwise.
+		Input string
+	}
+
+	manifest struct {
+		ImportPath string          `json:"importPath"`
+		Package    string          `json:"package"`
+		Variant    Variant         `json:"variant"`
+		Files      []manifestEntry `json:"files"`
+	}
+	manifestEntry struct {
+		Name     string `json:"name"`
+		Original string `json:"original"`
+		// SHA256 is the digest of the original file at the time it was compiled,
+		// which is used to detect stale entries.
+		SHA256 string `json:"sha256,omitempty"`
+		Input  bool   `json:"input,omitempty"`
+	}
+)
+
+// DefaultDir returns the default directory of the [Store], which is
+// `$GOCACHE/orchestrion/injected`.
+func DefaultDir() (string, error) {
+	goCache, err := goenv.GOCACHE()
+	if err != nil {
+		return "", fmt.Errorf("locating the injected sources directory: %w", err)
+	}
+	return filepath.Join(goCache, "orchestrion", "injected"), nil
+}
+
+// Open returns a [Store] rooted in the provided directory.
+func Open(dir string) Store {
+	return Store{dir: dir}
+}
+
+// ActionID returns the action ID part of the provided build ID, which is the
+// same for the build ID passed to the compiler and the one recorded in the
+// resulting archive.
+func ActionID(buildID string) string {
+	actionID, _, _ := strings.Cut(buildID, "/")
+	return actionID
+}
+
+// Save records the modified files of the package compilation identified by key,
+// with the provided package path (the value of the compiler's -p flag). Entries
+// are never replaced, as compilations with the same key produce the same files.
+func (s Store) Save(key Key, pkg string, files []File) error {
+	if key.ActionID == "" {
+		return errors.New("missing action ID")
+	}
+	entryDir := s.entryDir(key)
+	if s.complete(entryDir) {
+		// Record the access, so that entries in use are not trimmed.
+		now := time.Now()
+		_ = os.Chtimes(filepath.Join(entryDir, manifestFile), now, now)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Join(s.dir, stagingDir), 0o755); err != nil {
+		return fmt.Errorf("creating store directory: %w", err)
+	}
+	staging, err := os.MkdirTemp(filepath.Join(s.dir, stagingDir), "entry-*")
+	if err != nil {
+		return fmt.Errorf("creating staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	man := manifest{ImportPath: key.ImportPath, Package: pkg, Variant: key.Variant, Files: make([]manifestEntry, 0, len(files))}
+	for _, file := range files {
+		entry := manifestEntry{Name: filepath.Base(file.Modified), Original: file.Original}
+		if entry.SHA256, err = digest(file.Original); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("hashing %q: %w", file.Original, err)
+		}
+		dest := filepath.Join(staging, entry.Name)
+		if err := copyFile(file.Modified, dest); err != nil {
+			return err
+		}
+		if err := copyFile(attribution.SidecarPath(file.Modified), attribution.SidecarPath(dest)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if file.Input != "" {
+			if err := copyFile(file.Input, InputPath(dest)); err != nil {
+				return err
+			}
+			entry.Input = true
+		}
+		man.Files = append(man.Files, entry)
+	}
+
+	data, err := json.Marshal(man)
+	if err != nil {
+		return err
+	}
+	// The manifest is written last, so its presence indicates a complete entry.
+	if err := os.WriteFile(filepath.Join(staging, manifestFile), data, 0o644); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(entryDir), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(staging, entryDir); err != nil && !s.complete(entryDir) {
+		// A concurrent compilation of the same package may have won the race, which
+		// is fine as it'd have produced the same files.
+		return fmt.Errorf("moving entry into place: %w", err)
+	}
+
+	return s.trim()
+}
+
+// Restore copies the modified files saved for the package compilation
+// identified by key into `destDir/<package>/`, as they were laid out in the
+// package's build directory. It returns false if there is no such entry, or if
+// any of its original files has changed since it was saved.
+func (s Store) Restore(key Key, destDir string) (bool, error) {
+	entryDir := s.entryDir(key)
+	data, err := os.ReadFile(filepath.Join(entryDir, manifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var man manifest
+	if err := json.Unmarshal(data, &man); err != nil {
+		return false, fmt.Errorf("invalid manifest for %q: %w", key.ImportPath, err)
+	}
+	if man.ImportPath != key.ImportPath || man.Variant != key.Variant {
+		return false, nil
+	}
+
+	for _, entry := range man.Files {
+		if entry.SHA256 == "" {
+			continue
+		}
+		if sum, err := digest(entry.Original); err != nil || sum != entry.SHA256 {
+			return false, nil
+		}
+	}
+
+	pkgDir := filepath.Join(destDir, filepath.FromSlash(man.Package))
+	for _, entry := range man.Files {
+		src, dest := filepath.Join(entryDir, entry.Name), filepath.Join(pkgDir, entry.Name)
+		if err := copyFile(src, dest); err != nil {
+			return false, err
+		}
+		if err := copyFile(attribution.SidecarPath(src), attribution.SidecarPath(dest)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+		if entry.Input {
+			if err := copyFile(InputPath(src), InputPath(dest)); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	// Record the access, so that entries in use are not trimmed.
+	now := time.Now()
+	_ = os.Chtimes(filepath.Join(entryDir, manifestFile), now, now)
+	return true, nil
+}
+
+func (s Store) entryDir(key Key) string {
+	sum := sha256.Sum256([]byte(key.ImportPath + "\x00" + string(key.Variant) + "\x00" + key.ActionID))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(s.dir, name[:2], name)
+}
+
+// complete returns true if entryDir holds a complete entry.
+func (Store) complete(entryDir string) bool {
+	_, err := os.Stat(filepath.Join(entryDir, manifestFile))
+	return err == nil
+}
+
+// trim removes entries that have not been used in a while. It does so at most
+// once per [trimInterval].
+func (s Store) trim() error {
+	marker := filepath.Join(s.dir, trimFile)
+	if stat, err := os.Stat(marker); err == nil && time.Since(stat.ModTime()) < trimInterval {
+		return nil
+	}
+	if err := os.WriteFile(marker, nil, 0o644); err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-trimUnused)
+	shards, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, shard := range shards {
+		if !shard.IsDir() || shard.Name() == stagingDir {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.dir, shard.Name()))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			entryDir := filepath.Join(s.dir, shard.Name(), entry.Name())
+			stat, err := os.Stat(filepath.Join(entryDir, manifestFile))
+			if err == nil && stat.ModTime().After(cutoff) {
+				continue
+			}
+			if err := os.RemoveAll(entryDir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func digest(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func copyFile(src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("copying %q: %w", src, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,76 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package injected
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/injector/attribution"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	srcDir := t.TempDir()
+	original := filepath.Join(srcDir, "foo.go")
+	require.NoError(t, os.WriteFile(original, []byte("package foo\n"), 0o644))
+
+	buildDir := t.TempDir()
+	modified := filepath.Join(buildDir, "foo.go")
+	require.NoError(t, os.WriteFile(modified, []byte("//line "+original+":1:1\npackage foo\n\nimport _ \"strings\"\n"), 0o644))
+	require.NoError(t, attribution.Write(modified, attribution.Manifest{Ranges: []attribution.Range{{StartLine: 4, EndLine: 4, Aspect: "ID"}}}))
+	// The compiler was given the output of the cover tool rather than the original file.
+	require.NoError(t, os.WriteFile(InputPath(modified), []byte("//line "+original+":1:1\npackage foo\n\nvar counters [1]uint32\n"), 0o644))
+
+	store := Open(t.TempDir())
+	key := Key{ImportPath: "example.com/foo [example.com/foo.test]", Variant: VariantCover, ActionID: ActionID("action/content")}
+	files := []File{{Original: original, Modified: modified, Input: InputPath(modified)}}
+	require.NoError(t, store.Save(key, "example.com/foo", files))
+	// Saving the same compilation again (e.g, from a concurrent build) is a no-op.
+	require.NoError(t, store.Save(key, "example.com/foo", files))
+	require.ErrorContains(t, store.Save(Key{ImportPath: key.ImportPath, Variant: key.Variant}, "example.com/foo", files), "missing action ID")
+
+	t.Run("missing", func(t *testing.T) {
+		for name, other := range map[string]Key{
+			"import path": {ImportPath: "example.com/foo", Variant: key.Variant, ActionID: key.ActionID},
+			"variant":     {ImportPath: key.ImportPath, Variant: VariantDefault, ActionID: key.ActionID},
+			"action ID":   {ImportPath: key.ImportPath, Variant: key.Variant, ActionID: "other"},
+		} {
+			found, err := store.Restore(other, t.TempDir())
+			require.NoError(t, err)
+			assert.False(t, found, "the %s is part of the key", name)
+		}
+	})
+
+	t.Run("found", func(t *testing.T) {
+		destDir := t.TempDir()
+		found, err := store.Restore(Key{ImportPath: key.ImportPath, Variant: key.Variant, ActionID: "action"}, destDir)
+		require.NoError(t, err)
+		require.True(t, found)
+
+		restored := filepath.Join(destDir, "example.com", "foo", "foo.go")
+		for _, pair := range [][2]string{
+			{modified, restored},
+			{attribution.SidecarPath(modified), attribution.SidecarPath(restored)},
+			{InputPath(modified), InputPath(restored)},
+		} {
+			expected, err := os.ReadFile(pair[0])
+			require.NoError(t, err)
+			actual, err := os.ReadFile(pair[1])
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(actual))
+		}
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(original, []byte("package foo\n\nfunc Foo() {}\n"), 0o644))
+		found, err := store.Restore(key, t.TempDir())
+		require.NoError(t, err)
+		assert.False(t, found, "entries are not restored once the original file changed")
+	})
+}
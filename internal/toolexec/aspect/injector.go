@@ -0,0 +1,66 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package aspect
+
+import (
+	"context"
+	"fmt"
+	"go/importer"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/DataDog/orchestrion/internal/injector"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/rs/zerolog"
+)
+
+// NewInjector returns an [injector.Injector] for the package at importPath,
+// configured the same way by all commands weaving aspects into packages, along
+// with the aspects that apply to the package once its [BehaviorOverride] is
+// taken into account. It returns a nil injector if the package must never be
+// woven into. Callers are expected to set the remaining fields of the
+// injector, such as [injector.Injector.ImportMap], according to their needs.
+func NewInjector(ctx context.Context, importPath string, lookup importer.Lookup, aspects []*aspect.Aspect) (*injector.Injector, []*aspect.Aspect) {
+	log := zerolog.Ctx(ctx)
+
+	switch behavior, _ := FindBehaviorOverride(importPath); behavior {
+	case NeverWeave:
+		log.Debug().Str("import-path", importPath).Msg("Not weaving aspects to prevent circular instrumentation")
+		return nil, nil
+
+	case WeaveTracerInternal:
+		log.Debug().Str("import-path", importPath).Msg("Enabling tracer-internal mode")
+		aspects = slices.DeleteFunc(slices.Clone(aspects), func(a *aspect.Aspect) bool {
+			return !a.TracerInternal
+		})
+
+	case NoOverride:
+		// No-op
+
+	default:
+		// Unreachable
+		panic(fmt.Sprintf("un-handled behavior override: %d", behavior))
+	}
+
+	return &injector.Injector{
+		RootConfig: map[string]string{"httpmode": "wrap"},
+		ImportPath: importPath,
+		Lookup:     lookup,
+	}, aspects
+}
+
+// ExportLookup returns an [importer.Lookup] that resolves packages using the
+// provided map of import paths to export data files.
+func ExportLookup(exports map[string]string) importer.Lookup {
+	return func(path string) (io.ReadCloser, error) {
+		file, found := exports[path]
+		if !found || file == "" {
+			return nil, fmt.Errorf("no export data for %q", path)
+		}
+		return os.Open(file)
+	}
+}
@@ -8,24 +8,28 @@ package aspect
 import (
 	"context"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/goenv"
 	"github.com/DataDog/orchestrion/internal/injector"
-	"github.com/DataDog/orchestrion/internal/injector/aspect"
 	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/injector/parse"
 	"github.com/DataDog/orchestrion/internal/injector/typed"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/configs"
 	"github.com/DataDog/orchestrion/internal/jobserver/pkgs"
+	"github.com/DataDog/orchestrion/internal/timing"
+	"github.com/DataDog/orchestrion/internal/toolexec/aspect/injected"
 	"github.com/DataDog/orchestrion/internal/toolexec/aspect/linkdeps"
 	"github.com/DataDog/orchestrion/internal/toolexec/importcfg"
 	"github.com/DataDog/orchestrion/internal/toolexec/proxy"
 	"github.com/rs/zerolog"
-	"golang.org/x/tools/go/packages"
 )
 
 // OrchestrionDirPathElement is the prefix for orchestrion source files in the build output directory.
@@ -47,6 +51,9 @@ func (w Weaver) OnCompile(ctx context.Context, cmd *proxy.CompileCommand) (resEr
 	log := zerolog.Ctx(ctx).With().Str("phase", "compile").Str("import-path", w.ImportPath).Logger()
 	ctx = log.WithContext(ctx)
 
+	timings := timing.FromEnvironment()
+	defer func() { cmd.Timings = timings.Profile() }()
+
 	imports, err := importcfg.ParseFile(ctx, cmd.Flags.ImportCfg)
 	if err != nil {
 		return fmt.Errorf("parsing %q: %w", cmd.Flags.ImportCfg, err)
@@ -63,46 +70,43 @@ func (w Weaver) OnCompile(ctx context.Context, cmd *proxy.CompileCommand) (resEr
 	if err != nil {
 		return err
 	}
-	pkgLoader := packageLoader(js)
 
-	cfg, resErr := config.NewLoader(pkgLoader, goModDir, false).Load(ctx)
+	// The configuration is loaded once per build by the job server, which only
+	// serves the aspects that may match this package, so that decoding them is
+	// cheap for the many packages that are not instrumented at all.
+	testMain := cmd.TestMain() && strings.HasSuffix(w.ImportPath, ".test")
+	start := time.Now()
+	cfg, resErr := client.Request(ctx, js, configs.LoadRequest{
+		Dir: goModDir,
+		Package: &configs.Package{
+			ImportPath: w.ImportPath,
+			Imports:    slices.Collect(maps.Keys(imports.PackageFile)),
+			TestMain:   testMain,
+		},
+	})
 	if resErr != nil {
 		return fmt.Errorf("loading injector configuration: %w", resErr)
 	}
-
-	aspects := cfg.Aspects()
-	specialBehavior, isSpecial := FindBehaviorOverride(w.ImportPath)
-	if isSpecial {
-		switch specialBehavior {
-		case NeverWeave:
-			log.Debug().Str("import-path", w.ImportPath).Msg("Not weaving aspects to prevent circular instrumentation")
-			return nil
-
-		case WeaveTracerInternal:
-			log.Debug().Str("import-path", w.ImportPath).Msg("Enabling tracer-internal mode")
-			aspects = slices.DeleteFunc(aspects, func(a *aspect.Aspect) bool {
-				return !a.TracerInternal
-			})
-
-		case NoOverride:
-			// No-op
-
-		default:
-			// Unreachable
-			panic(fmt.Sprintf("un-handled behavior override: %d", specialBehavior))
-		}
+	aspects, resErr := config.DecodeAspects(ctx, cfg.Aspects)
+	if resErr != nil {
+		return fmt.Errorf("decoding injector configuration: %w", resErr)
 	}
+	timings.Since(timing.PhaseConfig, start)
 
-	injector := injector.Injector{
-		RootConfig: map[string]string{"httpmode": "wrap"},
-		Lookup:     imports.Lookup,
-		ImportPath: w.ImportPath,
-		TestMain:   cmd.TestMain() && strings.HasSuffix(w.ImportPath, ".test"),
-		ImportMap:  imports.PackageFile,
-		GoVersion:  cmd.Flags.Lang,
-		ModifiedFile: func(file string) string {
-			return filepath.Join(filepath.Dir(cmd.Flags.Output), OrchestrionDirPathElement, cmd.Flags.Package, filepath.Base(file))
-		},
+	injector, aspects := NewInjector(ctx, w.ImportPath, imports.Lookup, aspects)
+	if injector == nil {
+		return nil
+	}
+	injector.TestMain = testMain
+	injector.ImportMap = imports.PackageFile
+	injector.GoVersion = cmd.Flags.Lang
+	// The manifest is only used by `orchestrion diff` to attribute changes to aspects.
+	injector.AttributionManifest = injected.Enabled()
+	injector.Timings = timings
+	// Honor the concurrency budget cmd/go allocated to this compilation.
+	injector.Concurrency = cmd.Flags.Concurrency
+	injector.ModifiedFile = func(file string) string {
+		return filepath.Join(filepath.Dir(cmd.Flags.Output), OrchestrionDirPathElement, cmd.Flags.Package, filepath.Base(file))
 	}
 
 	goFiles := cmd.GoFiles()
@@ -115,20 +119,37 @@ func (w Weaver) OnCompile(ctx context.Context, cmd *proxy.CompileCommand) (resEr
 		return err
 	}
 
+	// Visit files in a consistent order, so that references (and their aliases) are merged deterministically.
 	references := typed.ReferenceMap{}
-	for gofile, modFile := range results {
+	for _, gofile := range slices.Sorted(maps.Keys(results)) {
+		modFile := results[gofile]
 		log.Debug().Str("original", gofile).Str("updated", modFile.Filename).Msg("Replacing argument for modified source code")
 		if err := cmd.ReplaceParam(gofile, modFile.Filename); err != nil {
 			return fmt.Errorf("replacing %q with %q: %w", gofile, modFile.Filename, err)
 		}
 
 		references.Merge(modFile.References)
+		cmd.ModifiedFiles = append(cmd.ModifiedFiles, gofile)
+		cmd.Aspects = append(cmd.Aspects, modFile.Aspects...)
+	}
+	slices.Sort(cmd.ModifiedFiles)
+	slices.Sort(cmd.Aspects)
+	cmd.Aspects = slices.Compact(cmd.Aspects)
+
+	if len(results) > 0 && injected.Enabled() {
+		// Keeping a copy of the modified files is only useful to `orchestrion diff`, so it must not fail the build.
+		if err := w.saveInjectedSources(cmd, results); err != nil {
+			log.Warn().Err(err).Msg("Failed to save a copy of the modified source files")
+		}
 	}
 
 	if references.Count() == 0 {
 		return nil
 	}
 
+	start = time.Now()
+	defer timings.Since(timing.PhaseResolve, start)
+
 	var regUpdated bool
 	for depImportPath, kind := range references.Map() {
 		if depImportPath == "unsafe" {
@@ -197,6 +218,44 @@ func (w Weaver) OnCompile(ctx context.Context, cmd *proxy.CompileCommand) (resEr
 	return nil
 }
 
+// saveInjectedSources records the modified files in the [injected.Store], keyed
+// by the compilation's action ID, so that `orchestrion diff` can report on them
+// even if a later build of this package is satisfied from the go build cache. When the compiler was given something else
+// than the original source file (such as the output of the cover tool, or the
+// translation of the file by cmd/cgo), a copy of that input is kept next to the
+// modified file, so that the diff is not polluted by changes orchestrion did not
+// make.
+func (w Weaver) saveInjectedSources(cmd *proxy.CompileCommand, results map[string]injector.InjectedFile) error {
+	dir, err := injected.DefaultDir()
+	if err != nil {
+		return err
+	}
+
+	variant := injected.VariantDefault
+	if cmd.Flags.CoverageCfg != "" {
+		variant = injected.VariantCover
+	}
+
+	files := make([]injected.File, 0, len(results))
+	for _, gofile := range slices.Sorted(maps.Keys(results)) {
+		file := injected.File{Original: gofile, Modified: results[gofile].Filename}
+		original, content, err := parse.ReadMappedFile(gofile)
+		if err != nil {
+			return err
+		}
+		if original != "" && filepath.Clean(original) != gofile {
+			file.Original, file.Input = filepath.Clean(original), injected.InputPath(file.Modified)
+			if err := os.WriteFile(file.Input, content, 0o644); err != nil {
+				return err
+			}
+		}
+		files = append(files, file)
+	}
+
+	key := injected.Key{ImportPath: w.ImportPath, Variant: variant, ActionID: injected.ActionID(cmd.Flags.BuildID)}
+	return injected.Open(dir).Save(key, cmd.Flags.Package, files)
+}
+
 func writeUpdatedImportConfig(log zerolog.Logger, reg importcfg.ImportConfig, filename string) (err error) {
 	const dotOriginal = ".original"
 
@@ -212,9 +271,3 @@ func writeUpdatedImportConfig(log zerolog.Logger, reg importcfg.ImportConfig, fi
 
 	return nil
 }
-
-func packageLoader(js *client.Client) config.PackageLoader {
-	return func(ctx context.Context, dir string, patterns ...string) ([]*packages.Package, error) {
-		return client.Request(ctx, js, pkgs.LoadRequest{Dir: dir, Patterns: patterns})
-	}
-}
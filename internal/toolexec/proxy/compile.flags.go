@@ -32,11 +32,11 @@ func (f *compileFlagSet) parse(args []string) ([]string, error) {
 	flagSet.String("bench", "", "append benchmark times to file")
 	flagSet.String("blockprofile", "", "write block profile to file")
 	flagSet.StringVar(&f.BuildID, "buildid", "", "record id as the build id in the export metadata")
-	flagSet.Int("c", 0, "concurrency during compilation (1 means no concurrency)")
+	flagSet.IntVar(&f.Concurrency, "c", 0, "concurrency during compilation (1 means no concurrency)")
 	flagSet.Bool("clobberdead", false, "clobber dead stack slots (for debugging)")
 	flagSet.Bool("clobberdeadreg", false, "clobber dead registers (for debugging)")
 	flagSet.Bool("complete", false, "compiling complete package (no C or assembly)")
-	flagSet.String("coveragecfg", "", "read coverage configuration from file")
+	flagSet.StringVar(&f.CoverageCfg, "coveragecfg", "", "read coverage configuration from file")
 	flagSet.String("cpuprofile", "", "write cpu profile to file")
 	flagSet.String("d", "", "enable debugging settings; try -d help")
 	flagSet.Bool("dwarf", false, "generate DWARF symbols")
@@ -18,6 +18,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
 	"github.com/DataDog/orchestrion/internal/jobserver/nbt"
+	"github.com/DataDog/orchestrion/internal/timing"
 	"github.com/DataDog/orchestrion/internal/toolexec/aspect/linkdeps"
 	"github.com/DataDog/orchestrion/internal/toolexec/importcfg"
 	"github.com/blakesmith/ar"
@@ -29,6 +30,8 @@ import (
 type compileFlagSet struct {
 	Asmhdr      string `ddflag:"-asmhdr"`
 	BuildID     string `ddflag:"-buildid"`
+	Concurrency int    `ddflag:"-c"`
+	CoverageCfg string `ddflag:"-coveragecfg"`
 	ImportCfg   string `ddflag:"-importcfg"`
 	Lang        string `ddflag:"-lang"`
 	Output      string `ddflag:"-o"`
@@ -49,6 +52,17 @@ type CompileCommand struct {
 	// appended to the archive output.
 	LinkDeps linkdeps.LinkDeps
 
+	// Aspects lists the IDs of the aspects that modified the package's source
+	// files. It is reported to the job server once the command completes.
+	Aspects []string
+	// ModifiedFiles lists the package's source files that were modified by
+	// instrumentation. It is reported to the job server once the command
+	// completes.
+	ModifiedFiles []string
+	// Timings is the time spent instrumenting the package, if measured. It is
+	// reported to the job server once the command completes.
+	Timings *timing.Profile
+
 	// importPath is the import path of the package being built.
 	importPath string
 	// testMain records whether the original compiler inputs identify Go's generated test main.
@@ -223,11 +237,14 @@ func (cmd *CompileCommand) notifyJobServer(ctx gocontext.Context, cmdErr error)
 	}
 
 	_, err = client.Request(ctx, jobs, nbt.FinishRequest{
-		ImportPath:  cmd.importPath,
-		BuildID:     cmd.Flags.BuildID,
-		FinishToken: cmd.finishToken,
-		Files:       files,
-		Error:       errorMessage,
+		ImportPath:    cmd.importPath,
+		BuildID:       cmd.Flags.BuildID,
+		FinishToken:   cmd.finishToken,
+		Files:         files,
+		Aspects:       cmd.Aspects,
+		ModifiedFiles: cmd.ModifiedFiles,
+		Timings:       cmd.Timings,
+		Error:         errorMessage,
 	})
 
 	return err
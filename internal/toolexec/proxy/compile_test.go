@@ -54,11 +54,12 @@ func TestParseCompile(t *testing.T) {
 			input:   []string{"/path/compile", "-o", work + "/b019/_pkg_.a", "-trimpath", work + "=>", "-p", "internal/profilerecord", "-lang=go1.23", "-std", "-complete", "-buildid", "58eel3bXIltdLxQE0aV1/58eel3bXIltdLxQE0aV1", "-goversion", "go1.23.4", "-c=4", "-shared", "-nolocalimports", "-importcfg", importCfgFile, "-pack", "/go/src/internal/profilerecord/profilerecord.go"},
 			goFiles: []string{"/go/src/internal/profilerecord/profilerecord.go"},
 			flags: compileFlagSet{
-				Package:   "internal/profilerecord",
-				ImportCfg: importCfgFile,
-				Output:    work + "/b019/_pkg_.a",
-				Lang:      "go1.23",
-				BuildID:   "58eel3bXIltdLxQE0aV1/58eel3bXIltdLxQE0aV1",
+				Package:     "internal/profilerecord",
+				ImportCfg:   importCfgFile,
+				Output:      work + "/b019/_pkg_.a",
+				Lang:        "go1.23",
+				BuildID:     "58eel3bXIltdLxQE0aV1/58eel3bXIltdLxQE0aV1",
+				Concurrency: 4,
 			},
 		},
 		"nats.go": {
@@ -14,6 +14,8 @@ import (
 	"strings"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/goflags/quoted"
 )
 
 type (
@@ -138,7 +140,8 @@ func (cmd *command) ReplaceParam(param string, val string) error {
 // to capture the output of the command instead of forwarding it to the host process' STDIO.
 type RunCommandOption func(*exec.Cmd)
 
-// RunCommand executes the underlying go tool command and forwards the program's standard fluxes
+// RunCommand executes the underlying go tool command and forwards the program's standard fluxes.
+// If an inner toolexec is configured (see [goflags.EnvVarInnerToolexec]), the command is run through it.
 func RunCommand(ctx context.Context, cmd Command, opts ...RunCommandOption) (err error) {
 	span, _ := tracer.StartSpanFromContext(ctx, cmd.Type().String(),
 		tracer.ServiceName("go-tool"),
@@ -146,7 +149,11 @@ func RunCommand(ctx context.Context, cmd Command, opts ...RunCommandOption) (err
 	)
 	defer func() { span.Finish(tracer.WithError(err)) }()
 
-	args := cmd.Args()
+	inner, err := InnerToolexec()
+	if err != nil {
+		return err
+	}
+	args := append(inner, cmd.Args()...)
 	c := exec.Command(args[0], args[1:]...)
 	if c == nil {
 		return errors.New("command couldn't build")
@@ -163,6 +170,20 @@ func RunCommand(ctx context.Context, cmd Command, opts ...RunCommandOption) (err
 	return c.Run()
 }
 
+// InnerToolexec returns the words of the user-supplied `-toolexec` command set
+// in [goflags.EnvVarInnerToolexec], if any.
+func InnerToolexec() ([]string, error) {
+	val := os.Getenv(goflags.EnvVarInnerToolexec)
+	if val == "" {
+		return nil, nil
+	}
+	words, err := quoted.Split(val)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s=%q: %w", goflags.EnvVarInnerToolexec, val, err)
+	}
+	return words, nil
+}
+
 func (*command) Type() CommandType {
 	return CommandTypeOther
 }
@@ -7,9 +7,13 @@ package proxy_test
 
 import (
 	"context"
+	"os/exec"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/toolexec/proxy"
 
 	"github.com/stretchr/testify/require"
@@ -76,3 +80,16 @@ func TestParseCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestRunCommandInnerToolexec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on the echo command")
+	}
+
+	t.Setenv(goflags.EnvVarInnerToolexec, "echo 'inner wrapper'")
+	cmd := proxy.NewCommand([]string{"compile", "-V=full"})
+
+	var stdout strings.Builder
+	require.NoError(t, proxy.RunCommand(context.Background(), &cmd, func(c *exec.Cmd) { c.Stdout = &stdout }))
+	require.Equal(t, "inner wrapper compile -V=full\n", stdout.String())
+}
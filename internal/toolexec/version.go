@@ -7,11 +7,16 @@ package toolexec
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 
+	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/jobserver"
 	"github.com/DataDog/orchestrion/internal/jobserver/buildid"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
@@ -27,36 +32,82 @@ import (
 // - the orchestrion binary is different (instrumentation process may have changed)
 // - the injector configuration is different
 // - injected dependencies versions are different
+// - the inner toolexec command (see [goflags.EnvVarInnerToolexec]) is different
+//
+// When [buildid.EnvVarStrict] is set, it fails if the build uses versions of
+// modules that are not supported by the integrations in use.
 func ComputeVersion(ctx context.Context, cmd proxy.Command) (string, error) {
-	log := zerolog.Ctx(ctx)
-
 	// Get the output of the raw `-V=full` invocation
 	stdout := strings.Builder{}
 	if err := proxy.RunCommand(ctx, cmd, func(cmd *exec.Cmd) { cmd.Stdout = &stdout }); err != nil {
 		return "", err
 	}
 
-	conn, err := client.FromEnvironment(ctx, "")
+	conn, shutdown, err := connect(ctx)
 	if err != nil {
-		if !errors.Is(err, client.ErrNoServerAvailable) {
-			return "", err
-		}
-		log.Debug().Msg("No job server available; starting an in-process temporary server...")
-		server, err := jobserver.New(ctx, &jobserver.Options{NoListener: true})
-		if err != nil {
-			return "", err
-		}
-		defer server.Shutdown()
-		if conn, err = server.Connect(); err != nil {
-			return "", err
-		}
-	}
-
-	res, err := client.Request(ctx, conn, buildid.VersionSuffixRequest{})
+		return "", err
+	}
+	defer shutdown()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	strict, _ := strconv.ParseBool(os.Getenv(buildid.EnvVarStrict))
+	res, err := client.Request(ctx, conn, buildid.VersionSuffixRequest{Strict: strict, Dir: wd})
 	if err != nil {
 		return "", err
 	}
 
 	// Produce the complete version string
-	return fmt.Sprintf("%s:%s", strings.TrimSpace(stdout.String()), res), nil
+	version := fmt.Sprintf("%s:%s", strings.TrimSpace(stdout.String()), res)
+	if inner := os.Getenv(goflags.EnvVarInnerToolexec); inner != "" {
+		// The raw invocation above went through the inner toolexec already, but
+		// it may not alter the version string. The go command only allows spaces
+		// in specific places of the version string, so we use a digest.
+		sum := sha256.Sum256([]byte(inner))
+		version = fmt.Sprintf("%s;toolexec=%s", version, hex.EncodeToString(sum[:8]))
+	}
+	return version, nil
+}
+
+// SupportedVersions returns the support status of the versions of the modules
+// used by the build of the current directory, according to the integrations in
+// use.
+func SupportedVersions(ctx context.Context) (buildid.SupportResponse, error) {
+	conn, shutdown, err := connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer shutdown()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return client.Request(ctx, conn, buildid.SupportRequest{Dir: wd})
+}
+
+// connect returns a client for the job server designated by the environment,
+// or for an in-process temporary server if there is none. The returned
+// function must be called once the client is no longer needed.
+func connect(ctx context.Context) (*client.Client, func(), error) {
+	conn, err := client.FromEnvironment(ctx, "")
+	if err == nil {
+		return conn, func() {}, nil
+	}
+	if !errors.Is(err, client.ErrNoServerAvailable) {
+		return nil, nil, err
+	}
+
+	zerolog.Ctx(ctx).Debug().Msg("No job server available; starting an in-process temporary server...")
+	server, err := jobserver.New(ctx, &jobserver.Options{NoListener: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	if conn, err = server.Connect(); err != nil {
+		server.Shutdown()
+		return nil, nil, err
+	}
+	return conn, server.Shutdown, nil
 }
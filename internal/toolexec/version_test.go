@@ -16,6 +16,7 @@ import (
 
 	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/jobserver/buildid"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
 	"github.com/DataDog/orchestrion/internal/toolexec/proxy"
 	"github.com/otiai10/copy"
@@ -187,6 +188,79 @@ func Test(t *testing.T) {
 	})
 }
 
+func TestSupport(t *testing.T) {
+	t.Setenv(client.EnvVarJobserverURL, "") // Make sure we don't accidentally connect to an external jobserver...
+
+	tmp := t.TempDir()
+	runGo(t, tmp, "mod", "init", "github.com/DataDog/phony/package")
+
+	// A local integration that injects `golang.org/x/mod`, but claims not to
+	// support the version used by orchestrion itself.
+	integration := filepath.Join(tmp, "integration")
+	require.NoError(t, os.Mkdir(integration, 0o755))
+	runGo(t, integration, "mod", "init", "github.com/DataDog/phony/integration")
+	require.NoError(t, os.WriteFile(filepath.Join(integration, config.FilenameOrchestrionToolGo), []byte("//go:build tools\n\npackage integration\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(integration, config.FilenameOrchestrionYML), []byte(`
+meta:
+  name: phony
+  description: A phony integration.
+  supports:
+    golang.org/x/mod: ">=v0.0.1 <v0.0.2"
+    golang.org/x/not-used: ">=v1.0.0"
+aspects: [{join-point: {test-main: true}, advice: [{add-blank-import: golang.org/x/mod/semver}]}]
+`), 0o644))
+
+	modVersion := goListModVersion(t, "golang.org/x/mod")
+	runGo(t, tmp, "mod", "edit",
+		"-replace=github.com/DataDog/orchestrion="+rootDir,
+		"-replace=github.com/DataDog/phony/integration=./integration",
+		"-require=github.com/DataDog/phony/integration@v0.0.0-00010101000000-000000000000",
+		"-require=golang.org/x/mod@"+modVersion,
+	)
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, config.FilenameOrchestrionToolGo), []byte(`
+		//go:build tools
+		package tools
+
+		import (
+			_ "github.com/DataDog/orchestrion"
+			_ "github.com/DataDog/phony/integration"
+			_ "golang.org/x/mod/semver"
+		)
+	`), 0o644))
+	runGo(t, tmp, "mod", "tidy")
+
+	cmd, err := proxy.ParseCommand(context.Background(), "github.com/DataDog/phony/package", []string{"go", "tool", "compile", "-V=full"})
+	require.NoError(t, err)
+
+	ctx := zerolog.New(zerolog.MultiLevelWriter(zerolog.NewTestWriter(t))).
+		Level(zerolog.InfoLevel).
+		WithContext(context.Background())
+	goflags.SetFlags(ctx, tmp, []string{"test", "./..."})
+
+	inDir(t, tmp, func() any {
+		support, err := SupportedVersions(ctx)
+		require.NoError(t, err)
+		require.Equal(t, buildid.SupportResponse{{
+			Integration: "phony",
+			PkgPath:     "github.com/DataDog/phony/integration",
+			Module:      "golang.org/x/mod",
+			Version:     modVersion,
+			Range:       ">=v0.0.1 <v0.0.2",
+			Supported:   false,
+		}}, support)
+
+		// Unsupported versions only produce a warning by default...
+		_, err = ComputeVersion(ctx, cmd)
+		require.NoError(t, err)
+
+		// ... but fail the build in strict mode.
+		t.Setenv(buildid.EnvVarStrict, "true")
+		_, err = ComputeVersion(ctx, cmd)
+		require.ErrorContains(t, err, "phony: golang.org/x/mod@"+modVersion+" is unsupported (expecting >=v0.0.1 <v0.0.2)")
+		return nil
+	})
+}
+
 func inDir[T any](t *testing.T, wd string, cb func() T) T {
 	orig, err := os.Getwd()
 	require.NoError(t, err)
@@ -204,3 +278,13 @@ func runGo(t *testing.T, wd string, args ...string) {
 
 	require.NoError(t, cmd.Run(), "failed to run 'go %s'", strings.Join(args, " "))
 }
+
+// goListModVersion returns the version of the specified module required by
+// orchestrion itself, so that it is available in the module cache.
+func goListModVersion(t *testing.T, path string) string {
+	cmd := exec.Command("go", "list", "-m", "-f", "{{.Version}}", path)
+	cmd.Dir = rootDir
+	out, err := cmd.Output()
+	require.NoError(t, err, "failed to run 'go list -m %s'", path)
+	return strings.TrimSpace(string(out))
+}
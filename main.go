@@ -142,10 +142,17 @@ func main() {
 			cmd.Go,
 			cmd.Pin,
 			cmd.Toolexec,
+			cmd.Compile,
+			cmd.Instrument,
+			cmd.Overlay,
 			cmd.Version,
 			cmd.Server,
 			cmd.Diff,
 			cmd.Lint,
+			cmd.Config,
+			cmd.Explain,
+			cmd.TestAspects,
+			cmd.CacheProg,
 		},
 		Before: func(ctx *cli.Context) error {
 			profiles := ctx.StringSlice("profile")
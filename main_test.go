@@ -177,6 +177,66 @@ func Value() int { return subject.Value() }
 	run.exec(t, buildOrchestrion(t), "go", "test", "-a", "./subject")
 }
 
+func TestStrictFailsOnUnsupportedModuleVersions(t *testing.T) {
+	run := runner{dir: t.TempDir()}
+	writeFile := func(name, contents string) {
+		t.Helper()
+		path := filepath.Join(run.dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	}
+
+	writeFile("go.mod", `module example.com/strict
+
+go 1.25
+
+require github.com/DataDog/orchestrion v0.0.0
+
+replace github.com/DataDog/orchestrion => `+rootDir+"\n")
+	writeFile("orchestrion.tool.go", `//go:build tools
+
+package tools
+
+import (
+	_ "example.com/strict/instrumentation"
+	_ "github.com/DataDog/orchestrion"
+)
+`)
+	writeFile("instrumentation/instrumentation.go", "package instrumentation\n")
+	// The supported range deliberately excludes the version of golang.org/x/mod
+	// required by orchestrion, which no instrumented package depends on.
+	writeFile("instrumentation/orchestrion.yml", `meta:
+  name: Unsupported module version
+  description: Declares a supported range that the build does not satisfy.
+  supports:
+    golang.org/x/mod: ">=v99.0.0"
+aspects:
+  - id: main-function
+    join-point:
+      all-of:
+        - import-path: example.com/strict
+        - function-body:
+            function:
+              - name: main
+    advice:
+      - prepend-statements:
+          template: _ = "instrumented"
+`)
+	writeFile("main.go", "package main\n\nfunc main() {}\n")
+	orchestrionBin := buildOrchestrion(t)
+
+	cmd := exec.Command(orchestrionBin, "go", "build", "--strict", ".")
+	cmd.Dir = run.dir
+	cmd.Env = append(os.Environ(), "GOCACHE="+t.TempDir())
+	output, err := cmd.CombinedOutput()
+	require.Error(t, err, "strict build unexpectedly succeeded:\n%s", output)
+	require.Contains(t, string(output), "golang.org/x/mod@")
+	require.Contains(t, string(output), "is unsupported (expecting >=v99.0.0)")
+
+	// Without --strict, unsupported versions only cause a warning.
+	run.exec(t, orchestrionBin, "go", "build", ".")
+}
+
 func TestBuildFromModuleSubdirectory(t *testing.T) {
 	run := runner{dir: t.TempDir()}
 